@@ -0,0 +1,279 @@
+package proctree
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// syntheticSource simulates a large process tree with a configurable rate of churn, for benchmarks and tests
+// of updates that do not depend on the processes running on the test system.
+type syntheticSource struct {
+	rng     *rand.Rand
+	churn   int
+	nextPid int
+
+	// clock is the start time of the most recently spawned process.
+	clock uint64
+
+	// procs are the live processes, in creation order; procs[0] is the init process.
+	procs []*staticProcess
+
+	// startTimes are the start times of live processes, by pid.
+	startTimes map[int]uint64
+}
+
+// newSyntheticSource creates a syntheticSource with n live processes, of which churn exit and are replaced by
+// new processes at each step.
+func newSyntheticSource(n int, churn int, seed int64) *syntheticSource {
+	ss := &syntheticSource{
+		rng:        rand.New(rand.NewSource(seed)),
+		churn:      churn,
+		nextPid:    1000,
+		startTimes: make(map[int]uint64),
+	}
+	// Use a high init pid, so that synthetic processes are never mistaken for kernel threads
+	ss.spawn(0)
+	for len(ss.procs) < n {
+		ss.spawn(ss.procs[ss.rng.Intn(len(ss.procs))].pid)
+	}
+	return ss
+}
+
+func (ss *syntheticSource) spawn(ppid int) {
+	ss.clock++
+	proc := &staticProcess{pid: ss.nextPid, ppid: ppid, executable: fmt.Sprintf("exe%d", ss.rng.Intn(50))}
+	ss.nextPid++
+	ss.procs = append(ss.procs, proc)
+	ss.startTimes[proc.pid] = ss.clock
+}
+
+// step replaces churn random processes other than init with new processes. The children of exited processes
+// are adopted by init.
+func (ss *syntheticSource) step() {
+	exited := make(map[int]bool, ss.churn)
+	for len(exited) < ss.churn && len(exited) < len(ss.procs)-1 {
+		exited[ss.procs[1+ss.rng.Intn(len(ss.procs)-1)].pid] = true
+	}
+	initPid := ss.procs[0].pid
+	live := ss.procs[:0]
+	for _, proc := range ss.procs {
+		if exited[proc.pid] {
+			delete(ss.startTimes, proc.pid)
+			continue
+		}
+		if exited[proc.ppid] {
+			proc = &staticProcess{pid: proc.pid, ppid: initPid, executable: proc.executable}
+		}
+		live = append(live, proc)
+	}
+	ss.procs = live
+	for i := 0; i < ss.churn; i++ {
+		ss.spawn(ss.procs[ss.rng.Intn(len(ss.procs))].pid)
+	}
+}
+
+// Snapshot implements ProcessSource, listing the current synthetic processes.
+func (ss *syntheticSource) Snapshot() ([]ProcInfo, error) {
+	infos := make([]ProcInfo, len(ss.procs))
+	for i, proc := range ss.procs {
+		infos[i] = ProcInfo{Pid: proc.pid, PPid: proc.ppid, Executable: proc.executable, StartTime: ss.startTimes[proc.pid]}
+	}
+	return infos, nil
+}
+
+func newSyntheticTree(tb testing.TB, n int, churn int, opts ...ConfigOption) (*ProcTree, *syntheticSource) {
+	ss := newSyntheticSource(n, churn, 1)
+	pt, err := New(append(opts, WithProcessSource(ss))...)
+	if err != nil {
+		tb.Fatalf("New() returned error: %s", err)
+	}
+	return pt, ss
+}
+
+func TestSyntheticChurn(t *testing.T) {
+	pt, ss := newSyntheticTree(t, 1000, 50)
+	defer pt.Close()
+
+	sub, err := pt.Subscribe(WithBufferSize(10000))
+	if err != nil {
+		t.Fatalf("Subscribe() returned error: %s", err)
+	}
+	defer sub.Close()
+	for i := 0; i < 10; i++ {
+		ss.step()
+		err = pt.Update(true)
+		if err != nil {
+			t.Fatalf("Update() returned error: %s", err)
+		}
+		counts := pt.Counts()
+		if counts.Total != len(ss.procs) || counts.Included != len(ss.procs) || counts.Roots != 1 {
+			t.Fatalf("Counts() returned %+v after update %d, expected %d processes in one tree", counts, i, len(ss.procs))
+		}
+		if pt.Roots()[0].SubtreeCount() != len(ss.procs) {
+			t.Fatalf("SubtreeCount() of root returned %d, expected %d", pt.Roots()[0].SubtreeCount(), len(ss.procs))
+		}
+	}
+	started, exited := 0, 0
+	for done := false; !done; {
+		select {
+		case ev := <-sub.Events():
+			switch ev.Type {
+			case ProcessStarted:
+				started++
+			case ProcessExited:
+				exited++
+			}
+		default:
+			done = true
+		}
+	}
+	if started != 500 || exited != 500 {
+		t.Errorf("Received %d started and %d exited events, expected 500 of each", started, exited)
+	}
+}
+
+// TestIncrementalIndexes checks that the incrementally maintained process lists remain complete and sorted as
+// processes start, exit and exec, and as the child order is reconfigured.
+func TestIncrementalIndexes(t *testing.T) {
+	orders := []ChildOrder{ByPid, ByStartTime, ByExecutable, ByPid, ByExecutable, ByStartTime}
+	pt, ss := newSyntheticTree(t, 500, 25, WithChildSort(orders[0]))
+	defer pt.Close()
+
+	for i := 0; i < 30; i++ {
+		if i%5 == 0 && i > 0 {
+			err := pt.Reconfigure(WithChildSort(orders[i/5]))
+			if err != nil {
+				t.Fatalf("Reconfigure() returned error: %s", err)
+			}
+		}
+		ss.step()
+		// Some processes exec a different executable
+		for j := 0; j < 10; j++ {
+			k := 1 + ss.rng.Intn(len(ss.procs)-1)
+			proc := ss.procs[k]
+			ss.procs[k] = &staticProcess{pid: proc.pid, ppid: proc.ppid, executable: fmt.Sprintf("exe%d", ss.rng.Intn(50))}
+		}
+		err := pt.Update(true)
+		if err != nil {
+			t.Fatalf("Update() returned error: %s", err)
+		}
+
+		pt.plock()
+		err = pt.lockedCheckIndexes(len(ss.procs))
+		pt.punlock()
+		if err != nil {
+			t.Fatalf("Update %d: %s", i, err)
+		}
+	}
+}
+
+// lockedCheckIndexes checks that the process lists of a ProcTree contain the n Processes in the tree, and that
+// the process list and child lists are sorted.
+func (pt *ProcTree) lockedCheckIndexes(n int) error {
+	if len(pt.absProcs) != n {
+		return fmt.Errorf("Found %d processes, expected %d", len(pt.absProcs), n)
+	}
+	for i, proc := range pt.absProcs {
+		if pt.pidMap[proc.lockedPid()] != proc {
+			return fmt.Errorf("Process %d was left in the index after it exited", proc.lockedPid())
+		}
+		if i > 0 && !lessByPid(pt.absProcs[i-1], proc) {
+			return fmt.Errorf("Processes are out of pid order at index %d", i)
+		}
+	}
+	less := pt.lockedChildLess()
+	for _, proc := range pt.absProcs {
+		children := proc.absChildProcs
+		for i := 1; i < len(children); i++ {
+			if !less(children[i-1], children[i]) {
+				return fmt.Errorf("Children of process %d are out of %s order", proc.lockedPid(), pt.cfg.childOrder)
+			}
+		}
+	}
+	return nil
+}
+
+var benchmarkSizes = []int{1000, 10000, 100000}
+
+func BenchmarkUpdate(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		for _, churnPercent := range []int{0, 1, 10} {
+			b.Run(fmt.Sprintf("procs=%d/churn=%d%%", n, churnPercent), func(b *testing.B) {
+				pt, ss := newSyntheticTree(b, n, n*churnPercent/100)
+				defer pt.Close()
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					ss.step()
+					b.StartTimer()
+					err := pt.Update(true)
+					if err != nil {
+						b.Fatalf("Update() returned error: %s", err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkUpdateChildSort(b *testing.B) {
+	for _, order := range []ChildOrder{ByPid, ByStartTime, ByExecutable} {
+		b.Run(order.String(), func(b *testing.B) {
+			pt, ss := newSyntheticTree(b, 10000, 100, WithChildSort(order))
+			defer pt.Close()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				ss.step()
+				b.StartTimer()
+				err := pt.Update(true)
+				if err != nil {
+					b.Fatalf("Update() returned error: %s", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkWalk(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		b.Run(fmt.Sprintf("procs=%d", n), func(b *testing.B) {
+			pt, _ := newSyntheticTree(b, n, 0)
+			defer pt.Close()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				count := 0
+				err := pt.Walk(func(proc *Process) error {
+					count++
+					return nil
+				})
+				if err != nil || count != n {
+					b.Fatalf("Walk() visited %d processes, returned %v", count, err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSortProcessesByPid(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		b.Run(fmt.Sprintf("procs=%d", n), func(b *testing.B) {
+			pt, _ := newSyntheticTree(b, n, 0)
+			defer pt.Close()
+			procs := pt.Processes()
+			rng := rand.New(rand.NewSource(1))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				rng.Shuffle(len(procs), func(i, j int) { procs[i], procs[j] = procs[j], procs[i] })
+				b.StartTimer()
+				pt.SortProcessesByPid(procs)
+			}
+		})
+	}
+}
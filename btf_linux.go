@@ -0,0 +1,192 @@
+package proctree
+
+import (
+	"fmt"
+	"os"
+)
+
+// vmlinuxBTFPath is the location of the kernel's own BTF type information.
+const vmlinuxBTFPath = "/sys/kernel/btf/vmlinux"
+
+// BTF type kinds, from linux/btf.h
+const (
+	btfKindInt       = 1
+	btfKindPtr       = 2
+	btfKindArray     = 3
+	btfKindStruct    = 4
+	btfKindUnion     = 5
+	btfKindEnum      = 6
+	btfKindFwd       = 7
+	btfKindTypedef   = 8
+	btfKindVolatile  = 9
+	btfKindConst     = 10
+	btfKindRestrict  = 11
+	btfKindFunc      = 12
+	btfKindFuncProto = 13
+	btfKindVar       = 14
+	btfKindDatasec   = 15
+	btfKindFloat     = 16
+	btfKindDeclTag   = 17
+	btfKindTypeTag   = 18
+	btfKindEnum64    = 19
+
+	btfMagic      = 0xeb9f
+	btfTypeLen    = 12
+	btfMemberLen  = 12
+	btfHeaderSize = 24
+)
+
+// btfMember is a member of a BTF struct or union.
+type btfMember struct {
+	name      string
+	typeID    uint32
+	bitOffset uint32
+}
+
+// btfType is a parsed BTF type. Only the information needed to locate struct members is retained.
+type btfType struct {
+	kind    int
+	name    string
+	typeID  uint32
+	members []btfMember
+}
+
+// btfSpec is the parsed type information of a kernel, used to find structure member offsets so that
+// eBPF programs can read kernel structures without compiled-in layouts.
+type btfSpec struct {
+	// types is indexed by BTF type ID. Type ID 0 is void.
+	types []btfType
+}
+
+// loadKernelBTF parses the running kernel's BTF type information.
+func loadKernelBTF() (*btfSpec, error) {
+	data, err := os.ReadFile(vmlinuxBTFPath)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read kernel BTF: %s", err)
+	}
+	return parseBTF(data)
+}
+
+func parseBTF(data []byte) (*btfSpec, error) {
+	if len(data) < btfHeaderSize || nativeEndian.Uint16(data[0:]) != btfMagic {
+		return nil, fmt.Errorf("Invalid BTF header")
+	}
+	bo := nativeEndian
+	hdrLen := bo.Uint32(data[4:])
+	typeOff := hdrLen + bo.Uint32(data[8:])
+	typeLen := bo.Uint32(data[12:])
+	strOff := hdrLen + bo.Uint32(data[16:])
+	strLen := bo.Uint32(data[20:])
+	if uint64(typeOff)+uint64(typeLen) > uint64(len(data)) || uint64(strOff)+uint64(strLen) > uint64(len(data)) {
+		return nil, fmt.Errorf("Truncated BTF data")
+	}
+	typeData := data[typeOff : typeOff+typeLen]
+	strData := data[strOff : strOff+strLen]
+
+	str := func(off uint32) string {
+		if off >= uint32(len(strData)) {
+			return ""
+		}
+		end := off
+		for end < uint32(len(strData)) && strData[end] != 0 {
+			end++
+		}
+		return string(strData[off:end])
+	}
+
+	spec := &btfSpec{types: []btfType{{}}}
+	for pos := 0; pos+btfTypeLen <= len(typeData); {
+		nameOff := bo.Uint32(typeData[pos:])
+		info := bo.Uint32(typeData[pos+4:])
+		sizeOrType := bo.Uint32(typeData[pos+8:])
+		pos += btfTypeLen
+		kind := int((info >> 24) & 0x1f)
+		vlen := int(info & 0xffff)
+		kindFlag := info>>31 != 0
+
+		t := btfType{kind: kind, name: str(nameOff), typeID: sizeOrType}
+		extra := 0
+		switch kind {
+		case btfKindInt, btfKindVar, btfKindDeclTag:
+			extra = 4
+		case btfKindArray:
+			extra = 12
+		case btfKindStruct, btfKindUnion:
+			extra = vlen * btfMemberLen
+			if pos+extra > len(typeData) {
+				return nil, fmt.Errorf("Truncated BTF struct")
+			}
+			t.members = make([]btfMember, vlen)
+			for i := range t.members {
+				m := typeData[pos+i*btfMemberLen:]
+				offset := bo.Uint32(m[8:])
+				if kindFlag {
+					offset &= 0xffffff
+				}
+				t.members[i] = btfMember{name: str(bo.Uint32(m[0:])), typeID: bo.Uint32(m[4:]), bitOffset: offset}
+			}
+		case btfKindEnum, btfKindFuncProto:
+			extra = vlen * 8
+		case btfKindDatasec, btfKindEnum64:
+			extra = vlen * 12
+		case btfKindPtr, btfKindFwd, btfKindTypedef, btfKindVolatile, btfKindConst, btfKindRestrict,
+			btfKindFunc, btfKindFloat, btfKindTypeTag:
+		default:
+			return nil, fmt.Errorf("Unknown BTF kind %d", kind)
+		}
+		pos += extra
+		spec.types = append(spec.types, t)
+	}
+	return spec, nil
+}
+
+// resolve follows typedefs and type modifiers to the underlying type.
+func (spec *btfSpec) resolve(id uint32) *btfType {
+	for i := 0; i < len(spec.types) && id < uint32(len(spec.types)); i++ {
+		t := &spec.types[id]
+		switch t.kind {
+		case btfKindTypedef, btfKindVolatile, btfKindConst, btfKindRestrict, btfKindTypeTag:
+			id = t.typeID
+		default:
+			return t
+		}
+	}
+	return nil
+}
+
+// memberOffset returns the byte offset of a named member of a struct, searching anonymous nested structs
+// and unions.
+func (spec *btfSpec) memberOffset(structName string, memberName string) (uint32, error) {
+	for i := range spec.types {
+		t := &spec.types[i]
+		if t.kind == btfKindStruct && t.name == structName && len(t.members) > 0 {
+			bitOffset, ok := spec.findMember(t, memberName)
+			if !ok {
+				return 0, fmt.Errorf("Kernel struct %s has no member %s", structName, memberName)
+			}
+			if bitOffset%8 != 0 {
+				return 0, fmt.Errorf("Kernel struct member %s.%s is a bitfield", structName, memberName)
+			}
+			return bitOffset / 8, nil
+		}
+	}
+	return 0, fmt.Errorf("Kernel struct %s not found in BTF", structName)
+}
+
+func (spec *btfSpec) findMember(t *btfType, memberName string) (uint32, bool) {
+	for _, m := range t.members {
+		if m.name == memberName {
+			return m.bitOffset, true
+		}
+		if m.name == "" {
+			inner := spec.resolve(m.typeID)
+			if inner != nil && (inner.kind == btfKindStruct || inner.kind == btfKindUnion) {
+				bitOffset, ok := spec.findMember(inner, memberName)
+				if ok {
+					return m.bitOffset + bitOffset, true
+				}
+			}
+		}
+	}
+	return 0, false
+}
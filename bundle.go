@@ -0,0 +1,193 @@
+package proctree
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"time"
+)
+
+// debugBundleFiles are the /proc/<pid> entries archived for each Process by CollectDebugBundle.
+var debugBundleFiles = []string{"stat", "status", "cmdline", "cgroup"}
+
+// debugBundleFileFields are the metadata fields exposed by /proc/<pid> entries, which are only archived if the
+// field is enabled (see WithMetadata).
+var debugBundleFileFields = map[string]MetadataField{
+	"cmdline": MetadataCmdline,
+	"cgroup":  MetadataCgroup,
+}
+
+// maxDebugBundleEntrySize is the largest entry accepted by LoadDebugBundle. It is well above the size of any
+// /proc entry that is archived, and guards against exhausting memory on a crafted bundle.
+const maxDebugBundleEntrySize = 4 << 20
+
+// CollectDebugBundle writes a gzip-compressed tar archive to the file at path, containing the /proc/<pid>/stat,
+// status, cmdline and cgroup entries of every live included Process, as proc/<pid>/<name>. The bundle can be
+// attached to a support case, and loaded with LoadDebugBundle to examine the tree offline. Entries that cannot
+// be read, e.g., because the process has exited since the last update, are omitted, as are the cmdline and
+// cgroup entries if MetadataCmdline or MetadataCgroup is not enabled (see WithMetadata). Only supported on Linux.
+func (pt *ProcTree) CollectDebugBundle(path string) error {
+	pids := []int{}
+	pt.prlock()
+	names := []string{}
+	for _, name := range debugBundleFiles {
+		field, ok := debugBundleFileFields[name]
+		if !ok || pt.cfg.MetadataEnabled(field) {
+			names = append(names, name)
+		}
+	}
+	for _, proc := range pt.includedProcs {
+		if !proc.isTombstone {
+			pids = append(pids, proc.lockedPid())
+		}
+	}
+	readOnly := pt.readOnly
+	pt.prunlock()
+	if readOnly {
+		return fmt.Errorf("Unable to collect a debug bundle from a ProcTree that is not updated from the system")
+	}
+	_, err := defaultProcfs.readProcfsFile(os.Getpid(), "stat")
+	if err != nil {
+		return fmt.Errorf("Unable to collect debug bundle: %s", err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("Unable to create debug bundle: %s", err)
+	}
+	err = writeDebugBundle(f, pt.procfs, pids, names)
+	cerr := f.Close()
+	if err == nil && cerr != nil {
+		err = fmt.Errorf("Unable to write debug bundle: %s", cerr)
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+func writeDebugBundle(w io.Writer, fs procfs, pids []int, names []string) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	now := time.Now()
+	for _, pid := range pids {
+		for _, name := range names {
+			data, err := fs.readProcfsFile(pid, name)
+			if err != nil {
+				continue
+			}
+			hdr := &tar.Header{
+				Name:    fmt.Sprintf("proc/%d/%s", pid, name),
+				Mode:    0444,
+				Size:    int64(len(data)),
+				ModTime: now,
+			}
+			err = tw.WriteHeader(hdr)
+			if err == nil {
+				_, err = tw.Write(data)
+			}
+			if err != nil {
+				return fmt.Errorf("Unable to write debug bundle: %s", err)
+			}
+		}
+	}
+	err := tw.Close()
+	if err == nil {
+		err = gw.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to write debug bundle: %s", err)
+	}
+	return nil
+}
+
+// LoadDebugBundle creates a read-only ProcTree (see LoadJSON) from a debug bundle written by
+// CollectDebugBundle. The pid, parent pid and executable name of each Process are read from its stat entry,
+// and its command line and user id from its cmdline and status entries. Processes whose parent is not in the
+// bundle are roots. Processes without a stat entry are ignored.
+func LoadDebugBundle(path string) (*ProcTree, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open debug bundle: %s", err)
+	}
+	defer f.Close()
+	files, err := readDebugBundle(f)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read debug bundle: %s", err)
+	}
+
+	pt := newReadOnlyProcTree()
+	pt.plock()
+	defer pt.punlock()
+	for pid, entries := range files {
+		stat, ok := entries["stat"]
+		if !ok {
+			continue
+		}
+		executable, fields, err := parseStat(stat)
+		if err != nil || len(fields) < 2 {
+			return nil, fmt.Errorf("Malformed stat entry for pid %d in debug bundle", pid)
+		}
+		ppid, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("Malformed stat entry for pid %d in debug bundle", pid)
+		}
+		proc := newProcess(pt, &staticProcess{pid: pid, ppid: ppid, executable: executable})
+		proc.cmdline = parseCmdline(entries["cmdline"])
+		status, ok := entries["status"]
+		if ok {
+			uid, err := parseStatusUID(status)
+			if err == nil {
+				proc.uid = uid
+			}
+		}
+		pt.pidMap[pid] = proc
+	}
+	for _, proc := range pt.pidMap {
+		proc.parentProc = pt.pidMap[proc.gopsProcess.PPid()]
+		proc.origParentProc = proc.parentProc
+	}
+	pt.lockedRebuildReadOnly()
+	return pt, nil
+}
+
+// readDebugBundle returns the contents of the entries in a debug bundle, by pid and entry name. Unrecognized
+// entries are ignored.
+func readDebugBundle(r io.Reader) (map[int]map[string]string, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gr)
+	files := make(map[int]map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		dir, name := path.Split(hdr.Name)
+		pid, err := strconv.Atoi(path.Base(dir))
+		if err != nil || path.Dir(path.Clean(dir)) != "proc" {
+			continue
+		}
+		if hdr.Size > maxDebugBundleEntrySize {
+			return nil, fmt.Errorf("Entry %s has size %d, which exceeds the maximum of %d", hdr.Name, hdr.Size,
+				maxDebugBundleEntrySize)
+		}
+		data, err := io.ReadAll(io.LimitReader(tr, maxDebugBundleEntrySize))
+		if err != nil {
+			return nil, err
+		}
+		if files[pid] == nil {
+			files[pid] = make(map[string]string)
+		}
+		files[pid][name] = string(data)
+	}
+}
@@ -0,0 +1,70 @@
+package proctree
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDebugBundle(t *testing.T) {
+	pt, err := New(WithRootPid(os.Getpid()))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	path := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	err = pt.CollectDebugBundle(path)
+	if err != nil {
+		t.Fatalf("pt.CollectDebugBundle() returned error: %s", err)
+	}
+
+	loaded, err := LoadDebugBundle(path)
+	if err != nil {
+		t.Fatalf("LoadDebugBundle() returned error: %s", err)
+	}
+	defer loaded.Close()
+	proc := loaded.PidProcess(os.Getpid())
+	if proc == nil {
+		t.Fatalf("Current process not found in loaded bundle")
+	}
+	if proc.Parent() != nil || proc.Executable() != pt.PidProcess(os.Getpid()).Executable() {
+		t.Errorf("Current process does not have the expected parent and executable in loaded bundle")
+	}
+	if len(proc.Cmdline()) != len(os.Args) || proc.Cmdline()[0] != os.Args[0] {
+		t.Errorf("Loaded command line %q does not match %q", proc.Cmdline(), os.Args)
+	}
+	for _, p := range loaded.Processes() {
+		if pt.PidProcess(p.Pid()) == nil {
+			t.Errorf("Loaded bundle contains unexpected pid %d", p.Pid())
+		}
+	}
+}
+
+func TestDebugBundleOversizedEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("os.Create() returned error: %s", err)
+	}
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	// Only the header of the entry is written, since its size is checked before it is read
+	err = tw.WriteHeader(&tar.Header{Name: "proc/1/stat", Mode: 0444, Size: 1 << 40})
+	if err != nil {
+		t.Fatalf("tw.WriteHeader() returned error: %s", err)
+	}
+	tw.Flush()
+	gw.Close()
+	f.Close()
+
+	_, err = LoadDebugBundle(path)
+	if err == nil {
+		t.Errorf("LoadDebugBundle() did not return error for an oversized entry")
+	} else if !strings.Contains(err.Error(), "exceeds the maximum") {
+		t.Errorf("LoadDebugBundle() returned unexpected error for an oversized entry: %s", err)
+	}
+}
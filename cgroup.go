@@ -0,0 +1,154 @@
+package proctree
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+)
+
+// CgroupNode is a cgroup in a CgroupTree, with the Processes that it contains.
+type CgroupNode struct {
+	// Path is the path of the cgroup, e.g., "/system.slice/sshd.service". The path of the root cgroup is "/".
+	Path string
+
+	// Name is the last element of the path, or "/" for the root cgroup.
+	Name string
+
+	// Parent is the parent cgroup, or nil for the root cgroup.
+	Parent *CgroupNode
+
+	// Children are the child cgroups that contain Processes, directly or in their descendants, sorted by name.
+	Children []*CgroupNode
+
+	// Processes are the Processes that are directly in the cgroup, sorted by pid.
+	Processes []*Process
+}
+
+// lookupCgroupNode returns the node for a cgroup path, creating it and any missing ancestors.
+func lookupCgroupNode(nodes map[string]*CgroupNode, cgroup string) *CgroupNode {
+	cgroup = path.Clean("/" + cgroup)
+	node := nodes[cgroup]
+	if node == nil {
+		parent := lookupCgroupNode(nodes, path.Dir(cgroup))
+		node = &CgroupNode{
+			Path:      cgroup,
+			Name:      path.Base(cgroup),
+			Parent:    parent,
+			Children:  []*CgroupNode{},
+			Processes: []*Process{},
+		}
+		parent.Children = append(parent.Children, node)
+		nodes[cgroup] = node
+	}
+	return node
+}
+
+// Walk walks the cgroup and its descendants in depth-first order, parents before their children, invoking a
+// handler for each. If the handler returns an error, the walk is stopped and the error is returned.
+func (n *CgroupNode) Walk(h func(node *CgroupNode) error) error {
+	err := h(n)
+	if err != nil {
+		return err
+	}
+	for _, child := range n.Children {
+		err = child.Walk(h)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CgroupTree returns the root of a view of the live included Processes arranged by the cgroup hierarchy, rather
+// than by parent pid. Parent pids do not reflect ownership after a process double-forks to detach from its
+// parent, but cgroups usually do, e.g., each systemd service and container has its own cgroup. The view is a
+// snapshot of the Processes in the tree, which are the same Process objects as in the tree, and only includes
+// the cgroups that contain them. Processes are placed by their path in the unified (cgroup v2) hierarchy, or in
+// the first listed hierarchy on systems with only cgroup v1 (see Process.Cgroup). Processes whose cgroup cannot
+// be read, e.g., because they have exited since the last update, are omitted. Cgroups are read from the system
+// without holding the tree lock; configure WithMetadataPrefetch(MetadataCgroup) to read them during updates
+// instead. Returns an error on platforms other than Linux, or for a ProcTree that is not updated from the
+// system.
+func (pt *ProcTree) CgroupTree() (*CgroupNode, error) {
+	procs := []*Process{}
+	pt.prlock()
+	readOnly := pt.readOnly
+	metadataErr := pt.cfg.checkMetadata(MetadataCgroup)
+	for _, proc := range pt.includedProcs {
+		if !proc.isTombstone {
+			procs = append(procs, proc)
+		}
+	}
+	pt.prunlock()
+	if readOnly {
+		return nil, fmt.Errorf("Unable to arrange processes by cgroup in a ProcTree that is not updated from the system")
+	}
+	if metadataErr != nil {
+		return nil, fmt.Errorf("Unable to arrange processes by cgroup: %w", metadataErr)
+	}
+	_, err := defaultProcfs.processCgroup(os.Getpid())
+	if err != nil {
+		return nil, fmt.Errorf("Unable to arrange processes by cgroup: %s", err)
+	}
+
+	root := &CgroupNode{Path: "/", Name: "/", Children: []*CgroupNode{}, Processes: []*Process{}}
+	nodes := map[string]*CgroupNode{"/": root}
+	// The included Processes are sorted by pid, so each node's Processes are too
+	for _, proc := range procs {
+		cgroup, err := proc.Cgroup()
+		if err != nil {
+			continue
+		}
+		node := lookupCgroupNode(nodes, cgroup)
+		node.Processes = append(node.Processes, proc)
+	}
+	root.Walk(func(node *CgroupNode) error {
+		sort.Slice(node.Children, func(i, j int) bool {
+			return node.Children[i].Name < node.Children[j].Name
+		})
+		return nil
+	})
+	return root, nil
+}
+
+// lockedCgroupRenderLines appends the lines for a cgroup, its Processes and its descendants.
+func (n *CgroupNode) lockedCgroupRenderLines(lines []renderLine, rc *renderConfig, indent string) []renderLine {
+	next := renderPrefixes(rc, indent, len(n.Processes)+len(n.Children))
+	for _, proc := range n.Processes {
+		prefix, _ := next()
+		lines = append(lines, proc.lockedRenderLine(rc, prefix))
+	}
+	for _, child := range n.Children {
+		prefix, childIndent := next()
+		lines = append(lines, renderLine{prefix: prefix, heading: child.Name + "/"})
+		lines = child.lockedCgroupRenderLines(lines, rc, childIndent)
+	}
+	return lines
+}
+
+// RenderCgroups writes a CgroupTree to w as indented text with line art, beneath a root line of "/". Each cgroup
+// is listed, with a trailing "/", followed by the Processes that it contains and then its child cgroups, e.g.:
+//
+//	/
+//	├── init.scope/
+//	│   └── [1]  systemd
+//	└── system.slice/
+//	    └── sshd.service/
+//	        └── [812]  sshd
+//
+// Options select the label fields of Processes and the line art, as with Render.
+func (pt *ProcTree) RenderCgroups(w io.Writer, opts ...RenderOption) error {
+	rc := newRenderConfig(opts...)
+	root, err := pt.CgroupTree()
+	if err != nil {
+		return err
+	}
+
+	pt.plock()
+	lines := root.lockedCgroupRenderLines([]renderLine{}, rc, "")
+	pt.punlock()
+
+	return writeRenderLines(w, rc, "/", lines)
+}
@@ -0,0 +1,80 @@
+package proctree
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestCgroupTree(t *testing.T) {
+	dir := t.TempDir()
+	writeFakeProcess(t, dir, 1, 0, "systemd", 1)
+	writeFakeProcess(t, dir, 10, 1, "sshd", 100)
+	writeFakeProcess(t, dir, 11, 10, "bash", 200)
+	writeFakeProcess(t, dir, 12, 1, "daemon", 300)
+	writeFakeProcess(t, dir, 13, 1, "cron", 400)
+	// The daemon double-forked, so its parent is init, but it remains in the cgroup of the session
+	cgroups := map[int]string{
+		1:  "/init.scope",
+		10: "/system.slice/sshd.service",
+		11: "/user.slice/user-1000.slice/session-1.scope",
+		12: "/user.slice/user-1000.slice/session-1.scope",
+		13: "/system.slice/cron.service",
+	}
+	for pid, cgroup := range cgroups {
+		err := os.WriteFile(filepath.Join(dir, strconv.Itoa(pid), "cgroup"), []byte("0::"+cgroup+"\n"), 0644)
+		if err != nil {
+			t.Fatalf("os.WriteFile() returned error: %s", err)
+		}
+	}
+
+	pt, err := New(WithProcfsPath(dir), WithMetadataPrefetch(MetadataCgroup))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	root, err := pt.CgroupTree()
+	if err != nil {
+		t.Fatalf("pt.CgroupTree() returned error: %s", err)
+	}
+	paths := []string{}
+	root.Walk(func(node *CgroupNode) error {
+		paths = append(paths, node.Path+pidList(node.Processes))
+		return nil
+	})
+	expected := "[/[] /init.scope[1] /system.slice[] /system.slice/cron.service[13] /system.slice/sshd.service[10] " +
+		"/user.slice[] /user.slice/user-1000.slice[] /user.slice/user-1000.slice/session-1.scope[11 12]]"
+	if fmt.Sprint(paths) != expected {
+		t.Errorf("pt.CgroupTree() returned %v, expected %s", paths, expected)
+	}
+	session := root.Children[2].Children[0].Children[0]
+	if session.Processes[1] != pt.PidProcess(12) || session.Parent.Name != "user-1000.slice" {
+		t.Errorf("pt.CgroupTree() did not return the Processes of the tree")
+	}
+
+	var buf bytes.Buffer
+	err = pt.RenderCgroups(&buf, WithASCIILineArt())
+	if err != nil {
+		t.Fatalf("pt.RenderCgroups() returned error: %s", err)
+	}
+	expectedRender := "/\n" +
+		"|-- init.scope/\n" +
+		"|   `-- [1]  systemd\n" +
+		"|-- system.slice/\n" +
+		"|   |-- cron.service/\n" +
+		"|   |   `-- [13]  cron\n" +
+		"|   `-- sshd.service/\n" +
+		"|       `-- [10]  sshd\n" +
+		"`-- user.slice/\n" +
+		"    `-- user-1000.slice/\n" +
+		"        `-- session-1.scope/\n" +
+		"            |-- [11]  bash\n" +
+		"            `-- [12]  daemon\n"
+	if buf.String() != expectedRender {
+		t.Errorf("pt.RenderCgroups() wrote:\n%s\nexpected:\n%s", buf.String(), expectedRender)
+	}
+}
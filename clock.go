@@ -0,0 +1,27 @@
+package proctree
+
+import (
+	"time"
+)
+
+// Clock is the source of the current time for a ProcTree (see WithClock). It timestamps updates, and with them
+// the times at which Processes were first and last seen, the events generated by updates, the records of a
+// Recorder and the samples of a UsageSampler, and it determines the age of cached metadata and of tombstones.
+// Waits, e.g., for the grace period of Process.Terminate or between auto-updates, use the system's clock
+// regardless. A Clock must be safe for concurrent use.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+}
+
+// systemClock is the Clock that reads the system's clock.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock returns the Clock that reads the system's clock. This is the default clock.
+func SystemClock() Clock {
+	return systemClock{}
+}
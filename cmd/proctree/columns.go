@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sammck-go/proctree"
+)
+
+// columnFields maps the names accepted by --columns to the label fields that render them.
+var columnFields = map[string]proctree.LabelField{
+	"ppid":    proctree.LabelPPid,
+	"user":    proctree.LabelUser,
+	"cpu":     proctree.LabelCPUTime,
+	"mem":     proctree.LabelRSS,
+	"cmdline": proctree.LabelCmdline,
+	"start":   proctree.LabelStartTime,
+	"exit":    proctree.LabelExitStatus,
+}
+
+// columnNames returns the names accepted by --columns, sorted.
+func columnNames() []string {
+	names := make([]string, 0, len(columnFields))
+	for name := range columnFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseColumns returns the label fields of the pid and executable name, followed by the fields of the named
+// columns.
+func parseColumns(names []string) ([]proctree.LabelField, error) {
+	fields := []proctree.LabelField{proctree.LabelPid, proctree.LabelExecutable}
+	for _, name := range names {
+		field, ok := columnFields[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("Unknown column %q; valid columns are %s", name, strings.Join(columnNames(), ", "))
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// jsonProcess is the JSON form of a process and its subtree printed by --json when columns are selected. Columns
+// that were not selected, or whose values are not known, are omitted.
+type jsonProcess struct {
+	Pid        int             `json:"pid"`
+	PPid       *int            `json:"ppid,omitempty"`
+	Executable string          `json:"executable"`
+	User       string          `json:"user,omitempty"`
+	CPUSeconds *float64        `json:"cpuSeconds,omitempty"`
+	RSSBytes   *uint64         `json:"rssBytes,omitempty"`
+	Cmdline    []string        `json:"cmdline,omitempty"`
+	StartTime  *time.Time      `json:"startTime,omitempty"`
+	Tombstone  bool            `json:"tombstone,omitempty"`
+	ExitStatus *jsonExitStatus `json:"exitStatus,omitempty"`
+	Children   []*jsonProcess  `json:"children,omitempty"`
+}
+
+// jsonExitStatus is the JSON form of the exit status of a process.
+type jsonExitStatus struct {
+	Code       int  `json:"code"`
+	Signal     int  `json:"signal,omitempty"`
+	CoreDumped bool `json:"coreDumped,omitempty"`
+}
+
+// jsonTree is the JSON form of the tree printed by --json when columns are selected.
+type jsonTree struct {
+	Roots []*jsonProcess `json:"roots"`
+}
+
+// newJSONTree returns the JSON form of the included tree, with the selected columns.
+func newJSONTree(pt *proctree.ProcTree, fields []proctree.LabelField) *jsonTree {
+	records := make(map[int]proctree.Record)
+	for _, rec := range pt.Records() {
+		records[rec.Pid] = rec
+	}
+	roots := pt.Roots()
+	tree := &jsonTree{Roots: make([]*jsonProcess, 0, len(roots))}
+	for _, root := range roots {
+		tree.Roots = append(tree.Roots, newJSONProcess(root, fields, records))
+	}
+	return tree
+}
+
+// newJSONProcess returns the JSON form of a process and its subtree, with the selected columns.
+func newJSONProcess(proc *proctree.Process, fields []proctree.LabelField, records map[int]proctree.Record) *jsonProcess {
+	rec := records[proc.Pid()]
+	jp := &jsonProcess{Pid: rec.Pid, Executable: rec.Executable, Tombstone: rec.Tombstone}
+	for _, field := range fields {
+		switch field {
+		case proctree.LabelPPid:
+			ppid := rec.PPid
+			jp.PPid = &ppid
+		case proctree.LabelUser:
+			jp.User = rec.User
+		case proctree.LabelCPUTime:
+			if !rec.Tombstone {
+				seconds := rec.CPUTime.Seconds()
+				jp.CPUSeconds = &seconds
+			}
+		case proctree.LabelRSS:
+			if !rec.Tombstone {
+				rss := rec.RSS
+				jp.RSSBytes = &rss
+			}
+		case proctree.LabelCmdline:
+			jp.Cmdline = proc.Cmdline()
+			if jp.Cmdline == nil && !rec.Tombstone {
+				jp.Cmdline, _ = proc.SystemCmdline()
+			}
+		case proctree.LabelStartTime:
+			start, err := proc.StartTime()
+			if err == nil {
+				jp.StartTime = &start
+			}
+		case proctree.LabelExitStatus:
+			if es := proc.ExitStatus(); es != nil {
+				jp.ExitStatus = &jsonExitStatus{Code: es.Code, Signal: int(es.Signal), CoreDumped: es.CoreDumped}
+			}
+		}
+	}
+	for _, child := range proc.Children() {
+		jp.Children = append(jp.Children, newJSONProcess(child, fields, records))
+	}
+	return jp
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sammck-go/proctree"
+	flag "github.com/spf13/pflag"
+)
+
+// captureFlags, if not nil, is called by parseFlags with the flag set of a command instead of parsing its
+// arguments, so that the completion subcommand can list the flags of every command without running them.
+var captureFlags func(fs *flag.FlagSet)
+
+// errFlagsCaptured is returned by parseFlags when the flag set was captured rather than parsed.
+var errFlagsCaptured = errors.New("Flags captured")
+
+// parseFlags parses the arguments of a command, unless its flags are being captured for completion.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if captureFlags != nil {
+		captureFlags(fs)
+		return errFlagsCaptured
+	}
+	return fs.Parse(args)
+}
+
+// dynamicFlags are the flags whose values are completed from running processes, with the arguments to the
+// completion subcommand that list the candidates.
+var dynamicFlags = map[string]string{
+	"root-name": "executables",
+}
+
+// completionFlag describes a flag for completion.
+type completionFlag struct {
+	name        string
+	shorthand   string
+	description string
+	takesValue  bool
+	dynamic     string
+}
+
+// commandFlags returns the flags of the main command, with the key "", and of each subcommand, by running each
+// command with its flags captured.
+func commandFlags() map[string][]completionFlag {
+	result := make(map[string][]completionFlag)
+	var captured *flag.FlagSet
+	captureFlags = func(fs *flag.FlagSet) {
+		captured = fs
+	}
+	defer func() {
+		captureFlags = nil
+	}()
+	commands := map[string]func(args []string) int{"": func(args []string) int { return run() }}
+	for name, f := range subcommands {
+		commands[name] = f
+	}
+	for name, f := range commands {
+		captured = nil
+		f(nil)
+		if captured == nil {
+			continue
+		}
+		flags := []completionFlag{}
+		captured.VisitAll(func(f *flag.Flag) {
+			if f.Hidden {
+				return
+			}
+			flags = append(flags, completionFlag{
+				name:        f.Name,
+				shorthand:   f.Shorthand,
+				description: strings.SplitN(f.Usage, "\n", 2)[0],
+				takesValue:  f.Value.Type() != "bool" && f.NoOptDefVal == "",
+				dynamic:     dynamicFlags[f.Name],
+			})
+		})
+		result[name] = flags
+	}
+	return result
+}
+
+// sortedSubcommands returns the names of the subcommands, sorted.
+func sortedSubcommands() []string {
+	names := make([]string, 0, len(subcommands))
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// flagWords returns the words that name the flags of a command, e.g., "--root -r".
+func flagWords(flags []completionFlag) string {
+	words := []string{}
+	for _, f := range flags {
+		words = append(words, "--"+f.name)
+		if f.shorthand != "" {
+			words = append(words, "-"+f.shorthand)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// writeBashCompletion writes a bash completion script for the program.
+func writeBashCompletion(w io.Writer, prog string) {
+	flags := commandFlags()
+	fn := "_" + strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' {
+			return '_'
+		}
+		return r
+	}, prog)
+	fmt.Fprintf(w, "# bash completion for %s. Load with: source <(%s completion bash)\n", prog, prog)
+	fmt.Fprintf(w, "%s() {\n", fn)
+	fmt.Fprintln(w, `    local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}" cmd="" flags=""`)
+	fmt.Fprintln(w, `    case "${COMP_WORDS[1]}" in`)
+	fmt.Fprintf(w, "        %s) [[ ${COMP_CWORD} -gt 1 ]] && cmd=\"${COMP_WORDS[1]}\" ;;\n",
+		strings.Join(sortedSubcommands(), "|"))
+	fmt.Fprintln(w, `    esac`)
+
+	// Flags that take values complete their values instead of flags
+	fmt.Fprintln(w, `    case "$cmd" in`)
+	for _, name := range append([]string{""}, sortedSubcommands()...) {
+		fmt.Fprintf(w, "        %q)\n", name)
+		fmt.Fprintf(w, "            flags=%q\n", flagWords(flags[name]))
+		fmt.Fprintln(w, `            case "$prev" in`)
+		valueWords := []string{}
+		for _, f := range flags[name] {
+			words := "--" + f.name
+			if f.shorthand != "" {
+				words += "|-" + f.shorthand
+			}
+			if f.dynamic != "" {
+				fmt.Fprintf(w, "                %s) COMPREPLY=($(compgen -W \"$(%s completion %s 2>/dev/null)\" -- \"$cur\")); return ;;\n",
+					words, prog, f.dynamic)
+			} else if f.takesValue {
+				valueWords = append(valueWords, words)
+			}
+		}
+		if len(valueWords) > 0 {
+			fmt.Fprintf(w, "                %s) COMPREPLY=($(compgen -f -- \"$cur\")); return ;;\n",
+				strings.Join(valueWords, "|"))
+		}
+		fmt.Fprintln(w, `            esac ;;`)
+	}
+	fmt.Fprintln(w, `    esac`)
+	fmt.Fprintln(w, `    if [[ -z "$cmd" && ${COMP_CWORD} -eq 1 && "$cur" != -* ]]; then`)
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(sortedSubcommands(), " "))
+	fmt.Fprintln(w, `    elif [[ "$cur" == -* ]]; then`)
+	fmt.Fprintln(w, `        COMPREPLY=($(compgen -W "$flags" -- "$cur"))`)
+	fmt.Fprintln(w, `    else`)
+	fmt.Fprintln(w, `        COMPREPLY=($(compgen -f -- "$cur"))`)
+	fmt.Fprintln(w, `    fi`)
+	fmt.Fprintln(w, `}`)
+	fmt.Fprintf(w, "complete -F %s %s\n", fn, prog)
+}
+
+// writeZshCompletion writes a zsh completion script for the program, which uses the bash script through zsh's
+// bash completion emulation.
+func writeZshCompletion(w io.Writer, prog string) {
+	fmt.Fprintf(w, "# zsh completion for %s. Load with: source <(%s completion zsh)\n", prog, prog)
+	fmt.Fprintln(w, "autoload -U +X compinit && compinit")
+	fmt.Fprintln(w, "autoload -U +X bashcompinit && bashcompinit")
+	writeBashCompletion(w, prog)
+}
+
+// fishQuote quotes a string for fish.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// writeFishCompletion writes a fish completion script for the program.
+func writeFishCompletion(w io.Writer, prog string) {
+	flags := commandFlags()
+	names := sortedSubcommands()
+	fmt.Fprintf(w, "# fish completion for %s. Load with: %s completion fish | source\n", prog, prog)
+	fmt.Fprintf(w, "complete -c %s -f\n", prog)
+	fmt.Fprintf(w, "complete -c %s -n __fish_use_subcommand -a %s\n", prog, fishQuote(strings.Join(names, " ")))
+	for _, name := range append([]string{""}, names...) {
+		condition := "__fish_use_subcommand"
+		if name != "" {
+			condition = "'__fish_seen_subcommand_from " + name + "'"
+		}
+		for _, f := range flags[name] {
+			fmt.Fprintf(w, "complete -c %s -n %s -l %s", prog, condition, f.name)
+			if f.shorthand != "" {
+				fmt.Fprintf(w, " -s %s", f.shorthand)
+			}
+			if f.dynamic != "" {
+				fmt.Fprintf(w, " -x -a %s", fishQuote("("+prog+" completion "+f.dynamic+" 2>/dev/null)"))
+			} else if f.takesValue {
+				fmt.Fprintf(w, " -r -F")
+			}
+			fmt.Fprintf(w, " -d %s\n", fishQuote(f.description))
+		}
+	}
+}
+
+// writeExecutables writes the distinct executable names of the running processes, one per line, for dynamic
+// completion.
+func writeExecutables(w io.Writer) error {
+	pt, err := proctree.New()
+	if err != nil {
+		return err
+	}
+	defer pt.Close()
+	seen := make(map[string]bool)
+	names := []string{}
+	for _, proc := range pt.Processes() {
+		name := proc.Executable()
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(w, name)
+	}
+	return nil
+}
+
+// completionWriters are the shells supported by the completion subcommand, with the functions that write
+// their scripts.
+var completionWriters = map[string]func(w io.Writer, prog string){
+	"bash": writeBashCompletion,
+	"zsh":  writeZshCompletion,
+	"fish": writeFishCompletion,
+}
+
+// runCompletion runs the completion subcommand, which writes a shell completion script.
+func runCompletion(args []string) int {
+	fs := flag.NewFlagSet("completion", flag.ContinueOnError)
+	fs.Usage = func() {
+		prog := filepath.Base(os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s completion bash|zsh|fish\n\n", prog)
+		fmt.Fprintf(os.Stderr, "Write a shell completion script for the flags and subcommands, which also completes\n")
+		fmt.Fprintf(os.Stderr, "the names of running executables for --root-name. For example:\n\n")
+		fmt.Fprintf(os.Stderr, "  bash:  source <(%s completion bash)\n", prog)
+		fmt.Fprintf(os.Stderr, "  zsh:   source <(%s completion zsh)\n", prog)
+		fmt.Fprintf(os.Stderr, "  fish:  %s completion fish | source\n", prog)
+	}
+
+	err := parseFlags(fs, args)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+	if len(fs.Args()) != 1 {
+		fmt.Fprintln(os.Stderr, "proctree: Exactly one shell must be supplied")
+		fmt.Fprintln(os.Stderr)
+		fs.Usage()
+		return 1
+	}
+	// Lists the candidates for dynamically completed flags, for use by the completion scripts
+	if fs.Args()[0] == "executables" {
+		err = writeExecutables(os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "proctree: Could not build process tree: ", err)
+			return 1
+		}
+		return 0
+	}
+	writeCompletion, ok := completionWriters[fs.Args()[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "proctree: Unsupported shell \"%s\"\n", fs.Args()[0])
+		return 1
+	}
+	writeCompletion(os.Stdout, filepath.Base(os.Args[0]))
+	return 0
+}
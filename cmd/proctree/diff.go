@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/sammck-go/proctree"
+	flag "github.com/spf13/pflag"
+)
+
+// loadTreeFile loads a process tree saved with --json, or from stdin if the path is "-".
+func loadTreeFile(path string) (*proctree.ProcTree, error) {
+	if path == "-" {
+		return proctree.LoadJSON(os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return proctree.LoadJSON(f)
+}
+
+// writeDiff prints the changes in a TreeDiff, one per line: "+" for added processes, "-" for removed processes
+// and "~" for reparented processes.
+func writeDiff(w io.Writer, diff *proctree.TreeDiff) {
+	for _, proc := range diff.Removed {
+		fmt.Fprintf(w, "- [%d]  %s\n", proc.Pid(), proc.Executable())
+	}
+	for _, proc := range diff.Added {
+		if proc.Parent() != nil {
+			fmt.Fprintf(w, "+ [%d]  %s  parent %d\n", proc.Pid(), proc.Executable(), proc.Parent().Pid())
+		} else {
+			fmt.Fprintf(w, "+ [%d]  %s\n", proc.Pid(), proc.Executable())
+		}
+	}
+	for _, r := range diff.Reparented {
+		fmt.Fprintf(w, "~ [%d]  %s  parent %d -> %d\n", r.Process.Pid(), r.Process.Executable(), r.OldParentPid,
+			r.NewParentPid)
+	}
+}
+
+// runDiff runs the diff subcommand, which prints the processes that were added, removed and reparented between
+// two saved trees, or in the live tree at an interval. Like diff, it exits with 0 if the trees are the same, 1
+// if they differ, and 2 if an error occurs.
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s diff <before.json> <after.json>\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s diff --live [<option>...]\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "Print the processes that were added (+), removed (-) and reparented (~) between\n")
+		fmt.Fprintf(os.Stderr, "two trees saved with --json, or in the live tree at an interval. Exits with 0 if\n")
+		fmt.Fprintf(os.Stderr, "the saved trees are the same, 1 if they differ, and 2 on error.\n\n")
+		fmt.Fprintln(os.Stderr, "Options:")
+
+		fs.PrintDefaults()
+	}
+
+	live := false
+	interval := 2 * time.Second
+	rootPids := []int{}
+	includeKernelThreads := false
+	fs.BoolVar(&live, "live", false, "Compare the live tree with itself at an interval, until interrupted.")
+	fs.DurationVarP(&interval, "interval", "i", interval, "Provides the interval at which the live tree is compared.")
+	fs.IntSliceVarP(&rootPids, "root", "r", []int{}, "With --live, provides a pid to use as a root of the tree. May be repeated.")
+	fs.BoolVarP(&includeKernelThreads, "include-kernel-threads", "k", false, "With --live, include kernel threads.")
+
+	err := parseFlags(fs, args)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	if !live {
+		if len(fs.Args()) != 2 {
+			fmt.Fprintln(os.Stderr, "proctree: Exactly two tree files must be supplied, or --live")
+			fmt.Fprintln(os.Stderr)
+			fs.Usage()
+			return 2
+		}
+		trees := make([]*proctree.ProcTree, 2)
+		for i, path := range fs.Args() {
+			trees[i], err = loadTreeFile(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "proctree: Unable to load %s: %s\n", path, err)
+				return 2
+			}
+			defer trees[i].Close()
+		}
+		diff := proctree.Diff(trees[0], trees[1])
+		writeDiff(os.Stdout, diff)
+		if !diff.Empty() {
+			return 1
+		}
+		return 0
+	}
+
+	if len(fs.Args()) != 0 {
+		fmt.Fprintln(os.Stderr, "proctree: Tree files cannot be combined with --live")
+		return 2
+	}
+	if interval <= 0 {
+		fmt.Fprintf(os.Stderr, "proctree: Invalid interval %s supplied to --interval\n", interval)
+		return 2
+	}
+	cfg := proctree.NewConfig()
+	for _, pid := range uniquePids(rootPids) {
+		cfg = cfg.Refine(proctree.WithRootPid(pid))
+	}
+	if includeKernelThreads {
+		cfg = cfg.Refine(proctree.WithKernelThreads())
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Each comparison uses a new tree, so the earlier tree keeps the state that it was built with
+	prev, err := proctree.New(proctree.WithConfig(cfg))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "proctree: Could not build process tree: ", err)
+		return 2
+	}
+	defer func() {
+		prev.Close()
+	}()
+	for {
+		select {
+		case <-sigs:
+			return 0
+		case now := <-ticker.C:
+			cur, err := proctree.New(proctree.WithConfig(cfg))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "proctree: Could not build process tree: ", err)
+				return 2
+			}
+			diff := proctree.Diff(prev, cur)
+			if !diff.Empty() {
+				fmt.Printf("%s\n", now.Format("15:04:05"))
+				writeDiff(os.Stdout, diff)
+			}
+			prev.Close()
+			prev = cur
+		}
+	}
+}
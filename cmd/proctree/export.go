@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sammck-go/proctree"
+	flag "github.com/spf13/pflag"
+)
+
+// exporters maps the formats accepted by the export subcommand to the functions that write them.
+var exporters = map[string]func(pt *proctree.ProcTree, w io.Writer) error{
+	"dot":     (*proctree.ProcTree).WriteDOT,
+	"mermaid": (*proctree.ProcTree).WriteMermaid,
+	"csv":     (*proctree.ProcTree).WriteCSV,
+	"json": func(pt *proctree.ProcTree, w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(pt)
+	},
+}
+
+// exportFormats returns the formats accepted by the export subcommand, sorted.
+func exportFormats() []string {
+	formats := make([]string, 0, len(exporters))
+	for format := range exporters {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// runExport runs the export subcommand, which writes the tree in a format for other tools.
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s export --format <format> [<option>...]\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "Export the process tree, e.g., as a diagram:\n\n")
+		fmt.Fprintf(os.Stderr, "  %s export --format dot | dot -Tsvg -o tree.svg\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(os.Stderr, "Options:")
+
+		fs.PrintDefaults()
+	}
+
+	format := ""
+	output := ""
+	includeKernelThreads := false
+	rootPidStrs := []string{}
+	fs.StringVarP(&format, "format", "f", "", "Provides the export format: "+strings.Join(exportFormats(), ", ")+". Required.")
+	fs.StringVarP(&output, "output", "o", "", "Provides the file to write. By default, the tree is written to stdout.")
+	fs.BoolVarP(&includeKernelThreads, "include-kernel-threads", "k", false, "Include kernel threads. Disabled by default.")
+	fs.StringSliceVarP(&rootPidStrs, "root", "r", []string{}, "Provides a pid to use as a root of the tree. May be repeated.\nBy default, all orphaned processes are roots.")
+
+	err := parseFlags(fs, args)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+	if len(fs.Args()) != 0 {
+		fmt.Fprintln(os.Stderr, "proctree: Too many command line arguments")
+		fmt.Fprintln(os.Stderr)
+		fs.Usage()
+		return 1
+	}
+	exporter := exporters[strings.ToLower(format)]
+	if exporter == nil {
+		fmt.Fprintf(os.Stderr, "proctree: A format must be supplied with --format: %s\n", strings.Join(exportFormats(), ", "))
+		return 1
+	}
+
+	cfg := proctree.NewConfig()
+	rootPids, err := collectRootPids(rootPidStrs, nil, nil, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctree: %s\n", err)
+		return 1
+	}
+	for _, pid := range rootPids {
+		cfg = cfg.Refine(proctree.WithRootPid(pid))
+	}
+	if includeKernelThreads {
+		cfg = cfg.Refine(proctree.WithKernelThreads())
+	}
+
+	pt, err := proctree.New(proctree.WithConfig(cfg))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "proctree: Could not build process tree: ", err)
+		return 1
+	}
+	defer pt.Close()
+
+	w := io.Writer(os.Stdout)
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "proctree: %s\n", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	err = exporter(pt, bw)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctree: Unable to export tree: %s\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/sammck-go/proctree"
+	flag "github.com/spf13/pflag"
+)
+
+// runFind runs the find subcommand, which prints the pids of processes that match a pattern, like pgrep. It
+// exits with 0 if any processes match, 1 if none match, and 2 if an error occurs.
+func runFind(args []string) int {
+	fs := flag.NewFlagSet("find", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s find [<option>...] <pattern>\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "Print the pids of processes whose executable name matches a regular expression.\n")
+		fmt.Fprintf(os.Stderr, "Exits with 0 if any processes match, 1 if none match, and 2 on error.\n\n")
+		fmt.Fprintln(os.Stderr, "Options:")
+
+		fs.PrintDefaults()
+	}
+
+	full := false
+	subtree := false
+	listNames := false
+	user := ""
+	rootPidStrs := []string{}
+	fs.BoolVarP(&full, "full", "f", false, "Match the pattern against the full command line instead of the\nexecutable name.")
+	fs.BoolVarP(&subtree, "subtree", "s", false, "Also print the pids of the descendants of matching processes.")
+	fs.BoolVarP(&listNames, "list-name", "l", false, "Print the executable name after each pid.")
+	fs.StringVarP(&user, "user", "u", "", "Only match processes whose effective user is the provided user\nname or id.")
+	fs.StringSliceVarP(&rootPidStrs, "root", "r", []string{}, "Only match processes in the subtree of a pid. May be repeated.")
+
+	err := parseFlags(fs, args)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if len(fs.Args()) != 1 {
+		fmt.Fprintln(os.Stderr, "proctree: Exactly one pattern must be supplied")
+		fmt.Fprintln(os.Stderr)
+		fs.Usage()
+		return 2
+	}
+	pattern := fs.Args()[0]
+
+	cfg := proctree.NewConfig()
+	rootPids, err := collectRootPids(rootPidStrs, nil, nil, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctree: %s\n", err)
+		return 2
+	}
+	for _, pid := range rootPids {
+		cfg = cfg.Refine(proctree.WithRootPid(pid))
+	}
+
+	pt, err := proctree.New(proctree.WithConfig(cfg))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "proctree: Could not build process tree: ", err)
+		return 2
+	}
+	defer pt.Close()
+
+	var matches []*proctree.Process
+	if full {
+		matches, err = pt.FindByCmdline(pattern)
+	} else {
+		var re *regexp.Regexp
+		re, err = regexp.Compile(pattern)
+		if err == nil {
+			for _, proc := range pt.Processes() {
+				if re.MatchString(proc.Executable()) {
+					matches = append(matches, proc)
+				}
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctree: Invalid pattern: %s\n", err)
+		return 2
+	}
+	if user != "" {
+		procs, err := pt.FindByUser(user)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "proctree: %s\n", err)
+			return 2
+		}
+		matches = intersectProcesses(matches, procs)
+	}
+
+	// Like pgrep, the command does not match itself
+	found := make(map[*proctree.Process]bool)
+	for _, proc := range matches {
+		if proc.Pid() == os.Getpid() {
+			continue
+		}
+		found[proc] = true
+		if subtree {
+			proc.WalkSubtree(func(desc *proctree.Process) error {
+				if desc.Pid() != os.Getpid() {
+					found[desc] = true
+				}
+				return nil
+			})
+		}
+	}
+	procs := make([]*proctree.Process, 0, len(found))
+	for proc := range found {
+		procs = append(procs, proc)
+	}
+	sort.Slice(procs, func(i, j int) bool {
+		return procs[i].Pid() < procs[j].Pid()
+	})
+	for _, proc := range procs {
+		if listNames {
+			fmt.Printf("%d %s\n", proc.Pid(), proc.Executable())
+		} else {
+			fmt.Println(proc.Pid())
+		}
+	}
+	if len(procs) == 0 {
+		return 1
+	}
+	return 0
+}
+
+// intersectProcesses returns the Processes that are in both lists, in the order of the first.
+func intersectProcesses(procs []*proctree.Process, others []*proctree.Process) []*proctree.Process {
+	in := make(map[*proctree.Process]bool, len(others))
+	for _, proc := range others {
+		in[proc] = true
+	}
+	result := []*proctree.Process{}
+	for _, proc := range procs {
+		if in[proc] {
+			result = append(result, proc)
+		}
+	}
+	return result
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sammck-go/proctree"
+)
+
+// formatNode is the data passed to the --format template for each process: the fields of its proctree.Record,
+// e.g., {{.Pid}} and {{.User}}, and methods that read further metadata on demand, e.g., {{.Cmdline}}.
+type formatNode struct {
+	proctree.Record
+	proc *proctree.Process
+}
+
+// Cmdline returns the command line of the process, with arguments joined by spaces, or "" if it is not known.
+func (n *formatNode) Cmdline() string {
+	cmdline := n.proc.Cmdline()
+	if cmdline == nil && !n.Tombstone {
+		cmdline, _ = n.proc.SystemCmdline()
+	}
+	return strings.Join(cmdline, " ")
+}
+
+// StartTime returns the time at which the process started, or the zero time if it is not known.
+func (n *formatNode) StartTime() time.Time {
+	start, _ := n.proc.StartTime()
+	return start
+}
+
+// ExitStatus returns the exit status of the process, or nil if it has not exited or its exit status is not
+// known.
+func (n *formatNode) ExitStatus() *proctree.ExitStatus {
+	return n.proc.ExitStatus()
+}
+
+// Process returns the process, for access to the rest of its methods.
+func (n *formatNode) Process() *proctree.Process {
+	return n.proc
+}
+
+// formatFuncs are the functions available to --format templates, in addition to the standard ones.
+var formatFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// parseFormat parses a --format template.
+func parseFormat(format string) (*template.Template, error) {
+	return template.New("format").Funcs(formatFuncs).Parse(format)
+}
+
+// writeFormatted writes a line for each of the provided processes, in order, by executing a --format template.
+func writeFormatted(w io.Writer, tmpl *template.Template, pt *proctree.ProcTree, procs []*proctree.Process) error {
+	records := make(map[int]proctree.Record)
+	for _, rec := range pt.Records() {
+		records[rec.Pid] = rec
+	}
+	bw := bufio.NewWriter(w)
+	for _, proc := range procs {
+		err := tmpl.Execute(bw, &formatNode{Record: records[proc.Pid()], proc: proc})
+		if err != nil {
+			return fmt.Errorf("Unable to format process %d: %s", proc.Pid(), err)
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sammck-go/proctree"
+	flag "github.com/spf13/pflag"
+)
+
+// signalNames maps the names accepted by --signal, without the "SIG" prefix, to signals.
+var signalNames = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL,
+	"TERM": syscall.SIGTERM,
+}
+
+// parseSignal parses a signal name, with or without the "SIG" prefix, or number.
+func parseSignal(s string) (syscall.Signal, error) {
+	n, err := strconv.Atoi(s)
+	if err == nil && n > 0 {
+		return syscall.Signal(n), nil
+	}
+	sig, ok := signalNames[strings.TrimPrefix(strings.ToUpper(s), "SIG")]
+	if !ok {
+		return 0, fmt.Errorf("Unknown signal %q", s)
+	}
+	return sig, nil
+}
+
+// outcomeNames are the descriptions of TerminateOutcomes printed by the kill subcommand.
+var outcomeNames = map[proctree.TerminateOutcome]string{
+	proctree.TerminateExited:   "exited",
+	proctree.TerminateKilled:   "killed",
+	proctree.TerminateSurvived: "survived",
+}
+
+// runKill runs the kill subcommand, which terminates a subtree and prints the result for each process.
+func runKill(args []string) int {
+	fs := flag.NewFlagSet("kill", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s kill --root <pid> [<option>...]\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "Terminate a process and its descendants, including descendants that have been\n")
+		fmt.Fprintf(os.Stderr, "reparented, escalating to SIGKILL after a grace period. A subtree that contains\n")
+		fmt.Fprintf(os.Stderr, "proctree itself is refused.\n\n")
+		fmt.Fprintln(os.Stderr, "Options:")
+
+		fs.PrintDefaults()
+	}
+
+	rootPid := 0
+	signalStr := "TERM"
+	gracePeriod := 10 * time.Second
+	fs.IntVarP(&rootPid, "root", "r", 0, "Provides the pid of the root of the subtree to terminate. Required.")
+	fs.StringVarP(&signalStr, "signal", "s", signalStr, "Provides the signal sent first, by name or number.")
+	fs.DurationVarP(&gracePeriod, "grace", "g", gracePeriod, "Provides the time allowed for processes to exit before they are\nsent SIGKILL.")
+
+	err := parseFlags(fs, args)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+	if len(fs.Args()) != 0 {
+		fmt.Fprintln(os.Stderr, "proctree: Too many command line arguments")
+		fmt.Fprintln(os.Stderr)
+		fs.Usage()
+		return 1
+	}
+	if rootPid <= 0 {
+		fmt.Fprintln(os.Stderr, "proctree: A root pid must be supplied with --root")
+		return 1
+	}
+	sig, err := parseSignal(signalStr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctree: Invalid signal supplied to --signal: %s\n", err)
+		return 1
+	}
+
+	pt, err := proctree.New(proctree.WithRootPid(rootPid))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "proctree: Could not build process tree: ", err)
+		return 1
+	}
+	defer pt.Close()
+
+	// Refuse to terminate a subtree that contains this command, e.g., "--root $$" from a shell, which would
+	// terminate the command before it reports its results
+	root := pt.PidProcess(rootPid)
+	self := pt.Self()
+	if self != nil && (self == root || self.IsDescendantOf(root)) {
+		fmt.Fprintf(os.Stderr, "proctree: The subtree rooted at pid %d contains this command (pid %d)\n", rootPid, self.Pid())
+		return 1
+	}
+
+	results, err := pt.TerminateSubtree(root, sig, gracePeriod)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctree: %s\n", err)
+		return 1
+	}
+
+	exitCode := 0
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "PID\tEXECUTABLE\tRESULT")
+	for _, result := range results {
+		outcome := outcomeNames[result.Outcome]
+		if result.Outcome == proctree.TerminateSurvived {
+			exitCode = 1
+			if result.Err != nil {
+				outcome += ": " + result.Err.Error()
+			}
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", result.Pid, result.Process.Executable(), outcome)
+	}
+	tw.Flush()
+	return exitCode
+}
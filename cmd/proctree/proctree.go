@@ -1,42 +1,33 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/sammck-go/proctree"
 	flag "github.com/spf13/pflag"
-	"github.com/xlab/treeprint"
 )
 
-func addProc(root treeprint.Tree, pidToTree map[int]treeprint.Tree, proc *proctree.Process) error {
-	pid := proc.Pid()
-	parentTree := root
-	parentProc := proc.Parent()
-	if parentProc != nil {
-		parentPid := parentProc.Pid()
-		var ok bool
-		parentTree, ok = pidToTree[parentPid]
-		if !ok {
-			return fmt.Errorf("Process with pid %d has parent pid %d but it is not in treeprint map", pid, parentPid)
-		}
-	}
-	nodeTree := parentTree.AddMetaBranch(pid, proc.Executable())
-	pidToTree[pid] = nodeTree
-
-	for _, childProc := range proc.Children() {
-		addProc(root, pidToTree, childProc)
-	}
-
-	return nil
-}
-
 func run() int {
 
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [<option>...]\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "Usage: %s [<option>...]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s completion bash|zsh|fish\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s diff <before.json> <after.json>\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s export --format <format> [<option>...]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s find [<option>...] <pattern>\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s kill --root <pid> [<option>...]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s serve [--listen <address>] [<option>...]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s top [--root <pid>] [<option>...]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s tui [<option>...]\n\n", filepath.Base(os.Args[0]))
 		fmt.Fprintf(os.Stderr, "Print process tree details.\n\n")
 		fmt.Fprintln(os.Stderr, "Options:")
 
@@ -46,23 +37,49 @@ func run() int {
 	includeKernelThreads := false
 	includeAncestors := false
 	rootPidStrs := []string{}
+	rootNames := []string{}
+	rootPidFiles := []string{}
+	query := ""
+	outputJSON := false
+	watchInterval := time.Duration(0)
+	columns := []string{}
+	format := ""
+	depth := -1
+	collapseThreads := false
+	sortKey := "pid"
+	pidsOrder := ""
 	flag.BoolVarP(&includeKernelThreads, "include-kernel-threads", "k", false, "Include kernel threads. Disabled by default.")
 	flag.BoolVarP(&includeAncestors, "include-ancestors", "a", false, "Include ancestors of roots. No effect if roots not provided.\nDisabled by default.")
 	flag.StringSliceVarP(&rootPidStrs, "root", "r", []string{}, "Provides a pid to use as a root of the tree. May be repeated.\nBy default, all orphaned processes are roots.")
+	flag.StringSliceVar(&rootNames, "root-name", []string{}, "Provides a glob pattern, e.g., \"nginx*\". Processes whose executable\nname matches are used as roots, except those descended from another match.\nMay be repeated.")
+	flag.StringSliceVar(&rootPidFiles, "root-pidfile", []string{}, "Provides a pidfile, e.g., /run/sshd.pid, whose pid is used as a root.\nMay be repeated.")
+
+	flag.StringVarP(&query, "query", "q", "", "Print only the processes that match a query expression, e.g.,\n'exe ~ \"nginx*\" && user == \"www-data\" && depth < 3'.")
 
-	flag.Parse()
+	flag.BoolVarP(&outputJSON, "json", "j", false, "Print the tree as JSON, with the children of each process nested beneath it.\nWith --query, prints an array of the matching processes and their subtrees.")
+	flag.StringSliceVarP(&columns, "columns", "c", []string{}, "Show metadata columns after each process, e.g., --columns user,cpu,mem.\nValid columns are "+strings.Join(columnNames(), ", ")+".")
+	flag.StringVarP(&format, "format", "f", "", "Print a line for each process by executing a Go template, e.g.,\n'{{.Pid}} {{.Executable}} {{.User}}'. Fields are those of proctree.Record,\nand .Cmdline, .StartTime, .ExitStatus and .Process.")
+	flag.IntVarP(&depth, "depth", "d", -1, "Print only the processes at most this many levels below each root,\nwith the number of hidden descendants of each. By default, the entire tree is printed.")
+	flag.BoolVar(&collapseThreads, "collapse-threads", false, "Print sibling processes with the same name and no children, e.g.,\nbrowser renderers and build workers, as one line, e.g., \"12*[chrome]\".")
+	flag.StringVarP(&sortKey, "sort", "s", "pid", "Order the children of each process by one of pid, name, start (oldest first),\ncpu (most CPU time first) or mem (largest resident set first).")
+	flag.DurationVarP(&watchInterval, "watch", "w", 0, "Keep the tree refreshed at an interval, e.g., --watch=5s, highlighting\nprocesses that start and exit. The default interval is 2s.")
+	flag.Lookup("watch").NoOptDefVal = "2s"
+	flag.StringVar(&pidsOrder, "pids", "", "Print only the pids of the included processes, one per line, in tree order,\nor with --pids=sorted, in ascending order. With --query, prints the pids of the\nmatching processes.")
+	flag.Lookup("pids").NoOptDefVal = "tree"
+
+	if parseFlags(flag.CommandLine, os.Args[1:]) != nil {
+		return 0
+	}
 
 	cfg := proctree.NewConfig()
 
-	if len(rootPidStrs) > 0 {
-		for _, pidStr := range rootPidStrs {
-			pid, err := strconv.Atoi(pidStr)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "proctree: Invalid pid \"%s\" supplied to --root: %s\n", pidStr, err)
-				return 1
-			}
-			cfg = cfg.Refine(proctree.WithRootPid(pid))
-		}
+	rootPids, err := collectRootPids(rootPidStrs, rootPidFiles, rootNames, includeKernelThreads)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctree: %s\n", err)
+		return 1
+	}
+	for _, pid := range rootPids {
+		cfg = cfg.Refine(proctree.WithRootPid(pid))
 	}
 
 	if includeAncestors {
@@ -73,6 +90,55 @@ func run() int {
 		cfg = cfg.Refine(proctree.WithKernelThreads())
 	}
 
+	order, ok := childOrders[sortKey]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "proctree: Invalid key \"%s\" supplied to --sort\n", sortKey)
+		return 1
+	}
+	cfg = cfg.Refine(proctree.WithChildSort(order))
+
+	labelFields, err := parseColumns(columns)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctree: Invalid columns supplied to --columns: %s\n", err)
+		return 1
+	}
+
+	var tmpl *template.Template
+	if format != "" {
+		if outputJSON || len(columns) > 0 {
+			fmt.Fprintln(os.Stderr, "proctree: --format cannot be combined with --json or --columns")
+			return 1
+		}
+		tmpl, err = parseFormat(format)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "proctree: Invalid template supplied to --format: %s\n", err)
+			return 1
+		}
+	}
+
+	if pidsOrder != "" {
+		if pidsOrder != "tree" && pidsOrder != "sorted" {
+			fmt.Fprintf(os.Stderr, "proctree: Invalid order \"%s\" supplied to --pids\n", pidsOrder)
+			return 1
+		}
+		if outputJSON || format != "" || len(columns) > 0 || watchInterval != 0 {
+			fmt.Fprintln(os.Stderr, "proctree: --pids cannot be combined with --json, --format, --columns or --watch")
+			return 1
+		}
+	}
+
+	if watchInterval < 0 {
+		fmt.Fprintf(os.Stderr, "proctree: Invalid interval %s supplied to --watch\n", watchInterval)
+		return 1
+	}
+	if watchInterval > 0 {
+		if query != "" || outputJSON || format != "" {
+			fmt.Fprintln(os.Stderr, "proctree: --watch cannot be combined with --query, --json or --format")
+			return 1
+		}
+		cfg = cfg.Refine(proctree.WithAutoUpdate(watchInterval, false))
+	}
+
 	if len(flag.Args()) != 0 {
 		fmt.Fprintln(os.Stderr, "proctree: Too many command line arguments")
 		fmt.Fprintln(os.Stderr)
@@ -88,24 +154,138 @@ func run() int {
 
 	defer pt.Close()
 
-	pidToTree := map[int]treeprint.Tree{}
-
-	root := treeprint.New()
-
-	for _, proc := range pt.Roots() {
-		err = addProc(root, pidToTree, proc)
+	if query != "" {
+		procs, err := pt.Query(query)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "proctree: Unable to build printable tree: ", err)
+			fmt.Fprintf(os.Stderr, "proctree: %s\n", err)
 			return 1
 		}
+		if outputJSON {
+			return printJSON(procs)
+		}
+		if tmpl != nil {
+			return printFormatted(tmpl, pt, procs)
+		}
+		if pidsOrder != "" {
+			if pidsOrder == "sorted" {
+				sort.Slice(procs, func(i, j int) bool { return procs[i].Pid() < procs[j].Pid() })
+			}
+			return printPids(procs)
+		}
+		for _, proc := range procs {
+			fmt.Printf("[%d]  %s\n", proc.Pid(), proc.Executable())
+		}
+		return 0
+	}
+
+	if outputJSON {
+		if len(columns) > 0 {
+			return printJSON(newJSONTree(pt, labelFields))
+		}
+		return printJSON(pt)
+	}
+
+	if pidsOrder == "sorted" {
+		return printPids(pt.Processes())
+	}
+
+	if tmpl != nil || pidsOrder != "" {
+		// Processes are printed in tree order, so that .Depth can be used to indent them
+		procs := []*proctree.Process{}
+		pt.Walk(func(proc *proctree.Process) error {
+			procs = append(procs, proc)
+			return nil
+		})
+		if pidsOrder != "" {
+			return printPids(procs)
+		}
+		return printFormatted(tmpl, pt, procs)
+	}
+
+	renderOpts := []proctree.RenderOption{proctree.WithLabelFields(labelFields...), proctree.WithRenderDepth(depth)}
+	if collapseThreads {
+		renderOpts = append(renderOpts, proctree.WithCollapsedSiblings())
+	}
+	if watchInterval > 0 {
+		return watch(pt, watchInterval, renderOpts)
+	}
+
+	err = pt.Render(os.Stdout, renderOpts...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "proctree: Unable to print tree: ", err)
+		return 1
+	}
+
+	return 0
+}
+
+// printPids prints the pids of the provided processes, one per line, and returns the exit code.
+func printPids(procs []*proctree.Process) int {
+	var buf bytes.Buffer
+	for _, proc := range procs {
+		buf.WriteString(strconv.Itoa(proc.Pid()))
+		buf.WriteByte('\n')
 	}
+	os.Stdout.Write(buf.Bytes())
+	return 0
+}
 
-	fmt.Println(root.String())
+// printFormatted prints a line for each of the provided processes with a --format template, and returns the exit
+// code.
+func printFormatted(tmpl *template.Template, pt *proctree.ProcTree, procs []*proctree.Process) int {
+	err := writeFormatted(os.Stdout, tmpl, pt, procs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctree: %s\n", err)
+		return 1
+	}
+	return 0
+}
 
+// printJSON prints a value to stdout as indented JSON, and returns the exit code.
+func printJSON(v interface{}) int {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(v)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "proctree: Unable to print JSON: ", err)
+		return 1
+	}
 	return 0
 }
 
+// childOrders are the keys that may be supplied to --sort, with the child orders that they select.
+var childOrders = map[string]proctree.ChildOrder{
+	"pid":   proctree.ByPid,
+	"name":  proctree.ByExecutable,
+	"start": proctree.ByStartTime,
+	"cpu":   proctree.ByCPUTime,
+	"mem":   proctree.ByMemory,
+}
+
+// subcommands are the commands that may be given as the first argument, with the functions that run them.
+var subcommands map[string]func(args []string) int
+
+func init() {
+	// The completion subcommand lists the subcommands, so they are registered at run time to avoid an
+	// initialization cycle
+	subcommands = map[string]func(args []string) int{
+		"completion": runCompletion,
+		"diff":       runDiff,
+		"export":     runExport,
+		"find":       runFind,
+		"kill":       runKill,
+		"serve":      runServe,
+		"top":        runTop,
+		"tui":        runTUI,
+	}
+}
+
 func main() {
-	exitCode := run()
+	exitCode := 0
+	if len(os.Args) > 1 && subcommands[os.Args[1]] != nil {
+		exitCode = subcommands[os.Args[1]](os.Args[2:])
+	} else {
+		exitCode = run()
+	}
 	os.Exit(exitCode)
 }
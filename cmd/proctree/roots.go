@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sammck-go/proctree"
+)
+
+// readPidFile reads the pid of a daemon from a pidfile, which contains the pid in decimal, optionally followed
+// by a newline.
+func readPidFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("%s does not contain a pid", path)
+	}
+	return pid, nil
+}
+
+// collectRootPids returns the pids supplied to --root, read from the pidfiles supplied to --root-pidfile and
+// found for the patterns supplied to --root-name, in that order. A pid supplied more than once, e.g., by both
+// --root and --root-name, is returned once, since a ProcTree rejects duplicate roots.
+func collectRootPids(rootPidStrs []string, rootPidFiles []string, rootNames []string, includeKernelThreads bool) ([]int, error) {
+	pids := []int{}
+	for _, pidStr := range rootPidStrs {
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid pid \"%s\" supplied to --root: %s", pidStr, err)
+		}
+		pids = append(pids, pid)
+	}
+	for _, path := range rootPidFiles {
+		pid, err := readPidFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid pidfile supplied to --root-pidfile: %s", err)
+		}
+		pids = append(pids, pid)
+	}
+	if len(rootNames) > 0 {
+		found, err := findRootPids(rootNames, includeKernelThreads)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to find roots supplied to --root-name: %s", err)
+		}
+		pids = append(pids, found...)
+	}
+	return uniquePids(pids), nil
+}
+
+// uniquePids returns a list of pids without repeats, in the order in which each pid first appears.
+func uniquePids(pids []int) []int {
+	seen := make(map[int]bool, len(pids))
+	result := []int{}
+	for _, pid := range pids {
+		if !seen[pid] {
+			seen[pid] = true
+			result = append(result, pid)
+		}
+	}
+	return result
+}
+
+// findRootPids returns the pids of the processes whose executable names match any of a list of glob patterns,
+// omitting those that are descended from another match, so that each matching tree, e.g., an nginx master and
+// its workers, has a single root. Returns an error if a pattern matches no processes.
+func findRootPids(patterns []string, includeKernelThreads bool) ([]int, error) {
+	cfg := proctree.NewConfig()
+	if includeKernelThreads {
+		cfg = cfg.Refine(proctree.WithKernelThreads())
+	}
+	pt, err := proctree.New(proctree.WithConfig(cfg))
+	if err != nil {
+		return nil, err
+	}
+	defer pt.Close()
+
+	matched := make(map[*proctree.Process]bool)
+	for _, pattern := range patterns {
+		procs, err := pt.FindByExecutable(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(procs) == 0 {
+			return nil, fmt.Errorf("No processes match %q", pattern)
+		}
+		for _, proc := range procs {
+			matched[proc] = true
+		}
+	}
+
+	pids := []int{}
+	for _, proc := range pt.Processes() {
+		if !matched[proc] {
+			continue
+		}
+		nested := false
+		for _, ancestor := range proc.Ancestors() {
+			if matched[ancestor] {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			pids = append(pids, proc.Pid())
+		}
+	}
+	return pids, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/sammck-go/proctree"
+)
+
+func TestOverlappingRootFlags(t *testing.T) {
+	self := os.Getpid()
+	pidFile := filepath.Join(t.TempDir(), "self.pid")
+	err := ioutil.WriteFile(pidFile, []byte(strconv.Itoa(self)+"\n"), 0644)
+	if err != nil {
+		t.Fatalf("ioutil.WriteFile() returned error: %s", err)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("os.Executable() returned error: %s", err)
+	}
+
+	// The calling process is supplied twice by --root, and again by --root-pidfile and --root-name
+	pids, err := collectRootPids([]string{strconv.Itoa(self), strconv.Itoa(self)}, []string{pidFile},
+		[]string{filepath.Base(exe)}, false)
+	if err != nil {
+		t.Fatalf("collectRootPids() returned error: %s", err)
+	}
+	count := 0
+	opts := []proctree.ConfigOption{}
+	for _, pid := range pids {
+		if pid == self {
+			count++
+		}
+		opts = append(opts, proctree.WithRootPid(pid))
+	}
+	if count != 1 {
+		t.Errorf("collectRootPids() returned %v, expected pid %d once", pids, self)
+	}
+	err = proctree.NewConfig(opts...).Validate()
+	if err != nil {
+		t.Errorf("Validate() of the collected roots returned error: %s", err)
+	}
+
+	_, err = collectRootPids([]string{"x"}, nil, nil, false)
+	if err == nil {
+		t.Errorf("collectRootPids() of an invalid pid did not return an error")
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sammck-go/proctree"
+	flag "github.com/spf13/pflag"
+)
+
+// eventNames are the names of event types in the event stream.
+var eventNames = map[proctree.EventType]string{
+	proctree.ProcessStarted:    "started",
+	proctree.ProcessExited:     "exited",
+	proctree.ProcessReparented: "reparented",
+	proctree.ProcessExeced:     "execed",
+}
+
+// jsonEvent is the JSON form of an Event in the event stream.
+type jsonEvent struct {
+	Type         string    `json:"type"`
+	Pid          int       `json:"pid"`
+	Executable   string    `json:"executable"`
+	Time         time.Time `json:"time"`
+	OldParentPid int       `json:"oldParentPid,omitempty"`
+	NewParentPid int       `json:"newParentPid,omitempty"`
+}
+
+func newJSONEvent(ev proctree.Event) *jsonEvent {
+	je := &jsonEvent{
+		Type:       eventNames[ev.Type],
+		Pid:        ev.Process.Pid(),
+		Executable: ev.Process.Executable(),
+		Time:       ev.Time,
+	}
+	if ev.OldParent != nil {
+		je.OldParentPid = ev.OldParent.Pid()
+	}
+	if ev.NewParent != nil {
+		je.NewParentPid = ev.NewParent.Pid()
+	}
+	return je
+}
+
+// writeJSONResponse writes a value as a JSON response.
+func writeJSONResponse(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
+}
+
+// treeServer serves a ProcTree over HTTP.
+type treeServer struct {
+	pt *proctree.ProcTree
+}
+
+// serveTree serves the entire tree at /tree, or the subtree of a pid at /tree/<pid>.
+func (s *treeServer) serveTree(w http.ResponseWriter, r *http.Request) {
+	pidStr := strings.TrimPrefix(r.URL.Path, "/tree")
+	if pidStr == "" || pidStr == "/" {
+		writeJSONResponse(w, s.pt)
+		return
+	}
+	pid, err := strconv.Atoi(strings.TrimPrefix(pidStr, "/"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid pid %q", pidStr[1:]), http.StatusBadRequest)
+		return
+	}
+	proc := s.pt.PidProcess(pid)
+	if proc == nil {
+		http.Error(w, fmt.Sprintf("Process %d is not in the tree", pid), http.StatusNotFound)
+		return
+	}
+	writeJSONResponse(w, proc)
+}
+
+// serveEvents streams the events of the tree as server-sent events, until the client disconnects. The root
+// query parameter restricts the stream to the subtree of a pid, and the exe parameter to executables that match
+// a glob pattern; each may be repeated.
+func (s *treeServer) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	// Slow clients lose their oldest events rather than holding up updates
+	opts := []proctree.SubscribeOption{proctree.WithOverflowPolicy(proctree.OverflowDropOldest)}
+	for _, pidStr := range r.URL.Query()["root"] {
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid pid %q", pidStr), http.StatusBadRequest)
+			return
+		}
+		proc := s.pt.PidProcess(pid)
+		if proc == nil {
+			http.Error(w, fmt.Sprintf("Process %d is not in the tree", pid), http.StatusNotFound)
+			return
+		}
+		opts = append(opts, proctree.WithSubtreeFilter(proc))
+	}
+	for _, pattern := range r.URL.Query()["exe"] {
+		opts = append(opts, proctree.WithExecutableFilter(pattern))
+	}
+	sub, err := s.pt.Subscribe(opts...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(newJSONEvent(ev))
+			if err != nil {
+				return
+			}
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventNames[ev.Type], data)
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// runServe runs the serve subcommand, which serves the tree and its events over HTTP until interrupted.
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s serve [<option>...]\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "Serve the process tree over HTTP, updated at an interval, with the endpoints:\n\n")
+		fmt.Fprintln(os.Stderr, "  /tree          The tree as JSON, as printed by --json")
+		fmt.Fprintln(os.Stderr, "  /tree/<pid>    The subtree of a process as JSON")
+		fmt.Fprintln(os.Stderr, "  /events        A stream of process events as server-sent events, optionally")
+		fmt.Fprintln(os.Stderr, "                 filtered with ?root=<pid> and ?exe=<pattern>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Options:")
+
+		fs.PrintDefaults()
+	}
+
+	listen := "localhost:8080"
+	interval := 2 * time.Second
+	rootPids := []int{}
+	includeKernelThreads := false
+	fs.StringVarP(&listen, "listen", "l", listen, "Provides the address on which to listen. The server is not\nauthenticated, so a non-loopback address exposes process\ndata, including command lines and users, to the network.")
+	fs.DurationVarP(&interval, "interval", "i", interval, "Provides the interval at which the tree is updated.")
+	fs.IntSliceVarP(&rootPids, "root", "r", []int{}, "Provides a pid to use as a root of the tree. May be repeated.\nBy default, all orphaned processes are roots.")
+	fs.BoolVarP(&includeKernelThreads, "include-kernel-threads", "k", false, "Include kernel threads. Disabled by default.")
+
+	err := parseFlags(fs, args)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+	if len(fs.Args()) != 0 {
+		fmt.Fprintln(os.Stderr, "proctree: Too many command line arguments")
+		fmt.Fprintln(os.Stderr)
+		fs.Usage()
+		return 1
+	}
+	if interval <= 0 {
+		fmt.Fprintf(os.Stderr, "proctree: Invalid interval %s supplied to --interval\n", interval)
+		return 1
+	}
+
+	cfg := proctree.NewConfig(proctree.WithAutoUpdate(interval, true))
+	for _, pid := range uniquePids(rootPids) {
+		cfg = cfg.Refine(proctree.WithRootPid(pid))
+	}
+	if includeKernelThreads {
+		cfg = cfg.Refine(proctree.WithKernelThreads())
+	}
+	pt, err := proctree.New(proctree.WithConfig(cfg))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "proctree: Could not build process tree: ", err)
+		return 1
+	}
+	defer pt.Close()
+
+	s := &treeServer{pt: pt}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tree", s.serveTree)
+	mux.HandleFunc("/tree/", s.serveTree)
+	mux.HandleFunc("/events", s.serveEvents)
+	srv := &http.Server{Addr: listen, Handler: mux}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	go func() {
+		<-sigs
+		srv.Close()
+	}()
+
+	err = srv.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		fmt.Fprintf(os.Stderr, "proctree: %s\n", err)
+		return 1
+	}
+	return 0
+}
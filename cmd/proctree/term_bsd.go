@@ -0,0 +1,14 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package main
+
+import "syscall"
+
+const (
+	// ioctlGetTermios is the ioctl that reads the terminal attributes.
+	ioctlGetTermios = syscall.TIOCGETA
+
+	// ioctlSetTermios is the ioctl that sets the terminal attributes.
+	ioctlSetTermios = syscall.TIOCSETA
+)
@@ -0,0 +1,14 @@
+//go:build linux
+// +build linux
+
+package main
+
+import "syscall"
+
+const (
+	// ioctlGetTermios is the ioctl that reads the terminal attributes.
+	ioctlGetTermios = syscall.TCGETS
+
+	// ioctlSetTermios is the ioctl that sets the terminal attributes.
+	ioctlSetTermios = syscall.TCSETS
+)
@@ -0,0 +1,24 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// resizeSignals are the signals that report a change in the size of the terminal. There are none on this
+// platform.
+var resizeSignals = []os.Signal{}
+
+// makeRaw puts the terminal on a file descriptor into raw mode. Not supported on this platform.
+func makeRaw(fd int) (func(), error) {
+	return nil, fmt.Errorf("Interactive terminals are not supported on this platform")
+}
+
+// terminalSize returns the width and height of the terminal on a file descriptor. Not supported on this
+// platform.
+func terminalSize(fd int) (int, int, error) {
+	return 0, 0, fmt.Errorf("Interactive terminals are not supported on this platform")
+}
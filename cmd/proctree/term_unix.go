@@ -0,0 +1,60 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// resizeSignals are the signals that report a change in the size of the terminal.
+var resizeSignals = []os.Signal{syscall.SIGWINCH}
+
+// ioctl performs an ioctl on a file descriptor with a pointer argument.
+func ioctl(fd int, req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// makeRaw puts the terminal on a file descriptor into raw mode, so that keys are read as they are pressed,
+// without echo or signal generation, and returns a function that restores its previous mode. Output
+// processing is left enabled, so newlines still return the cursor to the start of the line.
+func makeRaw(fd int) (func(), error) {
+	var orig syscall.Termios
+	err := ioctl(fd, ioctlGetTermios, unsafe.Pointer(&orig))
+	if err != nil {
+		return nil, err
+	}
+	raw := orig
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR |
+		syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	err = ioctl(fd, ioctlSetTermios, unsafe.Pointer(&raw))
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		ioctl(fd, ioctlSetTermios, unsafe.Pointer(&orig))
+	}, nil
+}
+
+// terminalSize returns the width and height of the terminal on a file descriptor, in characters.
+func terminalSize(fd int) (int, int, error) {
+	var ws struct {
+		rows, cols, xpixel, ypixel uint16
+	}
+	err := ioctl(fd, syscall.TIOCGWINSZ, unsafe.Pointer(&ws))
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(ws.cols), int(ws.rows), nil
+}
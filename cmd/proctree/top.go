@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sammck-go/proctree"
+	flag "github.com/spf13/pflag"
+)
+
+// formatSize formats a size in bytes with a binary unit suffix, e.g., "12.5M".
+func formatSize(n uint64) string {
+	units := "KMGTPE"
+	if n < 1024 {
+		return fmt.Sprintf("%dB", n)
+	}
+	size := float64(n) / 1024
+	i := 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%c", size, units[i])
+}
+
+// topSorts are the keys that may be supplied to top --sort, with functions that order samples by them.
+var topSorts = map[string]func(a, b *proctree.UsageSample) bool{
+	"cpu": func(a, b *proctree.UsageSample) bool {
+		if a.CPURate != b.CPURate {
+			return a.CPURate > b.CPURate
+		}
+		return a.Usage.CPUTime > b.Usage.CPUTime
+	},
+	"mem": func(a, b *proctree.UsageSample) bool {
+		return a.Usage.RSS > b.Usage.RSS
+	},
+}
+
+// writeTop writes a table of the heaviest processes in a sample.
+func writeTop(buf *bytes.Buffer, samples []proctree.UsageSample, less func(a, b *proctree.UsageSample) bool,
+	count int) {
+	sort.SliceStable(samples, func(i, j int) bool {
+		return less(&samples[i], &samples[j])
+	})
+	if len(samples) > count {
+		samples = samples[:count]
+	}
+	tw := tabwriter.NewWriter(buf, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "PID\t%CPU\tTIME\tRSS\tTHREADS\tEXECUTABLE")
+	for _, sample := range samples {
+		fmt.Fprintf(tw, "%d\t%.1f\t%s\t%s\t%d\t%s\n", sample.Process.Pid(), 100*sample.CPURate,
+			sample.Usage.CPUTime.Round(10*time.Millisecond), formatSize(sample.Usage.RSS), sample.Usage.Threads,
+			sample.Process.Executable())
+	}
+	tw.Flush()
+}
+
+// runTop runs the top subcommand, which shows the processes of a subtree that use the most CPU or memory,
+// refreshed at an interval until interrupted.
+func runTop(args []string) int {
+	fs := flag.NewFlagSet("top", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s top [--root <pid>] [<option>...]\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "Show the processes that use the most CPU or memory, refreshed at an interval.\n")
+		fmt.Fprintf(os.Stderr, "%%CPU is the percentage of one CPU used since the previous refresh.\n\n")
+		fmt.Fprintln(os.Stderr, "Options:")
+
+		fs.PrintDefaults()
+	}
+
+	rootPid := 0
+	interval := 2 * time.Second
+	sortKey := "cpu"
+	count := 20
+	once := false
+	fs.IntVarP(&rootPid, "root", "r", 0, "Provides the pid of the root of the subtree to show. By default, all\nprocesses are shown.")
+	fs.DurationVarP(&interval, "interval", "i", interval, "Provides the interval at which the processes are refreshed.")
+	fs.StringVarP(&sortKey, "sort", "s", sortKey, "Rank processes by cpu or mem.")
+	fs.IntVarP(&count, "count", "n", count, "Provides the number of processes to show.")
+	fs.BoolVar(&once, "once", false, "Print the processes once, after a single interval, and exit.")
+
+	err := parseFlags(fs, args)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+	if len(fs.Args()) != 0 {
+		fmt.Fprintln(os.Stderr, "proctree: Too many command line arguments")
+		fmt.Fprintln(os.Stderr)
+		fs.Usage()
+		return 1
+	}
+	if interval <= 0 {
+		fmt.Fprintf(os.Stderr, "proctree: Invalid interval %s supplied to --interval\n", interval)
+		return 1
+	}
+	less, ok := topSorts[sortKey]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "proctree: Invalid key \"%s\" supplied to --sort\n", sortKey)
+		return 1
+	}
+
+	cfg := proctree.NewConfig()
+	if rootPid > 0 {
+		cfg = cfg.Refine(proctree.WithRootPid(rootPid))
+	}
+	pt, err := proctree.New(proctree.WithConfig(cfg))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "proctree: Could not build process tree: ", err)
+		return 1
+	}
+	defer pt.Close()
+
+	sampler := pt.NewUsageSampler()
+	// The first sample has no CPU rates, so it is not shown
+	_, err = sampler.Sample()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctree: %s\n", err)
+		return 1
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sigs:
+			return 0
+		case now := <-ticker.C:
+			err = pt.Update(true)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "proctree: Unable to update process tree: ", err)
+				return 1
+			}
+			samples, err := sampler.Sample()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "proctree: %s\n", err)
+				return 1
+			}
+			var buf bytes.Buffer
+			if !once {
+				buf.WriteString(clearScreen)
+				fmt.Fprintf(&buf, "Every %s: proctree top\t%s\n\n", interval, now.Format(time.RFC1123))
+			}
+			writeTop(&buf, samples, less, count)
+			os.Stdout.Write(buf.Bytes())
+			if once {
+				return 0
+			}
+		}
+	}
+}
@@ -0,0 +1,629 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sammck-go/proctree"
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	// enterAltScreen switches to the terminal's alternate screen and hides the cursor.
+	enterAltScreen = "\x1b[?1049h\x1b[?25l"
+
+	// exitAltScreen shows the cursor and returns to the terminal's normal screen.
+	exitAltScreen = "\x1b[?25h\x1b[?1049l"
+
+	// highlightSelected is the terminal escape sequence that highlights the selected process (reverse video).
+	highlightSelected = "\x1b[7m"
+
+	// clearToEOL clears the rest of the current line.
+	clearToEOL = "\x1b[K"
+
+	// tuiHelp is the key summary shown on the status line.
+	tuiHelp = "q quit  ↑↓ move  ←→ collapse/expand  / search  n/N next/prev  t TERM  K KILL  I INT  H HUP"
+)
+
+// escapeKeys maps the terminal escape sequences of special keys to key names.
+var escapeKeys = map[string]string{
+	"\x1b[A":  "up",
+	"\x1b[B":  "down",
+	"\x1b[C":  "right",
+	"\x1b[D":  "left",
+	"\x1bOA":  "up",
+	"\x1bOB":  "down",
+	"\x1bOC":  "right",
+	"\x1bOD":  "left",
+	"\x1b[H":  "home",
+	"\x1b[F":  "end",
+	"\x1bOH":  "home",
+	"\x1bOF":  "end",
+	"\x1b[1~": "home",
+	"\x1b[4~": "end",
+	"\x1b[5~": "pgup",
+	"\x1b[6~": "pgdn",
+}
+
+// tuiSignals maps the keys that signal the selected subtree to the signals that they send.
+var tuiSignals = map[string]syscall.Signal{
+	"t": syscall.SIGTERM,
+	"K": syscall.SIGKILL,
+	"I": syscall.SIGINT,
+	"H": syscall.SIGHUP,
+}
+
+// parseKeys splits a chunk of terminal input into key names. Special keys are named as in escapeKeys, and
+// "esc", "enter", "backspace", "tab" and "ctrl-c"; other keys are named by the character that they type.
+// Unrecognized escape sequences are skipped.
+func parseKeys(b []byte) []string {
+	keys := []string{}
+	for len(b) > 0 {
+		switch {
+		case b[0] == 0x1b && len(b) == 1:
+			keys = append(keys, "esc")
+			b = b[1:]
+		case b[0] == 0x1b && (b[1] == '[' || b[1] == 'O'):
+			// A control sequence ends with a byte in the range 0x40 to 0x7e
+			n := 2
+			for n < len(b) && (b[n] < 0x40 || b[n] > 0x7e) {
+				n++
+			}
+			if n < len(b) {
+				n++
+			}
+			key, ok := escapeKeys[string(b[:n])]
+			if ok {
+				keys = append(keys, key)
+			}
+			b = b[n:]
+		case b[0] == 0x1b:
+			keys = append(keys, "esc")
+			b = b[1:]
+		case b[0] == '\r' || b[0] == '\n':
+			keys = append(keys, "enter")
+			b = b[1:]
+		case b[0] == 0x7f || b[0] == 0x08:
+			keys = append(keys, "backspace")
+			b = b[1:]
+		case b[0] == '\t':
+			keys = append(keys, "tab")
+			b = b[1:]
+		case b[0] == 0x03:
+			keys = append(keys, "ctrl-c")
+			b = b[1:]
+		case b[0] < 0x20:
+			b = b[1:]
+		default:
+			r, n := utf8.DecodeRune(b)
+			keys = append(keys, string(r))
+			b = b[n:]
+		}
+	}
+	return keys
+}
+
+// signalName returns the name of a signal with the "SIG" prefix, e.g., "SIGTERM".
+func signalName(sig syscall.Signal) string {
+	for name, s := range signalNames {
+		if s == sig {
+			return "SIG" + name
+		}
+	}
+	return "signal " + strconv.Itoa(int(sig))
+}
+
+// truncate returns a string shortened to at most width characters.
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	if width <= 0 {
+		return ""
+	}
+	return string([]rune(s)[:width])
+}
+
+// tuiRow is a line of the interactive tree view.
+type tuiRow struct {
+	// proc is the Process shown by the row.
+	proc *proctree.Process
+
+	// prefix is the line art that precedes the Process's label.
+	prefix string
+
+	// hasChildren is true if the Process has children, whether or not they are shown.
+	hasChildren bool
+
+	// hidden is the number of descendants hidden because the Process is collapsed.
+	hidden int
+}
+
+// pendingSignal is a signal waiting to be confirmed before it is sent to a subtree.
+type pendingSignal struct {
+	sig  syscall.Signal
+	root *proctree.Process
+	pids []int
+}
+
+// tui is the state of the interactive tree view.
+type tui struct {
+	pt        *proctree.ProcTree
+	rows      []tuiRow
+	total     int
+	updated   time.Time
+	collapsed map[*proctree.Process]bool
+	selected  *proctree.Process
+	cursor    int
+	offset    int
+	width     int
+	height    int
+
+	// searching is true while a search is being typed, starting from searchOrigin.
+	searching    bool
+	search       string
+	searchOrigin *proctree.Process
+
+	pending *pendingSignal
+	message string
+}
+
+// rebuild rederives the visible rows from the tree, keeping the selected Process selected if it is still
+// visible.
+func (t *tui) rebuild() {
+	for proc := range t.collapsed {
+		if t.pt.PidProcess(proc.Pid()) != proc {
+			delete(t.collapsed, proc)
+		}
+	}
+	t.rows = t.rows[:0]
+	t.total = 0
+	var add func(proc *proctree.Process, prefix, indent string)
+	add = func(proc *proctree.Process, prefix, indent string) {
+		children := proc.Children()
+		row := tuiRow{proc: proc, prefix: prefix, hasChildren: len(children) > 0}
+		if t.collapsed[proc] {
+			row.hidden = proc.SubtreeCount() - 1
+			t.rows = append(t.rows, row)
+			return
+		}
+		t.rows = append(t.rows, row)
+		for i, child := range children {
+			if i == len(children)-1 {
+				add(child, indent+"└── ", indent+"    ")
+			} else {
+				add(child, indent+"├── ", indent+"│   ")
+			}
+		}
+	}
+	for _, root := range t.pt.Roots() {
+		t.total += root.SubtreeCount()
+		add(root, "", "")
+	}
+
+	for i, row := range t.rows {
+		if row.proc == t.selected {
+			t.cursor = i
+			return
+		}
+	}
+	t.moveTo(t.cursor)
+}
+
+// moveTo selects the row at an index, clamped to the visible rows.
+func (t *tui) moveTo(i int) {
+	if i >= len(t.rows) {
+		i = len(t.rows) - 1
+	}
+	if i < 0 {
+		i = 0
+	}
+	t.cursor = i
+	t.selected = nil
+	if i < len(t.rows) {
+		t.selected = t.rows[i].proc
+	}
+}
+
+// selectProc selects a Process, expanding its ancestors so that it is visible.
+func (t *tui) selectProc(proc *proctree.Process) {
+	for ancestor := proc.Parent(); ancestor != nil; ancestor = ancestor.Parent() {
+		delete(t.collapsed, ancestor)
+	}
+	t.selected = proc
+	t.rebuild()
+}
+
+// listHeight returns the number of rows that fit between the header and status lines.
+func (t *tui) listHeight() int {
+	if t.height < 3 {
+		return 1
+	}
+	return t.height - 2
+}
+
+// matches returns true if a Process matches the search text, by executable name or pid.
+func (t *tui) matches(proc *proctree.Process) bool {
+	if t.search == "" {
+		return false
+	}
+	return strings.Contains(strings.ToLower(proc.Executable()), strings.ToLower(t.search)) ||
+		strings.HasPrefix(strconv.Itoa(proc.Pid()), t.search)
+}
+
+// find selects the next Process in tree order, including collapsed Processes, that matches the search text,
+// starting at start, or after it if skipStart is true, and wrapping around. Searches backwards if forward is
+// false.
+func (t *tui) find(start *proctree.Process, skipStart bool, forward bool) {
+	procs := []*proctree.Process{}
+	t.pt.Walk(func(proc *proctree.Process) error {
+		procs = append(procs, proc)
+		return nil
+	})
+	first := 0
+	for i, proc := range procs {
+		if proc == start {
+			first = i
+		}
+	}
+	step := 1
+	if !forward {
+		step = len(procs) - 1
+	}
+	if skipStart {
+		first += step
+	}
+	for n := 0; n < len(procs); n++ {
+		proc := procs[(first+n*step)%len(procs)]
+		if t.matches(proc) {
+			t.selectProc(proc)
+			t.message = ""
+			return
+		}
+	}
+	t.message = fmt.Sprintf("No process matches %q", t.search)
+}
+
+// signalSubtree sends a confirmed signal to each process of a subtree that is still alive, leaves first.
+func (t *tui) signalSubtree(p *pendingSignal) {
+	failed := 0
+	var lastErr error
+	for i := len(p.pids) - 1; i >= 0; i-- {
+		proc, err := os.FindProcess(p.pids[i])
+		if err == nil {
+			err = proc.Signal(p.sig)
+		}
+		if err != nil {
+			failed++
+			lastErr = err
+		}
+	}
+	t.message = fmt.Sprintf("Sent %s to %d processes", signalName(p.sig), len(p.pids)-failed)
+	if failed > 0 {
+		t.message += fmt.Sprintf("; %d failed: %s", failed, lastErr)
+	}
+}
+
+// handleKey applies a key press. Returns false if the view should exit.
+func (t *tui) handleKey(key string) bool {
+	if key == "ctrl-c" {
+		return false
+	}
+	if t.pending != nil {
+		if key == "y" || key == "Y" {
+			t.signalSubtree(t.pending)
+			t.update()
+		} else {
+			t.message = "Cancelled"
+		}
+		t.pending = nil
+		return true
+	}
+	if t.searching {
+		switch key {
+		case "enter":
+			t.searching = false
+		case "esc":
+			t.searching = false
+			t.search = ""
+			t.message = ""
+			if t.searchOrigin != nil {
+				t.selectProc(t.searchOrigin)
+			}
+		case "backspace":
+			if t.search != "" {
+				_, n := utf8.DecodeLastRuneInString(t.search)
+				t.search = t.search[:len(t.search)-n]
+				t.find(t.searchOrigin, false, true)
+			}
+		default:
+			if utf8.RuneCountInString(key) == 1 {
+				t.search += key
+				t.find(t.searchOrigin, false, true)
+			}
+		}
+		return true
+	}
+
+	t.message = ""
+	var row *tuiRow
+	if t.cursor < len(t.rows) {
+		row = &t.rows[t.cursor]
+	}
+	switch key {
+	case "q":
+		return false
+	case "up", "k":
+		t.moveTo(t.cursor - 1)
+	case "down", "j":
+		t.moveTo(t.cursor + 1)
+	case "pgup":
+		t.moveTo(t.cursor - t.listHeight())
+	case "pgdn":
+		t.moveTo(t.cursor + t.listHeight())
+	case "home", "g":
+		t.moveTo(0)
+	case "end", "G":
+		t.moveTo(len(t.rows) - 1)
+	case "left", "h":
+		if row == nil {
+			break
+		}
+		if row.hasChildren && !t.collapsed[row.proc] {
+			t.collapsed[row.proc] = true
+			t.rebuild()
+		} else if parent := row.proc.Parent(); parent != nil {
+			t.selectProc(parent)
+		}
+	case "right", "l":
+		if row == nil {
+			break
+		}
+		if t.collapsed[row.proc] {
+			delete(t.collapsed, row.proc)
+			t.rebuild()
+		} else if row.hasChildren {
+			t.moveTo(t.cursor + 1)
+		}
+	case "enter", " ":
+		if row != nil && row.hasChildren {
+			if t.collapsed[row.proc] {
+				delete(t.collapsed, row.proc)
+			} else {
+				t.collapsed[row.proc] = true
+			}
+			t.rebuild()
+		}
+	case "/":
+		t.searching = true
+		t.search = ""
+		t.searchOrigin = t.selected
+	case "n", "N":
+		if t.search != "" && t.selected != nil {
+			t.find(t.selected, true, key == "n")
+		}
+	case "r":
+		t.update()
+	default:
+		sig, ok := tuiSignals[key]
+		if ok && row != nil {
+			pids := []int{}
+			row.proc.WalkSubtree(func(proc *proctree.Process) error {
+				pids = append(pids, proc.Pid())
+				return nil
+			})
+			t.pending = &pendingSignal{sig: sig, root: row.proc, pids: pids}
+		}
+	}
+	return true
+}
+
+// update refreshes the tree from the system and rebuilds the rows.
+func (t *tui) update() {
+	err := t.pt.Update(true)
+	if err != nil {
+		t.message = fmt.Sprintf("Unable to update process tree: %s", err)
+	}
+	t.updated = time.Now()
+	t.rebuild()
+}
+
+// statusLine returns the text of the bottom line of the view.
+func (t *tui) statusLine() string {
+	switch {
+	case t.searching:
+		return "/" + t.search
+	case t.pending != nil:
+		return fmt.Sprintf("Send %s to %d processes in the subtree of [%d] %s? (y/n)", signalName(t.pending.sig),
+			len(t.pending.pids), t.pending.root.Pid(), t.pending.root.Executable())
+	case t.message != "":
+		return t.message
+	default:
+		return tuiHelp
+	}
+}
+
+// draw writes the view to the terminal.
+func (t *tui) draw() {
+	height := t.listHeight()
+	if t.cursor < t.offset {
+		t.offset = t.cursor
+	}
+	if t.cursor >= t.offset+height {
+		t.offset = t.cursor - height + 1
+	}
+	if t.offset > 0 && t.offset > len(t.rows)-height {
+		t.offset = len(t.rows) - height
+		if t.offset < 0 {
+			t.offset = 0
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("\x1b[H")
+	header := fmt.Sprintf("proctree  %d processes  updated %s", t.total, t.updated.Format("15:04:05"))
+	buf.WriteString(truncate(header, t.width) + clearToEOL + "\r\n")
+	for i := t.offset; i < t.offset+height; i++ {
+		if i < len(t.rows) {
+			row := t.rows[i]
+			line := fmt.Sprintf("%s[%d]  %s", row.prefix, row.proc.Pid(), row.proc.Executable())
+			if row.hidden > 0 {
+				line += fmt.Sprintf(" (+%d)", row.hidden)
+			}
+			line = truncate(line, t.width)
+			if i == t.cursor {
+				line = highlightSelected + line + strings.Repeat(" ", t.width-utf8.RuneCountInString(line)) +
+					highlightReset
+			} else if t.matches(row.proc) {
+				line = highlightStarted + line + highlightReset
+			}
+			buf.WriteString(line)
+		}
+		buf.WriteString(clearToEOL + "\r\n")
+	}
+	buf.WriteString(truncate(t.statusLine(), t.width) + clearToEOL)
+	os.Stdout.Write(buf.Bytes())
+}
+
+// resize reads the size of the terminal.
+func (t *tui) resize() {
+	width, height, err := terminalSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		width, height = 80, 24
+	}
+	t.width, t.height = width, height
+}
+
+// runTUI runs the tui subcommand, which shows an interactive tree view.
+func runTUI(args []string) int {
+	fs := flag.NewFlagSet("tui", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s tui [<option>...]\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "Show an interactive, continuously updated process tree. Subtrees can be\n")
+		fmt.Fprintf(os.Stderr, "collapsed and expanded, searched by name or pid, and sent signals.\n\n")
+		fmt.Fprintln(os.Stderr, "Keys:")
+		tw := tabwriter.NewWriter(os.Stderr, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "  ↑/↓, j/k, PgUp/PgDn, Home/End\tMove the selection")
+		fmt.Fprintln(tw, "  ←/h, →/l, Enter, Space\tCollapse or expand the selected process")
+		fmt.Fprintln(tw, "  /, n, N\tSearch by name or pid, and find the next or previous match")
+		fmt.Fprintln(tw, "  t, K, I, H\tSend SIGTERM, SIGKILL, SIGINT or SIGHUP to the selected subtree")
+		fmt.Fprintln(tw, "  r\tRefresh now")
+		fmt.Fprintln(tw, "  q, Ctrl-C\tQuit")
+		tw.Flush()
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Options:")
+
+		fs.PrintDefaults()
+	}
+
+	rootPids := []int{}
+	includeKernelThreads := false
+	sortKey := "pid"
+	interval := 2 * time.Second
+	fs.IntSliceVarP(&rootPids, "root", "r", []int{}, "Provides a pid to use as a root of the tree. May be repeated.\nBy default, all orphaned processes are roots.")
+	fs.BoolVarP(&includeKernelThreads, "include-kernel-threads", "k", false, "Include kernel threads. Disabled by default.")
+	fs.StringVarP(&sortKey, "sort", "s", sortKey, "Order the children of each process by one of pid, name, start, cpu or mem.")
+	fs.DurationVarP(&interval, "interval", "i", interval, "Provides the interval at which the tree is refreshed.")
+
+	err := parseFlags(fs, args)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+	if len(fs.Args()) != 0 {
+		fmt.Fprintln(os.Stderr, "proctree: Too many command line arguments")
+		fmt.Fprintln(os.Stderr)
+		fs.Usage()
+		return 1
+	}
+	if interval <= 0 {
+		fmt.Fprintf(os.Stderr, "proctree: Invalid interval %s supplied to --interval\n", interval)
+		return 1
+	}
+	order, ok := childOrders[sortKey]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "proctree: Invalid key \"%s\" supplied to --sort\n", sortKey)
+		return 1
+	}
+
+	cfg := proctree.NewConfig(proctree.WithChildSort(order))
+	for _, pid := range uniquePids(rootPids) {
+		cfg = cfg.Refine(proctree.WithRootPid(pid))
+	}
+	if includeKernelThreads {
+		cfg = cfg.Refine(proctree.WithKernelThreads())
+	}
+	pt, err := proctree.New(proctree.WithConfig(cfg))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "proctree: Could not build process tree: ", err)
+		return 1
+	}
+	defer pt.Close()
+
+	restore, err := makeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proctree: Unable to use the terminal interactively: %s\n", err)
+		return 1
+	}
+	defer restore()
+	os.Stdout.WriteString(enterAltScreen)
+	defer os.Stdout.WriteString(exitAltScreen)
+
+	keys := make(chan []byte)
+	go func() {
+		for {
+			buf := make([]byte, 64)
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- buf[:n]
+		}
+	}()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+	resized := make(chan os.Signal, 1)
+	if len(resizeSignals) > 0 {
+		signal.Notify(resized, resizeSignals...)
+		defer signal.Stop(resized)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	t := &tui{pt: pt, collapsed: make(map[*proctree.Process]bool), updated: time.Now()}
+	t.resize()
+	t.rebuild()
+	for {
+		t.draw()
+		select {
+		case b, ok := <-keys:
+			if !ok {
+				return 0
+			}
+			for _, key := range parseKeys(b) {
+				if !t.handleKey(key) {
+					return 0
+				}
+			}
+		case <-ticker.C:
+			t.update()
+		case <-resized:
+			t.resize()
+		case <-sigs:
+			return 0
+		}
+	}
+}
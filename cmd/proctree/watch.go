@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sammck-go/proctree"
+)
+
+const (
+	// highlightStarted is the terminal escape sequence that highlights recently started processes (bold green).
+	highlightStarted = "\x1b[1;32m"
+
+	// highlightExited is the terminal escape sequence that highlights recently exited processes (faint and
+	// struck through).
+	highlightExited = "\x1b[2;9m"
+
+	// highlightReset ends a highlight.
+	highlightReset = "\x1b[0m"
+
+	// clearScreen moves the cursor home and clears the terminal.
+	clearScreen = "\x1b[H\x1b[2J"
+
+	// watchFadeIntervals is the number of refreshes for which started and exited processes are highlighted.
+	watchFadeIntervals = 3
+)
+
+// watch redraws the tree every interval until interrupted, with the provided render options. Processes that started or exited in the last few
+// refreshes are highlighted, and exited processes are removed once they have faded.
+func watch(pt *proctree.ProcTree, interval time.Duration, renderOpts []proctree.RenderOption) int {
+	sub, err := pt.Subscribe()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "proctree: Unable to watch process tree: ", err)
+		return 1
+	}
+	defer sub.Close()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	fade := watchFadeIntervals * interval
+	started := make(map[*proctree.Process]time.Time)
+	exited := make(map[*proctree.Process]time.Time)
+	decorate := func(proc *proctree.Process, label string) string {
+		if _, ok := exited[proc]; ok {
+			return highlightExited + label + highlightReset
+		}
+		if _, ok := started[proc]; ok {
+			return highlightStarted + label + highlightReset
+		}
+		return label
+	}
+
+	for {
+		now := time.Now()
+		for proc, t := range started {
+			if now.Sub(t) >= fade {
+				delete(started, proc)
+			}
+		}
+		// Tombstones can only be pruned together, so they are all pruned once the oldest has faded
+		for _, t := range exited {
+			if now.Sub(t) >= fade {
+				err = pt.Update(true)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "proctree: Unable to update process tree: ", err)
+					return 1
+				}
+				exited = make(map[*proctree.Process]time.Time)
+				break
+			}
+		}
+
+		var buf bytes.Buffer
+		buf.WriteString(clearScreen)
+		fmt.Fprintf(&buf, "Every %s: proctree\t%s\n\n", interval, now.Format(time.RFC1123))
+		err = pt.Render(&buf, append(renderOpts, proctree.WithLabelDecorator(decorate))...)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "proctree: Unable to print tree: ", err)
+			return 1
+		}
+		os.Stdout.Write(buf.Bytes())
+
+	wait:
+		for {
+			select {
+			case ev, ok := <-sub.Events():
+				if !ok {
+					return 0
+				}
+				switch ev.Type {
+				case proctree.ProcessStarted:
+					started[ev.Process] = ev.Time
+				case proctree.ProcessExited:
+					delete(started, ev.Process)
+					exited[ev.Process] = ev.Time
+				}
+			case <-ticker.C:
+				break wait
+			case <-sigs:
+				return 0
+			}
+		}
+	}
+}
@@ -1,5 +1,14 @@
 package proctree
 
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
 // Config provides configuration options for contruction of a ProcTree.  The constructed object is immutable
 // after it is constructed by NewConfig.
 type Config struct {
@@ -14,6 +23,115 @@ type Config struct {
 	// rootPids list a list of pids to use as roots of the process tree. If omitted, all orphaned processes are
 	// used as roots.
 	rootPids []int
+
+	// rootExecutables maps pids in rootPids that were configured with WithRootPidExecutable to the executable
+	// name that the process with the pid must have to become a root.
+	rootExecutables map[int]string
+
+	// lenientRoots causes configured roots that do not exist yet to be resolved by a later update, rather than
+	// failing New, AddRoot or Reconfigure.
+	lenientRoots bool
+
+	// rootPidFiles are the paths of pid files whose pids are added to rootPids by updates.
+	rootPidFiles []string
+
+	// selfRootPids is the subset of rootPids that were configured with WithRootSelf or WithRootParent. Processes
+	// descended from them through original parent links remain included after they are reparented.
+	selfRootPids []int
+
+	// namespaceRootPids are pids whose PID namespace's init process is to be added to rootPids when the
+	// configuration is applied.
+	namespaceRootPids []int
+
+	// subreaper enables child-subreaper mode, in which the calling process adopts orphaned descendants and
+	// reaps them when they terminate. Only supported on Linux.
+	subreaper bool
+
+	// ownedRootPids is the subset of rootPids whose subtrees are owned by the ProcTree, and are terminated
+	// when it is closed.
+	ownedRootPids []int
+
+	// gracePeriod is the time that owned subtrees are given to exit after SIGTERM, before they are sent SIGKILL.
+	gracePeriod time.Duration
+
+	// closeCtx, if not nil, causes the ProcTree to be closed when the context is done.
+	closeCtx context.Context
+
+	// autoUpdateInterval, if nonzero, is the interval at which a background goroutine updates the ProcTree.
+	autoUpdateInterval time.Duration
+
+	// autoUpdatePruneTombstones causes background updates to prune tombstones.
+	autoUpdatePruneTombstones bool
+
+	// tombstoneMaxAge, if nonzero, is the time after which tombstones are pruned by updates that do not prune
+	// all tombstones.
+	tombstoneMaxAge time.Duration
+
+	// tombstoneMaxCount, if nonzero, is the maximum number of tombstones kept by updates that do not prune all
+	// tombstones.
+	tombstoneMaxCount int
+
+	// realtimeMonitor enables a platform-specific real-time backend that triggers updates as soon as processes
+	// are created, exec'd or exit.
+	realtimeMonitor bool
+
+	// ebpfMonitor enables the eBPF real-time backend, which also captures command lines and exit codes of
+	// short-lived processes.
+	ebpfMonitor bool
+
+	// updateHooks are called after each update, with a summary of the update.
+	updateHooks []UpdateHook
+
+	// filters must all accept a Process for it to be included.
+	filters []ProcessFilter
+
+	// filterMode determines whether a Process rejected by a filter is excluded alone, or with its subtree.
+	filterMode FilterMode
+
+	// childOrder determines the order of each Process's child lists.
+	childOrder ChildOrder
+
+	// maxDepth, if not negative, is the maximum depth of included Processes below each included root.
+	maxDepth int
+
+	// excludeSubtreePids is a list of pids whose subtrees are excluded, even if they descend from a root.
+	excludeSubtreePids []int
+
+	// excludeSubtreeExecutables is a list of executable name glob patterns. The subtree of every Process whose
+	// executable name matches one of the patterns is excluded, even if it descends from a root.
+	excludeSubtreeExecutables []string
+
+	// metadataTTL is the time for which metadata read from the system is cached. 0 disables caching, and a
+	// negative value caches metadata until the Process execs.
+	metadataTTL time.Duration
+
+	// metadataFields lists the metadata fields that may be read from the system. nil allows every field.
+	metadataFields []MetadataField
+
+	// metadataPrefetch lists the metadata fields that are read for every live included Process by each update.
+	metadataPrefetch []MetadataField
+
+	// metadataWorkers is the maximum number of processes whose metadata is read concurrently by an update.
+	metadataWorkers int
+
+	// source lists the processes in the tree. If it is nil, the processes on the local system are listed.
+	source ProcessSource
+
+	// clock is the source of the current time. If it is nil, the system's clock is used.
+	clock Clock
+
+	// procfsPath is the directory at which procfs is mounted. Only used on Linux.
+	procfsPath string
+
+	// containerResolver looks up the names and images of containers, if it is not nil.
+	containerResolver ContainerResolver
+
+	// podResolver looks up the names of pods and their containers, if it is not nil.
+	podResolver PodResolver
+
+	// logger receives debug and trace logs of updates, event dispatch and manipulation operations, if it is not
+	// nil.
+	logger logger
 }
 
 // ConfigOption is an opaque configuration option setter created by one of the With functions.
@@ -23,15 +141,53 @@ type ConfigOption func(*Config)
 const (
 	defaultIncludeKernelThreads = false
 	defaultIncludeRootAncestors = false
+	defaultSubreaper            = false
+	defaultGracePeriod          = 5 * time.Second
+	defaultRealtimeMonitor      = false
+	defaultEBPFMonitor          = false
+	defaultFilterMode           = FilterProcess
+	defaultMaxDepth             = -1
+	defaultChildOrder           = ByPid
+	defaultMetadataTTL          = 5 * time.Second
+	defaultMetadataWorkers      = 8
 )
 
 // NewConfig creates a proctree Config object from provided options. The resulting object
 // can be passed to New using WithConfig.
 func NewConfig(opts ...ConfigOption) *Config {
 	cfg := &Config{
-		includeKernelThreads: defaultIncludeKernelThreads,
-		includeRootAncestors: defaultIncludeRootAncestors,
-		rootPids:             []int{},
+		includeKernelThreads:      defaultIncludeKernelThreads,
+		includeRootAncestors:      defaultIncludeRootAncestors,
+		rootPids:                  []int{},
+		rootExecutables:           map[int]string{},
+		lenientRoots:              false,
+		rootPidFiles:              []string{},
+		selfRootPids:              []int{},
+		namespaceRootPids:         []int{},
+		subreaper:                 defaultSubreaper,
+		ownedRootPids:             []int{},
+		gracePeriod:               defaultGracePeriod,
+		closeCtx:                  nil,
+		autoUpdateInterval:        0,
+		autoUpdatePruneTombstones: false,
+		tombstoneMaxAge:           0,
+		tombstoneMaxCount:         0,
+		realtimeMonitor:           defaultRealtimeMonitor,
+		ebpfMonitor:               defaultEBPFMonitor,
+		updateHooks:               []UpdateHook{},
+		filters:                   []ProcessFilter{},
+		filterMode:                defaultFilterMode,
+		maxDepth:                  defaultMaxDepth,
+		childOrder:                defaultChildOrder,
+		excludeSubtreePids:        []int{},
+		excludeSubtreeExecutables: []string{},
+		metadataTTL:               defaultMetadataTTL,
+		metadataPrefetch:          []MetadataField{},
+		metadataWorkers:           defaultMetadataWorkers,
+		procfsPath:                string(defaultProcfs),
+		containerResolver:         DockerResolver(defaultDockerSocket),
+		podResolver:               PodLogResolver(defaultPodLogDir),
+		logger:                    nil,
 	}
 
 	for _, opt := range opts {
@@ -41,8 +197,55 @@ func NewConfig(opts ...ConfigOption) *Config {
 	return cfg
 }
 
+// ChildOrder determines the order in which the children of each Process are listed (see WithChildSort).
+type ChildOrder int
+
+const (
+	// ByPid orders children in ascending pid order.
+	ByPid ChildOrder = iota
+
+	// ByStartTime orders children in the order in which they started, which reflects the actual spawn sequence
+	// even after pids wrap around. Start times are only available on Linux; children with unknown start times
+	// are ordered by pid after the others.
+	ByStartTime
+
+	// ByExecutable orders children by executable name, and then by pid.
+	ByExecutable
+
+	// ByCPUTime orders children by the CPU time that they have consumed, most first, and then by pid. CPU time is
+	// read for every process by each update, which makes updates slower, and is only available when processes
+	// are listed from the local system on Linux, macOS and Windows.
+	ByCPUTime
+
+	// ByMemory orders children by resident set size, largest first, and then by pid. As with ByCPUTime, it is
+	// read for every process by each update.
+	ByMemory
+)
+
+// readsUsage returns true if the order requires the resource usage of every process to be read by each update.
+func (o ChildOrder) readsUsage() bool {
+	return o == ByCPUTime || o == ByMemory
+}
+
+func (o ChildOrder) String() string {
+	switch o {
+	case ByPid:
+		return "ByPid"
+	case ByStartTime:
+		return "ByStartTime"
+	case ByExecutable:
+		return "ByExecutable"
+	case ByCPUTime:
+		return "ByCPUTime"
+	case ByMemory:
+		return "ByMemory"
+	default:
+		return "ChildOrder(unknown)"
+	}
+}
+
 // WithConfig allows initialization of a new configuration object starting with an existing one,
-// and incremental initialization of configuration separately from initialization of the PidFile.
+// and incremental initialization of configuration separately from construction of the ProcTree.
 // If provided, this option should be appear first in the option list, since it replaces all
 // configuration values.
 func WithConfig(other *Config) ConfigOption {
@@ -51,6 +254,54 @@ func WithConfig(other *Config) ConfigOption {
 		cfg.includeRootAncestors = other.includeRootAncestors
 		cfg.rootPids = make([]int, len(other.rootPids))
 		copy(cfg.rootPids, other.rootPids)
+		cfg.rootExecutables = make(map[int]string, len(other.rootExecutables))
+		for pid, executable := range other.rootExecutables {
+			cfg.rootExecutables[pid] = executable
+		}
+		cfg.lenientRoots = other.lenientRoots
+		cfg.rootPidFiles = make([]string, len(other.rootPidFiles))
+		copy(cfg.rootPidFiles, other.rootPidFiles)
+		cfg.selfRootPids = make([]int, len(other.selfRootPids))
+		copy(cfg.selfRootPids, other.selfRootPids)
+		cfg.namespaceRootPids = make([]int, len(other.namespaceRootPids))
+		copy(cfg.namespaceRootPids, other.namespaceRootPids)
+		cfg.subreaper = other.subreaper
+		cfg.ownedRootPids = make([]int, len(other.ownedRootPids))
+		copy(cfg.ownedRootPids, other.ownedRootPids)
+		cfg.gracePeriod = other.gracePeriod
+		cfg.closeCtx = other.closeCtx
+		cfg.autoUpdateInterval = other.autoUpdateInterval
+		cfg.autoUpdatePruneTombstones = other.autoUpdatePruneTombstones
+		cfg.tombstoneMaxAge = other.tombstoneMaxAge
+		cfg.tombstoneMaxCount = other.tombstoneMaxCount
+		cfg.realtimeMonitor = other.realtimeMonitor
+		cfg.ebpfMonitor = other.ebpfMonitor
+		cfg.updateHooks = make([]UpdateHook, len(other.updateHooks))
+		copy(cfg.updateHooks, other.updateHooks)
+		cfg.filters = make([]ProcessFilter, len(other.filters))
+		copy(cfg.filters, other.filters)
+		cfg.filterMode = other.filterMode
+		cfg.maxDepth = other.maxDepth
+		cfg.childOrder = other.childOrder
+		cfg.excludeSubtreePids = make([]int, len(other.excludeSubtreePids))
+		copy(cfg.excludeSubtreePids, other.excludeSubtreePids)
+		cfg.excludeSubtreeExecutables = make([]string, len(other.excludeSubtreeExecutables))
+		copy(cfg.excludeSubtreeExecutables, other.excludeSubtreeExecutables)
+		cfg.metadataTTL = other.metadataTTL
+		cfg.metadataFields = nil
+		if other.metadataFields != nil {
+			cfg.metadataFields = make([]MetadataField, len(other.metadataFields))
+			copy(cfg.metadataFields, other.metadataFields)
+		}
+		cfg.metadataPrefetch = make([]MetadataField, len(other.metadataPrefetch))
+		copy(cfg.metadataPrefetch, other.metadataPrefetch)
+		cfg.metadataWorkers = other.metadataWorkers
+		cfg.source = other.source
+		cfg.clock = other.clock
+		cfg.procfsPath = other.procfsPath
+		cfg.containerResolver = other.containerResolver
+		cfg.podResolver = other.podResolver
+		cfg.logger = other.logger
 	}
 }
 
@@ -61,6 +312,109 @@ func (cfg *Config) Refine(opts ...ConfigOption) *Config {
 	return newConfig
 }
 
+// Validate returns a descriptive error if the configuration is invalid, e.g., if a root pid is not positive or
+// is configured more than once, or if a root's subtree is also excluded. New and Reconfigure return the same
+// error, so Validate allows a configuration to be checked before it is used.
+func (cfg *Config) Validate() error {
+	return cfg.validate()
+}
+
+// validatePids returns an error if any pid in a configured list of pids is not positive, or if repeated is false
+// and a pid is repeated.
+func validatePids(what string, pids []int, repeated bool) error {
+	seen := make(map[int]bool, len(pids))
+	for _, pid := range pids {
+		if pid <= 0 {
+			return fmt.Errorf("Invalid %s pid %d", what, pid)
+		}
+		if seen[pid] && !repeated {
+			return fmt.Errorf("Pid %d is configured as a %s more than once", pid, what)
+		}
+		seen[pid] = true
+	}
+	return nil
+}
+
+// validate returns an error if the configuration is invalid.
+func (cfg *Config) validate() error {
+	err := validatePids("root", cfg.rootPids, false)
+	if err != nil {
+		return err
+	}
+	err = validatePids("namespace root", cfg.namespaceRootPids, true)
+	if err != nil {
+		return err
+	}
+	err = validatePids("excluded subtree", cfg.excludeSubtreePids, true)
+	if err != nil {
+		return err
+	}
+	for _, pid := range cfg.excludeSubtreePids {
+		for _, rootPid := range cfg.rootPids {
+			if pid == rootPid {
+				return fmt.Errorf("Pid %d is configured as both a root and an excluded subtree", pid)
+			}
+		}
+	}
+	for i, path := range cfg.rootPidFiles {
+		if path == "" {
+			return fmt.Errorf("Invalid empty root pid file path")
+		}
+		if containsString(cfg.rootPidFiles[:i], path) {
+			return fmt.Errorf("Pid file %s is configured as a root more than once", path)
+		}
+	}
+	for pid := range cfg.rootExecutables {
+		if !containsPid(cfg.rootPids, pid) {
+			return fmt.Errorf("Pid %d has a root executable, but is not a root", pid)
+		}
+	}
+	if cfg.gracePeriod < 0 {
+		return fmt.Errorf("Invalid grace period %s", cfg.gracePeriod)
+	}
+	if cfg.autoUpdateInterval < 0 {
+		return fmt.Errorf("Invalid auto-update interval %s", cfg.autoUpdateInterval)
+	}
+	if cfg.filterMode != FilterProcess && cfg.filterMode != FilterSubtree {
+		return fmt.Errorf("Invalid filter mode %s", cfg.filterMode)
+	}
+	if cfg.maxDepth < -1 {
+		return fmt.Errorf("Invalid maximum depth %d", cfg.maxDepth)
+	}
+	for _, pattern := range cfg.excludeSubtreeExecutables {
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return fmt.Errorf("Invalid executable pattern %q: %s", pattern, err)
+		}
+	}
+	if cfg.childOrder < ByPid || cfg.childOrder > ByMemory {
+		return fmt.Errorf("Invalid child order %s", cfg.childOrder)
+	}
+	for _, field := range cfg.metadataFields {
+		if field < MetadataCmdline || field >= numMetadataFields {
+			return fmt.Errorf("Invalid metadata field %s", field)
+		}
+	}
+	for _, field := range cfg.metadataPrefetch {
+		if field < MetadataCmdline || field >= numMetadataFields {
+			return fmt.Errorf("Invalid metadata field %s", field)
+		}
+		if !cfg.MetadataEnabled(field) {
+			return fmt.Errorf("Metadata field %s is prefetched but not enabled with WithMetadata", field)
+		}
+	}
+	if cfg.metadataWorkers < 1 {
+		return fmt.Errorf("Invalid number of metadata workers %d", cfg.metadataWorkers)
+	}
+	if cfg.tombstoneMaxAge < 0 || cfg.tombstoneMaxCount < 0 {
+		return fmt.Errorf("Invalid tombstone retention %s, %d", cfg.tombstoneMaxAge, cfg.tombstoneMaxCount)
+	}
+	if cfg.procfsPath == "" {
+		return fmt.Errorf("Invalid empty procfs path")
+	}
+	return nil
+}
+
 // WithKernelThreads enables inclusion of kernel threads (children of pid 2). By default, kernel threads are
 // excluded.
 func WithKernelThreads() ConfigOption {
@@ -102,9 +456,723 @@ func WithRootPid(pid int) ConfigOption {
 	}
 }
 
-// WithoutRootPid removes all pids added with WithRootPid, restoring config the default, which is to include all orphaned processses.
+// WithRootPidExecutable adds a pid to the set of pids to be included as roots of the tree, as with WithRootPid,
+// that only becomes a root if the process with the pid has the provided executable name. With WithLenientRoots,
+// this avoids mistaking an unrelated process that has reused the pid of a daemon that has not started yet for
+// the daemon. Without it, New returns an error if the process has a different executable name.
+func WithRootPidExecutable(pid int, executable string) ConfigOption {
+	return func(cfg *Config) {
+		cfg.rootPids = append(cfg.rootPids, pid)
+		cfg.rootExecutables[pid] = executable
+	}
+}
+
+// WithRootPidFile adds the pid in a pid file, e.g., /run/sshd.pid, to the set of pids to be included as roots of
+// the tree. The file must contain the pid as a decimal integer on its first line. Each update reads the file
+// again if it has changed, e.g., because the daemon has restarted, and replaces the root previously read from it
+// with the new pid. New returns an error if the file cannot be read, unless roots are lenient (see
+// WithLenientRoots); later updates keep the previous root until the file can be read again.
+func WithRootPidFile(path string) ConfigOption {
+	return func(cfg *Config) {
+		cfg.rootPidFiles = append(cfg.rootPidFiles, path)
+	}
+}
+
+// WithLenientRoots allows roots configured with WithRootPid, WithRootPidExecutable, AddRoot or Reconfigure to
+// not exist yet, e.g., because a daemon has not started. Rather than returning an error, New, AddRoot and
+// Reconfigure leave such a root pending, and it becomes a root when an update first finds the process (see
+// ProcTree.PendingRootPids). Until then, its subtree is empty.
+func WithLenientRoots() ConfigOption {
+	return func(cfg *Config) {
+		cfg.lenientRoots = true
+	}
+}
+
+// WithoutLenientRoots requires configured roots to exist when they are configured. This is the default setting.
+func WithoutLenientRoots() ConfigOption {
+	return func(cfg *Config) {
+		cfg.lenientRoots = false
+	}
+}
+
+// WithRootNamespaceInit adds the init process of the PID namespace of a pid (the process with pid 1 in the
+// namespace, e.g., the entrypoint of a container) to the set of pids to be included as roots of the tree, so
+// that the tree contains the processes of the namespace. The init process is found, in the procfs configured with
+// WithProcfsPath, when the configuration is applied by New or Reconfigure, which return an error if it cannot
+// be found. Only supported on Linux; see also Process.NamespacePids.
+func WithRootNamespaceInit(pid int) ConfigOption {
+	return func(cfg *Config) {
+		cfg.namespaceRootPids = append(cfg.namespaceRootPids, pid)
+	}
+}
+
+// resolveNamespaceRoots adds the init processes of the PID namespaces of the pids configured with
+// WithRootNamespaceInit to the configured roots.
+func (cfg *Config) resolveNamespaceRoots() error {
+	for _, pid := range cfg.namespaceRootPids {
+		initPid, err := procfs(cfg.procfsPath).namespaceInitPid(pid)
+		if err != nil {
+			return fmt.Errorf("Unable to find the init process of the PID namespace of pid %d: %s", pid, err)
+		}
+		cfg.rootPids = append(removePid(cfg.rootPids, initPid), initPid)
+	}
+	cfg.namespaceRootPids = []int{}
+	return nil
+}
+
+// WithoutRootPid removes all pids added with WithRootPid, WithRootPidExecutable, WithRootPidFile, WithOwnedRoot, WithRootSelf, WithRootParent or
+// WithRootNamespaceInit, restoring config the default, which is to include all orphaned processses.
 func WithoutRootPid() ConfigOption {
 	return func(cfg *Config) {
 		cfg.rootPids = []int{}
+		cfg.rootExecutables = map[int]string{}
+		cfg.rootPidFiles = []string{}
+		cfg.selfRootPids = []int{}
+		cfg.namespaceRootPids = []int{}
+		cfg.ownedRootPids = []int{}
+	}
+}
+
+// withoutRoot removes a single pid from the configured roots, including owned roots.
+func withoutRoot(pid int) ConfigOption {
+	return func(cfg *Config) {
+		cfg.rootPids = removePid(cfg.rootPids, pid)
+		delete(cfg.rootExecutables, pid)
+		cfg.selfRootPids = removePid(cfg.selfRootPids, pid)
+		cfg.ownedRootPids = removePid(cfg.ownedRootPids, pid)
+	}
+}
+
+// hasRoots returns true if roots are configured, so that only their subtrees are included, even if none of the
+// roots has been found yet.
+func (cfg *Config) hasRoots() bool {
+	return len(cfg.rootPids) > 0 || len(cfg.rootPidFiles) > 0
+}
+
+// containsPid returns true if a list of pids contains pid.
+func containsPid(pids []int, pid int) bool {
+	for _, p := range pids {
+		if p == pid {
+			return true
+		}
+	}
+	return false
+}
+
+// removePid returns a copy of a list of pids with every occurrence of pid removed.
+func removePid(pids []int, pid int) []int {
+	result := make([]int, 0, len(pids))
+	for _, p := range pids {
+		if p != pid {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// WithRootSelf adds the calling process as a root of the tree, so that the tree contains the calling process
+// and its descendants, including those started after New. Descendants that are reparented after their parent
+// exits (e.g., daemons that double-fork) remain included, provided they were seen by an update before they were
+// reparented; use WithSubreaper to keep them in the calling process's subtree regardless.
+func WithRootSelf() ConfigOption {
+	return func(cfg *Config) {
+		pid := os.Getpid()
+		cfg.rootPids = append(cfg.rootPids, pid)
+		cfg.selfRootPids = append(cfg.selfRootPids, pid)
+	}
+}
+
+// WithRootParent adds the parent of the calling process as a root of the tree, as with WithRootSelf, so that the
+// tree contains the calling process, its siblings, and their descendants.
+func WithRootParent() ConfigOption {
+	return func(cfg *Config) {
+		pid := os.Getppid()
+		cfg.rootPids = append(cfg.rootPids, pid)
+		cfg.selfRootPids = append(cfg.selfRootPids, pid)
+	}
+}
+
+// WithOwnedRoot adds a pid to the set of pids to be included as roots of the tree, as with WithRootPid, and
+// additionally marks its subtree as owned by the ProcTree. When the ProcTree is closed, every process in an owned
+// subtree (including descendants that have been reparented after their parent exited) is sent SIGTERM, and any
+// that remain after the grace period configured with WithGracePeriod are sent SIGKILL.
+func WithOwnedRoot(pid int) ConfigOption {
+	return func(cfg *Config) {
+		cfg.rootPids = append(cfg.rootPids, pid)
+		cfg.ownedRootPids = append(cfg.ownedRootPids, pid)
+	}
+}
+
+// WithGracePeriod sets the time that owned subtrees are given to exit after SIGTERM when the ProcTree is closed,
+// before they are sent SIGKILL. A zero grace period sends SIGKILL immediately. The default is 5 seconds.
+func WithGracePeriod(gracePeriod time.Duration) ConfigOption {
+	return func(cfg *Config) {
+		cfg.gracePeriod = gracePeriod
+	}
+}
+
+// WithCloseContext causes the ProcTree to be closed automatically, terminating any owned subtrees, when the provided
+// context is done. By default, the ProcTree is only closed by an explicit call to Close.
+func WithCloseContext(ctx context.Context) ConfigOption {
+	return func(cfg *Config) {
+		cfg.closeCtx = ctx
+	}
+}
+
+// WithSubreaper enables child-subreaper mode. The calling process is marked with PR_SET_CHILD_SUBREAPER so that
+// orphaned descendants are reparented to it rather than to init, and the ProcTree reaps them as they terminate,
+// recording their exit statuses on the corresponding Process objects. Because every terminated child of the calling
+// process is reaped, children should not be waited on through other means (e.g., exec.Cmd.Wait) while
+// subreaper mode is enabled, except for commands started with StartCommand, which are never reaped by the
+// ProcTree. Only supported on Linux; New returns an error on other platforms.
+func WithSubreaper() ConfigOption {
+	return func(cfg *Config) {
+		cfg.subreaper = true
+	}
+}
+
+// WithoutSubreaper disables child-subreaper mode. This is the default setting.
+func WithoutSubreaper() ConfigOption {
+	return func(cfg *Config) {
+		cfg.subreaper = false
+	}
+}
+
+// WithAutoUpdate enables a background goroutine that calls Update at the provided interval until the ProcTree is
+// closed. If pruneTombstones is true, each background update prunes Processes that are no longer found;
+// otherwise tombstones accumulate until Update is called with pruneTombstones. Events generated by background
+// updates are delivered to subscribers. By default, the ProcTree is only updated by explicit calls to Update.
+func WithAutoUpdate(interval time.Duration, pruneTombstones bool) ConfigOption {
+	return func(cfg *Config) {
+		cfg.autoUpdateInterval = interval
+		cfg.autoUpdatePruneTombstones = pruneTombstones
+	}
+}
+
+// WithoutAutoUpdate disables background updates. This is the default setting.
+func WithoutAutoUpdate() ConfigOption {
+	return func(cfg *Config) {
+		cfg.autoUpdateInterval = 0
+		cfg.autoUpdatePruneTombstones = false
+	}
+}
+
+// WithTombstoneRetention limits the tombstones that are kept by updates that do not prune tombstones: tombstones
+// of Processes that were last seen alive more than maxAge before an update are pruned by it, and if more than
+// maxCount tombstones remain, those that were last seen alive longest ago are pruned. A zero maxAge or maxCount
+// does not limit the age or number of tombstones. Updates that prune tombstones still prune all of them. By
+// default, tombstones are kept until an update prunes them.
+func WithTombstoneRetention(maxAge time.Duration, maxCount int) ConfigOption {
+	return func(cfg *Config) {
+		cfg.tombstoneMaxAge = maxAge
+		cfg.tombstoneMaxCount = maxCount
+	}
+}
+
+// WithoutTombstoneRetention keeps tombstones until an update prunes them. This is the default setting.
+func WithoutTombstoneRetention() ConfigOption {
+	return func(cfg *Config) {
+		cfg.tombstoneMaxAge = 0
+		cfg.tombstoneMaxCount = 0
+	}
+}
+
+// WithRealtimeMonitor enables a platform-specific real-time backend that updates the ProcTree in the background
+// within milliseconds of processes being created, exec'd or exiting. On Linux, this uses the netlink process
+// connector, which requires CAP_NET_ADMIN. On Darwin and FreeBSD, this uses kqueue EVFILT_PROC filters. On
+// Windows, exits are observed through waits on process handles, and new processes through a lightweight pid scan.
+// If the backend is unavailable, the ProcTree falls back to polling at the interval configured with
+// WithAutoUpdate, or every second if none was configured. When the backend is available, polling at the
+// WithAutoUpdate interval continues as a backstop for missed notifications. The pruneTombstones setting of
+// WithAutoUpdate applies to real-time updates.
+func WithRealtimeMonitor() ConfigOption {
+	return func(cfg *Config) {
+		cfg.realtimeMonitor = true
+	}
+}
+
+// WithoutRealtimeMonitor disables the real-time backend. This is the default setting.
+func WithoutRealtimeMonitor() ConfigOption {
+	return func(cfg *Config) {
+		cfg.realtimeMonitor = false
+	}
+}
+
+// WithEBPFMonitor enables an opt-in real-time backend that traces process exec and exit in the kernel with eBPF
+// programs attached to the sched_process_exec and sched_process_exit tracepoints. In addition to triggering
+// updates as with WithRealtimeMonitor, it captures the command line of every exec'd process (see
+// Process.Cmdline) and the exit status of every process, including processes that are too short-lived to be
+// seen by any update; these are added to the tree as transient, tombstoned Processes and reported to subscribers.
+// Requires Linux on amd64 or arm64 with kernel BTF, and CAP_BPF and CAP_PERFMON (or CAP_SYS_ADMIN). If the eBPF
+// backend is unavailable, the ProcTree falls back to the backend enabled by WithRealtimeMonitor, if any, and then
+// to polling.
+func WithEBPFMonitor() ConfigOption {
+	return func(cfg *Config) {
+		cfg.ebpfMonitor = true
+	}
+}
+
+// WithoutEBPFMonitor disables the eBPF backend. This is the default setting.
+func WithoutEBPFMonitor() ConfigOption {
+	return func(cfg *Config) {
+		cfg.ebpfMonitor = false
+	}
+}
+
+// WithUpdateHook adds a function that is called after each update of the ProcTree, including background updates,
+// with a summary of the changes made by the update. May be provided more than once; hooks are called in the order
+// they were added. By default, there are no update hooks.
+func WithUpdateHook(hook UpdateHook) ConfigOption {
+	return func(cfg *Config) {
+		cfg.updateHooks = append(cfg.updateHooks, hook)
+	}
+}
+
+// WithoutUpdateHooks removes all hooks added with WithUpdateHook. This is the default setting.
+func WithoutUpdateHooks() ConfigOption {
+	return func(cfg *Config) {
+		cfg.updateHooks = []UpdateHook{}
+	}
+}
+
+// WithFilter adds a predicate that must accept a Process for it to be included in the tree, in addition to the
+// inclusion rules for roots and kernel threads. May be provided more than once, in which case a Process is
+// included only if every filter accepts it. Filters are evaluated on each update, and may reject Processes
+// that were previously included (e.g., after an exec). How rejected Processes are excluded is determined by
+// WithFilterMode. By default, there are no filters.
+func WithFilter(filter ProcessFilter) ConfigOption {
+	return func(cfg *Config) {
+		cfg.filters = append(cfg.filters, filter)
+	}
+}
+
+// WithoutFilters removes all filters added with WithFilter. This is the default setting.
+func WithoutFilters() ConfigOption {
+	return func(cfg *Config) {
+		cfg.filters = []ProcessFilter{}
+	}
+}
+
+// WithFilterMode sets how Processes rejected by a filter added with WithFilter are excluded: FilterProcess
+// excludes only the rejected Process, and FilterSubtree excludes its entire subtree. The default is
+// FilterProcess.
+func WithFilterMode(mode FilterMode) ConfigOption {
+	return func(cfg *Config) {
+		cfg.filterMode = mode
+	}
+}
+
+// WithExcludeSubtreePid excludes the Process with the provided pid and all of its descendants from the tree, even
+// if they descend from a root configured with WithRootPid. May be provided more than once. By default, no
+// subtrees are excluded.
+func WithExcludeSubtreePid(pid int) ConfigOption {
+	return func(cfg *Config) {
+		cfg.excludeSubtreePids = append(cfg.excludeSubtreePids, pid)
+	}
+}
+
+// WithExcludeSubtreeExecutable excludes every Process whose executable name matches a glob pattern, using the
+// syntax of path.Match, and all of its descendants, even if they descend from a root configured with
+// WithRootPid. May be provided more than once. New returns an error if the pattern is malformed. By default, no
+// subtrees are excluded.
+func WithExcludeSubtreeExecutable(pattern string) ConfigOption {
+	return func(cfg *Config) {
+		cfg.excludeSubtreeExecutables = append(cfg.excludeSubtreeExecutables, pattern)
+	}
+}
+
+// WithoutExcludeSubtrees removes all subtree exclusions added with WithExcludeSubtreePid or
+// WithExcludeSubtreeExecutable. This is the default setting.
+func WithoutExcludeSubtrees() ConfigOption {
+	return func(cfg *Config) {
+		cfg.excludeSubtreePids = []int{}
+		cfg.excludeSubtreeExecutables = []string{}
+	}
+}
+
+// WithMaxDepth limits the included tree to the provided number of levels below each included root, after all
+// other inclusion rules have been applied. Processes deeper in the tree, and their descendants, are excluded.
+// A depth of 0 includes only the roots. By default, the depth of the tree is not limited.
+func WithMaxDepth(depth int) ConfigOption {
+	return func(cfg *Config) {
+		cfg.maxDepth = depth
+	}
+}
+
+// WithoutMaxDepth removes any limit set with WithMaxDepth. This is the default setting.
+func WithoutMaxDepth() ConfigOption {
+	return func(cfg *Config) {
+		cfg.maxDepth = defaultMaxDepth
+	}
+}
+
+// WithChildSort sets the order in which the children of each Process are listed by Children and AbsChildren,
+// which also determines the order of walks and rendering. The order is applied by each update. Roots are always
+// listed in pid order. The default is ByPid.
+func WithChildSort(order ChildOrder) ConfigOption {
+	return func(cfg *Config) {
+		cfg.childOrder = order
+	}
+}
+
+// WithMetadataTTL sets the time for which metadata that is read from the system on demand (see
+// Process.SystemCmdline, Process.Environ, Process.FDCount and Process.MemoryStats) is cached. Cached metadata is
+// discarded when an update detects that the Process has exec'd. A TTL of 0 disables caching, and a negative
+// TTL caches metadata until the Process execs. The default is 5 seconds.
+func WithMetadataTTL(ttl time.Duration) ConfigOption {
+	return func(cfg *Config) {
+		cfg.metadataTTL = ttl
+	}
+}
+
+// WithMetadata restricts the metadata that may be read from the system to the provided fields, so that an
+// application reads exactly the metadata it needs: accessors of other fields, e.g., Process.Environ, return an
+// error that wraps ErrMetadataNotEnabled without reading anything, which limits both the cost of collection and
+// the exposure of sensitive metadata such as environment variables. Process.Usage omits the file descriptor
+// count unless MetadataFDs is enabled. Repeated calls enable additional fields; use WithAllMetadata first to
+// replace the enabled fields, e.g., WithAllMetadata(), WithMetadata() disables all metadata. Command lines captured by the eBPF monitor are unaffected (see Process.Cmdline). By
+// default, all metadata may be read.
+func WithMetadata(fields ...MetadataField) ConfigOption {
+	return func(cfg *Config) {
+		if cfg.metadataFields == nil {
+			cfg.metadataFields = []MetadataField{}
+		}
+		for _, field := range fields {
+			if !cfg.MetadataEnabled(field) {
+				cfg.metadataFields = append(cfg.metadataFields, field)
+			}
+		}
+	}
+}
+
+// WithAllMetadata removes the restriction set by WithMetadata, so that all metadata may be read. This is the
+// default setting.
+func WithAllMetadata() ConfigOption {
+	return func(cfg *Config) {
+		cfg.metadataFields = nil
+	}
+}
+
+// WithMetadataPrefetch enables capture of rich metadata by each update: the provided metadata fields are read
+// for every live included Process whose cached value is missing or has expired, so that later calls to
+// accessors such as Process.Environ return immediately. Reads for different processes run concurrently (see
+// WithMetadataWorkers), without holding the tree lock, and complete before the update's events are dispatched.
+// Has no effect if caching is disabled with WithMetadataTTL. Updates performed while the tree is being changed
+// by another operation, e.g., AddRoot, do not prefetch metadata; it is read on demand instead. The fields must be
+// enabled if metadata is restricted with WithMetadata. By default, no metadata is prefetched.
+func WithMetadataPrefetch(fields ...MetadataField) ConfigOption {
+	return func(cfg *Config) {
+		cfg.metadataPrefetch = append(cfg.metadataPrefetch, fields...)
+	}
+}
+
+// WithoutMetadataPrefetch disables prefetching of metadata enabled with WithMetadataPrefetch. This is the default
+// setting.
+func WithoutMetadataPrefetch() ConfigOption {
+	return func(cfg *Config) {
+		cfg.metadataPrefetch = []MetadataField{}
+	}
+}
+
+// WithMetadataWorkers sets the maximum number of processes whose metadata is read concurrently by an update
+// (see WithMetadataPrefetch). The default is 8.
+func WithMetadataWorkers(workers int) ConfigOption {
+	return func(cfg *Config) {
+		cfg.metadataWorkers = workers
+	}
+}
+
+// WithProcessSource sets the ProcessSource that lists the processes in the tree, in place of the processes on the
+// local system. Operations that read details of processes from the local system (e.g., Process.SystemCmdline,
+// Process.UID and resource usage) or act on them (e.g., spawning, terminating and subreaper mode) are unaffected,
+// so they are only meaningful for sources that describe local processes. WithRealtimeMonitor uses the source's
+// events if it is a ProcessEventSource; otherwise the ProcTree falls back to polling. A nil source restores the
+// default, SystemSource.
+func WithProcessSource(source ProcessSource) ConfigOption {
+	return func(cfg *Config) {
+		cfg.source = source
+	}
+}
+
+// WithClock sets the Clock that is the source of the current time for the ProcTree, so that the times at which
+// Processes are first and last seen, the CPU rates measured by a UsageSampler, and the expiry of cached metadata
+// and tombstones (see WithMetadataTTL and WithTombstoneRetention) can be controlled by tests, e.g., with a
+// proctreetest.Clock together with a proctreetest.Source. A nil clock restores the default, SystemClock.
+func WithClock(clock Clock) ConfigOption {
+	return func(cfg *Config) {
+		cfg.clock = clock
+	}
+}
+
+// WithProcfsPath sets the directory at which procfs is mounted, from which the processes on the system and their
+// metadata are read on Linux. This allows a ProcTree to examine the processes of another pid namespace whose
+// procfs is mounted elsewhere, e.g., /host/proc inside a monitoring container, or a directory of per-process
+// entries captured from a system. The platform's real-time backends (see WithRealtimeMonitor) observe the local
+// pid namespace, so they are not used with an alternate procfs; the ProcTree falls back to polling instead.
+// Ignored on other platforms. The default is /proc.
+func WithProcfsPath(dir string) ConfigOption {
+	return func(cfg *Config) {
+		cfg.procfsPath = dir
+	}
+}
+
+// WithContainerResolver sets the ContainerResolver that looks up the names and images of the containers returned
+// by Process.Container. The default resolver queries the Docker Engine API at /var/run/docker.sock (see
+// DockerResolver).
+func WithContainerResolver(resolver ContainerResolver) ConfigOption {
+	return func(cfg *Config) {
+		cfg.containerResolver = resolver
+	}
+}
+
+// WithoutContainerResolver disables lookup of the names and images of containers, so that the Containers returned
+// by Process.Container only have ids and runtimes.
+func WithoutContainerResolver() ConfigOption {
+	return func(cfg *Config) {
+		cfg.containerResolver = nil
+	}
+}
+
+// WithPodResolver sets the PodResolver that looks up the names of the pods and containers returned by
+// Process.PodInfo. The default resolver reads the kubelet's log directory, /var/log (see PodLogResolver).
+func WithPodResolver(resolver PodResolver) ConfigOption {
+	return func(cfg *Config) {
+		cfg.podResolver = resolver
+	}
+}
+
+// WithoutPodResolver disables lookup of the names of pods and containers, so that the PodInfos returned by
+// Process.PodInfo only have uids, quality of service classes and container ids.
+func WithoutPodResolver() ConfigOption {
+	return func(cfg *Config) {
+		cfg.podResolver = nil
+	}
+}
+
+// copyPids returns a copy of a list of pids.
+func copyPids(pids []int) []int {
+	result := make([]int, len(pids))
+	copy(result, pids)
+	return result
+}
+
+// IncludeKernelThreads returns true if kernel threads are included (see WithKernelThreads).
+func (cfg *Config) IncludeKernelThreads() bool {
+	return cfg.includeKernelThreads
+}
+
+// IncludeRootAncestors returns true if the ancestors of configured roots are included (see WithRootAncestors).
+func (cfg *Config) IncludeRootAncestors() bool {
+	return cfg.includeRootAncestors
+}
+
+// RootPids returns the configured root pids, in the order in which they were configured. Roots configured with
+// WithRootNamespaceInit are only included once the configuration has been applied by New or Reconfigure.
+func (cfg *Config) RootPids() []int {
+	return copyPids(cfg.rootPids)
+}
+
+// RootPidFiles returns the paths of the pid files configured with WithRootPidFile. The pids read from them are
+// included in the RootPids of the configuration of a ProcTree (see ProcTree.Config).
+func (cfg *Config) RootPidFiles() []string {
+	result := make([]string, len(cfg.rootPidFiles))
+	copy(result, cfg.rootPidFiles)
+	return result
+}
+
+// RootExecutable returns the executable name that the process with a root pid must have to become a root, as
+// configured with WithRootPidExecutable, and true; or "" and false if none was configured.
+func (cfg *Config) RootExecutable(pid int) (string, bool) {
+	executable, ok := cfg.rootExecutables[pid]
+	return executable, ok
+}
+
+// OwnedRootPids returns the root pids whose subtrees are owned by the ProcTree (see WithOwnedRoot).
+func (cfg *Config) OwnedRootPids() []int {
+	return copyPids(cfg.ownedRootPids)
+}
+
+// LenientRoots returns true if configured roots may not exist yet (see WithLenientRoots).
+func (cfg *Config) LenientRoots() bool {
+	return cfg.lenientRoots
+}
+
+// GracePeriod returns the time that owned subtrees are given to exit after SIGTERM (see WithGracePeriod).
+func (cfg *Config) GracePeriod() time.Duration {
+	return cfg.gracePeriod
+}
+
+// Subreaper returns true if child-subreaper mode is enabled (see WithSubreaper).
+func (cfg *Config) Subreaper() bool {
+	return cfg.subreaper
+}
+
+// AutoUpdate returns the interval of background updates, which is 0 if they are disabled, and whether they
+// prune tombstones (see WithAutoUpdate).
+func (cfg *Config) AutoUpdate() (time.Duration, bool) {
+	return cfg.autoUpdateInterval, cfg.autoUpdatePruneTombstones
+}
+
+// TombstoneRetention returns the maximum age and number of tombstones that are kept, where 0 is unlimited (see
+// WithTombstoneRetention).
+func (cfg *Config) TombstoneRetention() (time.Duration, int) {
+	return cfg.tombstoneMaxAge, cfg.tombstoneMaxCount
+}
+
+// RealtimeMonitor returns true if the real-time monitor is enabled (see WithRealtimeMonitor).
+func (cfg *Config) RealtimeMonitor() bool {
+	return cfg.realtimeMonitor
+}
+
+// EBPFMonitor returns true if the eBPF monitor is enabled (see WithEBPFMonitor).
+func (cfg *Config) EBPFMonitor() bool {
+	return cfg.ebpfMonitor
+}
+
+// NumFilters returns the number of filters configured with WithFilter.
+func (cfg *Config) NumFilters() int {
+	return len(cfg.filters)
+}
+
+// FilterMode returns the configured filter mode (see WithFilterMode).
+func (cfg *Config) FilterMode() FilterMode {
+	return cfg.filterMode
+}
+
+// ChildOrder returns the configured order of child lists (see WithChildSort).
+func (cfg *Config) ChildOrder() ChildOrder {
+	return cfg.childOrder
+}
+
+// MaxDepth returns the configured maximum depth of the included tree, or -1 if it is not limited (see
+// WithMaxDepth).
+func (cfg *Config) MaxDepth() int {
+	return cfg.maxDepth
+}
+
+// ExcludeSubtreePids returns the pids whose subtrees are excluded (see WithExcludeSubtreePid).
+func (cfg *Config) ExcludeSubtreePids() []int {
+	return copyPids(cfg.excludeSubtreePids)
+}
+
+// ExcludeSubtreeExecutables returns the executable name patterns whose subtrees are excluded (see
+// WithExcludeSubtreeExecutable).
+func (cfg *Config) ExcludeSubtreeExecutables() []string {
+	result := make([]string, len(cfg.excludeSubtreeExecutables))
+	copy(result, cfg.excludeSubtreeExecutables)
+	return result
+}
+
+// MetadataTTL returns the time for which metadata is cached (see WithMetadataTTL).
+func (cfg *Config) MetadataTTL() time.Duration {
+	return cfg.metadataTTL
+}
+
+// MetadataEnabled returns true if a metadata field may be read from the system (see WithMetadata).
+func (cfg *Config) MetadataEnabled(field MetadataField) bool {
+	if cfg.metadataFields == nil {
+		return true
+	}
+	for _, f := range cfg.metadataFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// MetadataFields returns the metadata fields that may be read from the system, or nil if all of them may be read
+// (see WithMetadata).
+func (cfg *Config) MetadataFields() []MetadataField {
+	if cfg.metadataFields == nil {
+		return nil
+	}
+	result := make([]MetadataField, len(cfg.metadataFields))
+	copy(result, cfg.metadataFields)
+	return result
+}
+
+// MetadataPrefetch returns the metadata fields that are read by each update (see WithMetadataPrefetch).
+func (cfg *Config) MetadataPrefetch() []MetadataField {
+	result := make([]MetadataField, len(cfg.metadataPrefetch))
+	copy(result, cfg.metadataPrefetch)
+	return result
+}
+
+// MetadataWorkers returns the maximum number of processes whose metadata is read concurrently (see
+// WithMetadataWorkers).
+func (cfg *Config) MetadataWorkers() int {
+	return cfg.metadataWorkers
+}
+
+// ProcfsPath returns the directory at which procfs is read (see WithProcfsPath).
+func (cfg *Config) ProcfsPath() string {
+	return cfg.procfsPath
+}
+
+// HasProcessSource returns true if a ProcessSource was configured with WithProcessSource, rather than listing
+// the processes of the local system.
+func (cfg *Config) HasProcessSource() bool {
+	return cfg.source != nil
+}
+
+// Clock returns the Clock that is the source of the current time (see WithClock).
+func (cfg *Config) Clock() Clock {
+	if cfg.clock == nil {
+		return SystemClock()
+	}
+	return cfg.clock
+}
+
+// String describes the configuration for logging, e.g., "Config{roots: [812], order: ByPid, ...}". Only
+// options that differ from their defaults are described, apart from the roots and child order.
+func (cfg *Config) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Config{roots: %v, order: %s", cfg.rootPids, cfg.childOrder)
+	if len(cfg.rootPidFiles) > 0 {
+		fmt.Fprintf(&b, ", pid files: %q", cfg.rootPidFiles)
+	}
+	if len(cfg.ownedRootPids) > 0 {
+		fmt.Fprintf(&b, ", owned: %v, grace: %s", cfg.ownedRootPids, cfg.gracePeriod)
+	}
+	if cfg.lenientRoots {
+		b.WriteString(", lenient roots")
+	}
+	if cfg.includeRootAncestors {
+		b.WriteString(", root ancestors")
+	}
+	if cfg.includeKernelThreads {
+		b.WriteString(", kernel threads")
+	}
+	if len(cfg.filters) > 0 {
+		fmt.Fprintf(&b, ", filters: %d, mode: %s", len(cfg.filters), cfg.filterMode)
+	}
+	if len(cfg.excludeSubtreePids) > 0 || len(cfg.excludeSubtreeExecutables) > 0 {
+		fmt.Fprintf(&b, ", exclude: %v %q", cfg.excludeSubtreePids, cfg.excludeSubtreeExecutables)
+	}
+	if cfg.maxDepth >= 0 {
+		fmt.Fprintf(&b, ", max depth: %d", cfg.maxDepth)
+	}
+	if cfg.autoUpdateInterval > 0 {
+		fmt.Fprintf(&b, ", auto-update: %s", cfg.autoUpdateInterval)
+	}
+	if cfg.tombstoneMaxAge > 0 || cfg.tombstoneMaxCount > 0 {
+		fmt.Fprintf(&b, ", tombstones: %s %d", cfg.tombstoneMaxAge, cfg.tombstoneMaxCount)
+	}
+	if cfg.realtimeMonitor {
+		b.WriteString(", realtime")
+	}
+	if cfg.ebpfMonitor {
+		b.WriteString(", ebpf")
+	}
+	if cfg.subreaper {
+		b.WriteString(", subreaper")
+	}
+	if cfg.source != nil {
+		b.WriteString(", custom source")
+	} else if cfg.procfsPath != string(defaultProcfs) {
+		fmt.Fprintf(&b, ", procfs: %s", cfg.procfsPath)
 	}
+	b.WriteString("}")
+	return b.String()
 }
@@ -0,0 +1,93 @@
+package proctree
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigValidation(t *testing.T) {
+	invalid := []*Config{
+		NewConfig(WithRootPid(0)),
+		NewConfig(WithRootPid(-5)),
+		NewConfig(WithRootPid(100), WithRootPid(100)),
+		NewConfig(WithRootPid(100), WithOwnedRoot(100)),
+		NewConfig(WithRootPid(100), WithExcludeSubtreePid(100)),
+		NewConfig(WithExcludeSubtreePid(-1)),
+		NewConfig(WithGracePeriod(-time.Second)),
+		NewConfig(WithAutoUpdate(-time.Second, false)),
+		NewConfig(WithFilterMode(FilterMode(7))),
+		NewConfig(WithMaxDepth(-2)),
+		NewConfig(WithExcludeSubtreeExecutable("[")),
+	}
+	for _, cfg := range invalid {
+		if cfg.Validate() == nil {
+			t.Errorf("Validate() of %s did not return an error", cfg)
+		}
+	}
+	fs := newFakeSource(ProcInfo{Pid: 100, Executable: "init", StartTime: 1})
+	_, err := New(WithProcessSource(fs), WithRootPid(100), WithRootPid(100))
+	if err == nil || !strings.Contains(err.Error(), "more than once") {
+		t.Errorf("New() with a duplicate root returned error %v, expected a duplicate root error", err)
+	}
+	pt, err := New(WithProcessSource(fs), WithRootPid(100))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+	err = pt.Reconfigure(WithExcludeSubtreePid(100))
+	if err == nil {
+		t.Errorf("Reconfigure() that excludes a root did not return an error")
+	}
+	err = pt.AddRoot(-5)
+	if err == nil {
+		t.Errorf("AddRoot() of a negative pid did not return an error")
+	}
+
+	if NewConfig().Validate() != nil {
+		t.Errorf("Validate() of the default config returned error: %s", NewConfig().Validate())
+	}
+}
+
+func TestConfigAccessors(t *testing.T) {
+	cfg := NewConfig(WithOwnedRoot(100), WithRootPidExecutable(200, "sshd"), WithMaxDepth(3),
+		WithTombstoneRetention(time.Minute, 10), WithChildSort(ByExecutable))
+	pids := cfg.RootPids()
+	if len(pids) != 2 || pids[0] != 100 || pids[1] != 200 {
+		t.Errorf("RootPids() returned %v, expected [100 200]", pids)
+	}
+	pids[0] = 5
+	if cfg.RootPids()[0] != 100 {
+		t.Errorf("RootPids() returned the config's own slice")
+	}
+	if exe, ok := cfg.RootExecutable(200); !ok || exe != "sshd" {
+		t.Errorf("RootExecutable(200) returned %q, %t, expected sshd", exe, ok)
+	}
+	if owned := cfg.OwnedRootPids(); len(owned) != 1 || owned[0] != 100 {
+		t.Errorf("OwnedRootPids() returned %v, expected [100]", owned)
+	}
+	if cfg.MaxDepth() != 3 || cfg.ChildOrder() != ByExecutable {
+		t.Errorf("MaxDepth() and ChildOrder() returned %d, %s", cfg.MaxDepth(), cfg.ChildOrder())
+	}
+	if maxAge, maxCount := cfg.TombstoneRetention(); maxAge != time.Minute || maxCount != 10 {
+		t.Errorf("TombstoneRetention() returned %s, %d", maxAge, maxCount)
+	}
+	s := cfg.String()
+	if !strings.Contains(s, "roots: [100 200]") || !strings.Contains(s, "max depth: 3") {
+		t.Errorf("String() returned %q", s)
+	}
+
+	fs := newFakeSource(ProcInfo{Pid: 100, Executable: "init", StartTime: 1})
+	pt, err := New(WithProcessSource(fs))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+	err = pt.AddRoot(100)
+	if err != nil {
+		t.Fatalf("AddRoot() returned error: %s", err)
+	}
+	if pids := pt.Config().RootPids(); len(pids) != 1 || pids[0] != 100 || !pt.Config().HasProcessSource() {
+		t.Errorf("Config() returned %s after AddRoot(100)", pt.Config())
+	}
+}
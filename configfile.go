@@ -0,0 +1,378 @@
+package proctree
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// childOrderNames are the names of child orders in configuration files, as accepted by proctree --sort.
+var childOrderNames = []string{
+	ByPid:        "pid",
+	ByExecutable: "name",
+	ByStartTime:  "start",
+	ByCPUTime:    "cpu",
+	ByMemory:     "mem",
+}
+
+// filterModeNames are the names of filter modes in configuration files.
+var filterModeNames = []string{
+	FilterProcess: "process",
+	FilterSubtree: "subtree",
+}
+
+// metadataFieldNames are the names of metadata fields in configuration files.
+var metadataFieldNames = []string{
+	MetadataCmdline:       "cmdline",
+	MetadataEnviron:       "environ",
+	MetadataFDs:           "fds",
+	MetadataMemory:        "memory",
+	MetadataUserSID:       "userSID",
+	MetadataSession:       "session",
+	MetadataCgroup:        "cgroup",
+	MetadataProcessGroup:  "processGroup",
+	MetadataNamespacePids: "namespacePids",
+}
+
+// configDuration is a time.Duration that is encoded as a string, e.g., "1m30s".
+type configDuration time.Duration
+
+func (d configDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *configDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return fmt.Errorf("Durations must be strings, e.g., \"1m30s\"")
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = configDuration(duration)
+	return nil
+}
+
+// encodedRoot is the serialized form of a configured root. A root is selected by exactly one of Pid, Self,
+// Parent and PidFile.
+type encodedRoot struct {
+	Pid           int    `json:"pid,omitempty"`
+	PidFile       string `json:"pidFile,omitempty"`
+	Self          bool   `json:"self,omitempty"`
+	Parent        bool   `json:"parent,omitempty"`
+	NamespaceInit bool   `json:"namespaceInit,omitempty"`
+	Executable    string `json:"executable,omitempty"`
+	Owned         bool   `json:"owned,omitempty"`
+}
+
+// encodedConfig is the serialized form of the options of a Config that can be serialized.
+type encodedConfig struct {
+	Roots                     []encodedRoot  `json:"roots"`
+	LenientRoots              bool           `json:"lenientRoots"`
+	RootAncestors             bool           `json:"rootAncestors"`
+	KernelThreads             bool           `json:"kernelThreads"`
+	GracePeriod               configDuration `json:"gracePeriod"`
+	AutoUpdateInterval        configDuration `json:"autoUpdateInterval"`
+	AutoUpdatePruneTombstones bool           `json:"autoUpdatePruneTombstones"`
+	TombstoneMaxAge           configDuration `json:"tombstoneMaxAge"`
+	TombstoneMaxCount         int            `json:"tombstoneMaxCount"`
+	RealtimeMonitor           bool           `json:"realtimeMonitor"`
+	EBPFMonitor               bool           `json:"ebpfMonitor"`
+	Subreaper                 bool           `json:"subreaper"`
+	FilterMode                string         `json:"filterMode"`
+	ExcludeSubtreePids        []int          `json:"excludeSubtreePids"`
+	ExcludeSubtreeExecutables []string       `json:"excludeSubtreeExecutables"`
+	MaxDepth                  *int           `json:"maxDepth"`
+	ChildOrder                string         `json:"childOrder"`
+	MetadataTTL               configDuration `json:"metadataTTL"`
+	Metadata                  []string       `json:"metadata"`
+	MetadataPrefetch          []string       `json:"metadataPrefetch"`
+	MetadataWorkers           int            `json:"metadataWorkers"`
+	ProcfsPath                string         `json:"procfsPath"`
+}
+
+// encode returns the serialized form of a Config.
+func (cfg *Config) encode() *encodedConfig {
+	ec := &encodedConfig{
+		Roots:                     []encodedRoot{},
+		LenientRoots:              cfg.lenientRoots,
+		RootAncestors:             cfg.includeRootAncestors,
+		KernelThreads:             cfg.includeKernelThreads,
+		GracePeriod:               configDuration(cfg.gracePeriod),
+		AutoUpdateInterval:        configDuration(cfg.autoUpdateInterval),
+		AutoUpdatePruneTombstones: cfg.autoUpdatePruneTombstones,
+		TombstoneMaxAge:           configDuration(cfg.tombstoneMaxAge),
+		TombstoneMaxCount:         cfg.tombstoneMaxCount,
+		RealtimeMonitor:           cfg.realtimeMonitor,
+		EBPFMonitor:               cfg.ebpfMonitor,
+		Subreaper:                 cfg.subreaper,
+		FilterMode:                configName(filterModeNames, int(cfg.filterMode)),
+		ExcludeSubtreePids:        copyPids(cfg.excludeSubtreePids),
+		ExcludeSubtreeExecutables: cfg.ExcludeSubtreeExecutables(),
+		ChildOrder:                configName(childOrderNames, int(cfg.childOrder)),
+		MetadataTTL:               configDuration(cfg.metadataTTL),
+		MetadataPrefetch:          []string{},
+		MetadataWorkers:           cfg.metadataWorkers,
+		ProcfsPath:                cfg.procfsPath,
+	}
+	for _, pid := range cfg.rootPids {
+		root := encodedRoot{Pid: pid}
+		if containsPid(cfg.selfRootPids, pid) {
+			if pid == os.Getpid() {
+				root = encodedRoot{Self: true}
+			} else if pid == os.Getppid() {
+				root = encodedRoot{Parent: true}
+			}
+		}
+		root.Executable = cfg.rootExecutables[pid]
+		root.Owned = containsPid(cfg.ownedRootPids, pid)
+		ec.Roots = append(ec.Roots, root)
+	}
+	for _, path := range cfg.rootPidFiles {
+		ec.Roots = append(ec.Roots, encodedRoot{PidFile: path})
+	}
+	for _, pid := range cfg.namespaceRootPids {
+		ec.Roots = append(ec.Roots, encodedRoot{Pid: pid, NamespaceInit: true})
+	}
+	if cfg.maxDepth >= 0 {
+		maxDepth := cfg.maxDepth
+		ec.MaxDepth = &maxDepth
+	}
+	if cfg.metadataFields != nil {
+		ec.Metadata = []string{}
+		for _, field := range cfg.metadataFields {
+			ec.Metadata = append(ec.Metadata, configName(metadataFieldNames, int(field)))
+		}
+	}
+	for _, field := range cfg.metadataPrefetch {
+		ec.MetadataPrefetch = append(ec.MetadataPrefetch, configName(metadataFieldNames, int(field)))
+	}
+	return ec
+}
+
+// options returns the ConfigOptions that create the Config of a serialized form.
+func (ec *encodedConfig) options() ([]ConfigOption, error) {
+	opts := []ConfigOption{WithoutRootPid()}
+	for _, root := range ec.Roots {
+		selectors := 0
+		for _, selected := range []bool{root.Pid != 0, root.Self, root.Parent, root.PidFile != ""} {
+			if selected {
+				selectors++
+			}
+		}
+		if selectors != 1 {
+			return nil, fmt.Errorf("Each root must have exactly one of pid, self, parent and pidFile")
+		}
+		switch {
+		case root.PidFile != "":
+			if root.NamespaceInit || root.Executable != "" || root.Owned {
+				return nil, fmt.Errorf("Roots with pidFile may not have namespaceInit, executable or owned")
+			}
+			opts = append(opts, WithRootPidFile(root.PidFile))
+			continue
+		case root.NamespaceInit:
+			if root.Executable != "" || root.Owned || root.Pid == 0 {
+				return nil, fmt.Errorf("Roots with namespaceInit must have a pid, and no executable or owned")
+			}
+			opts = append(opts, WithRootNamespaceInit(root.Pid))
+			continue
+		case root.Self:
+			opts = append(opts, WithRootSelf())
+		case root.Parent:
+			opts = append(opts, WithRootParent())
+		default:
+			opts = append(opts, WithRootPid(root.Pid))
+		}
+		// The executable and ownership apply to the root that was just added, whose pid is not known until the
+		// options are applied for self and parent roots
+		executable, owned := root.Executable, root.Owned
+		opts = append(opts, func(cfg *Config) {
+			pid := cfg.rootPids[len(cfg.rootPids)-1]
+			if executable != "" {
+				cfg.rootExecutables[pid] = executable
+			}
+			if owned {
+				cfg.ownedRootPids = append(cfg.ownedRootPids, pid)
+			}
+		})
+	}
+	if ec.LenientRoots {
+		opts = append(opts, WithLenientRoots())
+	}
+	if ec.RootAncestors {
+		opts = append(opts, WithRootAncestors())
+	}
+	if ec.KernelThreads {
+		opts = append(opts, WithKernelThreads())
+	}
+	opts = append(opts,
+		WithGracePeriod(time.Duration(ec.GracePeriod)),
+		WithAutoUpdate(time.Duration(ec.AutoUpdateInterval), ec.AutoUpdatePruneTombstones),
+		WithTombstoneRetention(time.Duration(ec.TombstoneMaxAge), ec.TombstoneMaxCount),
+		WithMetadataTTL(time.Duration(ec.MetadataTTL)),
+		WithMetadataWorkers(ec.MetadataWorkers),
+		WithProcfsPath(ec.ProcfsPath),
+	)
+	if ec.RealtimeMonitor {
+		opts = append(opts, WithRealtimeMonitor())
+	}
+	if ec.EBPFMonitor {
+		opts = append(opts, WithEBPFMonitor())
+	}
+	if ec.Subreaper {
+		opts = append(opts, WithSubreaper())
+	}
+	mode, ok := lookupConfigName(filterModeNames, ec.FilterMode)
+	if !ok {
+		return nil, fmt.Errorf("Invalid filter mode %q; expected one of %s", ec.FilterMode, configNames(filterModeNames))
+	}
+	opts = append(opts, WithFilterMode(FilterMode(mode)))
+	for _, pid := range ec.ExcludeSubtreePids {
+		opts = append(opts, WithExcludeSubtreePid(pid))
+	}
+	for _, pattern := range ec.ExcludeSubtreeExecutables {
+		opts = append(opts, WithExcludeSubtreeExecutable(pattern))
+	}
+	if ec.MaxDepth != nil {
+		opts = append(opts, WithMaxDepth(*ec.MaxDepth))
+	}
+	order, ok := lookupConfigName(childOrderNames, ec.ChildOrder)
+	if !ok {
+		return nil, fmt.Errorf("Invalid child order %q; expected one of %s", ec.ChildOrder, configNames(childOrderNames))
+	}
+	opts = append(opts, WithChildSort(ChildOrder(order)))
+	opts = append(opts, WithAllMetadata())
+	if ec.Metadata != nil {
+		fields, err := lookupMetadataFields(ec.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithMetadata(fields...))
+	}
+	fields, err := lookupMetadataFields(ec.MetadataPrefetch)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, WithoutMetadataPrefetch(), WithMetadataPrefetch(fields...))
+	return opts, nil
+}
+
+// lookupMetadataFields returns the metadata fields with a list of names in configuration files.
+func lookupMetadataFields(names []string) ([]MetadataField, error) {
+	fields := []MetadataField{}
+	for _, name := range names {
+		field, ok := lookupConfigName(metadataFieldNames, name)
+		if !ok {
+			return nil, fmt.Errorf("Invalid metadata field %q; expected one of %s", name, configNames(metadataFieldNames))
+		}
+		fields = append(fields, MetadataField(field))
+	}
+	return fields, nil
+}
+
+// configName returns the name of a value in configuration files, or "" if the value is invalid.
+func configName(names []string, value int) string {
+	if value < 0 || value >= len(names) {
+		return ""
+	}
+	return names[value]
+}
+
+// lookupConfigName returns the value with a name in a list of the names of values in configuration files.
+func lookupConfigName(names []string, name string) (int, bool) {
+	for value, n := range names {
+		if n == name {
+			return value, true
+		}
+	}
+	return 0, false
+}
+
+// configNames returns the sorted names of values in configuration files, for error messages, e.g.,
+// "process, subtree".
+func configNames(names []string) string {
+	result := make([]string, len(names))
+	copy(result, names)
+	sort.Strings(result)
+	return strings.Join(result, ", ")
+}
+
+// MarshalJSON implements json.Marshaler. A Config is encoded as an object containing the options that can be
+// serialized: roots, inclusion and exclusion options, background activity, tombstone retention, child order,
+// metadata options and the procfs path. Durations are encoded as strings, e.g., "1m30s". Options that cannot
+// be serialized (filters configured with WithFilter, update hooks, the close context, process sources, clocks,
+// container and pod resolvers, and the logger) are omitted. Roots configured with WithRootSelf or
+// WithRootParent are encoded as {"self": true} or {"parent": true}, so that they refer to the process that
+// loads the configuration.
+func (cfg *Config) MarshalJSON() ([]byte, error) {
+	return json.Marshal(cfg.encode())
+}
+
+// UnmarshalJSON implements json.Unmarshaler. The Config is replaced by one decoded from the encoding of
+// Config.MarshalJSON. Options that are not present have their default values, as do the options that cannot be
+// serialized. Unknown keys are rejected, so that misspelled options are not silently ignored, and the decoded
+// configuration is validated as by Config.Validate.
+func (cfg *Config) UnmarshalJSON(data []byte) error {
+	ec := NewConfig().encode()
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(ec)
+	if err != nil {
+		return fmt.Errorf("Unable to decode config: %s", err)
+	}
+	opts, err := ec.options()
+	if err != nil {
+		return fmt.Errorf("Unable to decode config: %s", err)
+	}
+	decoded := NewConfig(opts...)
+	err = decoded.validate()
+	if err != nil {
+		return fmt.Errorf("Invalid config: %s", err)
+	}
+	*cfg = *decoded
+	return nil
+}
+
+// LoadConfigFile creates a Config from a configuration file, e.g., so that a long-running agent can define its
+// roots, exclusions and metadata in a file rather than in code. Files whose names end in .yaml or .yml are YAML,
+// and others are JSON; in either case, the keys are those of the JSON encoding of Config.MarshalJSON, e.g.:
+//
+//	roots:
+//	  - pid: 812
+//	    executable: sshd
+//	  - self: true
+//	lenientRoots: true
+//	excludeSubtreeExecutables: ["cron*"]
+//	childOrder: start
+//	metadata: [cmdline, fds, memory]
+//	metadataPrefetch: [cmdline, fds]
+//
+// A YAML file must contain a single document. Options that cannot be serialized, such as filters, may be supplied
+// as opts, which are applied after the file.
+func LoadConfigFile(path string, opts ...ConfigOption) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".yaml" || ext == ".yml" {
+		data, err = yamlToJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse config file %s: %s", path, err)
+		}
+	}
+	cfg := &Config{}
+	err = cfg.UnmarshalJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load config file %s: %s", path, err)
+	}
+	return cfg.Refine(opts...), nil
+}
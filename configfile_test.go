@@ -0,0 +1,151 @@
+package proctree
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigJSON(t *testing.T) {
+	cfg := NewConfig(WithRootPidExecutable(812, "sshd"), WithOwnedRoot(900), WithRootSelf(), WithLenientRoots(),
+		WithExcludeSubtreeExecutable("cron*"), WithMaxDepth(2), WithChildSort(ByStartTime),
+		WithMetadata(MetadataCmdline, MetadataFDs, MetadataMemory), WithMetadataPrefetch(MetadataCmdline, MetadataFDs),
+		WithTombstoneRetention(time.Minute, 100),
+		WithFilterMode(FilterSubtree))
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("json.Marshal() returned error: %s", err)
+	}
+	decoded := &Config{}
+	err = json.Unmarshal(data, decoded)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() of %s returned error: %s", data, err)
+	}
+	if decoded.String() != cfg.String() {
+		t.Errorf("Decoded config %s, expected %s", decoded, cfg)
+	}
+	redata, err := json.Marshal(decoded)
+	if err != nil || string(redata) != string(data) {
+		t.Errorf("json.Marshal() of the decoded config returned %s, %v, expected %s", redata, err, data)
+	}
+	if exe, _ := decoded.RootExecutable(812); exe != "sshd" || !containsPid(decoded.OwnedRootPids(), 900) {
+		t.Errorf("Decoded config %s lost the root executable or owned root", decoded)
+	}
+	if len(decoded.MetadataFields()) != 3 || decoded.MetadataEnabled(MetadataEnviron) {
+		t.Errorf("Decoded config enables metadata %v, expected [MetadataCmdline MetadataFDs MetadataMemory]",
+			decoded.MetadataFields())
+	}
+	if !containsPid(decoded.selfRootPids, os.Getpid()) {
+		t.Errorf("Decoded config %s lost the self root", decoded)
+	}
+
+	invalid := []string{
+		`{"roots": [{"pid": 5, "self": true}]}`,
+		`{"childOrder": "size"}`,
+		`{"metadataPrefetch": ["password"]}`,
+		`{"metadata": ["cmdline"], "metadataPrefetch": ["fds"]}`,
+		`{"gracePeriod": 5}`,
+		`{"rootPid": 5}`,
+		`{"roots": [{"pid": 5}, {"pid": 5}]}`,
+	}
+	for _, s := range invalid {
+		err = json.Unmarshal([]byte(s), &Config{})
+		if err == nil {
+			t.Errorf("json.Unmarshal() of %s did not return an error", s)
+		}
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "proctree.yaml")
+	err := ioutil.WriteFile(yamlPath, []byte(`---
+# Watch sshd, even before it starts
+roots:
+  - pid: 812
+    executable: sshd   # guards against pid reuse
+  - self: true
+lenientRoots: true
+excludeSubtreeExecutables: ["cron*", 'at # d']
+excludeSubtreePids:
+- 77
+childOrder: start
+metadataPrefetch: [cmdline, fds]
+metadataTTL: 30s
+maxDepth: 3
+`), 0644)
+	if err != nil {
+		t.Fatalf("ioutil.WriteFile() returned error: %s", err)
+	}
+	cfg, err := LoadConfigFile(yamlPath, WithKernelThreads())
+	if err != nil {
+		t.Fatalf("LoadConfigFile() returned error: %s", err)
+	}
+	expected := NewConfig(WithRootPidExecutable(812, "sshd"), WithRootSelf(), WithLenientRoots(),
+		WithExcludeSubtreeExecutable("cron*"), WithExcludeSubtreeExecutable("at # d"), WithExcludeSubtreePid(77),
+		WithChildSort(ByStartTime), WithMetadataPrefetch(MetadataCmdline, MetadataFDs),
+		WithMetadataTTL(30*time.Second), WithMaxDepth(3), WithKernelThreads())
+	if cfg.String() != expected.String() || cfg.MetadataTTL() != 30*time.Second || len(cfg.MetadataPrefetch()) != 2 {
+		t.Errorf("LoadConfigFile() returned %s, expected %s", cfg, expected)
+	}
+
+	jsonPath := filepath.Join(dir, "proctree.json")
+	data, _ := json.Marshal(cfg)
+	err = ioutil.WriteFile(jsonPath, data, 0644)
+	if err != nil {
+		t.Fatalf("ioutil.WriteFile() returned error: %s", err)
+	}
+	reloaded, err := LoadConfigFile(jsonPath)
+	if err != nil || reloaded.String() != cfg.String() {
+		t.Errorf("LoadConfigFile() of the JSON encoding returned %s, %v, expected %s", reloaded, err, cfg)
+	}
+
+	badYAML := map[string]string{
+		"tab.yaml":     "roots:\n\t- pid: 5\n",
+		"indent.yaml":  "lenientRoots: true\n    maxDepth: 3\n",
+		"unknown.yaml": "lenientRoot: true\n",
+		"dup.yml":      "maxDepth: 1\nmaxDepth: 2\n",
+		"nested.yaml":  "maxDepth: b: c\n",
+		"docs.yaml":    "maxDepth: 1\n---\nmaxDepth: 2\n",
+		"inf.yaml":     "maxDepth: .inf\n",
+	}
+	for name, content := range badYAML {
+		path := filepath.Join(dir, name)
+		err = ioutil.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("ioutil.WriteFile() returned error: %s", err)
+		}
+		_, err = LoadConfigFile(path)
+		if err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("LoadConfigFile() of %q returned error %v, expected an error naming the file", content, err)
+		}
+	}
+}
+
+func TestYAMLNumbers(t *testing.T) {
+	data, err := yamlToJSON([]byte("a: [.5, 1., +1, -2e3, 0x1F, 12345678901234567890]\nb: \"x\\_y\"\n"))
+	if err != nil {
+		t.Fatalf("yamlToJSON() returned error: %s", err)
+	}
+	expected := "{\"a\":[0.5,1,1,-2000,31,12345678901234567890],\"b\":\"x\u00a0y\"}"
+	if string(data) != expected {
+		t.Errorf("yamlToJSON() returned %s, expected %s", data, expected)
+	}
+
+	path := filepath.Join(t.TempDir(), "proctree.yaml")
+	err = ioutil.WriteFile(path, []byte("maxDepth: +3\n"), 0644)
+	if err != nil {
+		t.Fatalf("ioutil.WriteFile() returned error: %s", err)
+	}
+	cfg, err := LoadConfigFile(path)
+	if err != nil {
+		t.Fatalf("LoadConfigFile() returned error: %s", err)
+	}
+	if cfg.MaxDepth() != 3 {
+		t.Errorf("LoadConfigFile() returned max depth %d, expected 3", cfg.MaxDepth())
+	}
+}
@@ -0,0 +1,275 @@
+package proctree
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Container describes the container in which a Process runs (see Process.Container).
+type Container struct {
+	// ID is the full container id, 64 hexadecimal digits.
+	ID string
+
+	// Runtime is the container runtime that created the container, as inferred from its cgroup path: "docker",
+	// "containerd", "cri-o" or "podman", or "" if it is not known.
+	Runtime string
+
+	// Name is the name of the container, or "" if it is not known.
+	Name string
+
+	// Image is the image from which the container was created, or "" if it is not known.
+	Image string
+}
+
+// ContainerResolver looks up the names and images of containers (see WithContainerResolver).
+type ContainerResolver interface {
+	// ResolveContainer returns the name and image of the container with the provided id and runtime. Empty
+	// strings are returned, without an error, for containers that the resolver does not know; resolutions that
+	// fail with an error are retried by later calls. It may be called concurrently.
+	ResolveContainer(id string, runtime string) (name string, image string, err error)
+}
+
+// defaultDockerSocket is the path of the Docker Engine API socket used by the default ContainerResolver.
+const defaultDockerSocket = "/var/run/docker.sock"
+
+// dockerResolveTimeout is the time allowed for a request to the Docker Engine API.
+const dockerResolveTimeout = 2 * time.Second
+
+// dockerResolver is a ContainerResolver that queries the Docker Engine API.
+type dockerResolver struct {
+	client *http.Client
+}
+
+// DockerResolver returns a ContainerResolver that looks up containers with the Docker Engine API on the unix
+// socket at socketPath, e.g., /var/run/docker.sock. Podman's Docker-compatible API socket may also be used. The
+// default resolver uses /var/run/docker.sock.
+func DockerResolver(socketPath string) ContainerResolver {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network string, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
+		},
+	}
+	return &dockerResolver{client: &http.Client{Transport: transport, Timeout: dockerResolveTimeout}}
+}
+
+func (r *dockerResolver) ResolveContainer(id string, runtime string) (string, string, error) {
+	resp, err := r.client.Get("http://docker/containers/" + url.PathEscape(id) + "/json")
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", "", nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("Unable to inspect container %s: %s", id, resp.Status)
+	}
+	var inspect struct {
+		Name   string
+		Config struct {
+			Image string
+		}
+	}
+	err = json.NewDecoder(resp.Body).Decode(&inspect)
+	if err != nil {
+		return "", "", fmt.Errorf("Unable to inspect container %s: %s", id, err)
+	}
+	return strings.TrimPrefix(inspect.Name, "/"), inspect.Config.Image, nil
+}
+
+// containerScopePrefixes are the prefixes of the systemd scope units in which runtimes run containers, and the
+// runtimes that use them.
+var containerScopePrefixes = []struct {
+	prefix  string
+	runtime string
+}{
+	{"docker-", "docker"},
+	{"cri-containerd-", "containerd"},
+	{"crio-", "cri-o"},
+	{"libpod-", "podman"},
+}
+
+// isContainerID returns true if s is a full container id.
+func isContainerID(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseContainerCgroup returns the id of the container and the runtime that created it, as identified by a
+// cgroup path, e.g., "/system.slice/docker-<id>.scope" or "/kubepods/besteffort/pod<uid>/<id>". Returns an
+// empty id if the path does not belong to a container. The innermost container is returned for nested
+// containers.
+func parseContainerCgroup(cgroup string) (string, string) {
+	parts := strings.Split(cgroup, "/")
+	for i := len(parts) - 1; i >= 0; i-- {
+		part := strings.TrimSuffix(parts[i], ".scope")
+		runtime := ""
+		for _, p := range containerScopePrefixes {
+			if strings.HasPrefix(part, p.prefix) {
+				part, runtime = part[len(p.prefix):], p.runtime
+				break
+			}
+		}
+		if !isContainerID(part) {
+			continue
+		}
+		// Runtimes that use cgroupfs name the parent cgroup instead
+		for j := i - 1; j >= 0 && runtime == ""; j-- {
+			switch {
+			case parts[j] == "docker":
+				runtime = "docker"
+			case strings.HasPrefix(parts[j], "libpod"):
+				runtime = "podman"
+			}
+		}
+		return part, runtime
+	}
+	return "", ""
+}
+
+// Container returns the container in which the Process runs, or nil if it does not run in a container. The
+// container is identified by the Process's cgroup path (see Cgroup), and its name and image are looked up with
+// the ContainerResolver configured with WithContainerResolver, and cached by the ProcTree. Returns an error if
+// the cgroup cannot be read, e.g., because the Process has exited, or the platform does not support it; only
+// Linux is supported. The returned Container must not be modified.
+func (p *Process) Container() (*Container, error) {
+	cgroup, err := p.Cgroup()
+	if err != nil {
+		return nil, err
+	}
+	return p.pt.container(cgroup), nil
+}
+
+// container returns the container identified by a cgroup path, or nil if the path does not belong to a
+// container. Containers are resolved without holding the tree lock, and cached unless resolution fails.
+func (pt *ProcTree) container(cgroup string) *Container {
+	id, runtime := parseContainerCgroup(cgroup)
+	if id == "" {
+		return nil
+	}
+	pt.prlock()
+	c := pt.containers[id]
+	resolver := pt.cfg.containerResolver
+	pt.prunlock()
+	if c != nil {
+		return c
+	}
+	c = &Container{ID: id, Runtime: runtime}
+	if resolver != nil {
+		name, image, err := resolver.ResolveContainer(id, runtime)
+		if err != nil {
+			return c
+		}
+		c.Name, c.Image = name, image
+	}
+	pt.plock()
+	if pt.containers == nil {
+		pt.containers = make(map[string]*Container)
+	}
+	pt.containers[id] = c
+	pt.punlock()
+	return c
+}
+
+// ContainerGroup is a group of Processes that run in the same container, returned by ProcTree.ContainerGroups.
+type ContainerGroup struct {
+	// Container is the container in which the Processes run, or nil for Processes that do not run in a
+	// container.
+	Container *Container
+
+	// Roots are the Processes of the group whose parents are not in the group, sorted by pid. The included
+	// subtree of each root, less the subtrees of other containers, is the container's part of the tree.
+	Roots []*Process
+
+	// Processes are the Processes of the group, sorted by pid.
+	Processes []*Process
+}
+
+// ContainerGroups groups the live included Processes by the container in which they run (see Process.Container),
+// so that the tree can be viewed as a forest of containers. The group of Processes that do not run in a container
+// is first, followed by the containers sorted by id. Processes whose cgroup cannot be read, e.g., because they
+// have exited since the last update, are omitted. Returns an error on platforms other than Linux, or for a
+// ProcTree that is not updated from the system.
+func (pt *ProcTree) ContainerGroups() ([]ContainerGroup, error) {
+	procs := []*Process{}
+	pt.prlock()
+	readOnly := pt.readOnly
+	metadataErr := pt.cfg.checkMetadata(MetadataCgroup)
+	for _, proc := range pt.includedProcs {
+		if !proc.isTombstone {
+			procs = append(procs, proc)
+		}
+	}
+	pt.prunlock()
+	if readOnly {
+		return nil, fmt.Errorf("Unable to group processes by container in a ProcTree that is not updated from the system")
+	}
+	if metadataErr != nil {
+		return nil, fmt.Errorf("Unable to group processes by container: %w", metadataErr)
+	}
+	_, err := defaultProcfs.processCgroup(os.Getpid())
+	if err != nil {
+		return nil, fmt.Errorf("Unable to group processes by container: %s", err)
+	}
+
+	// Containers are looked up without holding the tree lock
+	groupOf := make(map[*Process]string, len(procs))
+	groups := make(map[string]*ContainerGroup)
+	for _, proc := range procs {
+		c, err := proc.Container()
+		if err != nil {
+			continue
+		}
+		id := ""
+		if c != nil {
+			id = c.ID
+		}
+		group := groups[id]
+		if group == nil {
+			group = &ContainerGroup{Container: c, Roots: []*Process{}, Processes: []*Process{}}
+			groups[id] = group
+		}
+		group.Processes = append(group.Processes, proc)
+		groupOf[proc] = id
+	}
+
+	pt.prlock()
+	for proc, id := range groupOf {
+		parent := proc.lockedParent()
+		parentID, ok := groupOf[parent]
+		if parent == nil || !ok || parentID != id {
+			groups[id].Roots = append(groups[id].Roots, proc)
+		}
+	}
+	pt.prunlock()
+
+	result := make([]ContainerGroup, 0, len(groups))
+	for _, group := range groups {
+		pt.SortProcessesByPid(group.Roots)
+		pt.SortProcessesByPid(group.Processes)
+		result = append(result, *group)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Container == nil || result[j].Container == nil {
+			return result[i].Container == nil && result[j].Container != nil
+		}
+		return result[i].Container.ID < result[j].Container.ID
+	})
+	return result, nil
+}
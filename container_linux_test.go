@@ -0,0 +1,150 @@
+package proctree
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	testContainerID1 = "4f1c2a3b5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f708"
+	testContainerID2 = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+)
+
+func TestParseContainerCgroup(t *testing.T) {
+	tests := []struct {
+		cgroup  string
+		id      string
+		runtime string
+	}{
+		{"/user.slice/user-1000.slice/session-2.scope", "", ""},
+		{"/system.slice/docker-" + testContainerID1 + ".scope", testContainerID1, "docker"},
+		{"/docker/" + testContainerID1, testContainerID1, "docker"},
+		{"/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod1234.slice/cri-containerd-" +
+			testContainerID1 + ".scope", testContainerID1, "containerd"},
+		{"/kubepods/besteffort/pod1234/" + testContainerID1, testContainerID1, ""},
+		{"/machine.slice/libpod-" + testContainerID1 + ".scope/container", testContainerID1, "podman"},
+		{"/docker/" + testContainerID1 + "/docker/" + testContainerID2, testContainerID2, "docker"},
+		{"/system.slice/docker-" + strings.ToUpper(testContainerID1) + ".scope", "", ""},
+	}
+	for _, test := range tests {
+		id, runtime := parseContainerCgroup(test.cgroup)
+		if id != test.id || runtime != test.runtime {
+			t.Errorf("parseContainerCgroup(%q) returned %q, %q, expected %q, %q", test.cgroup, id, runtime, test.id,
+				test.runtime)
+		}
+	}
+}
+
+// countingResolver is a ContainerResolver that names containers after their ids, and counts its calls.
+type countingResolver struct {
+	lock  sync.Mutex
+	calls int
+}
+
+func (r *countingResolver) ResolveContainer(id string, runtime string) (string, string, error) {
+	r.lock.Lock()
+	r.calls++
+	r.lock.Unlock()
+	return "name-" + id[:4], "image-" + runtime, nil
+}
+
+func TestContainerGroups(t *testing.T) {
+	dir := t.TempDir()
+	cgroups := map[int]string{
+		10: "/system.slice/sshd.service",
+		11: "/system.slice/docker-" + testContainerID1 + ".scope",
+		12: "/system.slice/docker-" + testContainerID1 + ".scope",
+		13: "/system.slice/docker-" + testContainerID2 + ".scope",
+		14: "/system.slice/sshd.service",
+	}
+	writeFakeProcess(t, dir, 10, 1, "containerd-shim", 100)
+	writeFakeProcess(t, dir, 11, 10, "nginx", 200)
+	writeFakeProcess(t, dir, 12, 11, "nginx", 300)
+	writeFakeProcess(t, dir, 13, 10, "redis", 400)
+	writeFakeProcess(t, dir, 14, 13, "nsenter", 500)
+	for pid, cgroup := range cgroups {
+		err := os.WriteFile(filepath.Join(dir, strconv.Itoa(pid), "cgroup"), []byte("0::"+cgroup+"\n"), 0644)
+		if err != nil {
+			t.Fatalf("os.WriteFile() returned error: %s", err)
+		}
+	}
+
+	resolver := &countingResolver{}
+	pt, err := New(WithProcfsPath(dir), WithRootPid(10), WithContainerResolver(resolver))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	c, err := pt.PidProcess(12).Container()
+	if err != nil {
+		t.Fatalf("proc.Container() returned error: %s", err)
+	}
+	if c == nil || c.ID != testContainerID1 || c.Runtime != "docker" || c.Name != "name-4f1c" || c.Image != "image-docker" {
+		t.Errorf("proc.Container() returned %+v", c)
+	}
+	c, err = pt.PidProcess(10).Container()
+	if err != nil || c != nil {
+		t.Errorf("proc.Container() returned %+v, %v for a process that is not in a container", c, err)
+	}
+
+	groups, err := pt.ContainerGroups()
+	if err != nil {
+		t.Fatalf("pt.ContainerGroups() returned error: %s", err)
+	}
+	summary := []string{}
+	for _, group := range groups {
+		id := "host"
+		if group.Container != nil {
+			id = group.Container.ID[:4]
+		}
+		summary = append(summary, fmt.Sprintf("%s:%s:%s", id, pidList(group.Roots), pidList(group.Processes)))
+	}
+	expected := "[host:[10 14]:[10 14] 0123:[13]:[13] 4f1c:[11]:[11 12]]"
+	if fmt.Sprint(summary) != expected {
+		t.Errorf("pt.ContainerGroups() returned %v, expected %s", summary, expected)
+	}
+	if resolver.calls != 2 {
+		t.Errorf("Containers were resolved %d times, expected 2", resolver.calls)
+	}
+}
+
+func TestDockerResolver(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "docker.sock")
+	lis, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("net.Listen() returned error: %s", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/"+testContainerID1+"/json" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"Id": "`+testContainerID1+`", "Name": "/web", "Config": {"Image": "nginx:1.25"}}`)
+	}))
+	server.Listener = lis
+	server.Start()
+	defer server.Close()
+
+	resolver := DockerResolver(socketPath)
+	name, image, err := resolver.ResolveContainer(testContainerID1, "docker")
+	if err != nil || name != "web" || image != "nginx:1.25" {
+		t.Errorf("ResolveContainer() returned %q, %q, %v", name, image, err)
+	}
+	name, image, err = resolver.ResolveContainer(testContainerID2, "containerd")
+	if err != nil || name != "" || image != "" {
+		t.Errorf("ResolveContainer() returned %q, %q, %v for an unknown container", name, image, err)
+	}
+	_, _, err = DockerResolver(filepath.Join(t.TempDir(), "missing.sock")).ResolveContainer(testContainerID1, "docker")
+	if err == nil {
+		t.Errorf("ResolveContainer() succeeded with a missing socket")
+	}
+}
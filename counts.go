@@ -0,0 +1,78 @@
+package proctree
+
+// Counts summarizes the size of a ProcTree.
+type Counts struct {
+	// Total is the number of known Processes, including Processes excluded by configuration and unpruned
+	// tombstones.
+	Total int
+
+	// Included is the number of included Processes, including unpruned tombstones.
+	Included int
+
+	// Tombstones is the number of included Processes that have exited but have not been pruned.
+	Tombstones int
+
+	// Roots is the number of roots of the included tree.
+	Roots int
+}
+
+// lockedComputeCounts recomputes the counts of the tree and the size of each included subtree, after the
+// included process lists have been rebuilt.
+func (pt *ProcTree) lockedComputeCounts() {
+	counts := Counts{
+		Total:    len(pt.pidMap),
+		Included: len(pt.includedProcs),
+		Roots:    len(pt.includedRootProcs),
+	}
+	for _, proc := range pt.includedProcs {
+		if proc.isTombstone {
+			counts.Tombstones++
+		}
+	}
+	pt.counts = counts
+	for _, proc := range pt.absProcs {
+		proc.subtreeCount = 0
+	}
+	for _, root := range pt.includedRootProcs {
+		root.lockedComputeSubtreeCount()
+	}
+}
+
+// lockedComputeSubtreeCount computes the size of the included subtree rooted at the Process, and of each
+// subtree within it. The subtree counts of all Processes must have been reset to 0; a nonzero count marks a
+// Process that has already been visited, so a chain of parents that loops back on itself is counted once. The
+// walk is iterative: Processes are listed in breadth-first order, then each count is added to its parent's in
+// reverse order.
+func (p *Process) lockedComputeSubtreeCount() int {
+	p.subtreeCount = 1
+	order := []*Process{p}
+	for i := 0; i < len(order); i++ {
+		for _, child := range order[i].includedChildProcs {
+			if child.subtreeCount == 0 {
+				child.subtreeCount = 1
+				order = append(order, child)
+			}
+		}
+	}
+	for i := len(order) - 1; i > 0; i-- {
+		order[i].parentProc.subtreeCount += order[i].subtreeCount
+	}
+	return p.subtreeCount
+}
+
+// Counts returns the number of known, included, tombstoned and root Processes as of the most recent update.
+// The counts are maintained by each update, so no walk of the tree is needed.
+func (pt *ProcTree) Counts() Counts {
+	pt.prlock()
+	defer pt.prunlock()
+	return pt.counts
+}
+
+// SubtreeCount returns the number of included Processes in the subtree rooted at this Process, including the
+// Process itself and unpruned tombstones, as of the most recent update. Returns 0 if the Process is not
+// included. The count is maintained by each update, so no walk of the subtree is needed.
+func (p *Process) SubtreeCount() int {
+	p.prlock()
+	defer p.prunlock()
+	return p.subtreeCount
+}
@@ -0,0 +1,86 @@
+package proctree
+
+// TreeDiff describes the changes between two ProcTrees, e.g., a tree loaded with LoadJSON from a dump taken
+// before an incident and one taken after it. Processes are matched by pid. Only included Processes are
+// compared, and tombstones are treated as absent.
+type TreeDiff struct {
+	// Added are the Processes of the later tree whose pids were not live in the earlier tree, sorted by pid.
+	Added []*Process
+
+	// Removed are the Processes of the earlier tree whose pids are not live in the later tree, sorted by pid.
+	Removed []*Process
+
+	// Reparented describes the Processes that are live in both trees but whose parent pid changed, sorted by
+	// pid.
+	Reparented []Reparenting
+}
+
+// Reparenting describes a Process whose parent changed between two ProcTrees.
+type Reparenting struct {
+	// Process is the Process in the later tree.
+	Process *Process
+
+	// OldParentPid is the parent pid of the Process in the earlier tree.
+	OldParentPid int
+
+	// NewParentPid is the parent pid of the Process in the later tree.
+	NewParentPid int
+}
+
+// diffEntry is the state of a live Process that is compared by Diff.
+type diffEntry struct {
+	proc *Process
+	pid  int
+	ppid int
+}
+
+// liveDiffEntries returns the live included Processes of the tree, sorted by pid, with their parent pids.
+func (pt *ProcTree) liveDiffEntries() []diffEntry {
+	pt.prlock()
+	defer pt.prunlock()
+	entries := make([]diffEntry, 0, len(pt.includedProcs))
+	for _, proc := range pt.includedProcs {
+		if !proc.isTombstone {
+			entries = append(entries, diffEntry{proc: proc, pid: proc.lockedPid(), ppid: proc.gopsProcess.PPid()})
+		}
+	}
+	return entries
+}
+
+// Diff returns the changes from an earlier ProcTree to a later one: the processes that were added, were
+// removed, and were reparented, e.g., adopted by init after their parent exited. The trees are read one at a
+// time, so each is locked only while its processes are listed. Processes are identified only by pid, so a pid
+// that was reused by a new process between the trees is not reported as removed and added.
+func Diff(before, after *ProcTree) *TreeDiff {
+	prev := before.liveDiffEntries()
+	cur := after.liveDiffEntries()
+	diff := &TreeDiff{Added: []*Process{}, Removed: []*Process{}, Reparented: []Reparenting{}}
+	// Both lists are sorted by pid, so they are merged
+	i, j := 0, 0
+	for i < len(prev) || j < len(cur) {
+		switch {
+		case j >= len(cur) || (i < len(prev) && prev[i].pid < cur[j].pid):
+			diff.Removed = append(diff.Removed, prev[i].proc)
+			i++
+		case i >= len(prev) || cur[j].pid < prev[i].pid:
+			diff.Added = append(diff.Added, cur[j].proc)
+			j++
+		default:
+			if prev[i].ppid != cur[j].ppid {
+				diff.Reparented = append(diff.Reparented, Reparenting{
+					Process:      cur[j].proc,
+					OldParentPid: prev[i].ppid,
+					NewParentPid: cur[j].ppid,
+				})
+			}
+			i++
+			j++
+		}
+	}
+	return diff
+}
+
+// Empty returns true if the diff contains no changes.
+func (d *TreeDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Reparented) == 0
+}
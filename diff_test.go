@@ -0,0 +1,38 @@
+package proctree
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	load := func(s string) *ProcTree {
+		pt, err := LoadJSON(strings.NewReader(s))
+		if err != nil {
+			t.Fatalf("LoadJSON() returned error: %s", err)
+		}
+		return pt
+	}
+	before := load(`{"roots": [{"pid": 1, "ppid": 0, "executable": "init", "children": [
+		{"pid": 10, "ppid": 1, "executable": "sshd", "children": [
+			{"pid": 11, "ppid": 10, "executable": "bash", "children": [
+				{"pid": 12, "ppid": 11, "executable": "daemon"}]}]},
+		{"pid": 20, "ppid": 1, "executable": "cron", "tombstone": true}]}]}`)
+	after := load(`{"roots": [{"pid": 1, "ppid": 0, "executable": "init", "children": [
+		{"pid": 10, "ppid": 1, "executable": "sshd"},
+		{"pid": 12, "ppid": 1, "executable": "daemon"},
+		{"pid": 20, "ppid": 1, "executable": "cron"},
+		{"pid": 30, "ppid": 1, "executable": "sleep", "tombstone": true}]}]}`)
+
+	diff := Diff(before, after)
+	if pidList(diff.Added) != "[20]" || pidList(diff.Removed) != "[11]" {
+		t.Errorf("Diff() added %s and removed %s", pidList(diff.Added), pidList(diff.Removed))
+	}
+	if len(diff.Reparented) != 1 || diff.Reparented[0].Process != after.PidProcess(12) ||
+		diff.Reparented[0].OldParentPid != 11 || diff.Reparented[0].NewParentPid != 1 {
+		t.Errorf("Diff() reparented %+v", diff.Reparented)
+	}
+	if diff.Empty() || !Diff(after, after).Empty() {
+		t.Errorf("TreeDiff.Empty() returned the wrong result")
+	}
+}
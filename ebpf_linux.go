@@ -0,0 +1,532 @@
+//go:build linux && (amd64 || arm64)
+// +build linux
+// +build amd64 arm64
+
+package proctree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+// bpf(2) commands, map and program types, from linux/bpf.h
+const (
+	bpfMapCreate          = 0
+	bpfProgLoad           = 5
+	bpfRawTracepointOpen  = 17
+	bpfMapTypeRingbuf     = 27
+	bpfProgTypeRawTracept = 17
+	bpfPseudoMapFd        = 1
+	bpfAttrSize           = 128
+	bpfLogSize            = 64 * 1024
+)
+
+// eBPF helper function IDs, from linux/bpf.h
+const (
+	bpfFuncKtimeGetNs        = 5
+	bpfFuncGetCurrentPidTgid = 14
+	bpfFuncGetCurrentComm    = 16
+	bpfFuncGetCurrentTask    = 35
+	bpfFuncProbeReadUser     = 112
+	bpfFuncProbeReadKernel   = 113
+	bpfFuncRingbufOutput     = 130
+)
+
+// eBPF instruction classes, sizes, modes, operations and sources
+const (
+	bpfClassLD    = 0x00
+	bpfClassLDX   = 0x01
+	bpfClassST    = 0x02
+	bpfClassSTX   = 0x03
+	bpfClassALU   = 0x04
+	bpfClassJMP   = 0x05
+	bpfClassALU64 = 0x07
+
+	bpfSizeW  = 0x00
+	bpfSizeDW = 0x18
+
+	bpfModeIMM = 0x00
+	bpfModeMEM = 0x60
+
+	bpfSrcK = 0x00
+	bpfSrcX = 0x08
+
+	bpfOpADD  = 0x00
+	bpfOpSUB  = 0x10
+	bpfOpRSH  = 0x70
+	bpfOpMOV  = 0xb0
+	bpfOpJA   = 0x00
+	bpfOpJEQ  = 0x10
+	bpfOpJNE  = 0x50
+	bpfOpJLE  = 0xb0
+	bpfOpJSLE = 0xd0
+	bpfOpCALL = 0x80
+	bpfOpEXIT = 0x90
+
+	bpfRegFP = 10
+)
+
+// Ring buffer layout, from linux/bpf.h
+const (
+	ringbufBusyBit    = 1 << 31
+	ringbufDiscardBit = 1 << 30
+	ringbufHdrSize    = 8
+	ringbufSize       = 256 * 1024
+)
+
+// Layout of the records written to the ring buffer by the tracing programs. The record occupies the top of
+// the eBPF stack frame, followed by two scratch slots.
+const (
+	ebpfRecordExec = 1
+	ebpfRecordExit = 2
+
+	ebpfRecordSize     = 304
+	ebpfRecPid         = 4
+	ebpfRecPpid        = 8
+	ebpfRecExitCode    = 12
+	ebpfRecTime        = 16
+	ebpfRecComm        = 24
+	ebpfRecCommLen     = 16
+	ebpfRecArgsLen     = 40
+	ebpfRecArgs        = 48
+	ebpfRecArgsMax     = 256
+	ebpfStackRecord    = -ebpfRecordSize
+	ebpfStackScratch1  = ebpfStackRecord - 8
+	ebpfStackScratch2  = ebpfStackRecord - 16
+	ebpfStackFrameSize = ebpfRecordSize + 16
+)
+
+// ebpfPollTimeoutMs bounds how long the reader blocks, so that it notices when the backend is closed.
+const ebpfPollTimeoutMs = 100
+
+// ebpfKernelOffsets are the offsets of the kernel structure members read by the tracing programs, discovered
+// from the kernel's BTF information.
+type ebpfKernelOffsets struct {
+	taskRealParent uint32
+	taskTgid       uint32
+	taskMm         uint32
+	taskExitCode   uint32
+	mmArgStart     uint32
+	mmArgEnd       uint32
+}
+
+func loadEBPFKernelOffsets() (*ebpfKernelOffsets, error) {
+	spec, err := loadKernelBTF()
+	if err != nil {
+		return nil, err
+	}
+	offsets := &ebpfKernelOffsets{}
+	for _, m := range []struct {
+		structName string
+		memberName string
+		offset     *uint32
+	}{
+		{"task_struct", "real_parent", &offsets.taskRealParent},
+		{"task_struct", "tgid", &offsets.taskTgid},
+		{"task_struct", "mm", &offsets.taskMm},
+		{"task_struct", "exit_code", &offsets.taskExitCode},
+		{"mm_struct", "arg_start", &offsets.mmArgStart},
+		{"mm_struct", "arg_end", &offsets.mmArgEnd},
+	} {
+		*m.offset, err = spec.memberOffset(m.structName, m.memberName)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return offsets, nil
+}
+
+// bpfInsn is a single eBPF instruction.
+type bpfInsn struct {
+	code uint8
+	dst  uint8
+	src  uint8
+	off  int16
+	imm  int32
+}
+
+// bpfAsm is a minimal eBPF assembler with support for forward jumps to named labels.
+type bpfAsm struct {
+	insns  []bpfInsn
+	labels map[string]int
+	fixups map[int]string
+}
+
+func newBPFAsm() *bpfAsm {
+	return &bpfAsm{
+		insns:  nil,
+		labels: make(map[string]int),
+		fixups: make(map[int]string),
+	}
+}
+
+func (a *bpfAsm) emit(code uint8, dst uint8, src uint8, off int16, imm int32) {
+	a.insns = append(a.insns, bpfInsn{code: code, dst: dst, src: src, off: off, imm: imm})
+}
+
+func (a *bpfAsm) label(name string) {
+	a.labels[name] = len(a.insns)
+}
+
+func (a *bpfAsm) jump(op uint8, src uint8, dst uint8, srcReg uint8, imm int32, label string) {
+	a.fixups[len(a.insns)] = label
+	a.emit(bpfClassJMP|op|src, dst, srcReg, 0, imm)
+}
+
+func (a *bpfAsm) movImm(dst uint8, imm int32) {
+	a.emit(bpfClassALU64|bpfOpMOV|bpfSrcK, dst, 0, 0, imm)
+}
+
+func (a *bpfAsm) movReg(dst uint8, src uint8) {
+	a.emit(bpfClassALU64|bpfOpMOV|bpfSrcX, dst, src, 0, 0)
+}
+
+func (a *bpfAsm) addImm(dst uint8, imm int32) {
+	a.emit(bpfClassALU64|bpfOpADD|bpfSrcK, dst, 0, 0, imm)
+}
+
+func (a *bpfAsm) call(helper int32) {
+	a.emit(bpfClassJMP|bpfOpCALL, 0, 0, 0, helper)
+}
+
+// stackPtr loads the address of a stack slot into a register.
+func (a *bpfAsm) stackPtr(dst uint8, off int16) {
+	a.movReg(dst, bpfRegFP)
+	a.addImm(dst, int32(off))
+}
+
+// readKernel reads size bytes from the kernel address base+off into a stack slot.
+func (a *bpfAsm) readKernel(stackOff int16, size int32, base uint8, off uint32) {
+	a.stackPtr(1, stackOff)
+	a.movImm(2, size)
+	a.movReg(3, base)
+	a.addImm(3, int32(off))
+	a.call(bpfFuncProbeReadKernel)
+}
+
+func (a *bpfAsm) assemble() ([]byte, error) {
+	var buf bytes.Buffer
+	for i, insn := range a.insns {
+		if label, ok := a.fixups[i]; ok {
+			target, ok := a.labels[label]
+			if !ok {
+				return nil, fmt.Errorf("Undefined eBPF label %s", label)
+			}
+			insn.off = int16(target - i - 1)
+		}
+		buf.WriteByte(insn.code)
+		buf.WriteByte(insn.dst | insn.src<<4)
+		binary.Write(&buf, binary.LittleEndian, insn.off)
+		binary.Write(&buf, binary.LittleEndian, insn.imm)
+	}
+	return buf.Bytes(), nil
+}
+
+// buildEBPFProgram assembles a raw tracepoint program that writes a record describing the current process
+// to the ring buffer. Exec records include the new command line; exit records include the exit code, and
+// are only written when the whole thread group exits.
+func buildEBPFProgram(recordType int32, mapFd int, offsets *ebpfKernelOffsets) ([]byte, error) {
+	a := newBPFAsm()
+
+	// The verifier requires every byte passed to a helper to be initialized
+	for off := -ebpfStackFrameSize; off < 0; off += 8 {
+		a.emit(bpfClassST|bpfModeMEM|bpfSizeDW, bpfRegFP, 0, int16(off), 0)
+	}
+
+	// r6 = tgid
+	a.call(bpfFuncGetCurrentPidTgid)
+	a.movReg(6, 0)
+	a.emit(bpfClassALU64|bpfOpRSH|bpfSrcK, 6, 0, 0, 32)
+	if recordType == ebpfRecordExit {
+		// Ignore exits of individual threads: w7 = pid; if tgid != pid goto done
+		a.emit(bpfClassALU|bpfOpMOV|bpfSrcX, 7, 0, 0, 0)
+		a.jump(bpfOpJNE, bpfSrcX, 6, 7, 0, "done")
+	}
+	a.emit(bpfClassST|bpfModeMEM|bpfSizeW, bpfRegFP, 0, ebpfStackRecord, recordType)
+	a.emit(bpfClassSTX|bpfModeMEM|bpfSizeW, bpfRegFP, 6, ebpfStackRecord+ebpfRecPid, 0)
+
+	// r8 = current task; record.ppid = task->real_parent->tgid
+	a.call(bpfFuncGetCurrentTask)
+	a.movReg(8, 0)
+	a.readKernel(ebpfStackScratch1, 8, 8, offsets.taskRealParent)
+	a.emit(bpfClassLDX|bpfModeMEM|bpfSizeDW, 9, bpfRegFP, ebpfStackScratch1, 0)
+	a.readKernel(ebpfStackRecord+ebpfRecPpid, 4, 9, offsets.taskTgid)
+
+	a.call(bpfFuncKtimeGetNs)
+	a.emit(bpfClassSTX|bpfModeMEM|bpfSizeDW, bpfRegFP, 0, ebpfStackRecord+ebpfRecTime, 0)
+
+	a.stackPtr(1, ebpfStackRecord+ebpfRecComm)
+	a.movImm(2, ebpfRecCommLen)
+	a.call(bpfFuncGetCurrentComm)
+
+	if recordType == ebpfRecordExit {
+		a.readKernel(ebpfStackRecord+ebpfRecExitCode, 4, 8, offsets.taskExitCode)
+	} else {
+		// r9 = task->mm; the argument strings lie between mm->arg_start and mm->arg_end in user memory
+		a.readKernel(ebpfStackScratch1, 8, 8, offsets.taskMm)
+		a.emit(bpfClassLDX|bpfModeMEM|bpfSizeDW, 9, bpfRegFP, ebpfStackScratch1, 0)
+		a.jump(bpfOpJEQ, bpfSrcK, 9, 0, 0, "emit")
+		a.readKernel(ebpfStackScratch1, 8, 9, offsets.mmArgStart)
+		a.readKernel(ebpfStackScratch2, 8, 9, offsets.mmArgEnd)
+		a.emit(bpfClassLDX|bpfModeMEM|bpfSizeDW, 2, bpfRegFP, ebpfStackScratch2, 0)
+		a.emit(bpfClassLDX|bpfModeMEM|bpfSizeDW, 3, bpfRegFP, ebpfStackScratch1, 0)
+		a.emit(bpfClassALU64|bpfOpSUB|bpfSrcX, 2, 3, 0, 0)
+		a.jump(bpfOpJSLE, bpfSrcK, 2, 0, 0, "emit")
+		a.jump(bpfOpJLE, bpfSrcK, 2, 0, ebpfRecArgsMax, "readargs")
+		a.movImm(2, ebpfRecArgsMax)
+		a.label("readargs")
+		a.emit(bpfClassSTX|bpfModeMEM|bpfSizeW, bpfRegFP, 2, ebpfStackRecord+ebpfRecArgsLen, 0)
+		a.stackPtr(1, ebpfStackRecord+ebpfRecArgs)
+		a.call(bpfFuncProbeReadUser)
+	}
+
+	// bpf_ringbuf_output(map, &record, sizeof(record), 0)
+	a.label("emit")
+	a.emit(bpfClassLD|bpfModeIMM|bpfSizeDW, 1, bpfPseudoMapFd, 0, int32(mapFd))
+	a.emit(0, 0, 0, 0, 0)
+	a.stackPtr(2, ebpfStackRecord)
+	a.movImm(3, ebpfRecordSize)
+	a.movImm(4, 0)
+	a.call(bpfFuncRingbufOutput)
+
+	a.label("done")
+	a.movImm(0, 0)
+	a.emit(bpfClassJMP|bpfOpEXIT, 0, 0, 0, 0)
+
+	return a.assemble()
+}
+
+// bpfCall invokes the bpf(2) system call with an attribute block.
+func bpfCall(cmd int, attr []byte) (int, error) {
+	r1, _, errno := syscall.Syscall(sysBPF, uintptr(cmd), uintptr(unsafe.Pointer(&attr[0])), uintptr(len(attr)))
+	runtime.KeepAlive(attr)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(r1), nil
+}
+
+func bpfCreateRingbuf(size uint32) (int, error) {
+	attr := make([]byte, bpfAttrSize)
+	binary.LittleEndian.PutUint32(attr[0:], bpfMapTypeRingbuf)
+	binary.LittleEndian.PutUint32(attr[12:], size)
+	return bpfCall(bpfMapCreate, attr)
+}
+
+func bpfLoadProgram(insns []byte) (int, error) {
+	license := []byte("Dual MIT/GPL\x00")
+	logBuf := make([]byte, bpfLogSize)
+	attr := make([]byte, bpfAttrSize)
+	binary.LittleEndian.PutUint32(attr[0:], bpfProgTypeRawTracept)
+	binary.LittleEndian.PutUint32(attr[4:], uint32(len(insns)/8))
+	binary.LittleEndian.PutUint64(attr[8:], uint64(uintptr(unsafe.Pointer(&insns[0]))))
+	binary.LittleEndian.PutUint64(attr[16:], uint64(uintptr(unsafe.Pointer(&license[0]))))
+	binary.LittleEndian.PutUint32(attr[24:], 1)
+	binary.LittleEndian.PutUint32(attr[28:], uint32(len(logBuf)))
+	binary.LittleEndian.PutUint64(attr[32:], uint64(uintptr(unsafe.Pointer(&logBuf[0]))))
+	copy(attr[48:64], "proctree")
+	fd, err := bpfCall(bpfProgLoad, attr)
+	runtime.KeepAlive(insns)
+	runtime.KeepAlive(license)
+	if err != nil {
+		verifierLog := strings.TrimSpace(string(bytes.TrimRight(logBuf, "\x00")))
+		if verifierLog != "" {
+			return -1, fmt.Errorf("%s: %s", err, verifierLog)
+		}
+		return -1, err
+	}
+	return fd, nil
+}
+
+func bpfAttachRawTracepoint(name string, progFd int) (int, error) {
+	nameBytes := append([]byte(name), 0)
+	attr := make([]byte, bpfAttrSize)
+	binary.LittleEndian.PutUint64(attr[0:], uint64(uintptr(unsafe.Pointer(&nameBytes[0]))))
+	binary.LittleEndian.PutUint32(attr[8:], uint32(progFd))
+	fd, err := bpfCall(bpfRawTracepointOpen, attr)
+	runtime.KeepAlive(nameBytes)
+	return fd, err
+}
+
+// ebpfBackend is a real-time backend that traces process exec and exit in the kernel with eBPF programs
+// attached to the sched_process_exec and sched_process_exit tracepoints. Unlike the other backends, it
+// reports the command line and exit code of every process, including processes too short-lived to be seen
+// by any update. Requires CAP_BPF and CAP_PERFMON (or CAP_SYS_ADMIN), and a kernel with BTF.
+type ebpfBackend struct {
+	fds      []int
+	consumer []byte
+	producer []byte
+	epollFd  int
+	closed   int32
+}
+
+// newEBPFBackend creates the eBPF real-time backend.
+func newEBPFBackend() (realtimeBackend, error) {
+	offsets, err := loadEBPFKernelOffsets()
+	if err != nil {
+		return nil, err
+	}
+	eb := &ebpfBackend{epollFd: -1}
+	ok := false
+	defer func() {
+		if !ok {
+			eb.release()
+		}
+	}()
+
+	mapFd, err := bpfCreateRingbuf(ringbufSize)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create eBPF ring buffer: %s", err)
+	}
+	eb.fds = append(eb.fds, mapFd)
+
+	for _, tp := range []struct {
+		name       string
+		recordType int32
+	}{
+		{"sched_process_exec", ebpfRecordExec},
+		{"sched_process_exit", ebpfRecordExit},
+	} {
+		insns, err := buildEBPFProgram(tp.recordType, mapFd, offsets)
+		if err != nil {
+			return nil, err
+		}
+		progFd, err := bpfLoadProgram(insns)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to load eBPF program for %s: %s", tp.name, err)
+		}
+		eb.fds = append(eb.fds, progFd)
+		linkFd, err := bpfAttachRawTracepoint(tp.name, progFd)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to attach eBPF program to %s: %s", tp.name, err)
+		}
+		eb.fds = append(eb.fds, linkFd)
+	}
+
+	pageSize := os.Getpagesize()
+	eb.consumer, err = syscall.Mmap(mapFd, 0, pageSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to map eBPF ring buffer: %s", err)
+	}
+	// The data pages are mapped twice in succession, so that records that wrap around are contiguous
+	eb.producer, err = syscall.Mmap(mapFd, int64(pageSize), pageSize+2*ringbufSize, syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to map eBPF ring buffer: %s", err)
+	}
+
+	eb.epollFd, err = syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create epoll instance: %s", err)
+	}
+	err = syscall.EpollCtl(eb.epollFd, syscall.EPOLL_CTL_ADD, mapFd, &syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(mapFd)})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to poll eBPF ring buffer: %s", err)
+	}
+
+	ok = true
+	return eb, nil
+}
+
+// release detaches the tracing programs and frees all resources.
+func (eb *ebpfBackend) release() {
+	if eb.producer != nil {
+		syscall.Munmap(eb.producer)
+		eb.producer = nil
+	}
+	if eb.consumer != nil {
+		syscall.Munmap(eb.consumer)
+		eb.consumer = nil
+	}
+	if eb.epollFd >= 0 {
+		syscall.Close(eb.epollFd)
+		eb.epollFd = -1
+	}
+	for i := len(eb.fds) - 1; i >= 0; i-- {
+		syscall.Close(eb.fds[i])
+	}
+	eb.fds = nil
+}
+
+// watch is a no-op, because the tracepoints observe all processes.
+func (eb *ebpfBackend) watch(pid int, parentPid int) {
+}
+
+func (eb *ebpfBackend) run(notify func(procNotification)) {
+	defer eb.release()
+	consumerPos := (*uint64)(unsafe.Pointer(&eb.consumer[0]))
+	producerPos := (*uint64)(unsafe.Pointer(&eb.producer[0]))
+	data := eb.producer[os.Getpagesize():]
+	mask := uint64(ringbufSize - 1)
+	events := make([]syscall.EpollEvent, 1)
+	for atomic.LoadInt32(&eb.closed) == 0 {
+		cons := atomic.LoadUint64(consumerPos)
+		for {
+			prod := atomic.LoadUint64(producerPos)
+			if cons >= prod {
+				break
+			}
+			off := cons & mask
+			hdr := atomic.LoadUint32((*uint32)(unsafe.Pointer(&data[off])))
+			if hdr&ringbufBusyBit != 0 {
+				break
+			}
+			length := uint64(hdr &^ (ringbufBusyBit | ringbufDiscardBit))
+			if hdr&ringbufDiscardBit == 0 {
+				pn, ok := parseEBPFRecord(data[off+ringbufHdrSize : off+ringbufHdrSize+length])
+				if ok {
+					notify(pn)
+				}
+			}
+			cons += (length + ringbufHdrSize + 7) &^ 7
+			atomic.StoreUint64(consumerPos, cons)
+		}
+		_, err := syscall.EpollWait(eb.epollFd, events, ebpfPollTimeoutMs)
+		if err != nil && err != syscall.EINTR {
+			return
+		}
+	}
+}
+
+// close causes run to detach the tracing programs and return.
+func (eb *ebpfBackend) close() error {
+	atomic.StoreInt32(&eb.closed, 1)
+	return nil
+}
+
+// parseEBPFRecord converts a ring buffer record written by the tracing programs into a notification.
+func parseEBPFRecord(rec []byte) (procNotification, bool) {
+	if len(rec) < ebpfRecordSize {
+		return procNotification{}, false
+	}
+	le := binary.LittleEndian
+	pn := procNotification{
+		pid:        int(le.Uint32(rec[ebpfRecPid:])),
+		parentPid:  int(le.Uint32(rec[ebpfRecPpid:])),
+		executable: string(bytes.TrimRight(rec[ebpfRecComm:ebpfRecComm+ebpfRecCommLen], "\x00")),
+	}
+	switch le.Uint32(rec[0:]) {
+	case ebpfRecordExec:
+		pn.kind = notificationExec
+		argsLen := le.Uint32(rec[ebpfRecArgsLen:])
+		if argsLen > ebpfRecArgsMax {
+			argsLen = ebpfRecArgsMax
+		}
+		args := bytes.TrimRight(rec[ebpfRecArgs:ebpfRecArgs+argsLen], "\x00")
+		if len(args) > 0 {
+			pn.cmdline = strings.Split(string(args), "\x00")
+		}
+	case ebpfRecordExit:
+		pn.kind = notificationExit
+		pn.exitStatus = newExitStatus(syscall.WaitStatus(le.Uint32(rec[ebpfRecExitCode:])))
+	default:
+		return procNotification{}, false
+	}
+	return pn, true
+}
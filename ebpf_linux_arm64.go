@@ -0,0 +1,4 @@
+package proctree
+
+// sysBPF is the bpf(2) system call number.
+const sysBPF = 280
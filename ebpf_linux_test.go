@@ -0,0 +1,107 @@
+//go:build linux && (amd64 || arm64)
+// +build linux
+// +build amd64 arm64
+
+package proctree
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEBPFBackend(t *testing.T) {
+	backend, err := newEBPFBackend()
+	if err != nil {
+		t.Skipf("eBPF tracing unavailable: %s", err)
+	}
+	notifications := make(chan procNotification, 1024)
+	go backend.run(func(n procNotification) {
+		notifications <- n
+	})
+	defer backend.close()
+
+	cmd := exec.Command("sh", "-c", "exit 7", "ebpf-test-arg")
+	err = cmd.Start()
+	if err != nil {
+		t.Fatalf("cmd.Start() returned error: %s", err)
+	}
+	pid := cmd.Process.Pid
+	cmd.Wait()
+
+	sawExec := false
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case n := <-notifications:
+			if n.pid != pid {
+				continue
+			}
+			switch n.kind {
+			case notificationExec:
+				sawExec = true
+				if strings.Join(n.cmdline, " ") != "sh -c exit 7 ebpf-test-arg" {
+					t.Errorf("Exec notification has unexpected command line %q", n.cmdline)
+				}
+			case notificationExit:
+				if !sawExec {
+					t.Errorf("Exit notification for pid %d arrived without exec notification", pid)
+				}
+				if n.exitStatus == nil || n.exitStatus.Code != 7 {
+					t.Errorf("Exit notification for pid %d has unexpected status %+v", pid, n.exitStatus)
+				}
+				if n.executable != "sh" {
+					t.Errorf("Exit notification has unexpected executable %q", n.executable)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for exit notification for pid %d", pid)
+		}
+	}
+}
+
+func TestEBPFTransientProcesses(t *testing.T) {
+	backend, err := newEBPFBackend()
+	if err != nil {
+		t.Skipf("eBPF tracing unavailable: %s", err)
+	}
+	backend.(*ebpfBackend).release()
+
+	pt, err := New(WithEBPFMonitor())
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+	sub, err := pt.Subscribe()
+	if err != nil {
+		t.Fatalf("pt.Subscribe() returned error: %s", err)
+	}
+
+	// A short-lived process may be merged as a transient before any update sees it
+	cmd := exec.Command("sh", "-c", "exit 9")
+	err = cmd.Run()
+	if err == nil {
+		t.Fatalf("cmd.Run() did not return exit error")
+	}
+	pid := cmd.Process.Pid
+
+	for {
+		ev := nextEvent(t, sub, pid)
+		if ev.Type != ProcessExited {
+			continue
+		}
+		if ev.Process.Executable() != "sh" {
+			t.Errorf("Exited process has unexpected executable %q", ev.Process.Executable())
+		}
+		if strings.Join(ev.Process.Cmdline(), " ") != "sh -c exit 9" {
+			t.Errorf("Exited process has unexpected command line %q", ev.Process.Cmdline())
+		}
+		es := ev.Process.ExitStatus()
+		if es != nil && es.Code != 9 {
+			t.Errorf("Exited process has unexpected exit code %d", es.Code)
+		}
+		break
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux || (!amd64 && !arm64)
+// +build !linux !amd64,!arm64
+
+package proctree
+
+import (
+	"fmt"
+)
+
+// newEBPFBackend creates the eBPF real-time backend. eBPF tracing is not supported on this platform.
+func newEBPFBackend() (realtimeBackend, error) {
+	return nil, fmt.Errorf("eBPF process tracing is not supported on this platform")
+}
@@ -0,0 +1,288 @@
+package proctree
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// encodedTree is the serialized form of a ProcTree: the included tree, nested from its roots. It is shared
+// by the JSON and protobuf encodings.
+type encodedTree struct {
+	Roots []*encodedProcess `json:"roots"`
+}
+
+// encodedProcess is the serialized form of a Process and its included subtree. Metadata that was not
+// captured is omitted.
+type encodedProcess struct {
+	Pid        int                `json:"pid"`
+	PPid       int                `json:"ppid"`
+	Executable string             `json:"executable"`
+	Cmdline    []string           `json:"cmdline,omitempty"`
+	UID        *int               `json:"uid,omitempty"`
+	ExecCount  int                `json:"execCount,omitempty"`
+	Tombstone  bool               `json:"tombstone,omitempty"`
+	Excluded   bool               `json:"excluded,omitempty"`
+	ExitStatus *encodedExitStatus `json:"exitStatus,omitempty"`
+	Children   []*encodedProcess  `json:"children,omitempty"`
+}
+
+// encodedExitStatus is the serialized form of an ExitStatus.
+type encodedExitStatus struct {
+	Code       int  `json:"code"`
+	Signal     int  `json:"signal,omitempty"`
+	CoreDumped bool `json:"coreDumped,omitempty"`
+}
+
+// encodedEvent is the serialized form of an Event. The Process is encoded without its children, and parents
+// are identified by pid.
+type encodedEvent struct {
+	Type         EventType
+	Process      *encodedProcess
+	Time         time.Time
+	OldParentPid *int
+	NewParentPid *int
+}
+
+func newEncodedExitStatus(es *ExitStatus) *encodedExitStatus {
+	if es == nil {
+		return nil
+	}
+	return &encodedExitStatus{
+		Code:       es.Code,
+		Signal:     int(es.Signal),
+		CoreDumped: es.CoreDumped,
+	}
+}
+
+func (ees *encodedExitStatus) exitStatus() *ExitStatus {
+	if ees == nil {
+		return nil
+	}
+	return &ExitStatus{
+		Code:       ees.Code,
+		Signal:     syscall.Signal(ees.Signal),
+		CoreDumped: ees.CoreDumped,
+	}
+}
+
+// lockedEncodedProcess builds the serialized form of a Process. If withChildren is true, its included
+// subtree is nested beneath it.
+func (p *Process) lockedEncodedProcess(withChildren bool) *encodedProcess {
+	ep := &encodedProcess{
+		Pid:        p.lockedPid(),
+		PPid:       p.gopsProcess.PPid(),
+		Executable: p.lockedExecutable(),
+		Cmdline:    p.lockedCmdline(),
+		ExecCount:  p.lockedExecCount(),
+		Tombstone:  p.isTombstone,
+		Excluded:   !p.isIncluded,
+		ExitStatus: newEncodedExitStatus(p.lockedExitStatus()),
+	}
+	if p.uid >= 0 {
+		uid := p.uid
+		ep.UID = &uid
+	}
+	if withChildren {
+		for _, child := range p.lockedChildren() {
+			ep.Children = append(ep.Children, child.lockedEncodedProcess(true))
+		}
+	}
+	return ep
+}
+
+// lockedEncodedTree builds the serialized form of the included tree.
+func (pt *ProcTree) lockedEncodedTree() *encodedTree {
+	et := &encodedTree{Roots: make([]*encodedProcess, 0, len(pt.includedRootProcs))}
+	for _, root := range pt.includedRootProcs {
+		et.Roots = append(et.Roots, root.lockedEncodedProcess(true))
+	}
+	return et
+}
+
+// lockedEncodedEvent builds the serialized form of an Event.
+func lockedEncodedEvent(ev *Event) *encodedEvent {
+	ee := &encodedEvent{
+		Type:    ev.Type,
+		Process: ev.Process.lockedEncodedProcess(false),
+		Time:    ev.Time,
+	}
+	if ev.OldParent != nil {
+		pid := ev.OldParent.lockedPid()
+		ee.OldParentPid = &pid
+	}
+	if ev.NewParent != nil {
+		pid := ev.NewParent.lockedPid()
+		ee.NewParentPid = &pid
+	}
+	return ee
+}
+
+// newReadOnlyProcTree creates an empty ProcTree that is not populated from the system, and cannot be updated.
+func newReadOnlyProcTree() *ProcTree {
+	pt := &ProcTree{
+		cfg:               NewConfig(),
+		clock:             SystemClock(),
+		procfs:            defaultProcfs,
+		pidMap:            make(map[int]*Process),
+		absProcs:          []*Process{},
+		absRootProcs:      []*Process{},
+		cfgRootProcs:      nil,
+		includedProcs:     []*Process{},
+		includedRootProcs: []*Process{},
+		done:              make(chan struct{}),
+		spawned:           make(map[int]*spawnedCmd),
+		subs:              make(map[*Subscription]struct{}),
+		pendingCmdlines:   make(map[int][]string),
+		pendingEvents:     nil,
+		pendingSummaries:  nil,
+		readOnly:          true,
+	}
+	pt.ctx, pt.cancel = context.WithCancel(context.Background())
+	return pt
+}
+
+// loadEncodedTree creates a read-only ProcTree from a serialized tree.
+func loadEncodedTree(et *encodedTree) (*ProcTree, error) {
+	pt := newReadOnlyProcTree()
+	pt.plock()
+	defer pt.punlock()
+	for _, ep := range et.Roots {
+		_, err := pt.lockedLoadEncodedProcess(ep, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	pt.lockedRebuildReadOnly()
+	return pt, nil
+}
+
+// lockedLoadEncodedProcess adds a serialized Process and its subtree to a read-only ProcTree. The derived
+// process lists must be rebuilt with lockedRebuildReadOnly afterwards.
+func (pt *ProcTree) lockedLoadEncodedProcess(ep *encodedProcess, parent *Process) (*Process, error) {
+	if ep == nil {
+		return nil, fmt.Errorf("Unable to load process tree: null process")
+	}
+	_, ok := pt.pidMap[ep.Pid]
+	if ok {
+		return nil, fmt.Errorf("Unable to load process tree: duplicate pid %d", ep.Pid)
+	}
+	proc := newProcess(pt, &staticProcess{pid: ep.Pid, ppid: ep.PPid, executable: ep.Executable})
+	proc.isTombstone = ep.Tombstone
+	proc.parentProc = parent
+	proc.origParentProc = parent
+	proc.exitStatus = ep.ExitStatus.exitStatus()
+	proc.cmdline = ep.Cmdline
+	proc.execCount = ep.ExecCount
+	if ep.UID != nil {
+		proc.uid = *ep.UID
+	}
+	pt.pidMap[ep.Pid] = proc
+	for _, child := range ep.Children {
+		_, err := pt.lockedLoadEncodedProcess(child, proc)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return proc, nil
+}
+
+// lockedRebuildReadOnly rederives the sorted process lists and child lists of a read-only ProcTree from the
+// parent links of its Processes. Every Process in a read-only ProcTree is included.
+func (pt *ProcTree) lockedRebuildReadOnly() {
+	pt.absProcs = make([]*Process, 0, len(pt.pidMap))
+	pt.absRootProcs = []*Process{}
+	for _, proc := range pt.pidMap {
+		pt.absProcs = append(pt.absProcs, proc)
+		proc.absChildProcs = []*Process{}
+	}
+	pt.lockedSortProcessesByPid(pt.absProcs)
+	for _, proc := range pt.absProcs {
+		if proc.parentProc != nil {
+			proc.parentProc.absChildProcs = append(proc.parentProc.absChildProcs, proc)
+		} else {
+			pt.absRootProcs = append(pt.absRootProcs, proc)
+		}
+	}
+	for _, proc := range pt.absProcs {
+		proc.includedChildProcs = proc.absChildProcs
+	}
+	pt.includedProcs = pt.absProcs
+	pt.includedRootProcs = pt.absRootProcs
+	pt.lockedComputeCounts()
+}
+
+// applyEncodedEvent applies a serialized Event to a read-only ProcTree, so that it tracks the tree from which
+// the event was generated, and dispatches the resulting Event to subscribers. Returns the Event, which refers
+// to this ProcTree's Processes.
+func (pt *ProcTree) applyEncodedEvent(ee *encodedEvent) (Event, error) {
+	pt.plock()
+	ev, err := pt.lockedApplyEncodedEvent(ee)
+	if err == nil && len(pt.subs) > 0 {
+		pt.lockedAppendEvent(ev)
+	}
+	pt.punlockAndDispatch()
+	return ev, err
+}
+
+func (pt *ProcTree) lockedApplyEncodedEvent(ee *encodedEvent) (Event, error) {
+	if !pt.readOnly {
+		return Event{}, fmt.Errorf("Unable to apply an event to a ProcTree that is updated from the system")
+	}
+	ep := ee.Process
+	if ep == nil {
+		return Event{}, fmt.Errorf("Unable to apply event: no process")
+	}
+	ev := Event{Type: ee.Type, Process: nil, Time: ee.Time}
+	proc, ok := pt.pidMap[ep.Pid]
+	if ee.Type == ProcessStarted {
+		if ok && !proc.isTombstone {
+			return Event{}, fmt.Errorf("Unable to apply %s event: pid %d is already live", ee.Type, ep.Pid)
+		}
+		// A tombstone with the same pid is replaced by the new Process
+		proc = newProcess(pt, nil)
+		proc.parentProc = pt.pidMap[ep.PPid]
+		proc.origParentProc = proc.parentProc
+		pt.pidMap[ep.Pid] = proc
+	} else if !ok {
+		return Event{}, fmt.Errorf("Unable to apply %s event: unknown pid %d", ee.Type, ep.Pid)
+	}
+	ev.Process = proc
+
+	switch ee.Type {
+	case ProcessReparented:
+		if ee.OldParentPid != nil {
+			ev.OldParent = pt.pidMap[*ee.OldParentPid]
+		}
+		if ee.NewParentPid != nil {
+			ev.NewParent = pt.pidMap[*ee.NewParentPid]
+		}
+		proc.prevParentProc = proc.parentProc
+		proc.parentProc = ev.NewParent
+	case ProcessExeced, ProcessExited, ProcessStarted:
+	default:
+		return Event{}, fmt.Errorf("Unable to apply event of unknown type %s", ee.Type)
+	}
+
+	// Refresh the Process's metadata from the event. The event may have been encoded some time after it was
+	// generated, so whether the Process is live is determined by the event type rather than by the encoded
+	// tombstone state.
+	proc.gopsProcess = &staticProcess{pid: ep.Pid, ppid: ep.PPid, executable: ep.Executable}
+	if ee.Type == ProcessExited {
+		proc.isTombstone = true
+	}
+	if ep.ExitStatus != nil && proc.isTombstone {
+		proc.exitStatus = ep.ExitStatus.exitStatus()
+	}
+	proc.cmdline = ep.Cmdline
+	proc.execCount = ep.ExecCount
+	if ep.UID != nil {
+		proc.uid = *ep.UID
+	}
+	pt.generation++
+	proc.changedGen = pt.generation
+
+	pt.lockedRebuildReadOnly()
+	return ev, nil
+}
@@ -0,0 +1,91 @@
+package proctree
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+var (
+	// ErrRootPidNotFound is reported, wrapped in a PidError, when a root pid configured with WithRootPid or added
+	// with AddRoot or Reconfigure does not exist.
+	ErrRootPidNotFound = errors.New("Root process does not exist")
+
+	// ErrProcessGone is reported, wrapped in a PidError, when an operation on a Process fails because the process
+	// has exited. errors.Is also reports a PidError as ErrProcessGone if the system reported that the process
+	// does not exist, e.g., because its /proc entry vanished while it was read.
+	ErrProcessGone = errors.New("Process has exited")
+
+	// ErrNoSuchPid is reported, wrapped in a PidError, by PidProcessErr and PidProcesses when no Process with a
+	// pid is in the tree, either because no such process was found by the most recent update or because its
+	// tombstone was pruned.
+	ErrNoSuchPid = errors.New("No process with the pid is in the tree")
+
+	// ErrPidExcluded is reported, wrapped in a PidError, by PidProcessErr and PidProcesses when the Process with
+	// a pid is in the tree, but is excluded by configuration.
+	ErrPidExcluded = errors.New("Process is excluded from the tree")
+
+	// ErrMetadataNotEnabled is reported, wrapped in a PidError, when metadata of a Process is requested that is not
+	// enabled by WithMetadata.
+	ErrMetadataNotEnabled = errors.New("Metadata field is not enabled")
+
+	// ErrOverlappingRoots is reported by operations on several subtrees, e.g., WalkFromRoots with
+	// WithOverlappingRootsError, when a root is repeated or is a descendant of another root.
+	ErrOverlappingRoots = errors.New("Roots overlap")
+
+	// ErrPermissionDenied is reported when the system refuses access to a process or to the process listing, e.g.,
+	// when /proc is mounted with hidepid, or when signalling a process of another user. errors.Is reports a
+	// PidError as ErrPermissionDenied if it wraps a permission error from the system.
+	ErrPermissionDenied = errors.New("Permission denied")
+
+	// ErrNotLocal is reported, wrapped in a PidError, by operations that act on a live process (e.g., SetRlimit)
+	// when the Process is not a process of the local system, because the ProcTree was loaded from an encoded tree
+	// or built with another ProcessSource.
+	ErrNotLocal = errors.New("Process is not a process of the local system")
+)
+
+// PidError describes the failure of an operation on a single process. Use errors.As to find the pid, and
+// errors.Is with the sentinel errors of this package, e.g., ErrProcessGone or ErrPermissionDenied, to find out
+// why it failed.
+type PidError struct {
+	// Op describes the operation that failed, e.g., "read start time of".
+	Op string
+
+	// Pid is the pid of the process.
+	Pid int
+
+	// Err is the reason the operation failed: one of the sentinel errors of this package, or an error from the
+	// system.
+	Err error
+}
+
+func (e *PidError) Error() string {
+	return fmt.Sprintf("Unable to %s pid %d: %s", e.Op, e.Pid, e.Err)
+}
+
+// Unwrap returns the reason the operation failed.
+func (e *PidError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports system errors wrapped by the PidError as ErrPermissionDenied or ErrProcessGone.
+func (e *PidError) Is(target error) bool {
+	switch target {
+	case ErrPermissionDenied:
+		return errors.Is(e.Err, os.ErrPermission)
+	case ErrProcessGone:
+		return errors.Is(e.Err, os.ErrNotExist) || errors.Is(e.Err, os.ErrProcessDone) ||
+			errors.Is(e.Err, syscall.ESRCH)
+	default:
+		return false
+	}
+}
+
+// newPidError returns a PidError, or nil if err is nil.
+func newPidError(op string, pid int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PidError{Op: op, Pid: pid, Err: err}
+}
@@ -0,0 +1,117 @@
+package proctree
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestPidErrors(t *testing.T) {
+	fs := newFakeSource(
+		ProcInfo{Pid: 100, Executable: "init", StartTime: 1},
+		ProcInfo{Pid: 101, PPid: 100, Executable: "sh", StartTime: 2},
+	)
+	_, err := New(WithProcessSource(fs), WithRootPid(200))
+	var pidErr *PidError
+	if !errors.Is(err, ErrRootPidNotFound) || !errors.As(err, &pidErr) || pidErr.Pid != 200 {
+		t.Fatalf("New() with a missing root returned error %v, expected ErrRootPidNotFound for pid 200", err)
+	}
+
+	pt, err := New(WithProcessSource(fs))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+	err = pt.AddRoot(200)
+	if !errors.Is(err, ErrRootPidNotFound) {
+		t.Errorf("AddRoot() of a missing pid returned error %v, expected ErrRootPidNotFound", err)
+	}
+	if errors.Is(err, ErrProcessGone) || errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("AddRoot() of a missing pid returned error %v, which matches an unrelated sentinel", err)
+	}
+
+	proc := pt.PidProcess(101)
+	fs.remove(101)
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+	_, err = proc.StartTime()
+	if !errors.Is(err, ErrProcessGone) {
+		t.Errorf("StartTime() of an exited process returned error %v, expected ErrProcessGone", err)
+	}
+	_, err = proc.Usage()
+	if !errors.Is(err, ErrProcessGone) {
+		t.Errorf("Usage() of an exited process returned error %v, expected ErrProcessGone", err)
+	}
+
+	// System errors are classified by the PidError that wraps them
+	cases := []struct {
+		err        error
+		gone       bool
+		permission bool
+	}{
+		{err: &os.PathError{Op: "open", Path: "/proc/5/environ", Err: syscall.EACCES}, permission: true},
+		{err: &os.PathError{Op: "open", Path: "/proc/5/stat", Err: syscall.ENOENT}, gone: true},
+		{err: syscall.ESRCH, gone: true},
+		{err: syscall.EPERM, permission: true},
+		{err: os.ErrProcessDone, gone: true},
+		{err: fmt.Errorf("Malformed stat")},
+	}
+	for _, c := range cases {
+		err := newPidError("read", 5, c.err)
+		if errors.Is(err, ErrProcessGone) != c.gone {
+			t.Errorf("errors.Is(%v, ErrProcessGone) returned %t, expected %t", err, !c.gone, c.gone)
+		}
+		if errors.Is(err, ErrPermissionDenied) != c.permission {
+			t.Errorf("errors.Is(%v, ErrPermissionDenied) returned %t, expected %t", err, !c.permission, c.permission)
+		}
+		if !errors.Is(err, c.err) {
+			t.Errorf("errors.Is(%v, %v) returned false", err, c.err)
+		}
+	}
+	if newPidError("read", 5, nil) != nil {
+		t.Errorf("newPidError() of a nil error returned non-nil")
+	}
+}
+
+func TestPidProcessErr(t *testing.T) {
+	fs := newFakeSource(
+		ProcInfo{Pid: 100, Executable: "init", StartTime: 1},
+		ProcInfo{Pid: 101, PPid: 100, Executable: "sh", StartTime: 2},
+		ProcInfo{Pid: 102, PPid: 101, Executable: "cc", StartTime: 3},
+	)
+	pt, err := New(WithProcessSource(fs), WithRootPid(101))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	proc, err := pt.PidProcessErr(101)
+	if err != nil || proc != pt.PidProcess(101) {
+		t.Errorf("PidProcessErr(101) returned %v, %v, expected process 101", proc, err)
+	}
+	_, err = pt.PidProcessErr(100)
+	if !errors.Is(err, ErrPidExcluded) {
+		t.Errorf("PidProcessErr() of an excluded pid returned error %v, expected ErrPidExcluded", err)
+	}
+	_, err = pt.PidProcessErr(200)
+	if !errors.Is(err, ErrNoSuchPid) {
+		t.Errorf("PidProcessErr() of an unknown pid returned error %v, expected ErrNoSuchPid", err)
+	}
+
+	procs, err := pt.PidProcesses([]int{101, 200, 102, 100})
+	var pidErr *PidError
+	if !errors.As(err, &pidErr) || pidErr.Pid != 200 || !errors.Is(err, ErrNoSuchPid) {
+		t.Errorf("PidProcesses() returned error %v, expected ErrNoSuchPid for pid 200", err)
+	}
+	if len(procs) != 2 || procs[101] == nil || procs[102] == nil {
+		t.Errorf("PidProcesses() returned %v, expected processes 101 and 102", procs)
+	}
+	procs, err = pt.PidProcesses([]int{102})
+	if err != nil || len(procs) != 1 {
+		t.Errorf("PidProcesses() returned %v, %v, expected process 102", procs, err)
+	}
+}
@@ -0,0 +1,139 @@
+package proctree
+
+import (
+	"sync"
+)
+
+// eventQueue buffers events for a Subscription that drops or coalesces events. Unlike a buffered channel, it
+// allows buffered events to be discarded before the subscriber receives them.
+type eventQueue struct {
+	// lock protects the fields below.
+	lock sync.Mutex
+
+	// cond is signalled when events are pushed or popped, and when the queue is closed.
+	cond *sync.Cond
+
+	// events is the list of buffered events, oldest first.
+	events []Event
+
+	// size is the maximum number of buffered events.
+	size int
+
+	// policy determines what happens when an event is pushed while the queue is full.
+	policy OverflowPolicy
+
+	// coalesce causes buffered events for a Process to be discarded, together with its exit event, if its
+	// start event is still buffered when it exits.
+	coalesce bool
+
+	// overflows is the number of events discarded because the queue was full.
+	overflows uint64
+
+	// closed is set when the subscription is closed.
+	closed bool
+}
+
+func newEventQueue(sc *subscribeConfig) *eventQueue {
+	q := &eventQueue{
+		events:    nil,
+		size:      sc.bufferSize,
+		policy:    sc.overflowPolicy,
+		coalesce:  sc.coalesce,
+		overflows: 0,
+		closed:    false,
+	}
+	q.cond = sync.NewCond(&q.lock)
+	return q
+}
+
+// push adds events to the queue, applying the coalescing and overflow policies. Under the OverflowBlock policy,
+// push blocks while the queue is full, until the queue is closed.
+func (q *eventQueue) push(events []Event) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for _, ev := range events {
+		if q.closed {
+			return
+		}
+		if q.coalesce && ev.Type == ProcessExited && q.lockedDiscardStarted(ev.Process) {
+			continue
+		}
+		for q.policy == OverflowBlock && len(q.events) >= q.size && !q.closed {
+			q.cond.Wait()
+		}
+		if q.closed {
+			return
+		}
+		if len(q.events) >= q.size {
+			q.events = q.events[1:]
+			q.overflows++
+		}
+		q.events = append(q.events, ev)
+		q.cond.Broadcast()
+	}
+}
+
+// lockedDiscardStarted discards all buffered events for a Process if its start event is still buffered, and
+// returns true if they were discarded.
+func (q *eventQueue) lockedDiscardStarted(proc *Process) bool {
+	started := false
+	for _, ev := range q.events {
+		if ev.Process == proc && ev.Type == ProcessStarted {
+			started = true
+			break
+		}
+	}
+	if !started {
+		return false
+	}
+	remaining := q.events[:0]
+	for _, ev := range q.events {
+		if ev.Process != proc {
+			remaining = append(remaining, ev)
+		}
+	}
+	q.events = remaining
+	q.cond.Broadcast()
+	return true
+}
+
+// run sends buffered events to ch, oldest first, until the queue is closed, and then closes ch.
+func (q *eventQueue) run(ch chan<- Event, done <-chan struct{}) {
+	defer close(ch)
+	for {
+		q.lock.Lock()
+		for len(q.events) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if q.closed {
+			q.lock.Unlock()
+			return
+		}
+		ev := q.events[0]
+		q.events = q.events[1:]
+		q.cond.Broadcast()
+		q.lock.Unlock()
+
+		select {
+		case ch <- ev:
+		case <-done:
+			return
+		}
+	}
+}
+
+// overflowCount returns the number of events discarded because the queue was full.
+func (q *eventQueue) overflowCount() uint64 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.overflows
+}
+
+// close discards buffered events, and causes blocked and subsequent pushes to return immediately.
+func (q *eventQueue) close() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.closed = true
+	q.events = nil
+	q.cond.Broadcast()
+}
@@ -0,0 +1,88 @@
+package proctree
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// startSleeps starts n sleep commands.
+func startSleeps(t *testing.T, n int) []*exec.Cmd {
+	cmds := []*exec.Cmd{}
+	for i := 0; i < n; i++ {
+		cmd := exec.Command("sleep", "10")
+		err := cmd.Start()
+		if err != nil {
+			t.Fatalf("cmd.Start() returned error: %s", err)
+		}
+		cmds = append(cmds, cmd)
+	}
+	return cmds
+}
+
+func stopSleeps(cmds []*exec.Cmd) {
+	for _, cmd := range cmds {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+}
+
+func TestSubscribeDropOldest(t *testing.T) {
+	pt, err := New()
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+	sub, err := pt.Subscribe(WithExecutableFilter("sleep"), WithBufferSize(1), WithOverflowPolicy(OverflowDropOldest))
+	if err != nil {
+		t.Fatalf("pt.Subscribe() returned error: %s", err)
+	}
+	defer sub.Close()
+
+	cmds := startSleeps(t, 4)
+	defer stopSleeps(cmds)
+
+	// The update must not block, even though nothing is reading events
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("pt.Update() returned error: %s", err)
+	}
+	if sub.Overflows() == 0 {
+		t.Errorf("sub.Overflows() returned 0 after overflowing the buffer")
+	}
+	select {
+	case <-sub.Events():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for event")
+	}
+}
+
+func TestEventQueueCoalescing(t *testing.T) {
+	q := newEventQueue(newSubscribeConfig(WithCoalescing()))
+	short := &Process{}
+	long := &Process{}
+	q.push([]Event{
+		{Type: ProcessStarted, Process: long},
+		{Type: ProcessStarted, Process: short},
+		{Type: ProcessExeced, Process: short},
+	})
+	q.push([]Event{
+		{Type: ProcessExited, Process: short},
+		{Type: ProcessExited, Process: long},
+	})
+	// Both starts were still buffered, so both Processes are discarded
+	if len(q.events) != 0 {
+		t.Errorf("%d events remain buffered after coalescing", len(q.events))
+	}
+
+	q.push([]Event{{Type: ProcessStarted, Process: long}})
+	ev := q.events[0]
+	q.events = q.events[1:]
+	if ev.Type != ProcessStarted {
+		t.Fatalf("Event type %s is not expected", ev.Type)
+	}
+	q.push([]Event{{Type: ProcessExited, Process: long}})
+	if len(q.events) != 1 || q.events[0].Type != ProcessExited {
+		t.Errorf("Exit of a Process whose start was received was coalesced")
+	}
+}
@@ -0,0 +1,613 @@
+package proctree
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"path"
+	"strconv"
+	"time"
+)
+
+// EventType identifies the kind of change described by an Event.
+type EventType int
+
+const (
+	// ProcessStarted indicates that a new Process was discovered by an update.
+	ProcessStarted EventType = iota
+
+	// ProcessExited indicates that a previously live Process was not found by an update, and has been tombstoned.
+	ProcessExited
+
+	// ProcessReparented indicates that the parent of a Process changed, typically because its parent exited
+	// and it was adopted by init or a subreaper.
+	ProcessReparented
+
+	// ProcessExeced indicates that a Process replaced its executable image while retaining its pid.
+	ProcessExeced
+)
+
+// String returns a readable name for an EventType.
+func (t EventType) String() string {
+	switch t {
+	case ProcessStarted:
+		return "ProcessStarted"
+	case ProcessExited:
+		return "ProcessExited"
+	case ProcessReparented:
+		return "ProcessReparented"
+	case ProcessExeced:
+		return "ProcessExeced"
+	}
+	return "EventType(" + strconv.Itoa(int(t)) + ")"
+}
+
+// Event describes a change to a Process observed by the ProcTree.
+type Event struct {
+	// Type is the kind of change.
+	Type EventType
+
+	// Process is the stable Process object that changed.
+	Process *Process
+
+	// Time is the time at which the change was observed.
+	Time time.Time
+
+	// OldParent is the parent of the Process before it was reparented, for ProcessReparented events.
+	// Otherwise, it is nil. The parent at the time the Process was first discovered is available
+	// from Process.OrigParent.
+	OldParent *Process
+
+	// NewParent is the parent of the Process after it was reparented, for ProcessReparented events. It is
+	// nil if the new parent is not known to the ProcTree, or for other event types.
+	NewParent *Process
+
+	// seq is the sequence number of the event within its ProcTree, starting at 1.
+	seq uint64
+}
+
+// eventMask is a set of changes observed for a single Process during an update.
+type eventMask uint
+
+const (
+	eventMaskStarted eventMask = 1 << iota
+	eventMaskExited
+	eventMaskReparented
+	eventMaskExeced
+)
+
+// defaultSubscriptionBufferSize is the number of events that can be queued for a subscriber before the
+// overflow policy applies.
+const defaultSubscriptionBufferSize = 256
+
+// OverflowPolicy determines what happens when an event is generated for a Subscription whose buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock causes updates to block until the subscriber makes room in its buffer. This is the default
+	// policy.
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowDropOldest causes the oldest buffered event to be discarded to make room for the new event.
+	// Discarded events are counted by Subscription.Overflows.
+	OverflowDropOldest
+)
+
+// String returns a readable name for an OverflowPolicy.
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "OverflowBlock"
+	case OverflowDropOldest:
+		return "OverflowDropOldest"
+	}
+	return "OverflowPolicy(" + strconv.Itoa(int(p)) + ")"
+}
+
+// Subscription is a registration for events generated by a ProcTree. Events are generated by updates, in pid order
+// within each update. With the default OverflowBlock policy, subscribers must drain their event channel promptly;
+// while a subscriber's buffer is full, the update that is dispatching events blocks, and events generated by
+// other goroutines are queued behind it.
+type Subscription struct {
+	// pt is the ProcTree that generates events for this subscription.
+	pt *ProcTree
+
+	// ch is the channel on which events are delivered. It is closed when the subscription is closed.
+	ch chan Event
+
+	// done is closed when the subscription is closed, to abort blocked deliveries.
+	done chan struct{}
+
+	// lockedMatch, if not nil, selects the events that are delivered to this subscription. It is called with
+	// the tree lock held, at the time the events are generated.
+	lockedMatch func(ev *Event) bool
+
+	// queue, if not nil, buffers events for subscriptions that drop or coalesce events. Such subscriptions
+	// have an unbuffered channel, which is fed from the queue by a background goroutine.
+	queue *eventQueue
+}
+
+// SubscribeOption is an opaque subscription option setter created by one of the With functions.
+// It follows the Golang "options" pattern.
+type SubscribeOption func(*subscribeConfig)
+
+// subscribeConfig holds the filters and buffering selected by SubscribeOptions. Within each kind of filter, an
+// event is selected if it matches any of the values; an event is delivered only if it is selected by every
+// kind of filter that was configured.
+type subscribeConfig struct {
+	// bufferSize is the number of events that can be buffered for the subscriber.
+	bufferSize int
+
+	// overflowPolicy determines what happens when the buffer is full.
+	overflowPolicy OverflowPolicy
+
+	// coalesce causes the start and exit of a Process to be discarded together if the start has not yet been
+	// received by the subscriber when the exit is generated.
+	coalesce bool
+
+	// executableGlobs select Processes whose executable name matches one of the patterns.
+	executableGlobs []string
+
+	// users select Processes whose effective user matches one of the user names or numeric user ids.
+	users []string
+
+	// subtreeRoots select Processes that are one of the roots, or descended from one of them.
+	subtreeRoots []*Process
+}
+
+func newSubscribeConfig(opts ...SubscribeOption) *subscribeConfig {
+	sc := &subscribeConfig{
+		bufferSize:     defaultSubscriptionBufferSize,
+		overflowPolicy: OverflowBlock,
+		coalesce:       false,
+	}
+	for _, opt := range opts {
+		opt(sc)
+	}
+	return sc
+}
+
+// WithBufferSize sets the number of events that can be buffered for the subscriber before the overflow policy
+// applies. The default is 256.
+func WithBufferSize(size int) SubscribeOption {
+	return func(sc *subscribeConfig) {
+		sc.bufferSize = size
+	}
+}
+
+// WithOverflowPolicy sets the policy applied when an event is generated while the subscriber's buffer is full.
+// The default is OverflowBlock.
+func WithOverflowPolicy(policy OverflowPolicy) SubscribeOption {
+	return func(sc *subscribeConfig) {
+		sc.overflowPolicy = policy
+	}
+}
+
+// WithCoalescing causes short-lived Processes to be omitted from a subscription: when a Process exits before the
+// subscriber has received the event reporting that it started, both events (and any other buffered events for
+// the Process) are discarded. This includes transient Processes reported by the eBPF monitor.
+func WithCoalescing() SubscribeOption {
+	return func(sc *subscribeConfig) {
+		sc.coalesce = true
+	}
+}
+
+// WithExecutableFilter restricts a subscription to events for Processes whose executable name matches a
+// glob pattern, using the syntax of path.Match. May be provided more than once, in which case events for
+// Processes that match any of the patterns are delivered.
+func WithExecutableFilter(pattern string) SubscribeOption {
+	return func(sc *subscribeConfig) {
+		sc.executableGlobs = append(sc.executableGlobs, pattern)
+	}
+}
+
+// WithUserFilter restricts a subscription to events for Processes whose effective user is the provided
+// user name or numeric user id. May be provided more than once, in which case events for Processes owned
+// by any of the users are delivered. The user of a Process is looked up while it is live, so exit events
+// are only delivered for Processes whose user was determined before they exited. Only supported on Linux and
+// macOS; Subscribe returns an error on other platforms.
+func WithUserFilter(user string) SubscribeOption {
+	return func(sc *subscribeConfig) {
+		sc.users = append(sc.users, user)
+	}
+}
+
+// WithSubtreeFilter restricts a subscription to events for the provided root Process and its descendants,
+// either through current parent links or through original parent links (so that descendants that are
+// reparented after their parent exits are still reported). May be provided more than once, in which case
+// events for any of the subtrees are delivered, once each, even if the subtrees overlap.
+func WithSubtreeFilter(root *Process) SubscribeOption {
+	return func(sc *subscribeConfig) {
+		sc.subtreeRoots = append(sc.subtreeRoots, root)
+	}
+}
+
+// Subscribe registers for events generated by subsequent updates. Filters provided as options are evaluated
+// as events are generated, so that events that are not selected are never queued for the subscriber. The
+// returned Subscription should be closed when no longer needed. If the ProcTree is already closed, the
+// Subscription's event channel is closed.
+func (pt *ProcTree) Subscribe(opts ...SubscribeOption) (*Subscription, error) {
+	sc := newSubscribeConfig(opts...)
+	if sc.bufferSize < 0 {
+		return nil, fmt.Errorf("Invalid subscription buffer size %d", sc.bufferSize)
+	}
+	if sc.overflowPolicy != OverflowBlock && sc.overflowPolicy != OverflowDropOldest {
+		return nil, fmt.Errorf("Invalid subscription overflow policy %s", sc.overflowPolicy)
+	}
+	if sc.bufferSize == 0 && (sc.overflowPolicy != OverflowBlock || sc.coalesce) {
+		return nil, fmt.Errorf("Subscriptions that drop or coalesce events require a nonzero buffer size")
+	}
+	lockedMatch, err := pt.newEventMatcher(sc)
+	if err != nil {
+		return nil, err
+	}
+	return pt.subscribe(sc, lockedMatch), nil
+}
+
+// newEventMatcher validates the filters in a subscribeConfig, and returns a function that selects the
+// events that match them, or nil if all events are selected.
+func (pt *ProcTree) newEventMatcher(sc *subscribeConfig) (func(ev *Event) bool, error) {
+	for _, pattern := range sc.executableGlobs {
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return nil, fmt.Errorf("Invalid executable pattern %q: %s", pattern, err)
+		}
+	}
+	uids := make([]int, 0, len(sc.users))
+	for _, name := range sc.users {
+		uid, err := lookupUID(name)
+		if err != nil {
+			return nil, err
+		}
+		uids = append(uids, uid)
+	}
+	if len(uids) > 0 {
+		_, err := defaultProcfs.processUID(os.Getpid())
+		if err != nil {
+			return nil, fmt.Errorf("Unable to filter events by user: %s", err)
+		}
+	}
+	for _, root := range sc.subtreeRoots {
+		if root == nil || root.pt != pt {
+			return nil, fmt.Errorf("Subtree filter root is not a Process in this ProcTree")
+		}
+	}
+
+	if len(sc.executableGlobs) == 0 && len(uids) == 0 && len(sc.subtreeRoots) == 0 {
+		return nil, nil
+	}
+
+	lockedMatch := func(ev *Event) bool {
+		proc := ev.Process
+		if len(sc.subtreeRoots) > 0 {
+			found := false
+			for _, root := range sc.subtreeRoots {
+				if proc.lockedIsInOwnedSubtree(root) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		if len(sc.executableGlobs) > 0 {
+			executable := proc.lockedExecutable()
+			found := false
+			for _, pattern := range sc.executableGlobs {
+				matched, _ := path.Match(pattern, executable)
+				if matched {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		if len(uids) > 0 {
+			procUID := proc.lockedUID()
+			found := false
+			for _, uid := range uids {
+				if procUID == uid {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	}
+	return lockedMatch, nil
+}
+
+// lookupUID resolves a user name or numeric user id to a user id.
+func lookupUID(name string) (int, error) {
+	uid, err := strconv.Atoi(name)
+	if err == nil {
+		return uid, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return -1, fmt.Errorf("Unable to look up user %q: %s", name, err)
+	}
+	uid, err = strconv.Atoi(u.Uid)
+	if err != nil {
+		return -1, fmt.Errorf("User %q does not have a numeric user id: %s", name, u.Uid)
+	}
+	return uid, nil
+}
+
+func (pt *ProcTree) subscribe(sc *subscribeConfig, lockedMatch func(ev *Event) bool) *Subscription {
+	pt.plock()
+	defer pt.punlock()
+	return pt.lockedSubscribe(sc, lockedMatch)
+}
+
+// lockedSubscribe registers a subscription with the tree lock held, so that callers can capture the state of the
+// tree at the point from which the subscription receives events.
+func (pt *ProcTree) lockedSubscribe(sc *subscribeConfig, lockedMatch func(ev *Event) bool) *Subscription {
+	sub := &Subscription{
+		pt:          pt,
+		done:        make(chan struct{}),
+		lockedMatch: lockedMatch,
+		queue:       nil,
+	}
+	if sc.overflowPolicy != OverflowBlock || sc.coalesce {
+		sub.ch = make(chan Event)
+		sub.queue = newEventQueue(sc)
+	} else {
+		sub.ch = make(chan Event, sc.bufferSize)
+	}
+	select {
+	case <-pt.done:
+		close(sub.done)
+		close(sub.ch)
+	default:
+		pt.subs[sub] = struct{}{}
+		if sub.queue != nil {
+			go sub.queue.run(sub.ch, sub.done)
+		}
+	}
+	return sub
+}
+
+// Events returns the channel on which events are delivered. The channel is closed when the Subscription
+// or the ProcTree is closed.
+func (sub *Subscription) Events() <-chan Event {
+	return sub.ch
+}
+
+// Overflows returns the number of events that have been discarded because the Subscription's buffer was
+// full, under the OverflowDropOldest policy.
+func (sub *Subscription) Overflows() uint64 {
+	if sub.queue == nil {
+		return 0
+	}
+	return sub.queue.overflowCount()
+}
+
+// Close cancels the Subscription and closes its event channel. Events that have already been delivered
+// to the channel buffer remain available to be read, except for subscriptions that drop or coalesce
+// events, whose buffered events are discarded.
+func (sub *Subscription) Close() {
+	pt := sub.pt
+	pt.plock()
+	_, ok := pt.subs[sub]
+	if ok {
+		delete(pt.subs, sub)
+		if sub.queue != nil {
+			sub.queue.close()
+		}
+		close(sub.done)
+	}
+	pt.punlock()
+	if ok && sub.queue == nil {
+		// Wait for any in-progress dispatch to abandon this subscription before closing the channel
+		pt.dispatchLock.Lock()
+		close(sub.ch)
+		pt.dispatchLock.Unlock()
+	}
+}
+
+// deliver sends events to the subscriber, blocking while its buffer is full under the OverflowBlock policy.
+// Delivery is abandoned if the subscription is closed.
+func (sub *Subscription) deliver(events []Event) {
+	if sub.queue != nil {
+		sub.queue.push(events)
+		return
+	}
+	for _, ev := range events {
+		// The subscription may have been closed after its events were selected
+		select {
+		case <-sub.done:
+			return
+		default:
+		}
+		select {
+		case sub.ch <- ev:
+		case <-sub.done:
+			return
+		}
+	}
+}
+
+// lockedQueueEvents converts the changes observed by an update into events, and queues them for dispatch.
+// Only changes to included Processes generate events.
+func (pt *ProcTree) lockedQueueEvents(changes map[*Process]eventMask) {
+	if len(changes) == 0 || len(pt.subs) == 0 {
+		return
+	}
+	procs := make([]*Process, 0, len(changes))
+	for proc := range changes {
+		if proc.isIncluded {
+			procs = append(procs, proc)
+		}
+	}
+	pt.lockedSortProcessesByPid(procs)
+	now := pt.clock.Now()
+	for _, proc := range procs {
+		mask := changes[proc]
+		for _, et := range []struct {
+			mask      eventMask
+			eventType EventType
+		}{
+			{eventMaskStarted, ProcessStarted},
+			{eventMaskExeced, ProcessExeced},
+			{eventMaskReparented, ProcessReparented},
+			{eventMaskExited, ProcessExited},
+		} {
+			if mask&et.mask != 0 {
+				ev := Event{Type: et.eventType, Process: proc, Time: now}
+				if et.eventType == ProcessReparented {
+					ev.OldParent = proc.prevParentProc
+					ev.NewParent = proc.parentProc
+				}
+				pt.lockedAppendEvent(ev)
+			}
+		}
+	}
+}
+
+// lockedAppendEvent assigns the next sequence number to an event and queues it for dispatch.
+func (pt *ProcTree) lockedAppendEvent(ev Event) {
+	pt.eventSeq++
+	ev.seq = pt.eventSeq
+	pt.pendingEvents = append(pt.pendingEvents, ev)
+}
+
+// punlockAndDispatch releases the tree lock, and then delivers any queued events to subscribers, and any
+// update summaries to update hooks. Each subscription's events are selected before the lock is released, so that
+// filters see the tree as it was when the events were generated. The selected events are handed off to a queue
+// that is drained by one goroutine at a time, so that subscribers observe events in the order in which they were
+// generated. If no other goroutine is dispatching, the caller drains the queue after releasing the tree lock;
+// otherwise it returns without waiting, so that a subscriber that updates the tree while a dispatch is blocked on
+// its full buffer does not deadlock, and readers of the tree are never blocked by a dispatch.
+func (pt *ProcTree) punlockAndDispatch() {
+	events := pt.pendingEvents
+	pt.pendingEvents = nil
+	summaries := pt.pendingSummaries
+	pt.pendingSummaries = nil
+	hooks := pt.cfg.updateHooks
+	log := pt.cfg.logger
+	if len(events) == 0 && len(summaries) == 0 {
+		pt.punlock()
+		return
+	}
+	// The processes of traced events are described while the tree lock is held, and logged after it is released
+	type tracedEvent struct {
+		pid        int
+		executable string
+	}
+	var traced []tracedEvent
+	if traceEnabled(log) {
+		traced = make([]tracedEvent, len(events))
+		for i, ev := range events {
+			traced[i] = tracedEvent{pid: ev.Process.lockedPid(), executable: ev.Process.lockedExecutable()}
+		}
+	}
+	type delivery struct {
+		sub    *Subscription
+		events []Event
+	}
+	deliveries := make([]delivery, 0, len(pt.subs))
+	for sub := range pt.subs {
+		subEvents := events
+		if sub.lockedMatch != nil {
+			subEvents = nil
+			for i := range events {
+				if sub.lockedMatch(&events[i]) {
+					subEvents = append(subEvents, events[i])
+				}
+			}
+		}
+		if len(subEvents) > 0 {
+			deliveries = append(deliveries, delivery{sub: sub, events: subEvents})
+		}
+	}
+	dispatch := func() {
+		for _, summary := range summaries {
+			logDebug(log, "Updated process tree", "processes", summary.Processes, "added", summary.Added,
+				"removed", summary.Removed, "pruned", summary.Pruned, "reparented", summary.Reparented,
+				"execed", summary.Execed, "duration", summary.Duration)
+		}
+		for i, te := range traced {
+			logTrace(log, "Dispatching event", "type", events[i].Type.String(), "pid", te.pid,
+				"executable", te.executable)
+		}
+		if len(traced) > 0 {
+			logTrace(log, "Delivering events to subscriptions", "events", len(events), "subscriptions", len(deliveries))
+		}
+		for _, d := range deliveries {
+			d.sub.deliver(d.events)
+		}
+		pt.dispatchSummaries(summaries, hooks)
+	}
+
+	pt.dispatchQueueLock.Lock()
+	pt.dispatchQueue = append(pt.dispatchQueue, dispatch)
+	drain := !pt.dispatching
+	pt.dispatching = true
+	pt.dispatchQueueLock.Unlock()
+	pt.punlock()
+	if drain {
+		pt.drainDispatchQueue()
+	}
+}
+
+// drainDispatchQueue dispatches queued batches of events in order, until the queue is empty. Called without the
+// tree lock held, by the goroutine that set dispatching.
+func (pt *ProcTree) drainDispatchQueue() {
+	for {
+		pt.dispatchQueueLock.Lock()
+		if len(pt.dispatchQueue) == 0 {
+			pt.dispatching = false
+			pt.dispatchQueueLock.Unlock()
+			return
+		}
+		dispatch := pt.dispatchQueue[0]
+		pt.dispatchQueue[0] = nil
+		pt.dispatchQueue = pt.dispatchQueue[1:]
+		pt.dispatchQueueLock.Unlock()
+
+		pt.dispatchLock.Lock()
+		dispatch()
+		pt.dispatchLock.Unlock()
+	}
+}
+
+// closeSubscriptions closes all active subscriptions. Called when the ProcTree is closed.
+func (pt *ProcTree) closeSubscriptions() {
+	pt.plock()
+	subs := make([]*Subscription, 0, len(pt.subs))
+	for sub := range pt.subs {
+		subs = append(subs, sub)
+	}
+	pt.punlock()
+	for _, sub := range subs {
+		sub.Close()
+	}
+}
+
+// Watch registers for events that affect the subtree rooted at this Process: the Process itself, and any
+// Process that is descended from it, either through current parent links or through original parent links
+// (so that descendants that are reparented after their parent exits are still reported). The returned
+// Subscription is closed when ctx is done, when it is closed explicitly, or when the ProcTree is closed.
+func (p *Process) Watch(ctx context.Context) *Subscription {
+	sub := p.pt.subscribe(newSubscribeConfig(), func(ev *Event) bool {
+		return ev.Process.lockedIsInOwnedSubtree(p)
+	})
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				sub.Close()
+			case <-sub.done:
+			}
+		}()
+	}
+	return sub
+}
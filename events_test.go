@@ -0,0 +1,349 @@
+package proctree
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// nextEvent waits for the next event on a subscription that refers to the given pid, skipping unrelated events.
+func nextEvent(t *testing.T, sub *Subscription, pid int) Event {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev, ok := <-sub.Events():
+			if !ok {
+				t.Fatalf("Subscription closed while waiting for event for pid %d", pid)
+			}
+			if ev.Process.Pid() == pid {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for event for pid %d", pid)
+		}
+	}
+}
+
+func TestStartedExitedEvents(t *testing.T) {
+	pt, err := New()
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	sub, err := pt.Subscribe()
+	if err != nil {
+		t.Fatalf("pt.Subscribe() returned error: %s", err)
+	}
+
+	cmd := exec.Command("sleep", "10")
+	err = cmd.Start()
+	if err != nil {
+		t.Fatalf("cmd.Start() returned error: %s", err)
+	}
+	pid := cmd.Process.Pid
+
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("pt.Update() returned error: %s", err)
+	}
+	ev := nextEvent(t, sub, pid)
+	if ev.Type != ProcessStarted {
+		t.Errorf("Event type %s is not expected", ev.Type)
+	}
+
+	cmd.Process.Kill()
+	cmd.Wait()
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("pt.Update() returned error: %s", err)
+	}
+	ev = nextEvent(t, sub, pid)
+	if ev.Type != ProcessExited {
+		t.Errorf("Event type %s is not expected", ev.Type)
+	}
+
+	pt.Close()
+	for range sub.Events() {
+	}
+}
+
+func TestWatchSubtree(t *testing.T) {
+	pt, err := New(WithAutoUpdate(10*time.Millisecond, false))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	cmd := exec.Command("sh", "-c", "sleep 0.3; sleep 10")
+	proc, err := pt.StartCommand(context.Background(), cmd, true)
+	if err != nil {
+		t.Fatalf("pt.StartCommand() returned error: %s", err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := proc.Watch(ctx)
+
+	unrelated := exec.Command("sleep", "10")
+	err = unrelated.Start()
+	if err != nil {
+		t.Fatalf("unrelated.Start() returned error: %s", err)
+	}
+	defer unrelated.Wait()
+	defer unrelated.Process.Kill()
+
+	// The first child of the shell may start before the subscription, so wait for any Started event
+	timeout := time.After(5 * time.Second)
+	for started := false; !started; {
+		select {
+		case ev := <-sub.Events():
+			if !ev.Process.IsDescendantOf(proc) {
+				t.Errorf("Unexpected %s event for pid %d", ev.Type, ev.Process.Pid())
+			}
+			started = (ev.Type == ProcessStarted)
+		case <-timeout:
+			t.Fatalf("Timed out waiting for subtree event")
+		}
+	}
+
+	cancel()
+	for range sub.Events() {
+	}
+}
+
+func TestSubscribeFilters(t *testing.T) {
+	pt, err := New()
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	_, err = pt.Subscribe(WithExecutableFilter("["))
+	if err == nil {
+		t.Errorf("pt.Subscribe() accepted an invalid executable pattern")
+	}
+
+	sub, err := pt.Subscribe(WithExecutableFilter("sle?p"), WithUserFilter(strconv.Itoa(os.Geteuid())))
+	if err != nil {
+		t.Fatalf("pt.Subscribe() returned error: %s", err)
+	}
+	defer sub.Close()
+
+	unrelated := exec.Command("cat")
+	_, err = unrelated.StdinPipe()
+	if err != nil {
+		t.Fatalf("unrelated.StdinPipe() returned error: %s", err)
+	}
+	err = unrelated.Start()
+	if err != nil {
+		t.Fatalf("unrelated.Start() returned error: %s", err)
+	}
+	defer unrelated.Wait()
+	defer unrelated.Process.Kill()
+
+	cmd := exec.Command("sleep", "10")
+	err = cmd.Start()
+	if err != nil {
+		t.Fatalf("cmd.Start() returned error: %s", err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("pt.Update() returned error: %s", err)
+	}
+	// Events are delivered before Update returns
+	found := false
+	for {
+		select {
+		case ev := <-sub.Events():
+			if ev.Process.Executable() != "sleep" {
+				t.Errorf("Unexpected %s event for executable %s", ev.Type, ev.Process.Executable())
+			}
+			if ev.Process.Pid() == cmd.Process.Pid {
+				found = true
+			}
+			continue
+		default:
+		}
+		break
+	}
+	if !found {
+		t.Errorf("No event delivered for pid %d", cmd.Process.Pid)
+	}
+}
+
+func TestReparentedEvent(t *testing.T) {
+	pt, err := New()
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+	sub, err := pt.Subscribe()
+	if err != nil {
+		t.Fatalf("pt.Subscribe() returned error: %s", err)
+	}
+
+	// The shell starts a background child, and exits when its stdin is closed, orphaning the child
+	cmd := exec.Command("sh", "-c", "sleep 10 & echo $!; read x")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("cmd.StdinPipe() returned error: %s", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("cmd.StdoutPipe() returned error: %s", err)
+	}
+	err = cmd.Start()
+	if err != nil {
+		t.Fatalf("cmd.Start() returned error: %s", err)
+	}
+	var childPid int
+	_, err = fmt.Fscan(stdout, &childPid)
+	if err != nil {
+		t.Fatalf("Unable to read child pid: %s", err)
+	}
+	defer signalPid(childPid, os.Kill)
+
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("pt.Update() returned error: %s", err)
+	}
+	ev := nextEvent(t, sub, childPid)
+	if ev.Type != ProcessStarted {
+		t.Errorf("Event type %s is not expected", ev.Type)
+	}
+
+	stdin.Close()
+	cmd.Wait()
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("pt.Update() returned error: %s", err)
+	}
+	ev = nextEvent(t, sub, childPid)
+	if ev.Type != ProcessReparented {
+		t.Fatalf("Event type %s is not expected", ev.Type)
+	}
+	if ev.OldParent == nil || ev.OldParent.Pid() != cmd.Process.Pid {
+		t.Errorf("Reparented event OldParent is not the exited shell")
+	}
+	if ev.NewParent != nil && ev.NewParent == ev.OldParent {
+		t.Errorf("Reparented event NewParent is the same as OldParent")
+	}
+	if ev.Process.OrigParent() != ev.OldParent {
+		t.Errorf("OrigParent is not the exited shell")
+	}
+}
+
+func TestExecedEvent(t *testing.T) {
+	pt, err := New()
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+	sub, err := pt.Subscribe()
+	if err != nil {
+		t.Fatalf("pt.Subscribe() returned error: %s", err)
+	}
+
+	// The shell replaces itself with sleep when a line is written to its stdin
+	cmd := exec.Command("sh", "-c", "read x; exec sleep 10")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("cmd.StdinPipe() returned error: %s", err)
+	}
+	err = cmd.Start()
+	if err != nil {
+		t.Fatalf("cmd.Start() returned error: %s", err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+	pid := cmd.Process.Pid
+
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("pt.Update() returned error: %s", err)
+	}
+	ev := nextEvent(t, sub, pid)
+	if ev.Type != ProcessStarted {
+		t.Errorf("Event type %s is not expected", ev.Type)
+	}
+	proc := ev.Process
+
+	fmt.Fprintln(stdin, "go")
+	deadline := time.Now().Add(5 * time.Second)
+	for proc.Executable() != "sleep" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		err = pt.Update(false)
+		if err != nil {
+			t.Fatalf("pt.Update() returned error: %s", err)
+		}
+	}
+	ev = nextEvent(t, sub, pid)
+	if ev.Type != ProcessExeced || ev.Process != proc {
+		t.Fatalf("Event type %s is not expected", ev.Type)
+	}
+	if proc.ExecCount() != 1 {
+		t.Errorf("ExecCount() returned %d, expected 1", proc.ExecCount())
+	}
+}
+
+func TestUpdateWhileDispatchBlocked(t *testing.T) {
+	fs := newFakeSource(ProcInfo{Pid: 100, Executable: "init", StartTime: 1})
+	pt, err := New(WithProcessSource(fs))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+	sub, err := pt.Subscribe(WithBufferSize(1))
+	if err != nil {
+		t.Fatalf("Subscribe() returned error: %s", err)
+	}
+	defer sub.Close()
+
+	// An update generates more events than the subscriber's buffer holds, so its dispatch blocks
+	for pid := 101; pid <= 103; pid++ {
+		fs.set(ProcInfo{Pid: pid, PPid: 100, Executable: "worker", StartTime: 2})
+	}
+	blocked := make(chan error)
+	go func() {
+		blocked <- pt.Update(false)
+	}()
+	for len(sub.Events()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The subscriber updates the tree before draining its events
+	fs.set(ProcInfo{Pid: 104, PPid: 100, Executable: "worker", StartTime: 3})
+	updated := make(chan error)
+	go func() {
+		updated <- pt.Update(false)
+	}()
+	select {
+	case err = <-updated:
+		if err != nil {
+			t.Fatalf("Update() returned error: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Update() by a subscriber deadlocked with a blocked dispatch")
+	}
+	if len(pt.Roots()) != 1 {
+		t.Errorf("Roots() returned %d roots, expected 1", len(pt.Roots()))
+	}
+
+	for pid := 101; pid <= 104; pid++ {
+		ev := nextEvent(t, sub, pid)
+		if ev.Type != ProcessStarted {
+			t.Errorf("Event type %s for pid %d is not expected", ev.Type, pid)
+		}
+	}
+	err = <-blocked
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+}
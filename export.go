@@ -0,0 +1,206 @@
+package proctree
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Record is a flat, tabular description of a single Process, for export to spreadsheets and databases.
+type Record struct {
+	// Pid is the pid of the Process.
+	Pid int
+
+	// PPid is the pid of the parent process, which may not be included in the tree.
+	PPid int
+
+	// Depth is the depth of the Process in the included tree (see Process.Depth).
+	Depth int
+
+	// Executable is the executable name of the Process.
+	Executable string
+
+	// UID is the effective user id of the Process, or -1 if it is not known.
+	UID int
+
+	// User is the name of the user identified by UID, or its decimal representation if it has no name. It is
+	// empty if UID is not known.
+	User string
+
+	// CPUTime is the total user and system CPU time consumed by the Process. It is 0 if it is not known, e.g.,
+	// for tombstones.
+	CPUTime time.Duration
+
+	// RSS is the resident set size of the Process in bytes. It is 0 if it is not known, e.g., for tombstones.
+	RSS uint64
+
+	// Tombstone is true if the Process had exited when the record was produced.
+	Tombstone bool
+}
+
+// csvHeader lists the columns written by WriteCSV.
+var csvHeader = []string{"pid", "ppid", "depth", "executable", "uid", "user", "cpu_seconds", "rss_bytes", "tombstone"}
+
+// Records returns a Record for each included Process, in the order in which Walk visits them. CPU time and
+// resident set size are sampled when Records is called, and are currently only available on Linux.
+func (pt *ProcTree) Records() []Record {
+	pt.plock()
+	records := []Record{}
+	pt.lockedWalk(func(proc *Process) error {
+		records = append(records, Record{
+			Pid:        proc.lockedPid(),
+			PPid:       proc.gopsProcess.PPid(),
+			Depth:      proc.lockedDepth(),
+			Executable: proc.lockedExecutable(),
+			UID:        proc.lockedUID(),
+			Tombstone:  proc.isTombstone,
+		})
+		return nil
+	})
+	pt.punlock()
+
+	// Usage and user names are looked up without holding the tree lock
+	users := userNames{}
+	for i := range records {
+		rec := &records[i]
+		if !rec.Tombstone {
+			usage, _ := pt.procfs.processUsage(rec.Pid)
+			rec.CPUTime, rec.RSS = usage.CPUTime, usage.RSS
+		}
+		rec.User = users.lookup(rec.UID)
+	}
+	return records
+}
+
+// userNames caches user names by user id, so that each user id is only looked up once.
+type userNames map[int]string
+
+// lookup returns the name of the user with the provided user id, or its decimal representation if it has no
+// name, or "" if uid is -1.
+func (un userNames) lookup(uid int) string {
+	if uid < 0 {
+		return ""
+	}
+	name, ok := un[uid]
+	if !ok {
+		name = strconv.Itoa(uid)
+		u, err := user.LookupId(name)
+		if err == nil {
+			name = u.Username
+		}
+		un[uid] = name
+	}
+	return name
+}
+
+// WriteCSV writes the Records of the included tree to w as CSV, with a header row. CPU time is written in
+// seconds, and unknown user ids are written as empty fields.
+func (pt *ProcTree) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write(csvHeader)
+	if err != nil {
+		return err
+	}
+	for _, rec := range pt.Records() {
+		uid := ""
+		if rec.UID >= 0 {
+			uid = strconv.Itoa(rec.UID)
+		}
+		err = cw.Write([]string{
+			strconv.Itoa(rec.Pid),
+			strconv.Itoa(rec.PPid),
+			strconv.Itoa(rec.Depth),
+			rec.Executable,
+			uid,
+			rec.User,
+			strconv.FormatFloat(rec.CPUTime.Seconds(), 'f', -1, 64),
+			strconv.FormatUint(rec.RSS, 10),
+			strconv.FormatBool(rec.Tombstone),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// graphNode is a Process in a graph written by WriteDOT or WriteMermaid.
+type graphNode struct {
+	pid        int
+	parentPid  int
+	executable string
+	tombstone  bool
+}
+
+// graphNodes returns a graphNode for each included Process, in the order in which Walk visits them. parentPid is
+// -1 for included roots.
+func (pt *ProcTree) graphNodes() []graphNode {
+	pt.prlock()
+	defer pt.prunlock()
+	nodes := []graphNode{}
+	pt.lockedWalk(func(proc *Process) error {
+		parentPid := -1
+		if parent := proc.lockedParent(); parent != nil {
+			parentPid = parent.lockedPid()
+		}
+		nodes = append(nodes, graphNode{
+			pid:        proc.lockedPid(),
+			parentPid:  parentPid,
+			executable: proc.lockedExecutable(),
+			tombstone:  proc.isTombstone,
+		})
+		return nil
+	})
+	return nodes
+}
+
+// WriteDOT writes the included tree to w as a Graphviz DOT digraph, with a node for each Process, labeled with
+// its pid and executable name, and an edge from each Process to each of its included children. Tombstones are
+// drawn with dashed outlines. The output can be rendered with Graphviz, e.g., "dot -Tsvg".
+func (pt *ProcTree) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("digraph proctree {\n\tnode [shape=box];\n")
+	for _, node := range pt.graphNodes() {
+		label := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(fmt.Sprintf("[%d] %s", node.pid, node.executable))
+		style := ""
+		if node.tombstone {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(bw, "\t%d [label=\"%s\"%s];\n", node.pid, label, style)
+		if node.parentPid >= 0 {
+			fmt.Fprintf(bw, "\t%d -> %d;\n", node.parentPid, node.pid)
+		}
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+// WriteMermaid writes the included tree to w as a Mermaid flowchart, with a node for each Process, labeled with
+// its pid and executable name, and a link from each Process to each of its included children. Tombstones are
+// drawn with dashed outlines. The output can be embedded in Markdown that supports Mermaid diagrams.
+func (pt *ProcTree) WriteMermaid(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("graph TD\n")
+	tombstones := false
+	for _, node := range pt.graphNodes() {
+		label := strings.NewReplacer(`"`, "#quot;").Replace(fmt.Sprintf("[%d] %s", node.pid, node.executable))
+		fmt.Fprintf(bw, "\tp%d[\"%s\"]\n", node.pid, label)
+		if node.tombstone {
+			fmt.Fprintf(bw, "\tclass p%d tombstone\n", node.pid)
+			tombstones = true
+		}
+		if node.parentPid >= 0 {
+			fmt.Fprintf(bw, "\tp%d --> p%d\n", node.parentPid, node.pid)
+		}
+	}
+	if tombstones {
+		bw.WriteString("\tclassDef tombstone stroke-dasharray: 5 5\n")
+	}
+	return bw.Flush()
+}
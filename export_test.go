@@ -0,0 +1,80 @@
+package proctree
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRecordsAndCSV(t *testing.T) {
+	pt, err := New(WithRootPid(os.Getpid()))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	records := pt.Records()
+	if len(records) != len(pt.Processes()) || records[0].Pid != os.Getpid() || records[0].Depth != 0 {
+		t.Fatalf("pt.Records() returned unexpected records %+v", records)
+	}
+
+	var buf bytes.Buffer
+	err = pt.WriteCSV(&buf)
+	if err != nil {
+		t.Fatalf("pt.WriteCSV() returned error: %s", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Unable to read CSV: %s", err)
+	}
+	if len(rows) != len(records)+1 || rows[0][0] != "pid" || rows[1][0] != strconv.Itoa(os.Getpid()) {
+		t.Errorf("pt.WriteCSV() wrote unexpected rows %v", rows)
+	}
+}
+
+func TestDOTAndMermaid(t *testing.T) {
+	pt, err := LoadJSON(strings.NewReader(`{"roots":[{"pid":1,"executable":"init","children":[
+		{"pid":10,"ppid":1,"executable":"my \"shell\""},
+		{"pid":11,"ppid":1,"executable":"cron","tombstone":true}]}]}`))
+	if err != nil {
+		t.Fatalf("LoadJSON() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	var buf bytes.Buffer
+	err = pt.WriteDOT(&buf)
+	if err != nil {
+		t.Fatalf("pt.WriteDOT() returned error: %s", err)
+	}
+	expected := "digraph proctree {\n" +
+		"\tnode [shape=box];\n" +
+		"\t1 [label=\"[1] init\"];\n" +
+		"\t10 [label=\"[10] my \\\"shell\\\"\"];\n" +
+		"\t1 -> 10;\n" +
+		"\t11 [label=\"[11] cron\", style=dashed];\n" +
+		"\t1 -> 11;\n" +
+		"}\n"
+	if buf.String() != expected {
+		t.Errorf("pt.WriteDOT() wrote:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+
+	buf.Reset()
+	err = pt.WriteMermaid(&buf)
+	if err != nil {
+		t.Fatalf("pt.WriteMermaid() returned error: %s", err)
+	}
+	expected = "graph TD\n" +
+		"\tp1[\"[1] init\"]\n" +
+		"\tp10[\"[10] my #quot;shell#quot;\"]\n" +
+		"\tp1 --> p10\n" +
+		"\tp11[\"[11] cron\"]\n" +
+		"\tclass p11 tombstone\n" +
+		"\tp1 --> p11\n" +
+		"\tclassDef tombstone stroke-dasharray: 5 5\n"
+	if buf.String() != expected {
+		t.Errorf("pt.WriteMermaid() wrote:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
@@ -0,0 +1,95 @@
+package proctree
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// expvarLock serializes PublishExpvar, so that publishing a duplicate name returns an error rather than
+// panicking.
+var expvarLock sync.Mutex
+
+// updateStats accumulates the summaries of the updates of a ProcTree.
+type updateStats struct {
+	updates      uint64
+	lastUpdate   time.Time
+	lastDuration time.Duration
+	added        uint64
+	removed      uint64
+	pruned       uint64
+	reparented   uint64
+	execed       uint64
+}
+
+func (s *updateStats) lockedAdd(summary *UpdateSummary) {
+	s.updates++
+	s.lastUpdate = summary.Time
+	s.lastDuration = summary.Duration
+	s.added += uint64(summary.Added)
+	s.removed += uint64(summary.Removed)
+	s.pruned += uint64(summary.Pruned)
+	s.reparented += uint64(summary.Reparented)
+	s.execed += uint64(summary.Execed)
+}
+
+// expvarValue is the value published by PublishExpvar.
+type expvarValue struct {
+	Total        int     `json:"total"`
+	Included     int     `json:"included"`
+	Tombstones   int     `json:"tombstones"`
+	Roots        int     `json:"roots"`
+	Updates      uint64  `json:"updates"`
+	LastUpdate   string  `json:"last_update,omitempty"`
+	LastDuration float64 `json:"last_update_seconds"`
+	Added        uint64  `json:"added"`
+	Removed      uint64  `json:"removed"`
+	Pruned       uint64  `json:"pruned"`
+	Reparented   uint64  `json:"reparented"`
+	Execed       uint64  `json:"execed"`
+}
+
+func (pt *ProcTree) expvarValue() interface{} {
+	pt.prlock()
+	defer pt.prunlock()
+	v := expvarValue{
+		Total:        pt.counts.Total,
+		Included:     pt.counts.Included,
+		Tombstones:   pt.counts.Tombstones,
+		Roots:        pt.counts.Roots,
+		Updates:      pt.stats.updates,
+		LastDuration: pt.stats.lastDuration.Seconds(),
+		Added:        pt.stats.added,
+		Removed:      pt.stats.removed,
+		Pruned:       pt.stats.pruned,
+		Reparented:   pt.stats.reparented,
+		Execed:       pt.stats.execed,
+	}
+	if !pt.stats.lastUpdate.IsZero() {
+		v.LastUpdate = pt.stats.lastUpdate.UTC().Format(time.RFC3339Nano)
+	}
+	return v
+}
+
+// PublishExpvar publishes live statistics of the ProcTree through the expvar package, as a single variable
+// named name whose value is a JSON object with the fields:
+//
+//	total, included, tombstones, roots      the Counts of the tree
+//	updates                                 the number of completed updates
+//	last_update, last_update_seconds        the start time (RFC 3339) and duration of the most recent update
+//	added, removed, pruned, reparented,     cumulative numbers of Processes discovered, tombstoned, pruned,
+//	execed                                  reparented and exec'd by all updates (see UpdateSummary)
+//
+// The statistics are read when the variable is, e.g., when /debug/vars is served. Since expvar variables
+// cannot be unpublished, the variable continues to report the final statistics after the ProcTree is closed.
+// Returns an error if a variable with the name is already published.
+func (pt *ProcTree) PublishExpvar(name string) error {
+	expvarLock.Lock()
+	defer expvarLock.Unlock()
+	if expvar.Get(name) != nil {
+		return fmt.Errorf("Expvar %q is already published", name)
+	}
+	expvar.Publish(name, expvar.Func(pt.expvarValue))
+	return nil
+}
@@ -0,0 +1,38 @@
+package proctree
+
+import (
+	"encoding/json"
+	"expvar"
+	"os"
+	"testing"
+)
+
+func TestPublishExpvar(t *testing.T) {
+	pt, err := New(WithRootPid(os.Getpid()))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	err = pt.PublishExpvar("proctree_test")
+	if err != nil {
+		t.Fatalf("PublishExpvar() returned error: %s", err)
+	}
+	err = pt.PublishExpvar("proctree_test")
+	if err == nil {
+		t.Errorf("PublishExpvar() of a duplicate name did not return an error")
+	}
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+
+	var v expvarValue
+	err = json.Unmarshal([]byte(expvar.Get("proctree_test").String()), &v)
+	if err != nil {
+		t.Fatalf("Unable to unmarshal expvar: %s", err)
+	}
+	if v.Updates != 2 || v.Included != 1 || v.Roots != 1 || v.Total < v.Included || v.Added < 1 || v.LastUpdate == "" {
+		t.Errorf("Expvar has unexpected value %+v", v)
+	}
+}
@@ -0,0 +1,156 @@
+package proctree
+
+import (
+	"path"
+)
+
+// ProcessInfo describes a Process to a ProcessFilter.
+type ProcessInfo struct {
+	// Pid is the pid of the Process.
+	Pid int
+
+	// PPid is the pid of the parent process.
+	PPid int
+
+	// Executable is the executable name of the Process.
+	Executable string
+
+	// Cmdline is the command line of the Process, if it was captured (see Process.Cmdline). It must not be
+	// modified.
+	Cmdline []string
+
+	// UID is the effective user id of the Process, or -1 if it is not known. User ids are only available on Linux.
+	UID int
+
+	// Tombstone is true if the Process has exited.
+	Tombstone bool
+}
+
+// ProcessFilter is a predicate that decides whether a Process is included in a ProcTree (see WithFilter).
+// Filters are called during each update while the ProcTree is locked, so they must not call methods of the
+// ProcTree or its Processes.
+type ProcessFilter func(ProcessInfo) bool
+
+// FilterMode determines how Processes that are rejected by a ProcessFilter are excluded.
+type FilterMode int
+
+const (
+	// FilterProcess excludes only the rejected Process. Its included children become roots of the included
+	// tree.
+	FilterProcess FilterMode = iota
+
+	// FilterSubtree excludes the rejected Process and all of its descendants.
+	FilterSubtree
+)
+
+func (m FilterMode) String() string {
+	switch m {
+	case FilterProcess:
+		return "FilterProcess"
+	case FilterSubtree:
+		return "FilterSubtree"
+	default:
+		return "FilterMode(unknown)"
+	}
+}
+
+// lockedProcessInfo returns the description of a Process passed to filters.
+func (p *Process) lockedProcessInfo() ProcessInfo {
+	return ProcessInfo{
+		Pid:        p.lockedPid(),
+		PPid:       p.gopsProcess.PPid(),
+		Executable: p.lockedExecutable(),
+		Cmdline:    p.lockedCmdline(),
+		UID:        p.lockedUID(),
+		Tombstone:  p.isTombstone,
+	}
+}
+
+// lockedApplyFilters excludes included Processes that are rejected by any of the configured filters, according
+// to the configured filter mode.
+func (pt *ProcTree) lockedApplyFilters() error {
+	if len(pt.cfg.filters) == 0 {
+		return nil
+	}
+	rejected := []*Process{}
+	for _, proc := range pt.absProcs {
+		if !proc.isIncluded {
+			continue
+		}
+		info := proc.lockedProcessInfo()
+		for _, filter := range pt.cfg.filters {
+			if !filter(info) {
+				rejected = append(rejected, proc)
+				break
+			}
+		}
+	}
+	for _, proc := range rejected {
+		if pt.cfg.filterMode != FilterSubtree {
+			proc.isIncluded = false
+			continue
+		}
+		err := proc.lockedWalkFullSubtree(func(proc *Process) error {
+			proc.isIncluded = false
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockedExcludeSubtrees excludes the subtrees configured with WithExcludeSubtreePid and
+// WithExcludeSubtreeExecutable.
+func (pt *ProcTree) lockedExcludeSubtrees() error {
+	if len(pt.cfg.excludeSubtreePids) == 0 && len(pt.cfg.excludeSubtreeExecutables) == 0 {
+		return nil
+	}
+	excluded := []*Process{}
+	for _, pid := range pt.cfg.excludeSubtreePids {
+		proc, ok := pt.pidMap[pid]
+		if ok {
+			excluded = append(excluded, proc)
+		}
+	}
+	if len(pt.cfg.excludeSubtreeExecutables) > 0 {
+		for _, proc := range pt.absProcs {
+			for _, pattern := range pt.cfg.excludeSubtreeExecutables {
+				matched, _ := path.Match(pattern, proc.lockedExecutable())
+				if matched {
+					excluded = append(excluded, proc)
+					break
+				}
+			}
+		}
+	}
+	for _, proc := range excluded {
+		err := proc.lockedWalkFullSubtree(func(proc *Process) error {
+			proc.isIncluded = false
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockedApplyMaxDepth excludes included Processes that are deeper than the depth configured with WithMaxDepth.
+func (pt *ProcTree) lockedApplyMaxDepth() {
+	if pt.cfg.maxDepth < 0 {
+		return
+	}
+	// Depths are computed before any Processes are excluded, so that the descendants of an excluded Process
+	// are also excluded
+	tooDeep := []*Process{}
+	for _, proc := range pt.absProcs {
+		if proc.isIncluded && proc.lockedDepth() > pt.cfg.maxDepth {
+			tooDeep = append(tooDeep, proc)
+		}
+	}
+	for _, proc := range tooDeep {
+		proc.isIncluded = false
+	}
+}
@@ -0,0 +1,137 @@
+package proctree
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// startShellWithChild starts a shell with a background sleep child. The shell exits when its stdin is closed.
+// Returns the shell command, its stdin, and the pid of the child.
+func startShellWithChild(t *testing.T) (*exec.Cmd, io.WriteCloser, int) {
+	cmd := exec.Command("sh", "-c", "sleep 10 & echo $!; read x")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("cmd.StdinPipe() returned error: %s", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("cmd.StdoutPipe() returned error: %s", err)
+	}
+	err = cmd.Start()
+	if err != nil {
+		t.Fatalf("cmd.Start() returned error: %s", err)
+	}
+	var childPid int
+	_, err = fmt.Fscan(stdout, &childPid)
+	if err != nil {
+		stdin.Close()
+		cmd.Wait()
+		t.Fatalf("Unable to read child pid: %s", err)
+	}
+	return cmd, stdin, childPid
+}
+
+func TestFilter(t *testing.T) {
+	cmd, stdin, childPid := startShellWithChild(t)
+	defer cmd.Wait()
+	defer stdin.Close()
+	defer signalPid(childPid, os.Kill)
+
+	notShell := func(info ProcessInfo) bool {
+		return info.Pid != cmd.Process.Pid
+	}
+
+	pt, err := New(WithRootPid(os.Getpid()), WithFilter(notShell))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	if pt.PidProcess(cmd.Process.Pid) != nil {
+		t.Errorf("Filtered shell is included")
+	}
+	child := pt.PidProcess(childPid)
+	if child == nil {
+		t.Fatalf("Child of filtered shell is not included")
+	}
+	isRoot := false
+	for _, root := range pt.Roots() {
+		isRoot = isRoot || root == child
+	}
+	if !isRoot {
+		t.Errorf("Child of filtered shell is not a root")
+	}
+	pt.Close()
+
+	pt, err = New(WithRootPid(os.Getpid()), WithFilter(notShell), WithFilterMode(FilterSubtree))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+	if pt.PidProcess(cmd.Process.Pid) != nil || pt.PidProcess(childPid) != nil {
+		t.Errorf("Filtered subtree is included")
+	}
+	if pt.PidProcess(os.Getpid()) == nil {
+		t.Errorf("Root is not included")
+	}
+}
+
+func TestExcludeSubtree(t *testing.T) {
+	cmd, stdin, childPid := startShellWithChild(t)
+	defer cmd.Wait()
+	defer stdin.Close()
+	defer signalPid(childPid, os.Kill)
+
+	pt, err := New(WithRootPid(os.Getpid()), WithExcludeSubtreePid(cmd.Process.Pid))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	if pt.PidProcess(cmd.Process.Pid) != nil || pt.PidProcess(childPid) != nil {
+		t.Errorf("Excluded subtree is included")
+	}
+	if pt.PidProcess(os.Getpid()) == nil {
+		t.Errorf("Root is not included")
+	}
+	pt.Close()
+
+	pt, err = New(WithRootPid(os.Getpid()), WithExcludeSubtreeExecutable("sle*"))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+	if pt.PidProcess(cmd.Process.Pid) == nil || pt.PidProcess(childPid) != nil {
+		t.Errorf("Subtree excluded by executable is not the expected subtree")
+	}
+
+	_, err = New(WithExcludeSubtreeExecutable("["))
+	if err == nil {
+		t.Errorf("proctree.New() accepted a malformed pattern")
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	cmd, stdin, childPid := startShellWithChild(t)
+	defer cmd.Wait()
+	defer stdin.Close()
+	defer signalPid(childPid, os.Kill)
+
+	pt, err := New(WithRootPid(os.Getpid()), WithMaxDepth(1))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	if pt.PidProcess(cmd.Process.Pid) == nil || pt.PidProcess(childPid) != nil {
+		t.Errorf("Tree with maximum depth 1 does not include the expected processes")
+	}
+	pt.Close()
+
+	pt, err = New(WithRootPid(os.Getpid()), WithMaxDepth(0))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+	procs := pt.Processes()
+	if len(procs) != 1 || procs[0].Pid() != os.Getpid() {
+		t.Errorf("Tree with maximum depth 0 does not include only the root")
+	}
+}
@@ -0,0 +1,75 @@
+package proctree
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// lockedFind returns the included Processes for which match returns true, sorted by pid.
+func (pt *ProcTree) lockedFind(match func(proc *Process) bool) []*Process {
+	result := []*Process{}
+	for _, proc := range pt.includedProcs {
+		if match(proc) {
+			result = append(result, proc)
+		}
+	}
+	return result
+}
+
+// FindByExecutable returns the included Processes whose executable name matches a glob pattern, using the syntax
+// of path.Match, sorted by pid. Returns an error if the pattern is malformed.
+func (pt *ProcTree) FindByExecutable(pattern string) ([]*Process, error) {
+	_, err := path.Match(pattern, "")
+	if err != nil {
+		return nil, fmt.Errorf("Invalid executable pattern %q: %s", pattern, err)
+	}
+	pt.prlock()
+	defer pt.prunlock()
+	return pt.lockedFind(func(proc *Process) bool {
+		matched, _ := path.Match(pattern, proc.lockedExecutable())
+		return matched
+	}), nil
+}
+
+// FindByCmdline returns the included Processes whose command line, with arguments joined by spaces, matches a
+// regular expression, sorted by pid. The command line captured by the eBPF monitor is used if available (see
+// Process.Cmdline); otherwise, the command line of a live Process is read from the system, which is only
+// supported on Linux, macOS and Windows. Returns an error if the expression is malformed.
+func (pt *ProcTree) FindByCmdline(expr string) ([]*Process, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid command line expression %q: %s", expr, err)
+	}
+	pt.prlock()
+	defer pt.prunlock()
+	return pt.lockedFind(func(proc *Process) bool {
+		cmdline := proc.lockedSystemCmdline()
+		return cmdline != nil && re.MatchString(strings.Join(cmdline, " "))
+	}), nil
+}
+
+// FindByUser returns the included Processes whose effective user is the provided user name or numeric user id,
+// sorted by pid. The user of a Process is captured while it is live, so tombstones are only returned if their
+// user was captured before they exited. Returns an error if the user cannot be found, or if user ids are not
+// supported on this platform (they are only supported on Linux and macOS, and in trees loaded with LoadJSON or
+// LoadProto that include them).
+func (pt *ProcTree) FindByUser(user string) ([]*Process, error) {
+	uid, err := lookupUID(user)
+	if err != nil {
+		return nil, err
+	}
+	pt.plock()
+	defer pt.punlock()
+	if !pt.readOnly {
+		_, err = defaultProcfs.processUID(os.Getpid())
+		if err != nil {
+			return nil, fmt.Errorf("Unable to find processes by user: %s", err)
+		}
+	}
+	return pt.lockedFind(func(proc *Process) bool {
+		return proc.lockedUID() == uid
+	}), nil
+}
@@ -0,0 +1,85 @@
+package proctree
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	cmd := exec.Command("sleep", "12.5")
+	err := cmd.Start()
+	if err != nil {
+		t.Fatalf("cmd.Start() returned error: %s", err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	pt, err := New(WithRootPid(os.Getpid()))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	procs, err := pt.FindByExecutable("sl?ep")
+	if err != nil {
+		t.Fatalf("pt.FindByExecutable() returned error: %s", err)
+	}
+	if len(procs) != 1 || procs[0].Pid() != cmd.Process.Pid {
+		t.Errorf("pt.FindByExecutable() did not return only pid %d", cmd.Process.Pid)
+	}
+	_, err = pt.FindByExecutable("[")
+	if err == nil {
+		t.Errorf("pt.FindByExecutable() accepted a malformed pattern")
+	}
+
+	if runtime.GOOS == "linux" {
+		procs, err = pt.FindByCmdline(`^sleep 12\.5$`)
+		if err != nil {
+			t.Fatalf("pt.FindByCmdline() returned error: %s", err)
+		}
+		if len(procs) != 1 || procs[0].Pid() != cmd.Process.Pid {
+			t.Errorf("pt.FindByCmdline() did not return only pid %d", cmd.Process.Pid)
+		}
+	}
+	_, err = pt.FindByCmdline("(")
+	if err == nil {
+		t.Errorf("pt.FindByCmdline() accepted a malformed expression")
+	}
+}
+
+func TestFindByUser(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("User ids are only supported on Linux")
+	}
+	pt, err := New(WithRootPid(os.Getpid()))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	procs, err := pt.FindByUser(strconv.Itoa(os.Geteuid()))
+	if err != nil {
+		t.Fatalf("pt.FindByUser() returned error: %s", err)
+	}
+	if len(procs) == 0 || procs[0].Pid() != os.Getpid() {
+		t.Errorf("pt.FindByUser() did not return the calling process")
+	}
+	u, err := user.LookupId(strconv.Itoa(os.Geteuid()))
+	if err == nil {
+		byName, err := pt.FindByUser(u.Username)
+		if err != nil {
+			t.Fatalf("pt.FindByUser() returned error: %s", err)
+		}
+		if len(byName) != len(procs) {
+			t.Errorf("pt.FindByUser() returned different results for user name %q", u.Username)
+		}
+	}
+	procs, err = pt.FindByUser(strconv.Itoa(os.Geteuid() + 12345))
+	if err != nil || len(procs) != 0 {
+		t.Errorf("pt.FindByUser() returned processes for an unused user id")
+	}
+}
@@ -5,5 +5,5 @@ go 1.16
 require (
 	github.com/mitchellh/go-ps v1.0.0
 	github.com/spf13/pflag v1.0.5
-	github.com/xlab/treeprint v1.1.0
+	gopkg.in/yaml.v3 v3.0.1
 )
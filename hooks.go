@@ -0,0 +1,53 @@
+package proctree
+
+import (
+	"time"
+)
+
+// UpdateSummary describes the changes made to a ProcTree by a single update. Counts include Processes that are
+// excluded by configuration.
+type UpdateSummary struct {
+	// Time is the time at which the update started.
+	Time time.Time
+
+	// Duration is the time taken by the update.
+	Duration time.Duration
+
+	// Processes is the number of Processes known to the ProcTree after the update, including tombstones.
+	Processes int
+
+	// Added is the number of Processes that were discovered by the update.
+	Added int
+
+	// Removed is the number of previously live Processes that were not found by the update, and were tombstoned.
+	Removed int
+
+	// Pruned is the number of tombstoned Processes that were removed from the ProcTree by the update.
+	Pruned int
+
+	// Reparented is the number of Processes whose parent changed.
+	Reparented int
+
+	// Execed is the number of Processes that replaced their executable image.
+	Execed int
+
+	// Refreshed is the number of previously known Processes that were found again by the update, including
+	// those that were reparented or exec'd.
+	Refreshed int
+}
+
+// UpdateHook is a function that is called after each update of a ProcTree, with a summary of the update.
+// Hooks are called after the tree lock is released, so they may call ProcTree methods. Hooks are called in
+// update order and never concurrently: usually from the goroutine that performed the update, but if another
+// goroutine is dispatching events when the update completes, that goroutine calls them.
+type UpdateHook func(summary *UpdateSummary)
+
+// dispatchSummaries passes summaries of completed updates to the configured update hooks. Called by
+// drainDispatchQueue with dispatchLock held.
+func (pt *ProcTree) dispatchSummaries(summaries []*UpdateSummary, hooks []UpdateHook) {
+	for _, summary := range summaries {
+		for _, hook := range hooks {
+			hook(summary)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package proctree
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestUpdateHook(t *testing.T) {
+	var summaries []*UpdateSummary
+	pt, err := New(WithUpdateHook(func(summary *UpdateSummary) {
+		summaries = append(summaries, summary)
+	}))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+	if len(summaries) != 1 || summaries[0].Added == 0 || summaries[0].Added != summaries[0].Processes {
+		t.Fatalf("Initial update was not summarized correctly")
+	}
+
+	cmd := exec.Command("sleep", "10")
+	err = cmd.Start()
+	if err != nil {
+		t.Fatalf("cmd.Start() returned error: %s", err)
+	}
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("pt.Update() returned error: %s", err)
+	}
+	cmd.Process.Kill()
+	cmd.Wait()
+	err = pt.Update(true)
+	if err != nil {
+		t.Fatalf("pt.Update() returned error: %s", err)
+	}
+
+	if len(summaries) != 3 {
+		t.Fatalf("Update hook was called %d times, expected 3", len(summaries))
+	}
+	if summaries[1].Added < 1 || summaries[1].Refreshed == 0 {
+		t.Errorf("Second update summary %+v is not expected", *summaries[1])
+	}
+	if summaries[2].Removed < 1 || summaries[2].Pruned < summaries[2].Removed {
+		t.Errorf("Third update summary %+v is not expected", *summaries[2])
+	}
+}
@@ -0,0 +1,143 @@
+package proctree
+
+import (
+	"sort"
+)
+
+// lessByPid orders Processes by pid.
+func lessByPid(p, q *Process) bool {
+	return p.lockedPid() < q.lockedPid()
+}
+
+// lockedChildLess returns the ordering configured with WithChildSort. Ties are broken by pid.
+func (pt *ProcTree) lockedChildLess() func(p, q *Process) bool {
+	switch pt.cfg.childOrder {
+	case ByStartTime:
+		// Processes with unknown start times are sorted by pid after those with known start times
+		return func(p, q *Process) bool {
+			tp, tq := p.startTime, q.startTime
+			if tp != tq && tp != 0 && tq != 0 {
+				return tp < tq
+			}
+			if (tp == 0) != (tq == 0) {
+				return tq == 0
+			}
+			return p.lockedPid() < q.lockedPid()
+		}
+	case ByExecutable:
+		return func(p, q *Process) bool {
+			ep, eq := p.lockedExecutable(), q.lockedExecutable()
+			if ep != eq {
+				return ep < eq
+			}
+			return p.lockedPid() < q.lockedPid()
+		}
+	case ByCPUTime:
+		return func(p, q *Process) bool {
+			if p.cpuTime != q.cpuTime {
+				return p.cpuTime > q.cpuTime
+			}
+			return p.lockedPid() < q.lockedPid()
+		}
+	case ByMemory:
+		return func(p, q *Process) bool {
+			if p.rss != q.rss {
+				return p.rss > q.rss
+			}
+			return p.lockedPid() < q.lockedPid()
+		}
+	default:
+		return lessByPid
+	}
+}
+
+// mergeProcs appends the merge of two slices of Processes that are sorted by less to dst, and returns the
+// result.
+func mergeProcs(dst, a, b []*Process, less func(p, q *Process) bool) []*Process {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if less(b[j], a[i]) {
+			dst = append(dst, b[j])
+			j++
+		} else {
+			dst = append(dst, a[i])
+			i++
+		}
+	}
+	dst = append(dst, a[i:]...)
+	return append(dst, b[j:]...)
+}
+
+// lockedKeepIndexed removes the Processes that are no longer in the tree from a sorted index, in place, and
+// returns the result. If unsorted is not nil, Processes whose sort keys have changed are also removed, and
+// appended to unsorted.
+func (pt *ProcTree) lockedKeepIndexed(index []*Process, unsorted *[]*Process) []*Process {
+	kept := index[:0]
+	for _, proc := range index {
+		if pt.pidMap[proc.lockedPid()] != proc {
+			proc.indexed = false
+			continue
+		}
+		if unsorted != nil && proc.resort {
+			*unsorted = append(*unsorted, proc)
+			continue
+		}
+		kept = append(kept, proc)
+	}
+	for i := len(kept); i < len(index); i++ {
+		index[i] = nil
+	}
+	return kept
+}
+
+// lockedUpdateIndexes brings the sorted list of all Processes, and the list of all Processes in the order
+// configured with WithChildSort, up to date with pidMap. Rather than rebuilding and sorting them on every update,
+// Processes that are no longer in the tree are removed, and new Processes, or Processes whose sort keys have
+// changed, are sorted and merged in, so an update with few changes takes time linear in the number of
+// Processes.
+func (pt *ProcTree) lockedUpdateIndexes() {
+	added := resetProcs(pt.addedProcs)
+	for _, proc := range pt.pidMap {
+		if !proc.indexed {
+			added = append(added, proc)
+			proc.indexed = true
+		}
+	}
+	sort.Slice(added, func(i, j int) bool { return lessByPid(added[i], added[j]) })
+
+	kept := pt.lockedKeepIndexed(pt.absProcs, nil)
+	merged := mergeProcs(resetProcs(pt.spareProcs), kept, added, lessByPid)
+	pt.spareProcs, pt.absProcs = kept, merged
+
+	if pt.cfg.childOrder == ByPid {
+		pt.childOrderValid = false
+	} else {
+		less := pt.lockedChildLess()
+		if !pt.childOrderValid || pt.childOrderIndexed != pt.cfg.childOrder {
+			pt.childOrderProcs = append(resetProcs(pt.childOrderProcs), pt.absProcs...)
+			sort.Slice(pt.childOrderProcs, func(i, j int) bool { return less(pt.childOrderProcs[i], pt.childOrderProcs[j]) })
+			for _, proc := range pt.childOrderProcs {
+				proc.resort = false
+			}
+			pt.childOrderValid, pt.childOrderIndexed = true, pt.cfg.childOrder
+		} else {
+			kept := pt.lockedKeepIndexed(pt.childOrderProcs, &added)
+			sort.Slice(added, func(i, j int) bool { return less(added[i], added[j]) })
+			for _, proc := range added {
+				proc.resort = false
+			}
+			merged := mergeProcs(resetProcs(pt.childSpareProcs), kept, added, less)
+			pt.childSpareProcs, pt.childOrderProcs = kept, merged
+		}
+	}
+	pt.addedProcs = added
+}
+
+// lockedChildOrderProcs returns the absolute processes sorted in the order configured with WithChildSort, for
+// building child lists. It is only valid after lockedUpdateIndexes.
+func (pt *ProcTree) lockedChildOrderProcs() []*Process {
+	if pt.cfg.childOrder == ByPid {
+		return pt.absProcs
+	}
+	return pt.childOrderProcs
+}
@@ -0,0 +1,42 @@
+package proctree
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// MarshalJSON implements json.Marshaler. A Process is encoded as an object containing its pid, parent pid,
+// executable name and any captured metadata (command line, user id, exec count, exit status), with its
+// included children nested in a "children" array. A Process that has exited is marked with "tombstone", and one
+// that is excluded from the tree by configuration, e.g., one returned by AbsProcesses, with "excluded".
+func (p *Process) MarshalJSON() ([]byte, error) {
+	p.prlock()
+	ep := p.lockedEncodedProcess(true)
+	p.prunlock()
+	return json.Marshal(ep)
+}
+
+// MarshalJSON implements json.Marshaler. A ProcTree is encoded as an object whose "roots" array contains the
+// included root Processes, each encoded as by Process.MarshalJSON, so that the entire included tree is nested
+// beneath them.
+func (pt *ProcTree) MarshalJSON() ([]byte, error) {
+	pt.prlock()
+	et := pt.lockedEncodedTree()
+	pt.prunlock()
+	return json.Marshal(et)
+}
+
+// LoadJSON creates a read-only ProcTree from a tree previously encoded with ProcTree.MarshalJSON, e.g., a
+// process tree dump included in a crash report, so that it can be analyzed offline with the same query and walk
+// methods as a live tree. Every Process in the encoded tree is included, and keeps the tombstone state, exit
+// status and other metadata that were encoded. The loaded tree cannot be updated: Update and StartCommand return
+// errors. Methods that act on live processes (e.g., Rlimit and TerminateSubtree) also return errors.
+func LoadJSON(r io.Reader) (*ProcTree, error) {
+	et := &encodedTree{}
+	err := json.NewDecoder(r).Decode(et)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decode process tree: %s", err)
+	}
+	return loadEncodedTree(et)
+}
@@ -0,0 +1,104 @@
+package proctree
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	pt, err := New(WithRootPid(os.Getpid()))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	cmd := exec.Command("sleep", "10")
+	err = cmd.Start()
+	if err != nil {
+		t.Fatalf("cmd.Start() returned error: %s", err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("pt.Update() returned error: %s", err)
+	}
+
+	data, err := json.Marshal(pt)
+	if err != nil {
+		t.Fatalf("json.Marshal() returned error: %s", err)
+	}
+	var decoded struct {
+		Roots []struct {
+			Pid      int
+			Children []struct {
+				Pid        int
+				PPid       int
+				Executable string
+			}
+		}
+	}
+	err = json.Unmarshal(data, &decoded)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() returned error: %s", err)
+	}
+	if len(decoded.Roots) != 1 || decoded.Roots[0].Pid != os.Getpid() {
+		t.Fatalf("Encoded tree %s does not have the expected root", data)
+	}
+	found := false
+	for _, child := range decoded.Roots[0].Children {
+		if child.Pid == cmd.Process.Pid && child.PPid == os.Getpid() && child.Executable == "sleep" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Encoded tree %s does not include child pid %d", data, cmd.Process.Pid)
+	}
+}
+
+func TestLoadJSON(t *testing.T) {
+	pt, err := New()
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	data, err := json.Marshal(pt)
+	pt.Close()
+	if err != nil {
+		t.Fatalf("json.Marshal() returned error: %s", err)
+	}
+
+	loaded, err := LoadJSON(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("LoadJSON() returned error: %s", err)
+	}
+	defer loaded.Close()
+	proc := loaded.PidProcess(os.Getpid())
+	if proc == nil {
+		t.Fatalf("Current process not found in loaded tree")
+	}
+	if proc.Parent() == nil || proc.Parent().Pid() != os.Getppid() {
+		t.Errorf("Current process does not have the expected parent in loaded tree")
+	}
+	if len(loaded.Processes()) != len(pt.Processes()) {
+		t.Errorf("Loaded tree has %d processes, expected %d", len(loaded.Processes()), len(pt.Processes()))
+	}
+	reencoded, err := json.Marshal(loaded)
+	if err != nil {
+		t.Fatalf("json.Marshal() returned error: %s", err)
+	}
+	if !bytes.Equal(data, reencoded) {
+		t.Errorf("Loaded tree does not encode identically")
+	}
+	err = loaded.Update(false)
+	if err == nil {
+		t.Errorf("loaded.Update() did not return an error")
+	}
+
+	_, err = LoadJSON(bytes.NewReader([]byte(`{"roots":[{"pid":1},{"pid":1}]}`)))
+	if err == nil {
+		t.Errorf("LoadJSON() accepted duplicate pids")
+	}
+}
@@ -0,0 +1,53 @@
+package proctree
+
+// logger receives the debug and trace logs of a ProcTree (see WithLogger). Trace logs are more detailed than
+// debug logs, e.g., one for each dispatched event.
+type logger interface {
+	// enabled returns true if logs at the trace or debug level are recorded, so that their attributes need not
+	// be computed otherwise.
+	enabled(trace bool) bool
+
+	// log records a message at the trace or debug level, with alternating attribute keys and values.
+	log(trace bool, msg string, args ...interface{})
+}
+
+// WithoutLogger disables logging (see WithLogger). This is the default.
+func WithoutLogger() ConfigOption {
+	return func(cfg *Config) {
+		cfg.logger = nil
+	}
+}
+
+// logDebug records a debug log, if a logger is configured and debug logs are enabled.
+func logDebug(l logger, msg string, args ...interface{}) {
+	if l != nil && l.enabled(false) {
+		l.log(false, msg, args...)
+	}
+}
+
+// traceEnabled returns true if a logger is configured and trace logs are enabled.
+func traceEnabled(l logger) bool {
+	return l != nil && l.enabled(true)
+}
+
+// logTrace records a trace log, if a logger is configured and trace logs are enabled.
+func logTrace(l logger, msg string, args ...interface{}) {
+	if traceEnabled(l) {
+		l.log(true, msg, args...)
+	}
+}
+
+// logOp records a debug log of a manipulation operation, with its error if it failed.
+func logOp(l logger, msg string, err error, args ...interface{}) {
+	if err != nil {
+		args = append(args, "error", err)
+	}
+	logDebug(l, msg, args...)
+}
+
+// currentLogger returns the logger of the current configuration.
+func (pt *ProcTree) currentLogger() logger {
+	pt.prlock()
+	defer pt.prunlock()
+	return pt.cfg.logger
+}
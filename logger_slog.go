@@ -0,0 +1,47 @@
+//go:build go1.21
+// +build go1.21
+
+package proctree
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LevelTrace is the slog level of the trace logs of a ProcTree, which are more detailed than its debug logs,
+// e.g., one for each dispatched event.
+const LevelTrace = slog.LevelDebug - 4
+
+// slogLogger is a logger that records logs with a slog.Logger.
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (s slogLogger) level(trace bool) slog.Level {
+	if trace {
+		return LevelTrace
+	}
+	return slog.LevelDebug
+}
+
+func (s slogLogger) enabled(trace bool) bool {
+	return s.l.Enabled(context.Background(), s.level(trace))
+}
+
+func (s slogLogger) log(trace bool, msg string, args ...interface{}) {
+	s.l.Log(context.Background(), s.level(trace), msg, args...)
+}
+
+// WithLogger causes the ProcTree to log what it is doing to a slog.Logger: updates and their summaries at
+// slog.LevelDebug, as well as signals, root changes, reconfiguration and started commands, and each dispatched
+// event at LevelTrace. Logs are recorded without holding the tree lock. By default, nothing is logged. Only
+// available when built with Go 1.21 or later.
+func WithLogger(l *slog.Logger) ConfigOption {
+	return func(cfg *Config) {
+		if l == nil {
+			cfg.logger = nil
+			return
+		}
+		cfg.logger = slogLogger{l: l}
+	}
+}
@@ -0,0 +1,60 @@
+//go:build go1.21
+// +build go1.21
+
+package proctree
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestWithLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: LevelTrace}))
+	fs := newFakeSource(ProcInfo{Pid: 100, Executable: "init", StartTime: 1})
+	pt, err := New(WithProcessSource(fs), WithLogger(l))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+	sub, err := pt.Subscribe()
+	if err != nil {
+		t.Fatalf("Subscribe() returned error: %s", err)
+	}
+	defer sub.Close()
+
+	fs.set(ProcInfo{Pid: 101, PPid: 100, Executable: "sh", StartTime: 2})
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+	pt.AddRoot(200)
+	logs := buf.String()
+	for _, want := range []string{
+		`msg="Updated process tree" processes=2 added=1`,
+		`msg="Dispatching event" type=ProcessStarted pid=101 executable=sh`,
+		`msg="Add root" pid=200 error=`,
+	} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("Logs do not contain %q:\n%s", want, logs)
+		}
+	}
+
+	// Trace logs are not recorded unless their level is enabled
+	buf.Reset()
+	err = pt.Reconfigure(WithLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+	if err != nil {
+		t.Fatalf("Reconfigure() returned error: %s", err)
+	}
+	fs.set(ProcInfo{Pid: 102, PPid: 100, Executable: "cc", StartTime: 3})
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+	logs = buf.String()
+	if strings.Contains(logs, "Dispatching event") || !strings.Contains(logs, `msg="Updated process tree"`) {
+		t.Errorf("Logs at debug level are unexpected:\n%s", logs)
+	}
+}
@@ -0,0 +1,370 @@
+package proctree
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MetadataField identifies a kind of per-process metadata that is read from the system on demand.
+type MetadataField int
+
+const (
+	// MetadataCmdline is the command line of a Process (see Process.SystemCmdline).
+	MetadataCmdline MetadataField = iota
+
+	// MetadataEnviron is the environment of a Process (see Process.Environ).
+	MetadataEnviron
+
+	// MetadataFDs is the number of open file descriptors of a Process (see Process.FDCount).
+	MetadataFDs
+
+	// MetadataMemory is the memory statistics of a Process (see Process.MemoryStats).
+	MetadataMemory
+
+	// MetadataUserSID is the security identifier of the user of a Process (see Process.UserSID).
+	MetadataUserSID
+
+	// MetadataSession is the session of a Process (see Process.SessionID).
+	MetadataSession
+
+	// MetadataCgroup is the cgroup path of a Process (see Process.Cgroup).
+	MetadataCgroup
+
+	// MetadataProcessGroup is the process group of a Process (see Process.ProcessGroupID).
+	MetadataProcessGroup
+
+	// MetadataNamespacePids is the pids of a Process in its nested PID namespaces (see Process.NamespacePids).
+	MetadataNamespacePids
+
+	numMetadataFields
+)
+
+func (f MetadataField) String() string {
+	switch f {
+	case MetadataCmdline:
+		return "MetadataCmdline"
+	case MetadataEnviron:
+		return "MetadataEnviron"
+	case MetadataFDs:
+		return "MetadataFDs"
+	case MetadataMemory:
+		return "MetadataMemory"
+	case MetadataUserSID:
+		return "MetadataUserSID"
+	case MetadataSession:
+		return "MetadataSession"
+	case MetadataCgroup:
+		return "MetadataCgroup"
+	case MetadataProcessGroup:
+		return "MetadataProcessGroup"
+	case MetadataNamespacePids:
+		return "MetadataNamespacePids"
+	default:
+		return "MetadataField(unknown)"
+	}
+}
+
+// MemoryStats describes the memory usage of a Process, in bytes, as reported by /proc/<pid>/smaps_rollup on
+// Linux. Other platforms report a subset of the fields (see Process.MemoryStats).
+type MemoryStats struct {
+	// RSS is the resident set size.
+	RSS uint64
+
+	// PSS is the proportional set size: resident memory, with each page shared by n processes counted as 1/n.
+	PSS uint64
+
+	// Shared is the resident memory that is shared with other processes.
+	Shared uint64
+
+	// Private is the resident memory that is not shared with other processes.
+	Private uint64
+
+	// Swap is the memory that has been swapped out.
+	Swap uint64
+}
+
+// metadataEntry is a cached value of a MetadataField, or the error returned when it was read.
+type metadataEntry struct {
+	value   interface{}
+	err     error
+	fetched time.Time
+}
+
+// readMetadata reads a MetadataField of the process with the given pid from the system.
+func readMetadata(fs procfs, field MetadataField, pid int) (interface{}, error) {
+	switch field {
+	case MetadataCmdline:
+		return fs.processCmdline(pid)
+	case MetadataEnviron:
+		return fs.processEnviron(pid)
+	case MetadataFDs:
+		return fs.processFDCount(pid)
+	case MetadataMemory:
+		return fs.processMemory(pid)
+	case MetadataUserSID:
+		return fs.processSID(pid)
+	case MetadataCgroup:
+		return fs.processCgroup(pid)
+	case MetadataProcessGroup:
+		return fs.processGroupID(pid)
+	case MetadataNamespacePids:
+		return fs.processNamespacePids(pid)
+	default:
+		return fs.processSessionID(pid)
+	}
+}
+
+// checkMetadata returns an error that wraps ErrMetadataNotEnabled if any of the provided metadata fields is not
+// enabled (see WithMetadata).
+func (cfg *Config) checkMetadata(fields ...MetadataField) error {
+	for _, field := range fields {
+		if !cfg.MetadataEnabled(field) {
+			return fmt.Errorf("%w: %s", ErrMetadataNotEnabled, field)
+		}
+	}
+	return nil
+}
+
+// lockedCachedMetadata returns the cached entry for a MetadataField, or nil if there is none or it has expired.
+// The cached entries of a tombstone never expire, since they can no longer be refreshed.
+func (p *Process) lockedCachedMetadata(field MetadataField, now time.Time) *metadataEntry {
+	entry := p.metadata[field]
+	if entry == nil {
+		return nil
+	}
+	ttl := p.pt.cfg.metadataTTL
+	if p.isTombstone || ttl < 0 || now.Sub(entry.fetched) < ttl {
+		return entry
+	}
+	return nil
+}
+
+// lockedInvalidateMetadata discards all cached metadata, e.g., because the Process has exec'd.
+func (p *Process) lockedInvalidateMetadata() {
+	p.metadata = [numMetadataFields]*metadataEntry{}
+	p.metadataGen++
+}
+
+// getMetadata returns a MetadataField of the Process, from the cache if possible. Otherwise, the metadata is
+// read from the system without holding the tree lock, and cached unless caching is disabled or the Process
+// execs while it is being read. Returns an error without reading anything if the field is not enabled (see
+// WithMetadata).
+func (p *Process) getMetadata(field MetadataField) (interface{}, error) {
+	now := p.pt.clock.Now()
+	p.prlock()
+	entry := p.lockedCachedMetadata(field, now)
+	pid := p.lockedPid()
+	gen := p.metadataGen
+	isTombstone := p.isTombstone
+	readOnly := p.pt.readOnly
+	ttl := p.pt.cfg.metadataTTL
+	enabled := p.pt.cfg.MetadataEnabled(field)
+	p.prunlock()
+	if !enabled {
+		return nil, &PidError{Op: "read " + field.String() + " of", Pid: pid, Err: ErrMetadataNotEnabled}
+	}
+	if entry != nil {
+		return entry.value, entry.err
+	}
+	if readOnly {
+		return nil, fmt.Errorf("Unable to read metadata of a Process in a ProcTree that is not updated from the system")
+	}
+	if isTombstone {
+		return nil, &PidError{Op: "read metadata of", Pid: pid, Err: ErrProcessGone}
+	}
+
+	value, err := readMetadata(p.pt.procfs, field, pid)
+	err = newPidError("read metadata of", pid, err)
+	if ttl != 0 {
+		p.plock()
+		if p.metadataGen == gen {
+			p.metadata[field] = &metadataEntry{value: value, err: err, fetched: now}
+		}
+		p.punlock()
+	}
+	return value, err
+}
+
+// SystemCmdline returns the command line of the Process. A command line captured by the eBPF monitor is returned
+// if there is one (see Cmdline); otherwise the command line is read from the system on demand and cached (see
+// WithMetadataTTL). Returns an error if the command line cannot be read, e.g., because the Process has exited
+// or the platform does not support it; only Linux, macOS and Windows (8.1 or later) are supported. The returned
+// slice is shared with the cache, so it must not be modified.
+func (p *Process) SystemCmdline() ([]string, error) {
+	p.prlock()
+	cmdline := p.lockedCmdline()
+	p.prunlock()
+	if cmdline != nil {
+		return cmdline, nil
+	}
+	value, err := p.getMetadata(MetadataCmdline)
+	if err != nil {
+		return nil, err
+	}
+	return value.([]string), nil
+}
+
+// Environ returns the environment of the Process, as "key=value" strings, as it was when the Process started
+// or last exec'd. It is read from the system on demand and cached (see WithMetadataTTL). Returns an error if the
+// environment cannot be read, e.g., because the Process belongs to another user, has exited, or the platform
+// does not support it; only Linux and macOS are supported. The returned slice must not be modified.
+func (p *Process) Environ() ([]string, error) {
+	value, err := p.getMetadata(MetadataEnviron)
+	if err != nil {
+		return nil, err
+	}
+	return value.([]string), nil
+}
+
+// FDCount returns the number of open file descriptors of the Process, or on Windows, its number of open handles.
+// It is read from the system on demand and cached (see WithMetadataTTL). Returns an error if it cannot be read,
+// e.g., because the Process belongs to another user, has exited, or the platform does not support it; only Linux,
+// macOS and Windows are supported.
+func (p *Process) FDCount() (int, error) {
+	value, err := p.getMetadata(MetadataFDs)
+	if err != nil {
+		return 0, err
+	}
+	return value.(int), nil
+}
+
+// MemoryStats returns the memory statistics of the Process. They are read from the system on demand and cached
+// (see WithMetadataTTL). On macOS, only RSS is reported, and on Windows, only RSS (the working set) and Private
+// (the commit charge). Returns an error if they cannot be read, e.g., because the Process belongs to another
+// user, has exited, or the platform does not support it; only Linux, macOS and Windows are supported.
+func (p *Process) MemoryStats() (MemoryStats, error) {
+	value, err := p.getMetadata(MetadataMemory)
+	if err != nil {
+		return MemoryStats{}, err
+	}
+	return value.(MemoryStats), nil
+}
+
+// UserSID returns the security identifier of the user of the Process, e.g., "S-1-5-18". It is read from the
+// system on demand and cached (see WithMetadataTTL). Returns an error if it cannot be read, e.g., because the
+// Process is protected or has exited, or the platform does not support it; only Windows is supported. On other
+// platforms, the user of a Process is identified by its user id (see FindByUser).
+func (p *Process) UserSID() (string, error) {
+	value, err := p.getMetadata(MetadataUserSID)
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+// SessionID returns the session of the Process: on Windows, the Remote Desktop Services session in which it
+// runs, and on Linux and macOS, its session id, which is the pid of the session leader. It is read from the
+// system on demand and cached (see WithMetadataTTL). Returns an error if it cannot be read, e.g., because the
+// Process has exited, or the platform does not support it; only Linux, macOS and Windows are supported.
+func (p *Process) SessionID() (int, error) {
+	value, err := p.getMetadata(MetadataSession)
+	if err != nil {
+		return -1, err
+	}
+	return value.(int), nil
+}
+
+// ProcessGroupID returns the process group id of the Process, which is the pid of the process group leader. It
+// is read from the system on demand and cached (see WithMetadataTTL). Returns an error if it cannot be read, e.g.,
+// because the Process has exited, or the platform does not support it; only Linux and macOS are supported.
+func (p *Process) ProcessGroupID() (int, error) {
+	value, err := p.getMetadata(MetadataProcessGroup)
+	if err != nil {
+		return -1, err
+	}
+	return value.(int), nil
+}
+
+// NamespacePids returns the pids of the Process in each of its nested PID namespaces, from the outermost, which is
+// the namespace in which the tree is inspected, to the innermost, in which the Process runs. The first pid is
+// the pid of the Process, and for a Process in a container with its own PID namespace, the last is its pid
+// within the container, e.g., [48213 1] for the init process of a container. It is read from the system on
+// demand and cached (see WithMetadataTTL). Returns an error if it cannot be read, e.g., because the Process has
+// exited, or the platform does not support it; only Linux 4.1 and later are supported.
+func (p *Process) NamespacePids() ([]int, error) {
+	value, err := p.getMetadata(MetadataNamespacePids)
+	if err != nil {
+		return nil, err
+	}
+	return value.([]int), nil
+}
+
+// NamespacePid returns the pid of the Process in the innermost PID namespace in which it runs, which is the pid
+// that processes in the same namespace, e.g., the same container, use to refer to it (see NamespacePids).
+func (p *Process) NamespacePid() (int, error) {
+	pids, err := p.NamespacePids()
+	if err != nil {
+		return -1, err
+	}
+	return pids[len(pids)-1], nil
+}
+
+// Cgroup returns the cgroup path of the Process: its path in the unified (cgroup v2) hierarchy, or in the first
+// listed hierarchy on systems with only cgroup v1, e.g., "/system.slice/docker-<id>.scope". It is read from the
+// system on demand and cached (see WithMetadataTTL). Returns an error if it cannot be read, e.g., because the
+// Process has exited, or the platform does not support it; only Linux is supported.
+func (p *Process) Cgroup() (string, error) {
+	value, err := p.getMetadata(MetadataCgroup)
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+// metadataRead is a metadata field of a Process to be read by prefetchMetadata, and its result.
+type metadataRead struct {
+	proc  *Process
+	pid   int
+	gen   uint64
+	field MetadataField
+	value interface{}
+	err   error
+}
+
+// lockedMetadataReads returns the prefetched metadata fields of live included Processes whose cached values are
+// missing or have expired.
+func (pt *ProcTree) lockedMetadataReads(now time.Time) []*metadataRead {
+	if len(pt.cfg.metadataPrefetch) == 0 || pt.cfg.metadataTTL == 0 {
+		return nil
+	}
+	reads := []*metadataRead{}
+	for _, proc := range pt.includedProcs {
+		if proc.isTombstone {
+			continue
+		}
+		for _, field := range pt.cfg.metadataPrefetch {
+			if proc.lockedCachedMetadata(field, now) == nil {
+				reads = append(reads, &metadataRead{proc: proc, pid: proc.lockedPid(), gen: proc.metadataGen, field: field})
+			}
+		}
+	}
+	return reads
+}
+
+// prefetchMetadata performs metadata reads with up to workers reads running concurrently. It must be called
+// without holding the tree lock. The results are cached by lockedStoreMetadataReads.
+func prefetchMetadata(fs procfs, reads []*metadataRead, workers int) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+	for _, read := range reads {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(read *metadataRead) {
+			defer wg.Done()
+			read.value, read.err = readMetadata(fs, read.field, read.pid)
+			<-sem
+		}(read)
+	}
+	wg.Wait()
+}
+
+// lockedStoreMetadataReads caches the results of metadata reads, except for Processes that have exec'd since
+// the reads were planned.
+func (pt *ProcTree) lockedStoreMetadataReads(reads []*metadataRead, now time.Time) {
+	for _, read := range reads {
+		if read.proc.metadataGen == read.gen {
+			read.proc.metadata[read.field] = &metadataEntry{value: read.value, err: read.err, fetched: now}
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package proctree
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestProcessMetadata(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process metadata is only supported on Linux")
+	}
+	cmd := exec.Command("sleep", "10")
+	cmd.Env = []string{"PROCTREE_TEST=metadata"}
+	err := cmd.Start()
+	if err != nil {
+		t.Fatalf("cmd.Start() returned error: %s", err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	pt, err := New(WithRootPid(cmd.Process.Pid))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+	proc := pt.PidProcess(cmd.Process.Pid)
+
+	cmdline, err := proc.SystemCmdline()
+	if err != nil || len(cmdline) != 2 || cmdline[0] != "sleep" || cmdline[1] != "10" {
+		t.Errorf("SystemCmdline() returned %q, %v", cmdline, err)
+	}
+	environ, err := proc.Environ()
+	if err != nil || len(environ) != 1 || environ[0] != "PROCTREE_TEST=metadata" {
+		t.Errorf("Environ() returned %q, %v", environ, err)
+	}
+	fds, err := proc.FDCount()
+	if err != nil || fds < 3 {
+		t.Errorf("FDCount() returned %d, %v", fds, err)
+	}
+	mem, err := proc.MemoryStats()
+	if err != nil || mem.RSS == 0 || mem.RSS != mem.Shared+mem.Private {
+		t.Errorf("MemoryStats() returned %+v, %v", mem, err)
+	}
+	// The child inherits the session of the test
+	session, err := proc.SessionID()
+	selfSession, _ := defaultProcfs.processSessionID(os.Getpid())
+	if err != nil || session != selfSession {
+		t.Errorf("SessionID() returned %d, %v, expected %d", session, err, selfSession)
+	}
+	_, err = proc.UserSID()
+	if err == nil {
+		t.Errorf("UserSID() did not return an error on Linux")
+	}
+
+	// Cached metadata is retained after the Process exits
+	cmd.Process.Kill()
+	cmd.Wait()
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+	environ, err = proc.Environ()
+	if err != nil || len(environ) != 1 {
+		t.Errorf("Environ() of tombstone returned %q, %v", environ, err)
+	}
+}
+
+func TestMetadataTTL(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process metadata is only supported on Linux")
+	}
+	for _, tc := range []struct {
+		ttl    time.Duration
+		cached bool
+	}{
+		{-1, true},
+		{time.Hour, true},
+		{0, false},
+	} {
+		pt, err := New(WithRootPid(os.Getpid()), WithMetadataTTL(tc.ttl))
+		if err != nil {
+			t.Fatalf("New() returned error: %s", err)
+		}
+		proc := pt.PidProcess(os.Getpid())
+		before, err := proc.FDCount()
+		if err != nil {
+			t.Fatalf("FDCount() returned error: %s", err)
+		}
+		f, err := os.Open(os.DevNull)
+		if err != nil {
+			t.Fatalf("os.Open() returned error: %s", err)
+		}
+		after, err := proc.FDCount()
+		f.Close()
+		pt.Close()
+		if err != nil {
+			t.Fatalf("FDCount() returned error: %s", err)
+		}
+		if (after == before) != tc.cached {
+			t.Errorf("With TTL %s, FDCount() returned %d then %d", tc.ttl, before, after)
+		}
+	}
+}
+
+func TestParseSmapsRollup(t *testing.T) {
+	stats, err := parseSmapsRollup("563a16948000-7fff66069000 ---p 00000000 00:00 0    [rollup]\n" +
+		"Rss:                1320 kB\nPss:                 348 kB\nShared_Clean:       1180 kB\n" +
+		"Shared_Dirty:          0 kB\nPrivate_Clean:        40 kB\nPrivate_Dirty:       100 kB\nSwap:                  8 kB\n")
+	if err != nil {
+		t.Fatalf("parseSmapsRollup() returned error: %s", err)
+	}
+	expected := MemoryStats{RSS: 1320 * 1024, PSS: 348 * 1024, Shared: 1180 * 1024, Private: 140 * 1024, Swap: 8 * 1024}
+	if stats != expected {
+		t.Errorf("parseSmapsRollup() returned %+v, expected %+v", stats, expected)
+	}
+	_, err = parseSmapsRollup("")
+	if err == nil {
+		t.Errorf("parseSmapsRollup(\"\") did not return an error")
+	}
+}
+
+func TestParseStatusNSpid(t *testing.T) {
+	pids, err := parseStatusNSpid("Name:\tnginx\nTgid:\t48213\nPid:\t48213\nNSpid:\t48213\t1\n")
+	if err != nil || len(pids) != 2 || pids[0] != 48213 || pids[1] != 1 {
+		t.Errorf("parseStatusNSpid() returned %v, %v, expected [48213 1]", pids, err)
+	}
+	_, err = parseStatusNSpid("Name:\tnginx\nPid:\t48213\n")
+	if err == nil {
+		t.Errorf("parseStatusNSpid() without NSpid did not return an error")
+	}
+}
+
+func TestParseBootTime(t *testing.T) {
+	bootTime, err := parseBootTime("cpu  10 0 20 300\nintr 0\nctxt 42\nbtime 1622540000\nprocesses 100\n")
+	if err != nil || !bootTime.Equal(time.Unix(1622540000, 0)) {
+		t.Errorf("parseBootTime() returned %s, %v, expected %s", bootTime, err, time.Unix(1622540000, 0))
+	}
+	_, err = parseBootTime("cpu  10 0 20 300\n")
+	if err == nil {
+		t.Errorf("parseBootTime() without btime did not return an error")
+	}
+}
+
+func TestParseProcargs2(t *testing.T) {
+	data := []byte("\x02\x00\x00\x00/bin/sleep\x00\x00\x00\x00sleep\x0010\x00HOME=/\x00TERM=xterm\x00\x00junk\x00")
+	args, environ, err := parseProcargs2(data)
+	if err != nil {
+		t.Fatalf("parseProcargs2() returned error: %s", err)
+	}
+	if len(args) != 2 || args[0] != "sleep" || args[1] != "10" {
+		t.Errorf("parseProcargs2() returned arguments %q, expected [sleep 10]", args)
+	}
+	if len(environ) != 2 || environ[0] != "HOME=/" || environ[1] != "TERM=xterm" {
+		t.Errorf("parseProcargs2() returned environment %q, expected [HOME=/ TERM=xterm]", environ)
+	}
+	_, _, err = parseProcargs2([]byte("\x03\x00\x00\x00/bin/sleep\x00sleep\x00"))
+	if err == nil {
+		t.Errorf("parseProcargs2() of truncated arguments did not return an error")
+	}
+}
+
+func TestMetadataPrefetch(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process metadata is only supported on Linux")
+	}
+	cmd, stdin, childPid := startShellWithChild(t)
+	defer cmd.Wait()
+	defer stdin.Close()
+	defer signalPid(childPid, os.Kill)
+
+	_, err := New(WithMetadataWorkers(0))
+	if err == nil {
+		t.Errorf("New() with no metadata workers did not return an error")
+	}
+	pt, err := New(WithRootPid(cmd.Process.Pid), WithMetadataPrefetch(MetadataEnviron, MetadataFDs),
+		WithMetadataWorkers(2), WithMetadataTTL(time.Hour))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	pt.prlock()
+	for _, proc := range pt.includedProcs {
+		for _, field := range []MetadataField{MetadataEnviron, MetadataFDs} {
+			if proc.metadata[field] == nil {
+				t.Errorf("%s of pid %d was not prefetched", field, proc.lockedPid())
+			}
+		}
+		if proc.metadata[MetadataMemory] != nil {
+			t.Errorf("%s of pid %d was prefetched", MetadataMemory, proc.lockedPid())
+		}
+	}
+	pt.prunlock()
+	fds, err := pt.PidProcess(childPid).FDCount()
+	if err != nil || fds < 3 {
+		t.Errorf("FDCount() returned %d, %v", fds, err)
+	}
+}
+
+func TestMetadataSelection(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process metadata is only supported on Linux")
+	}
+	_, err := New(WithRootPid(os.Getpid()), WithMetadata(MetadataCmdline), WithMetadataPrefetch(MetadataEnviron))
+	if err == nil {
+		t.Errorf("New() prefetching a metadata field that is not enabled did not return an error")
+	}
+	pt, err := New(WithRootPid(os.Getpid()), WithMetadata(MetadataCmdline), WithMetadata(MetadataFDs, MetadataCmdline))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+	fields := pt.Config().MetadataFields()
+	if len(fields) != 2 || fields[0] != MetadataCmdline || fields[1] != MetadataFDs {
+		t.Errorf("MetadataFields() returned %v, expected [MetadataCmdline MetadataFDs]", fields)
+	}
+	proc := pt.PidProcess(os.Getpid())
+	cmdline, err := proc.SystemCmdline()
+	if err != nil || len(cmdline) == 0 {
+		t.Errorf("SystemCmdline() returned %q, %v", cmdline, err)
+	}
+	fds, err := proc.FDCount()
+	if err != nil || fds < 3 {
+		t.Errorf("FDCount() returned %d, %v", fds, err)
+	}
+	_, err = proc.Environ()
+	var pidErr *PidError
+	if !errors.Is(err, ErrMetadataNotEnabled) || !errors.As(err, &pidErr) || pidErr.Pid != os.Getpid() {
+		t.Errorf("Environ() returned error %v, expected ErrMetadataNotEnabled", err)
+	}
+	_, err = pt.Sessions()
+	if !errors.Is(err, ErrMetadataNotEnabled) {
+		t.Errorf("Sessions() returned error %v, expected ErrMetadataNotEnabled", err)
+	}
+
+	// Disabling all metadata also omits file descriptors from resource usage
+	err = pt.Reconfigure(WithAllMetadata(), WithMetadata())
+	if err != nil {
+		t.Fatalf("Reconfigure() returned error: %s", err)
+	}
+	_, err = proc.FDCount()
+	if !errors.Is(err, ErrMetadataNotEnabled) {
+		t.Errorf("FDCount() returned error %v, expected ErrMetadataNotEnabled", err)
+	}
+	usage, err := proc.Usage()
+	if err != nil || usage.FDs != 0 {
+		t.Errorf("Usage() returned %+v, %v, expected no file descriptors", usage, err)
+	}
+
+	// Debug bundles omit the entries of disabled metadata
+	path := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	err = pt.CollectDebugBundle(path)
+	if err != nil {
+		t.Fatalf("CollectDebugBundle() returned error: %s", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("os.Open() returned error: %s", err)
+	}
+	defer f.Close()
+	files, err := readDebugBundle(f)
+	if err != nil {
+		t.Fatalf("readDebugBundle() returned error: %s", err)
+	}
+	entries := files[os.Getpid()]
+	if entries["stat"] == "" {
+		t.Errorf("Debug bundle does not contain the stat entry of pid %d", os.Getpid())
+	}
+	for _, name := range []string{"cmdline", "cgroup"} {
+		if _, ok := entries[name]; ok {
+			t.Errorf("Debug bundle contains the %s entry of pid %d with its metadata disabled", name, os.Getpid())
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package proctree
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultFallbackInterval is the polling interval used when a real-time monitor was requested but is
+// unavailable, and no auto-update interval was configured.
+const defaultFallbackInterval = time.Second
+
+// realtimeCoalesceDelay is the time that the monitor waits after a real-time notification before updating,
+// so that bursts of notifications (e.g., fork immediately followed by exec) result in a single update.
+const realtimeCoalesceDelay = 2 * time.Millisecond
+
+// startMonitor starts a background goroutine that updates the ProcTree until the ProcTree is closed. Updates
+// occur at a fixed interval (if interval is nonzero), and shortly after each signal on kick (if kick is not nil).
+// Update errors are transient (e.g., a process vanishing mid-scan), so they are ignored and the update is
+// retried at the next opportunity.
+func (pt *ProcTree) startMonitor(interval time.Duration, pruneTombstones bool, kick <-chan struct{}) {
+	pt.wg.Add(1)
+	go func() {
+		defer pt.wg.Done()
+		var tick <-chan time.Time
+		if interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			select {
+			case <-pt.done:
+				return
+			case <-tick:
+				pt.Update(pruneTombstones)
+			case <-kick:
+				time.Sleep(realtimeCoalesceDelay)
+				// Drain any notifications that arrived while waiting; this update covers them
+				select {
+				case <-kick:
+				default:
+				}
+				pt.Update(pruneTombstones)
+			}
+		}
+	}()
+}
+
+// startMonitoring starts the configured background monitoring. If a real-time monitor was requested,
+// updates are triggered by real-time notifications, with polling at the auto-update interval as a
+// backstop. The eBPF backend is preferred if it was requested; otherwise, or if it is unavailable, the
+// platform's real-time backend is used. Trees with a ProcessSource other than the system use the source's events
+// instead, if it is a ProcessEventSource. If no real-time backend is available on this platform or to this
+// user, monitoring falls back to polling alone.
+func (pt *ProcTree) startMonitoring() {
+	interval := pt.cfg.autoUpdateInterval
+	var kick chan struct{}
+	if pt.cfg.realtimeMonitor || pt.cfg.ebpfMonitor {
+		kick = make(chan struct{}, 1)
+		notify := func(n procNotification) {
+			pt.applyNotification(n)
+			select {
+			case kick <- struct{}{}:
+			default:
+			}
+		}
+		err := fmt.Errorf("No real-time backend was requested")
+		if ss, ok := pt.source.(systemSource); ok && ss.procfs == defaultProcfs {
+			if pt.cfg.ebpfMonitor {
+				err = pt.startRealtimeBackend(newEBPFBackend, notify)
+			}
+			if err != nil && pt.cfg.realtimeMonitor {
+				err = pt.startRealtimeBackend(newRealtimeBackend, notify)
+			}
+		} else if eventSource, ok := pt.source.(ProcessEventSource); ok && pt.cfg.realtimeMonitor {
+			err = pt.startRealtimeBackend(func() (realtimeBackend, error) {
+				return &sourceBackend{source: eventSource, done: make(chan struct{})}, nil
+			}, notify)
+		}
+		if err != nil {
+			kick = nil
+			if interval == 0 {
+				interval = defaultFallbackInterval
+			}
+		}
+	}
+	if interval > 0 || kick != nil {
+		pt.monitored = true
+		pt.startMonitor(interval, pt.cfg.autoUpdatePruneTombstones, kick)
+	}
+}
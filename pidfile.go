@@ -0,0 +1,117 @@
+package proctree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pidFileRoot is the state of a pid file configured with WithRootPidFile.
+type pidFileRoot struct {
+	// pid is the pid most recently read from the file.
+	pid int
+
+	// added is true if the pid was added to the configured roots because of the file, rather than being
+	// configured as a root in its own right.
+	added bool
+
+	// modTime and size identify the version of the file that was read.
+	modTime time.Time
+	size    int64
+}
+
+// readPidFile reads the pid in a pid file: a positive decimal integer on the first line.
+func readPidFile(path string) (int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	line := strings.TrimSpace(strings.SplitN(string(data), "\n", 2)[0])
+	pid, err := strconv.Atoi(line)
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("Pid file %s does not contain a valid pid", path)
+	}
+	return pid, nil
+}
+
+// lockedRefreshPidFiles adds the pid of each pid file configured with WithRootPidFile that is new, or that has
+// changed since it was last read, to the configured roots, replacing the pid previously read from the file. On
+// the first update, the pids are resolved with the other configured roots, and an error is returned if a file
+// cannot be read and roots are not lenient. Afterwards, a file that cannot be read, or whose pid cannot be added
+// as a root, is read again by each update until it succeeds.
+func (pt *ProcTree) lockedRefreshPidFiles(first bool) error {
+	if pt.pidFileRoots == nil {
+		pt.pidFileRoots = make(map[string]*pidFileRoot)
+	}
+	for path := range pt.pidFileRoots {
+		if !containsString(pt.cfg.rootPidFiles, path) {
+			delete(pt.pidFileRoots, path)
+		}
+	}
+	for _, path := range pt.cfg.rootPidFiles {
+		pf := pt.pidFileRoots[path]
+		info, err := os.Stat(path)
+		if err == nil && pf != nil && info.ModTime().Equal(pf.modTime) && info.Size() == pf.size {
+			continue
+		}
+		pid := 0
+		if err == nil {
+			pid, err = readPidFile(path)
+		}
+		if err == nil && pf != nil && pid == pf.pid {
+			pf.modTime, pf.size = info.ModTime(), info.Size()
+			continue
+		}
+		if err == nil {
+			added := !containsPid(pt.cfg.rootPids, pid)
+			if first {
+				pt.cfg = pt.cfg.Refine(WithRootPid(pid))
+			} else {
+				err = pt.lockedAddRoot(pid)
+			}
+			if err == nil {
+				if pf != nil && pf.added {
+					pt.lockedRemoveRoot(pf.pid)
+				}
+				pt.pidFileRoots[path] = &pidFileRoot{pid: pid, added: added, modTime: info.ModTime(), size: info.Size()}
+			}
+		}
+		if err != nil {
+			if first && !pt.cfg.lenientRoots {
+				return fmt.Errorf("Unable to read root pid file: %s", err)
+			}
+			logDebug(pt.cfg.logger, "Unable to read root pid file", "path", path, "error", err)
+		}
+	}
+	return nil
+}
+
+// lockedReconfigurePidFiles carries the roots read from pid files over to a new configuration. The pids of
+// files that remain configured remain roots, and those of files that are no longer configured are removed from
+// the roots, unless they are configured as roots in their own right. The state of files that are no longer
+// configured is discarded by the next update.
+func (pt *ProcTree) lockedReconfigurePidFiles(cfg *Config) {
+	for path, pf := range pt.pidFileRoots {
+		if !pf.added {
+			continue
+		}
+		if !containsString(cfg.rootPidFiles, path) {
+			withoutRoot(pf.pid)(cfg)
+		} else if !containsPid(cfg.rootPids, pf.pid) {
+			cfg.rootPids = append(cfg.rootPids, pf.pid)
+		}
+	}
+}
+
+// containsString returns true if a list of strings contains s.
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package proctree
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestRootPidFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "daemon.pid")
+	fs := newFakeSource(
+		ProcInfo{Pid: 1, Executable: "init", StartTime: 1},
+		ProcInfo{Pid: 100, PPid: 1, Executable: "daemon", StartTime: 2},
+		ProcInfo{Pid: 101, PPid: 100, Executable: "worker", StartTime: 3},
+		ProcInfo{Pid: 200, PPid: 1, Executable: "cron", StartTime: 4},
+	)
+	_, err := New(WithProcessSource(fs), WithRootPidFile(path))
+	if err == nil {
+		t.Fatalf("New() with a missing pid file did not return an error")
+	}
+
+	// With lenient roots, the root is added once the pid file is written
+	pt, err := New(WithProcessSource(fs), WithRootPidFile(path), WithLenientRoots())
+	if err != nil {
+		t.Fatalf("New() with lenient roots returned error: %s", err)
+	}
+	defer pt.Close()
+	if len(pt.Processes()) != 0 {
+		t.Errorf("Processes() returned %v before the pid file was written, expected none", pt.Processes())
+	}
+	err = ioutil.WriteFile(path, []byte("100\n"), 0644)
+	if err != nil {
+		t.Fatalf("ioutil.WriteFile() returned error: %s", err)
+	}
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+	procs := pt.Processes()
+	if len(procs) != 2 || procs[0].Pid() != 100 || procs[1].Pid() != 101 {
+		t.Errorf("Processes() returned %v, expected the subtree of pid 100", procs)
+	}
+
+	// When the daemon restarts, the new pid replaces the old one
+	fs.remove(100)
+	fs.remove(101)
+	fs.set(ProcInfo{Pid: 3000, PPid: 1, Executable: "daemon", StartTime: 5})
+	err = ioutil.WriteFile(path, []byte("3000\n"), 0644)
+	if err != nil {
+		t.Fatalf("ioutil.WriteFile() returned error: %s", err)
+	}
+	err = pt.Update(true)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+	procs = pt.Processes()
+	if len(procs) != 1 || procs[0].Pid() != 3000 {
+		t.Errorf("Processes() returned %v, expected the restarted daemon", procs)
+	}
+	if pids := pt.Config().RootPids(); len(pids) != 1 || pids[0] != 3000 {
+		t.Errorf("Config().RootPids() returned %v, expected [3000]", pids)
+	}
+
+	// A pid file that is no longer configured no longer provides a root
+	err = pt.Reconfigure(WithoutRootPid(), WithRootPid(200))
+	if err != nil {
+		t.Fatalf("Reconfigure() returned error: %s", err)
+	}
+	procs = pt.Processes()
+	if len(procs) != 1 || procs[0].Pid() != 200 {
+		t.Errorf("Processes() returned %v after reconfiguration, expected pid 200", procs)
+	}
+
+	pt2, err := New(WithProcessSource(fs), WithRootPidFile(path))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt2.Close()
+	if pt2.PidProcess(3000) == nil {
+		t.Errorf("Root read from the pid file by New is not included")
+	}
+	err = ioutil.WriteFile(path, []byte("garbage"), 0644)
+	if err != nil {
+		t.Fatalf("ioutil.WriteFile() returned error: %s", err)
+	}
+	err = pt2.Update(false)
+	if err != nil || pt2.PidProcess(3000) == nil {
+		t.Errorf("Update() with an invalid pid file returned %v, or did not keep the previous root", err)
+	}
+}
@@ -0,0 +1,72 @@
+package proctree
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestNamespacePids(t *testing.T) {
+	dir := t.TempDir()
+	// Two containers, each with its own PID namespace; 16 was started in the first container by a process
+	// outside it, e.g., by "docker exec", so it does not descend from the container's init
+	procs := []struct {
+		pid, ppid  int
+		executable string
+		ns         string
+		nsPids     string
+	}{
+		{1, 0, "systemd", "pid:[4026531836]", "1"},
+		{10, 1, "containerd-shim", "pid:[4026531836]", "10"},
+		{11, 10, "nginx", "pid:[4026532001]", "11\t1"},
+		{12, 11, "nginx", "pid:[4026532001]", "12\t7"},
+		{13, 1, "containerd-shim", "pid:[4026531836]", "13"},
+		{14, 13, "redis", "pid:[4026532002]", "14\t1"},
+		{16, 10, "sh", "pid:[4026532001]", "16\t9"},
+	}
+	for i, proc := range procs {
+		writeFakeProcess(t, dir, proc.pid, proc.ppid, proc.executable, uint64(100*(i+1)))
+		pidDir := filepath.Join(dir, strconv.Itoa(proc.pid))
+		err := os.WriteFile(filepath.Join(pidDir, "status"), []byte("Name:\t"+proc.executable+"\nNSpid:\t"+proc.nsPids+"\n"), 0644)
+		if err == nil {
+			err = os.Mkdir(filepath.Join(pidDir, "ns"), 0755)
+		}
+		if err == nil {
+			err = os.Symlink(proc.ns, filepath.Join(pidDir, "ns", "pid"))
+		}
+		if err != nil {
+			t.Fatalf("Unable to write fake process: %s", err)
+		}
+	}
+
+	pt, err := New(WithProcfsPath(dir), WithRootNamespaceInit(16))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	if pidList(pt.Roots()) != "[11]" {
+		t.Errorf("pt.Roots() returned %s, expected the init process of the namespace [11]", pidList(pt.Roots()))
+	}
+	pids, err := pt.PidProcess(12).NamespacePids()
+	if err != nil || len(pids) != 2 || pids[0] != 12 || pids[1] != 7 {
+		t.Errorf("proc.NamespacePids() returned %v, %v, expected [12 7]", pids, err)
+	}
+	pid, err := pt.PidProcess(11).NamespacePid()
+	if err != nil || pid != 1 {
+		t.Errorf("proc.NamespacePid() returned %d, %v, expected 1", pid, err)
+	}
+
+	err = pt.Reconfigure(WithoutRootPid(), WithRootNamespaceInit(14))
+	if err != nil {
+		t.Fatalf("pt.Reconfigure() returned error: %s", err)
+	}
+	if pidList(pt.Roots()) != "[14]" {
+		t.Errorf("pt.Roots() returned %s after Reconfigure, expected [14]", pidList(pt.Roots()))
+	}
+	err = pt.Reconfigure(WithRootNamespaceInit(99))
+	if err == nil {
+		t.Errorf("pt.Reconfigure() did not return an error for a missing process")
+	}
+}
@@ -0,0 +1,185 @@
+package proctree
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PodInfo describes the Kubernetes pod in which a Process runs (see Process.PodInfo).
+type PodInfo struct {
+	// UID is the uid of the pod, e.g., "0b1c2d3e-4f50-6172-8394-a5b6c7d8e9f0".
+	UID string
+
+	// QOSClass is the quality of service class of the pod: "guaranteed", "burstable" or "besteffort".
+	QOSClass string
+
+	// Namespace is the namespace of the pod, or "" if it is not known.
+	Namespace string
+
+	// Pod is the name of the pod, or "" if it is not known.
+	Pod string
+
+	// Container is the name of the container in the pod in which the Process runs, or "" if it is not known.
+	Container string
+
+	// ContainerID is the id of the container in which the Process runs, or "" if the Process runs in the pod's
+	// cgroup rather than one of its containers.
+	ContainerID string
+}
+
+// PodResolver looks up the names of pods and their containers (see WithPodResolver).
+type PodResolver interface {
+	// ResolvePod returns the namespace and name of the pod with the provided uid, and the name of the container
+	// with the provided id, if containerID is not "". Empty strings are returned, without an error, for pods
+	// and containers that the resolver does not know; such resolutions, and resolutions that fail with an
+	// error, are retried by later calls. It may be called concurrently.
+	ResolvePod(uid string, containerID string) (namespace string, pod string, container string, err error)
+}
+
+// defaultPodLogDir is the directory of container logs used by the default PodResolver.
+const defaultPodLogDir = "/var/log"
+
+// podLogResolver is a PodResolver that reads the names of the kubelet's log files.
+type podLogResolver struct {
+	logDir string
+}
+
+// PodLogResolver returns a PodResolver that looks up pods and containers from the names of the log files and
+// directories that the kubelet maintains in logDir, normally /var/log: pods/<namespace>_<pod>_<uid> and
+// containers/<pod>_<namespace>_<container>-<id>.log. No credentials are required, but the resolver only works
+// on the node on which the pods run; a node agent running in a container should mount the node's /var/log, and
+// pass its mount point. The default resolver uses /var/log.
+func PodLogResolver(logDir string) PodResolver {
+	return &podLogResolver{logDir: logDir}
+}
+
+func (r *podLogResolver) ResolvePod(uid string, containerID string) (string, string, string, error) {
+	namespace, pod, container := "", "", ""
+	names, err := readDirNames(filepath.Join(r.logDir, "pods"))
+	if err != nil {
+		return "", "", "", err
+	}
+	for _, name := range names {
+		parts := strings.Split(name, "_")
+		if len(parts) == 3 && parts[2] == uid {
+			namespace, pod = parts[0], parts[1]
+			break
+		}
+	}
+	if containerID == "" || pod == "" {
+		return namespace, pod, "", nil
+	}
+	names, err = readDirNames(filepath.Join(r.logDir, "containers"))
+	if err != nil {
+		return "", "", "", err
+	}
+	suffix := "-" + containerID + ".log"
+	for _, name := range names {
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		parts := strings.Split(strings.TrimSuffix(name, suffix), "_")
+		if len(parts) == 3 && parts[0] == pod && parts[1] == namespace {
+			container = parts[2]
+			break
+		}
+	}
+	return namespace, pod, container, nil
+}
+
+// readDirNames returns the names of the entries in a directory.
+func readDirNames(dir string) ([]string, error) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	return d.Readdirnames(-1)
+}
+
+// kubepodsQOSClasses are the quality of service classes of pods, which name the cgroups of pods that are not
+// guaranteed.
+var kubepodsQOSClasses = []string{"besteffort", "burstable"}
+
+// parsePodCgroup returns the uid and quality of service class of the Kubernetes pod identified by a cgroup path,
+// and the id of the container within the pod, if any. The kubelet's cgroupfs layout is
+// /kubepods/[<qos>/]pod<uid>/<id>, and its systemd layout is
+// /kubepods.slice/[kubepods-<qos>.slice/]kubepods-[<qos>-]pod<uid>.slice/<runtime>-<id>.scope, with the
+// dashes of the uid replaced by underscores. Returns an empty uid if the path does not belong to a pod.
+func parsePodCgroup(cgroup string) (string, string, string) {
+	parts := strings.Split(cgroup, "/")
+	for i, part := range parts {
+		if part != "kubepods" && part != "kubepods.slice" {
+			continue
+		}
+		qos := "guaranteed"
+		for _, part := range parts[i+1:] {
+			part = strings.TrimSuffix(part, ".slice")
+			part = strings.TrimPrefix(part, "kubepods-")
+			for _, class := range kubepodsQOSClasses {
+				if part == class || strings.HasPrefix(part, class+"-") {
+					qos = class
+					part = strings.TrimPrefix(part, class+"-")
+				}
+			}
+			if !strings.HasPrefix(part, "pod") || len(part) == len("pod") {
+				continue
+			}
+			uid := strings.ReplaceAll(part[len("pod"):], "_", "-")
+			containerID, _ := parseContainerCgroup(cgroup)
+			return uid, qos, containerID
+		}
+		return "", "", ""
+	}
+	return "", "", ""
+}
+
+// PodInfo returns the Kubernetes pod in which the Process runs, or nil if it does not run in a pod. The pod and
+// container are identified by the Process's cgroup path (see Cgroup), which follows the kubelet's cgroup layout,
+// and their names are looked up with the PodResolver configured with WithPodResolver, and cached by the
+// ProcTree. Returns an error if the cgroup cannot be read, e.g., because the Process has exited, or the platform
+// does not support it; only Linux is supported. The returned PodInfo must not be modified.
+func (p *Process) PodInfo() (*PodInfo, error) {
+	cgroup, err := p.Cgroup()
+	if err != nil {
+		return nil, err
+	}
+	return p.pt.podInfo(cgroup), nil
+}
+
+// podInfo returns the pod identified by a cgroup path, or nil if the path does not belong to a pod. Pods are
+// resolved without holding the tree lock, and cached once they are fully resolved.
+func (pt *ProcTree) podInfo(cgroup string) *PodInfo {
+	uid, qos, containerID := parsePodCgroup(cgroup)
+	if uid == "" {
+		return nil
+	}
+	key := uid + "/" + containerID
+	pt.prlock()
+	info := pt.pods[key]
+	resolver := pt.cfg.podResolver
+	pt.prunlock()
+	if info != nil {
+		return info
+	}
+	info = &PodInfo{UID: uid, QOSClass: qos, ContainerID: containerID}
+	if resolver == nil {
+		return info
+	}
+	namespace, pod, container, err := resolver.ResolvePod(uid, containerID)
+	if err != nil {
+		return info
+	}
+	info.Namespace, info.Pod, info.Container = namespace, pod, container
+	if pod == "" || (containerID != "" && container == "") {
+		return info
+	}
+	pt.plock()
+	if pt.pods == nil {
+		pt.pods = make(map[string]*PodInfo)
+	}
+	pt.pods[key] = info
+	pt.punlock()
+	return info
+}
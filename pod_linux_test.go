@@ -0,0 +1,86 @@
+package proctree
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+const testPodUID = "0b1c2d3e-4f50-6172-8394-a5b6c7d8e9f0"
+
+func TestParsePodCgroup(t *testing.T) {
+	tests := []struct {
+		cgroup      string
+		uid         string
+		qos         string
+		containerID string
+	}{
+		{"/system.slice/docker-" + testContainerID1 + ".scope", "", "", ""},
+		{"/kubepods/besteffort/pod" + testPodUID + "/" + testContainerID1, testPodUID, "besteffort", testContainerID1},
+		{"/kubepods/pod" + testPodUID + "/" + testContainerID1, testPodUID, "guaranteed", testContainerID1},
+		{"/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod0b1c2d3e_4f50_6172_8394_a5b6c7d8e9f0.slice/" +
+			"cri-containerd-" + testContainerID1 + ".scope", testPodUID, "burstable", testContainerID1},
+		{"/kubepods.slice/kubepods-pod0b1c2d3e_4f50_6172_8394_a5b6c7d8e9f0.slice", testPodUID, "guaranteed", ""},
+		{"/kubepods.slice/kubepods-besteffort.slice", "", "", ""},
+	}
+	for _, test := range tests {
+		uid, qos, containerID := parsePodCgroup(test.cgroup)
+		if uid != test.uid || qos != test.qos || containerID != test.containerID {
+			t.Errorf("parsePodCgroup(%q) returned %q, %q, %q", test.cgroup, uid, qos, containerID)
+		}
+	}
+}
+
+func TestPodInfo(t *testing.T) {
+	logDir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(logDir, "pods", "web_frontend-7d9f_"+testPodUID, "nginx"), 0755)
+	if err == nil {
+		err = os.MkdirAll(filepath.Join(logDir, "containers"), 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(filepath.Join(logDir, "containers", "frontend-7d9f_web_nginx-"+testContainerID1+".log"),
+			nil, 0644)
+	}
+	if err != nil {
+		t.Fatalf("Unable to create log directory: %s", err)
+	}
+
+	dir := t.TempDir()
+	writeFakeProcess(t, dir, 10, 1, "containerd-shim", 100)
+	writeFakeProcess(t, dir, 11, 10, "nginx", 200)
+	writeFakeProcess(t, dir, 12, 10, "sidecar", 300)
+	cgroups := map[int]string{
+		10: "/system.slice/containerd.service",
+		11: "/kubepods/burstable/pod" + testPodUID + "/" + testContainerID1,
+		12: "/kubepods/burstable/pod" + testPodUID + "/" + testContainerID2,
+	}
+	for pid, cgroup := range cgroups {
+		err := os.WriteFile(filepath.Join(dir, strconv.Itoa(pid), "cgroup"), []byte("0::"+cgroup+"\n"), 0644)
+		if err != nil {
+			t.Fatalf("os.WriteFile() returned error: %s", err)
+		}
+	}
+
+	pt, err := New(WithProcfsPath(dir), WithRootPid(10), WithPodResolver(PodLogResolver(logDir)))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	info, err := pt.PidProcess(10).PodInfo()
+	if err != nil || info != nil {
+		t.Errorf("proc.PodInfo() returned %+v, %v for a process that is not in a pod", info, err)
+	}
+	info, err = pt.PidProcess(11).PodInfo()
+	expected := PodInfo{UID: testPodUID, QOSClass: "burstable", Namespace: "web", Pod: "frontend-7d9f",
+		Container: "nginx", ContainerID: testContainerID1}
+	if err != nil || info == nil || *info != expected {
+		t.Errorf("proc.PodInfo() returned %+v, %v, expected %+v", info, err, expected)
+	}
+	// The second container has no log file, so its name is not known
+	info, err = pt.PidProcess(12).PodInfo()
+	if err != nil || info == nil || info.Pod != "frontend-7d9f" || info.Container != "" {
+		t.Errorf("proc.PodInfo() returned %+v, %v for a container without a log file", info, err)
+	}
+}
@@ -1,6 +1,14 @@
 package proctree
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
 	gops "github.com/mitchellh/go-ps"
 )
 
@@ -8,25 +16,104 @@ import (
 // maintains its identity within a single session.
 type Process struct {
 	pt                 *ProcTree
+	id                 uint64
 	gopsProcess        gops.Process
 	isTombstone        bool
+	exitScanSeq        uint64
+	wasAlive           bool
+	indexed            bool
+	resort             bool
 	parentProc         *Process
 	origParentProc     *Process
+	prevParentProc     *Process
 	absChildProcs      []*Process
 	includedChildProcs []*Process
 	isIncluded         bool
+	wasIncluded        bool
+	changedGen         uint64
+	exitStatus         *ExitStatus
+	cmdline            []string
+	uid                int
+	startTime          uint64
+	cpuTime            time.Duration
+	rss                uint64
+	execCount          int
+	subtreeCount       int
+	metadata           [numMetadataFields]*metadataEntry
+	metadataGen        uint64
+	firstSeen          time.Time
+	lastSeen           time.Time
+}
+
+// ExitStatus describes how a Process terminated. It is only available for processes whose termination
+// was observed directly: children of the calling process (including commands started with StartCommand and,
+// in subreaper mode, adopted orphans) that terminate while the ProcTree is being updated, and any process
+// whose exit is reported by a real-time backend that provides exit statuses (see WithRealtimeMonitor and
+// WithEBPFMonitor).
+type ExitStatus struct {
+	// Code is the exit code of the process, or -1 if it was terminated by a signal.
+	Code int
+
+	// Signal is the signal that terminated the process, or 0 if it exited normally.
+	Signal syscall.Signal
+
+	// CoreDumped is true if the process produced a core dump when it was terminated.
+	CoreDumped bool
+}
+
+// newExitStatus creates an ExitStatus from a wait status.
+func newExitStatus(ws syscall.WaitStatus) *ExitStatus {
+	es := &ExitStatus{
+		Code:       ws.ExitStatus(),
+		Signal:     0,
+		CoreDumped: false,
+	}
+	if ws.Signaled() {
+		es.Signal = ws.Signal()
+		es.CoreDumped = ws.CoreDump()
+	}
+	return es
+}
+
+// staticProcess provides fixed process information for a Process that is not backed by a process found by an
+// update: a transient Process, which exited before it was discovered, or a Process loaded from a serialized tree.
+type staticProcess struct {
+	pid        int
+	ppid       int
+	executable string
+}
+
+func (sp *staticProcess) Pid() int {
+	return sp.pid
+}
+
+func (sp *staticProcess) PPid() int {
+	return sp.ppid
+}
+
+func (sp *staticProcess) Executable() string {
+	return sp.executable
 }
 
 func newProcess(pt *ProcTree, gopsProcess gops.Process) *Process {
 	p := &Process{
 		pt:                 pt,
+		id:                 atomic.AddUint64(&pt.processSeq, 1),
 		gopsProcess:        gopsProcess,
 		isTombstone:        false,
 		origParentProc:     nil,
 		parentProc:         nil,
+		prevParentProc:     nil,
 		absChildProcs:      nil,
 		includedChildProcs: nil,
 		isIncluded:         true,
+		exitStatus:         nil,
+		cmdline:            nil,
+		uid:                -1,
+		startTime:          0,
+		cpuTime:            0,
+		rss:                0,
+		execCount:          0,
 	}
 
 	return p
@@ -40,28 +127,211 @@ func (p *Process) punlock() {
 	p.pt.punlock()
 }
 
+func (p *Process) prlock() {
+	p.pt.prlock()
+}
+
+func (p *Process) prunlock() {
+	p.pt.prunlock()
+}
+
 func (p *Process) lockedPid() int {
 	return p.gopsProcess.Pid()
 }
 
 // Pid returns the pid of a Process
 func (p *Process) Pid() int {
-	p.plock()
-	defer p.punlock()
+	p.prlock()
+	defer p.prunlock()
 	return p.lockedPid()
 }
 
+// ID returns an identifier of the Process that is unique within the ProcTree session. Unlike a pid, it is never
+// reused: when an update finds that a pid was reused by a new process, the new process is represented by a new
+// Process with a new ID, so callers that store IDs can tell the two apart. IDs are assigned in the order in
+// which Processes are created, starting with 1. The ID is not the user id of the Process (see ProcessInfo.UID).
+func (p *Process) ID() uint64 {
+	return p.id
+}
+
 func (p *Process) lockedExecutable() string {
 	return p.gopsProcess.Executable()
 }
 
 // Executable returns the executable name associated with a process, without the directory path
 func (p *Process) Executable() string {
-	p.plock()
-	defer p.punlock()
+	p.prlock()
+	defer p.prunlock()
 	return p.lockedExecutable()
 }
 
+func (p *Process) lockedExecCount() int {
+	return p.execCount
+}
+
+// ExecCount returns the number of times the Process has been observed to replace its executable image while
+// retaining its pid, as reported by ProcessExeced events. Only execs that change the executable name and are
+// seen by an update are counted. Reuse of a pid by an unrelated process is detected from the process start
+// time where the platform provides it (currently Linux), and produces a new Process rather than an exec.
+func (p *Process) ExecCount() int {
+	p.prlock()
+	defer p.prunlock()
+	return p.lockedExecCount()
+}
+
+func (p *Process) lockedCmdline() []string {
+	return p.cmdline
+}
+
+// Cmdline returns the command line of a Process, if it was captured by the eBPF monitor (see WithEBPFMonitor).
+// Otherwise, nil is returned. The returned slice must not be modified.
+func (p *Process) Cmdline() []string {
+	p.prlock()
+	defer p.prunlock()
+	return p.lockedCmdline()
+}
+
+// lockedSystemCmdline returns the command line of the Process captured by the eBPF monitor, if available.
+// Otherwise, the command line of a live Process is read from the system, on platforms that support it; nil is
+// returned if it cannot be read.
+func (p *Process) lockedSystemCmdline() []string {
+	cmdline := p.lockedCmdline()
+	if cmdline != nil {
+		return cmdline
+	}
+	entry := p.lockedCachedMetadata(MetadataCmdline, p.pt.clock.Now())
+	if entry != nil {
+		cmdline, _ = entry.value.([]string)
+	} else if !p.isTombstone && !p.pt.readOnly && p.pt.cfg.MetadataEnabled(MetadataCmdline) {
+		cmdline, _ = p.pt.procfs.processCmdline(p.lockedPid())
+	}
+	return cmdline
+}
+
+// lockedUID returns the effective user id of the Process, or -1 if it is not known. The user id is looked up
+// the first time it is needed while the Process is live, and then cached.
+func (p *Process) lockedUID() int {
+	if p.uid < 0 && !p.isTombstone && !p.pt.readOnly {
+		uid, err := p.pt.procfs.processUID(p.lockedPid())
+		if err == nil {
+			p.uid = uid
+		}
+	}
+	return p.uid
+}
+
+func (p *Process) lockedExitStatus() *ExitStatus {
+	return p.exitStatus
+}
+
+// ExitStatus returns the recorded exit status of a terminated Process, or nil if the Process has not
+// terminated or its exit status was not observed. The exit status is normally available once the Process
+// has been tombstoned, and may be available earlier for zombie processes that have not yet been reaped.
+func (p *Process) ExitStatus() *ExitStatus {
+	p.prlock()
+	defer p.prunlock()
+	return p.lockedExitStatus()
+}
+
+// IsTombstone returns true if the Process has exited, as of the most recent update or real-time notification. A
+// tombstoned Process remains in the tree, with its exit status if it was observed, until tombstones are pruned
+// by an update.
+func (p *Process) IsTombstone() bool {
+	p.prlock()
+	defer p.prunlock()
+	return p.isTombstone
+}
+
+// IsIncluded returns true if the Process is included in the tree by configuration, i.e., it is returned by
+// Processes rather than only by AbsProcesses.
+func (p *Process) IsIncluded() bool {
+	p.prlock()
+	defer p.prunlock()
+	return p.isIncluded
+}
+
+// IsAlive checks the process source, without updating the tree, and returns true if the process is still
+// running: it is not tombstoned, a process with its pid exists, and, where start times are known, the pid has
+// not been reused by a new process. On the local system, zombie processes are not alive. Returns false for a
+// ProcTree that is not updated from the system.
+func (p *Process) IsAlive() bool {
+	p.prlock()
+	pid := p.lockedPid()
+	isTombstone := p.isTombstone
+	startTime := p.startTime
+	readOnly := p.pt.readOnly
+	source := p.pt.source
+	p.prunlock()
+	if isTombstone || readOnly {
+		return false
+	}
+	if ss, ok := source.(systemSource); ok {
+		found, err := ss.hasProcess(pid)
+		if err != nil || !found || ss.procfs.isZombie(pid) {
+			return false
+		}
+		// Start times are not available on every platform, so a pid whose start time cannot be read is alive
+		curStartTime, err := ss.procfs.processStartTime(pid)
+		return err != nil || startTime == 0 || curStartTime == 0 || curStartTime == startTime
+	}
+	infos, err := source.Snapshot()
+	if err != nil {
+		return false
+	}
+	for _, info := range infos {
+		if info.Pid == pid {
+			return startTime == 0 || info.StartTime == 0 || info.StartTime == startTime
+		}
+	}
+	return false
+}
+
+// LastChangedGeneration returns the generation of the ProcTree (see ProcTree.Generation) in which the Process
+// last changed: it was discovered, exited, exec'd or was reparented, or it became included in or excluded from
+// the tree. Returns 0 for a Process loaded from a serialized tree that has not changed since it was loaded.
+func (p *Process) LastChangedGeneration() uint64 {
+	p.prlock()
+	defer p.prunlock()
+	return p.changedGen
+}
+
+// FirstSeen returns the time at which the Process was first discovered: the start of the update that found it,
+// or the time of the real-time notification that reported it, as reported by the tree's Clock (see WithClock).
+// Returns the zero time for a Process loaded from a serialized tree.
+func (p *Process) FirstSeen() time.Time {
+	p.prlock()
+	defer p.prunlock()
+	return p.firstSeen
+}
+
+// LastSeen returns the start of the most recent update that found the Process alive, or FirstSeen if no update
+// has found it. Together with FirstSeen, it bounds the observed lifetime of a Process, and shows how stale a
+// Process that has not exited is. Returns the zero time for a Process loaded from a serialized tree.
+func (p *Process) LastSeen() time.Time {
+	p.prlock()
+	defer p.prunlock()
+	return p.lastSeen
+}
+
+// StartTime returns the time at which the Process started. It is read from the system, so it is not available
+// once the Process has exited. Returns an error if the Process has exited, if the ProcTree is not updated from
+// the system, or if start times are not supported on this platform; only Linux, macOS and Windows are supported.
+func (p *Process) StartTime() (time.Time, error) {
+	p.prlock()
+	pid := p.lockedPid()
+	isTombstone := p.isTombstone
+	readOnly := p.pt.readOnly
+	p.prunlock()
+	if readOnly {
+		return time.Time{}, fmt.Errorf("Unable to read start time in a ProcTree that is not updated from the system")
+	}
+	if isTombstone {
+		return time.Time{}, &PidError{Op: "read start time of", Pid: pid, Err: ErrProcessGone}
+	}
+	t, err := p.pt.procfs.processStartWallTime(pid)
+	return t, newPidError("read start time of", pid, err)
+}
+
 func (p *Process) lockedParent() *Process {
 	if p.parentProc == nil || p.parentProc == p || !p.parentProc.isIncluded {
 		return nil
@@ -72,8 +342,8 @@ func (p *Process) lockedParent() *Process {
 // Parent returns the Process that is the parent of this Process, or nil if the Process does not have
 // a parent that is configured for inclusion.
 func (p *Process) Parent() *Process {
-	p.plock()
-	defer p.punlock()
+	p.prlock()
+	defer p.prunlock()
 	return p.lockedParent()
 }
 
@@ -85,8 +355,8 @@ func (p *Process) lockedOrigParent() *Process {
 // to pid 1), if it is known. Otherwise, returns the parent at the time the session was initialized, which
 // may be null or pid 1.
 func (p *Process) OrigParent() *Process {
-	p.plock()
-	defer p.punlock()
+	p.prlock()
+	defer p.prunlock()
 	return p.lockedOrigParent()
 }
 
@@ -101,8 +371,8 @@ func (p *Process) lockedChildren() []*Process {
 // children that meet configured filter conditions (e.g., are in configured root subtrees or ancestor paths) are included.
 // This will include tombstoned children that have been added since the last time tombstones were pruned.
 func (p *Process) Children() []*Process {
-	p.plock()
-	defer p.punlock()
+	p.prlock()
+	defer p.prunlock()
 	result := make([]*Process, len(p.includedChildProcs))
 	for i, child := range p.includedChildProcs {
 		result[i] = child
@@ -110,26 +380,124 @@ func (p *Process) Children() []*Process {
 	return result
 }
 
+func (p *Process) lockedAbsChildren() []*Process {
+	return p.absChildProcs
+}
+
+// AbsChildren returns an immutable snapshot slice of all Processes known to be a child of the Process,
+// regardless of the configured roots and filters. This will include tombstoned children that have been added
+// since the last time tombstones were pruned.
+func (p *Process) AbsChildren() []*Process {
+	p.prlock()
+	defer p.prunlock()
+	result := make([]*Process, len(p.absChildProcs))
+	copy(result, p.absChildProcs)
+	return result
+}
+
+// ancestorChainLength returns the number of distinct Processes in the chain of parents that starts at first and
+// follows next, or -1 if the chain ends without looping back on itself. It uses Brent's cycle detection
+// algorithm, so it does not allocate.
+func ancestorChainLength(first *Process, next func(*Process) *Process) int {
+	if first == nil {
+		return -1
+	}
+	// Find the length of the cycle, if there is one
+	power, cycleLen := 1, 1
+	tortoise, hare := first, next(first)
+	for tortoise != hare {
+		if hare == nil {
+			return -1
+		}
+		if power == cycleLen {
+			tortoise = hare
+			power *= 2
+			cycleLen = 0
+		}
+		hare = next(hare)
+		cycleLen++
+	}
+	// Find the number of Processes that precede the cycle
+	tortoise, hare = first, first
+	for i := 0; i < cycleLen; i++ {
+		hare = next(hare)
+	}
+	prefixLen := 0
+	for tortoise != hare {
+		tortoise = next(tortoise)
+		hare = next(hare)
+		prefixLen++
+	}
+	return prefixLen + cycleLen
+}
+
+// lockedForEachAncestor calls f for each ancestor of the Process, from its parent up to the root, until f
+// returns false. Ancestors are followed through original parent links if orig is true, or current parent links
+// otherwise. The walk is iterative, and a chain of parents that loops back on itself, e.g., because of pid reuse
+// or a corrupted serialized tree, is followed only until a Process repeats, so that each ancestor is visited
+// once and the walk always terminates.
+func (p *Process) lockedForEachAncestor(orig bool, f func(proc *Process) bool) {
+	next := func(proc *Process) *Process {
+		if orig {
+			return proc.origParentProc
+		}
+		return proc.parentProc
+	}
+	limit := ancestorChainLength(next(p), next)
+	steps := 0
+	for proc := next(p); proc != nil && proc != p && (limit < 0 || steps < limit); proc = next(proc) {
+		steps++
+		if !f(proc) {
+			return
+		}
+	}
+}
+
 func (p *Process) lockedIsDescendantOf(ancestor *Process) bool {
-	parent := p.parentProc
-	return parent != nil && ancestor != nil && (parent == ancestor || parent.lockedIsDescendantOf(ancestor))
+	found := false
+	if ancestor != nil {
+		p.lockedForEachAncestor(false, func(proc *Process) bool {
+			found = (proc == ancestor)
+			return !found
+		})
+	}
+	return found
 }
 
 // IsDescendantOf returns true if the Process is a known descendant of a provided ancestor Process
 func (p *Process) IsDescendantOf(ancestor *Process) bool {
-	p.plock()
-	defer p.punlock()
+	p.prlock()
+	defer p.prunlock()
 	return p.lockedIsDescendantOf(ancestor)
 }
 
+// lockedIsOrigDescendantOf returns true if the Process is descended from a provided ancestor Process through
+// original parent links, i.e., as the tree was before any intermediate processes exited.
+func (p *Process) lockedIsOrigDescendantOf(ancestor *Process) bool {
+	found := false
+	if ancestor != nil {
+		p.lockedForEachAncestor(true, func(proc *Process) bool {
+			found = (proc == ancestor)
+			return !found
+		})
+	}
+	return found
+}
+
+// lockedIsInOwnedSubtree returns true if the Process is the provided root, or is descended from it through
+// either current or original parent links.
+func (p *Process) lockedIsInOwnedSubtree(root *Process) bool {
+	return p == root || p.lockedIsDescendantOf(root) || p.lockedIsOrigDescendantOf(root)
+}
+
 func (p *Process) lockedIsAncestorOf(descendant *Process) bool {
 	return descendant != nil && descendant.lockedIsDescendantOf(p)
 }
 
 // IsAncestorOf returns true if the Process is a known ancestor of a provided descendant Process
 func (p *Process) IsAncestorOf(descendant *Process) bool {
-	p.plock()
-	defer p.punlock()
+	p.prlock()
+	defer p.prunlock()
 	return p.lockedIsAncestorOf(descendant)
 }
 
@@ -137,28 +505,69 @@ func (p *Process) IsAncestorOf(descendant *Process) bool {
 // tree walking operations.
 type ProcessHandler func(*Process) error
 
-func (p *Process) lockedWalkFullSubtree(h ProcessHandler) error {
-	err := h(p)
-	if err != nil {
-		return err
-	}
-	for _, child := range p.absChildProcs {
-		err = child.lockedWalkFullSubtree(h)
+// lockedWalkDepthFirst walks the subtree rooted at the Process in depth-first order, invoking a handler for each
+// Process and then descending into the children returned by children, in order. The walk is iterative and visits
+// each Process once, so a chain of parents that loops back on itself, e.g., because of pid reuse, cannot cause
+// unbounded recursion.
+func (p *Process) lockedWalkDepthFirst(children func(*Process) []*Process, h ProcessHandler) error {
+	visited := map[*Process]bool{p: true}
+	stack := []*Process{p}
+	for len(stack) > 0 {
+		proc := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		err := h(proc)
 		if err != nil {
 			return err
 		}
+		// Push children in reverse order, so that they are popped in order
+		procChildren := children(proc)
+		for i := len(procChildren) - 1; i >= 0; i-- {
+			child := procChildren[i]
+			if !visited[child] {
+				visited[child] = true
+				stack = append(stack, child)
+			}
+		}
 	}
 	return nil
 }
 
+func (p *Process) lockedWalkFullSubtree(h ProcessHandler) error {
+	return p.lockedWalkDepthFirst(func(proc *Process) []*Process { return proc.absChildProcs }, h)
+}
+
 func (p *Process) lockedWalkSubtree(h ProcessHandler) error {
-	if p.isIncluded {
+	if !p.isIncluded {
+		return nil
+	}
+	return p.lockedWalkDepthFirst(func(proc *Process) []*Process { return proc.lockedChildren() }, h)
+}
+
+// WalkSubtree walks an entire subtree starting at this process as the root, invoking
+// a handler for each. Processes are walked in depth-first order with children
+// in the configured order (pid order by default; see WithChildSort). Only subtrees enabled by configuration
+// are included
+func (p *Process) WalkSubtree(h ProcessHandler) error {
+	return p.walkSubtreeOnce(h, make(map[*Process]bool))
+}
+
+// walkSubtreeOnce walks a subtree as with WalkSubtree, skipping Processes that have already been visited, with
+// their subtrees.
+func (p *Process) walkSubtreeOnce(h ProcessHandler, visited map[*Process]bool) error {
+	if visited[p] {
+		return nil
+	}
+	visited[p] = true
+	p.prlock()
+	isIncluded := p.isIncluded
+	p.prunlock()
+	if isIncluded {
 		err := h(p)
 		if err != nil {
 			return err
 		}
-		for _, child := range p.lockedChildren() {
-			err = child.lockedWalkSubtree(h)
+		for _, child := range p.Children() {
+			err = child.walkSubtreeOnce(h, visited)
 			if err != nil {
 				return err
 			}
@@ -167,51 +576,148 @@ func (p *Process) lockedWalkSubtree(h ProcessHandler) error {
 	return nil
 }
 
-// WalkSubtree walks an entire subtree starting at this process as the root, invoking
-// a handler for each. Processes are walked in depth-first order with children
-// sorted in pid order. Only subtrees enabled by configuration are included
-func (p *Process) WalkSubtree(h ProcessHandler) error {
-	if p.isIncluded {
-		err := h(p)
+// walkBFS walks the included subtrees of a list of Processes in breadth-first order, invoking a handler for
+// each. Each Process is visited once, even if the subtrees overlap or loop back on themselves. The tree lock is
+// not held while the handler runs.
+func walkBFS(queue []*Process, h ProcessHandler) error {
+	visited := make(map[*Process]bool)
+	for len(queue) > 0 {
+		proc := queue[0]
+		queue = queue[1:]
+		if visited[proc] {
+			continue
+		}
+		visited[proc] = true
+		proc.prlock()
+		isIncluded := proc.isIncluded
+		proc.prunlock()
+		if !isIncluded {
+			continue
+		}
+		err := h(proc)
 		if err != nil {
 			return err
 		}
-		for _, child := range p.Children() {
-			err = child.WalkSubtree(h)
-			if err != nil {
-				return err
+		queue = append(queue, proc.Children()...)
+	}
+	return nil
+}
+
+// WalkSubtreeBFS walks an entire subtree starting at this process as the root, invoking a handler for each, as
+// with WalkSubtree, but in breadth-first order: the Process itself, then its children, then its grandchildren,
+// and so on. Within each level, the children of each Process are walked together, in the configured order.
+// Only subtrees enabled by configuration are included.
+func (p *Process) WalkSubtreeBFS(h ProcessHandler) error {
+	return walkBFS([]*Process{p}, h)
+}
+
+// WalkSubtreeParallel walks an entire subtree starting at this process as the root, invoking a handler for
+// each, as with WalkSubtree, but with up to workers handler invocations running concurrently. The handler for
+// a Process always returns before the handlers for its children are invoked; otherwise, the order of
+// invocations is unspecified, so the handler must be safe for concurrent use. Each Process is visited once, even
+// if the subtree loops back on itself. If a handler returns an error, no further handlers are invoked, and the
+// first error is returned after running handlers complete. Only subtrees enabled by configuration are included.
+func (p *Process) WalkSubtreeParallel(h ProcessHandler, workers int) error {
+	if workers < 1 {
+		workers = 1
+	}
+	var (
+		lock     sync.Mutex
+		queue    = []*Process{p}
+		visited  = map[*Process]bool{p: true}
+		running  int
+		firstErr error
+	)
+	// A fixed pool of workers takes Processes from the queue. The walk is complete when the queue is empty and no
+	// handler is running that may add children to it.
+	cond := sync.NewCond(&lock)
+	worker := func() {
+		lock.Lock()
+		defer lock.Unlock()
+		for {
+			for len(queue) == 0 && running > 0 && firstErr == nil {
+				cond.Wait()
+			}
+			if len(queue) == 0 || firstErr != nil {
+				cond.Broadcast()
+				return
 			}
+			proc := queue[0]
+			queue = queue[1:]
+			running++
+			lock.Unlock()
+
+			proc.prlock()
+			isIncluded := proc.isIncluded
+			proc.prunlock()
+			var err error
+			var children []*Process
+			if isIncluded {
+				err = h(proc)
+				if err == nil {
+					children = proc.Children()
+				}
+			}
+
+			lock.Lock()
+			running--
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			for _, child := range children {
+				if !visited[child] {
+					visited[child] = true
+					queue = append(queue, child)
+				}
+			}
+			cond.Broadcast()
 		}
 	}
-	return nil
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			worker()
+		}()
+	}
+	wg.Wait()
+	return firstErr
 }
 
+// lockedWalkFullAncestry calls a handler for the Process and then each of its ancestors, included or not, up to
+// the root, until the handler returns an error. Each ancestor is visited once, even if the chain of parents loops
+// back on itself.
 func (p *Process) lockedWalkFullAncestry(h ProcessHandler) error {
 	err := h(p)
 	if err != nil {
 		return err
 	}
-	parent := p.parentProc
-	if parent != nil && parent != p {
-		err = parent.lockedWalkFullAncestry(h)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+	p.lockedForEachAncestor(false, func(proc *Process) bool {
+		err = h(proc)
+		return err == nil
+	})
+	return err
 }
 
-func (p *Process) lockedWalkAncestry(h ProcessHandler) error {
-	var err error
+// lockedAncestry returns the included Processes in the ancestry list starting at this Process, up to the root.
+func (p *Process) lockedAncestry() []*Process {
+	result := []*Process{}
 	if p.isIncluded {
-		err = h(p)
-		if err != nil {
-			return err
-		}
+		result = append(result, p)
 	}
-	parent := p.parentProc
-	if parent != nil && parent != p {
-		err = parent.lockedWalkAncestry(h)
+	p.lockedForEachAncestor(false, func(proc *Process) bool {
+		if proc.isIncluded {
+			result = append(result, proc)
+		}
+		return true
+	})
+	return result
+}
+
+func (p *Process) lockedWalkAncestry(h ProcessHandler) error {
+	for _, proc := range p.lockedAncestry() {
+		err := h(proc)
 		if err != nil {
 			return err
 		}
@@ -220,21 +726,14 @@ func (p *Process) lockedWalkAncestry(h ProcessHandler) error {
 }
 
 // WalkAncestry walks the ancestry list starting at this process, up to the root, invoking
-// a handler for each. Only Processes enabled by configuration are included
+// a handler for each. Only Processes enabled by configuration are included. The ancestry is captured
+// before the handler is first invoked.
 func (p *Process) WalkAncestry(h ProcessHandler) error {
-	var err error
-	p.plock()
-	isIncluded := p.isIncluded
-	parent := p.parentProc
-	p.punlock()
-	if isIncluded {
-		err = h(p)
-		if err != nil {
-			return err
-		}
-	}
-	if parent != nil && parent != p {
-		err = parent.WalkAncestry(h)
+	p.prlock()
+	ancestry := p.lockedAncestry()
+	p.prunlock()
+	for _, proc := range ancestry {
+		err := h(proc)
 		if err != nil {
 			return err
 		}
@@ -242,19 +741,110 @@ func (p *Process) WalkAncestry(h ProcessHandler) error {
 	return nil
 }
 
+func (p *Process) lockedDescendants() []*Process {
+	result := []*Process{}
+	for _, child := range p.lockedChildren() {
+		child.lockedWalkSubtree(func(proc *Process) error {
+			result = append(result, proc)
+			return nil
+		})
+	}
+	p.pt.lockedSortProcessesByPid(result)
+	return result
+}
+
+// Descendants returns a snapshot slice of the included descendants of the Process, not including the Process
+// itself, sorted in ascending pid order. Includes unpruned tombstones.
+func (p *Process) Descendants() []*Process {
+	p.prlock()
+	defer p.prunlock()
+	return p.lockedDescendants()
+}
+
+func (p *Process) lockedAncestors() []*Process {
+	result := []*Process{}
+	p.lockedForEachAncestor(false, func(proc *Process) bool {
+		if proc.isIncluded {
+			result = append(result, proc)
+		}
+		return true
+	})
+	return result
+}
+
+// Ancestors returns a snapshot slice of the included ancestors of the Process, not including the Process
+// itself, ordered from its parent up to the root, as visited by WalkAncestry.
+func (p *Process) Ancestors() []*Process {
+	p.prlock()
+	defer p.prunlock()
+	return p.lockedAncestors()
+}
+
 func (p *Process) lockedDepth() int {
 	result := 0
-	proc := p
-	for proc.parentProc != nil && proc.parentProc != proc && proc.parentProc.isIncluded {
-		proc = proc.parentProc
+	p.lockedForEachAncestor(false, func(proc *Process) bool {
+		if !proc.isIncluded {
+			return false
+		}
 		result++
-	}
+		return true
+	})
 	return result
 }
 
 // Depth computes the depth of this process in the process tree. 0 is returned for root processes; 1 for their children; etc.
 func (p *Process) Depth() int {
-	p.plock()
-	defer p.punlock()
+	p.prlock()
+	defer p.prunlock()
 	return p.lockedDepth()
 }
+
+func (p *Process) lockedPath() string {
+	lineage := p.pt.lockedIncludedLineage(p)
+	var sb strings.Builder
+	for i := len(lineage) - 1; i >= 0; i-- {
+		proc := lineage[i]
+		sb.WriteString(proc.lockedExecutable())
+		sb.WriteByte('(')
+		sb.WriteString(strconv.Itoa(proc.lockedPid()))
+		sb.WriteByte(')')
+		if i > 0 {
+			sb.WriteByte('/')
+		}
+	}
+	return sb.String()
+}
+
+// Path returns a readable description of the position of this Process in the included tree: the executable
+// name and pid of each of its included ancestors, from the root down to the Process itself, separated by
+// slashes, e.g., "systemd(1)/sshd(812)/bash(3401)". See ProcTree.ProcessByPath.
+func (p *Process) Path() string {
+	p.prlock()
+	defer p.prunlock()
+	return p.lockedPath()
+}
+
+// String implements fmt.Stringer, describing the Process by its executable name and pid, as in Path, with its
+// parent pid and whether it has exited or is excluded from the tree by configuration, e.g.,
+// "bash(3401, parent 812)" or "sleep(3502, parent 3401, exited)", so that Processes can be logged directly.
+func (p *Process) String() string {
+	p.prlock()
+	defer p.prunlock()
+	var sb strings.Builder
+	sb.WriteString(p.lockedExecutable())
+	sb.WriteByte('(')
+	sb.WriteString(strconv.Itoa(p.lockedPid()))
+	ppid := p.gopsProcess.PPid()
+	if ppid > 0 {
+		sb.WriteString(", parent ")
+		sb.WriteString(strconv.Itoa(ppid))
+	}
+	if p.isTombstone {
+		sb.WriteString(", exited")
+	}
+	if !p.isIncluded {
+		sb.WriteString(", excluded")
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
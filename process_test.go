@@ -0,0 +1,504 @@
+package proctree
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// loadTestTree loads a small read-only tree:
+//
+//	1 init
+//	├── 10 supervisor
+//	│   ├── 12 worker
+//	│   │   └── 15 helper
+//	│   └── 13 worker
+//	└── 11 cron
+func loadTestTree(t *testing.T) *ProcTree {
+	pt, err := LoadJSON(strings.NewReader(`{"roots":[{"pid":1,"executable":"init","children":[
+		{"pid":10,"ppid":1,"executable":"supervisor","children":[
+			{"pid":12,"ppid":10,"executable":"worker","children":[{"pid":15,"ppid":12,"executable":"helper"}]},
+			{"pid":13,"ppid":10,"executable":"worker"}]},
+		{"pid":11,"ppid":1,"executable":"cron"}]}]}`))
+	if err != nil {
+		t.Fatalf("LoadJSON() returned error: %s", err)
+	}
+	return pt
+}
+
+// checkPids reports an error if a list of Processes does not have the expected pids, in order.
+func checkPids(t *testing.T, what string, procs []*Process, expected ...int) {
+	pids := []int{}
+	for _, proc := range procs {
+		pids = append(pids, proc.Pid())
+	}
+	if len(pids) != len(expected) {
+		t.Errorf("%s returned pids %v, expected %v", what, pids, expected)
+		return
+	}
+	for i := range pids {
+		if pids[i] != expected[i] {
+			t.Errorf("%s returned pids %v, expected %v", what, pids, expected)
+			return
+		}
+	}
+}
+
+func TestDescendantsAndAncestors(t *testing.T) {
+	pt := loadTestTree(t)
+	defer pt.Close()
+
+	checkPids(t, "Descendants()", pt.PidProcess(1).Descendants(), 10, 11, 12, 13, 15)
+	checkPids(t, "Descendants()", pt.PidProcess(10).Descendants(), 12, 13, 15)
+	checkPids(t, "Descendants()", pt.PidProcess(15).Descendants())
+	checkPids(t, "Ancestors()", pt.PidProcess(15).Ancestors(), 12, 10, 1)
+	checkPids(t, "Ancestors()", pt.PidProcess(1).Ancestors())
+}
+
+func TestCommonAncestor(t *testing.T) {
+	pt := loadTestTree(t)
+	defer pt.Close()
+
+	p := pt.PidProcess
+	tests := []struct {
+		procs    []*Process
+		expected *Process
+	}{
+		{[]*Process{p(15), p(13)}, p(10)},
+		{[]*Process{p(12), p(13), p(15)}, p(10)},
+		{[]*Process{p(15), p(11)}, p(1)},
+		{[]*Process{p(12), p(15)}, p(12)},
+		{[]*Process{p(13)}, p(13)},
+		{[]*Process{}, nil},
+		{[]*Process{p(13), nil}, nil},
+	}
+	for i, test := range tests {
+		result := pt.CommonAncestor(test.procs...)
+		if result != test.expected {
+			t.Errorf("Test %d: pt.CommonAncestor() returned %v, expected %v", i, result, test.expected)
+		}
+	}
+}
+
+func TestWalkBFS(t *testing.T) {
+	pt := loadTestTree(t)
+	defer pt.Close()
+
+	visited := []*Process{}
+	visit := func(proc *Process) error {
+		visited = append(visited, proc)
+		return nil
+	}
+	err := pt.WalkBFS(visit)
+	if err != nil {
+		t.Fatalf("pt.WalkBFS() returned error: %s", err)
+	}
+	checkPids(t, "pt.WalkBFS()", visited, 1, 10, 11, 12, 13, 15)
+
+	visited = nil
+	err = pt.PidProcess(10).WalkSubtreeBFS(visit)
+	if err != nil {
+		t.Fatalf("WalkSubtreeBFS() returned error: %s", err)
+	}
+	checkPids(t, "WalkSubtreeBFS()", visited, 10, 12, 13, 15)
+}
+
+func TestWalkSubtreeParallel(t *testing.T) {
+	pt := loadTestTree(t)
+	defer pt.Close()
+
+	var lock sync.Mutex
+	done := make(map[int]bool)
+	err := pt.PidProcess(1).WalkSubtreeParallel(func(proc *Process) error {
+		lock.Lock()
+		defer lock.Unlock()
+		parent := proc.Parent()
+		if parent != nil && !done[parent.Pid()] {
+			t.Errorf("Handler for pid %d invoked before handler for its parent", proc.Pid())
+		}
+		done[proc.Pid()] = true
+		return nil
+	}, 3)
+	if err != nil {
+		t.Fatalf("WalkSubtreeParallel() returned error: %s", err)
+	}
+	if len(done) != 6 {
+		t.Errorf("WalkSubtreeParallel() visited %d processes, expected 6", len(done))
+	}
+
+	err = pt.PidProcess(1).WalkSubtreeParallel(func(proc *Process) error {
+		if proc.Pid() == 10 {
+			return fmt.Errorf("Handler failed")
+		}
+		if proc.Pid() == 12 {
+			t.Errorf("Handler invoked for a child of a failed process")
+		}
+		return nil
+	}, 3)
+	if err == nil {
+		t.Errorf("WalkSubtreeParallel() did not return the handler error")
+	}
+}
+
+func TestCounts(t *testing.T) {
+	pt, err := LoadJSON(strings.NewReader(`{"roots":[{"pid":1,"executable":"init","children":[
+		{"pid":10,"ppid":1,"executable":"bash","children":[{"pid":12,"ppid":10,"executable":"make","tombstone":true}]},
+		{"pid":11,"ppid":1,"executable":"cron"}]},{"pid":2,"executable":"kthreadd"}]}`))
+	if err != nil {
+		t.Fatalf("LoadJSON() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	counts := pt.Counts()
+	if counts != (Counts{Total: 5, Included: 5, Tombstones: 1, Roots: 2}) {
+		t.Errorf("pt.Counts() returned unexpected counts %+v", counts)
+	}
+	for pid, expected := range map[int]int{1: 4, 10: 2, 12: 1, 2: 1} {
+		count := pt.PidProcess(pid).SubtreeCount()
+		if count != expected {
+			t.Errorf("SubtreeCount() of pid %d returned %d, expected %d", pid, count, expected)
+		}
+	}
+}
+
+func TestSubtree(t *testing.T) {
+	pt := loadTestTree(t)
+	defer pt.Close()
+
+	_, err := pt.Subtree(nil)
+	if err == nil {
+		t.Errorf("Subtree(nil) did not return an error")
+	}
+	v, err := pt.Subtree(pt.PidProcess(10))
+	if err != nil {
+		t.Fatalf("Subtree() returned error: %s", err)
+	}
+	checkPids(t, "Processes()", v.Processes(), 10, 12, 13, 15)
+	if v.Count() != 4 {
+		t.Errorf("Count() returned %d, expected 4", v.Count())
+	}
+	if v.PidProcess(15) == nil {
+		t.Errorf("PidProcess(15) returned nil")
+	}
+	if v.PidProcess(11) != nil || v.PidProcess(1) != nil {
+		t.Errorf("PidProcess() returned a Process outside of the view")
+	}
+	if v.Contains(pt.PidProcess(1)) || !v.Contains(pt.PidProcess(10)) {
+		t.Errorf("Contains() returned unexpected result")
+	}
+	walked := []*Process{}
+	err = v.Walk(func(proc *Process) error {
+		walked = append(walked, proc)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk() returned error: %s", err)
+	}
+	checkPids(t, "Walk()", walked, 10, 12, 15, 13)
+}
+
+func TestPath(t *testing.T) {
+	pt := loadTestTree(t)
+	defer pt.Close()
+
+	proc := pt.PidProcess(15)
+	path := proc.Path()
+	expected := fmt.Sprintf("%s(1)/%s(10)/%s(12)/%s(15)", pt.PidProcess(1).Executable(), pt.PidProcess(10).Executable(),
+		pt.PidProcess(12).Executable(), proc.Executable())
+	if path != expected {
+		t.Errorf("Path() returned %q, expected %q", path, expected)
+	}
+	if pt.ProcessByPath(path) != proc {
+		t.Errorf("ProcessByPath(%q) did not return pid 15", path)
+	}
+	for _, bad := range []string{"", "15", strings.Replace(path, "(12)", "(13)", 1), path + "/x(99)"} {
+		if pt.ProcessByPath(bad) != nil {
+			t.Errorf("ProcessByPath(%q) returned a Process", bad)
+		}
+	}
+}
+
+func TestAncestryCycle(t *testing.T) {
+	pt := loadTestTree(t)
+	defer pt.Close()
+
+	// Corrupt the tree so that 13 hangs off a cycle 1 -> 15 -> 12 -> 10 -> 1 that does not contain it
+	pt.plock()
+	pt.pidMap[1].parentProc = pt.pidMap[15]
+	pt.punlock()
+
+	proc := pt.PidProcess(13)
+	ancestors := proc.Ancestors()
+	checkPids(t, "Ancestors()", ancestors, 10, 1, 15, 12)
+	if proc.Depth() != 4 {
+		t.Errorf("Depth() returned %d, expected 4", proc.Depth())
+	}
+	if proc.IsDescendantOf(pt.PidProcess(11)) {
+		t.Errorf("IsDescendantOf() returned true for a Process outside the cycle")
+	}
+	if !proc.IsDescendantOf(pt.PidProcess(15)) {
+		t.Errorf("IsDescendantOf() returned false for a Process in the cycle")
+	}
+	walked := []*Process{}
+	err := pt.PidProcess(12).WalkAncestry(func(proc *Process) error {
+		walked = append(walked, proc)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkAncestry() returned error: %s", err)
+	}
+	checkPids(t, "WalkAncestry()", walked, 12, 10, 1, 15)
+}
+
+func TestAncestryLongCycle(t *testing.T) {
+	pt := loadTestTree(t)
+	defer pt.Close()
+
+	// Build a long chain whose top loops back into its middle
+	pt.plock()
+	chain := []*Process{}
+	for i := 0; i < 200; i++ {
+		proc := newProcess(pt, &staticProcess{pid: 1000 + i, ppid: 999 + i, executable: "chain"})
+		proc.isIncluded = true
+		if i > 0 {
+			proc.parentProc = chain[i-1]
+		}
+		chain = append(chain, proc)
+	}
+	chain[0].parentProc = chain[70]
+	pt.punlock()
+
+	last := chain[len(chain)-1]
+	if n := len(last.Ancestors()); n != len(chain)-1 {
+		t.Errorf("Ancestors() returned %d Processes, expected %d", n, len(chain)-1)
+	}
+	if last.IsDescendantOf(pt.PidProcess(1)) {
+		t.Errorf("IsDescendantOf() returned true for a Process outside the chain")
+	}
+}
+
+func TestProcessString(t *testing.T) {
+	fs := newFakeSource(
+		ProcInfo{Pid: 100, Executable: "init", StartTime: 1},
+		ProcInfo{Pid: 101, PPid: 100, Executable: "sh", StartTime: 2},
+		ProcInfo{Pid: 102, PPid: 101, Executable: "sleep", StartTime: 3},
+	)
+	pt, err := New(WithProcessSource(fs), WithRootPid(101))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+	proc := pt.PidProcess(102)
+	fs.remove(102)
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+	var init *Process
+	for _, abs := range pt.AbsProcesses() {
+		if abs.Pid() == 100 {
+			init = abs
+		}
+	}
+
+	cases := []struct {
+		proc *Process
+		str  string
+		json string
+	}{
+		{proc: pt.PidProcess(101), str: "sh(101, parent 100)"},
+		{proc: proc, str: "sleep(102, parent 101, exited)", json: `"tombstone":true`},
+		{proc: init, str: "init(100, excluded)", json: `"excluded":true`},
+	}
+	for _, c := range cases {
+		str := fmt.Sprint(c.proc)
+		if str != c.str {
+			t.Errorf("String() returned %q, expected %q", str, c.str)
+		}
+		data, err := json.Marshal(c.proc)
+		if err != nil {
+			t.Fatalf("json.Marshal() returned error: %s", err)
+		}
+		if c.json != "" && !strings.Contains(string(data), c.json) {
+			t.Errorf("json.Marshal() of %s returned %s, which does not contain %s", str, data, c.json)
+		}
+	}
+}
+
+func TestProcessLiveness(t *testing.T) {
+	fs := newFakeSource(
+		ProcInfo{Pid: 100, Executable: "init", StartTime: 1},
+		ProcInfo{Pid: 101, PPid: 100, Executable: "sh", StartTime: 2},
+		ProcInfo{Pid: 102, PPid: 100, Executable: "sleep", StartTime: 3},
+	)
+	pt, err := New(WithProcessSource(fs), WithRootPid(101))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+	sh := pt.PidProcess(101)
+	if !sh.IsAlive() || sh.IsTombstone() || !sh.IsIncluded() {
+		t.Errorf("Process 101 is not alive and included")
+	}
+	for _, proc := range pt.AbsProcesses() {
+		if proc.Pid() == 100 && proc.IsIncluded() {
+			t.Errorf("Process 100 is included, although it is not descended from root 101")
+		}
+	}
+
+	// IsAlive checks the source, while IsTombstone reflects the most recent update
+	fs.remove(101)
+	if sh.IsAlive() || sh.IsTombstone() {
+		t.Errorf("Process 101 is alive or tombstoned after it exited, before an update")
+	}
+
+	// A pid that was reused by a new process is not alive
+	fs.set(ProcInfo{Pid: 101, PPid: 100, Executable: "sh", StartTime: 5})
+	if sh.IsAlive() {
+		t.Errorf("Process 101 is alive after its pid was reused")
+	}
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+	if sh.IsAlive() || !sh.IsTombstone() {
+		t.Errorf("Process 101 is alive or not tombstoned after an update")
+	}
+
+	loaded := loadTestTree(t)
+	defer loaded.Close()
+	if loaded.PidProcess(15).IsAlive() {
+		t.Errorf("Process 15 of a loaded tree is alive")
+	}
+}
+
+func TestFirstAndLastSeen(t *testing.T) {
+	fs := newFakeSource(
+		ProcInfo{Pid: 100, Executable: "init", StartTime: 1},
+		ProcInfo{Pid: 101, PPid: 100, Executable: "sh", StartTime: 2},
+	)
+	before := time.Now()
+	pt, err := New(WithProcessSource(fs))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+	init, sh := pt.PidProcess(100), pt.PidProcess(101)
+	first := init.FirstSeen()
+	if first.Before(before) || !init.LastSeen().Equal(first) {
+		t.Errorf("Process 100 was first seen at %s and last seen at %s, expected both at the initial update",
+			first, init.LastSeen())
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	fs.remove(101)
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+	if !init.FirstSeen().Equal(first) || !init.LastSeen().After(first) {
+		t.Errorf("Process 100 was first seen at %s and last seen at %s, expected to be seen again", first,
+			init.LastSeen())
+	}
+	if !sh.LastSeen().Equal(first) {
+		t.Errorf("Process 101 was last seen at %s, expected %s, before it exited", sh.LastSeen(), first)
+	}
+
+	loaded := loadTestTree(t)
+	defer loaded.Close()
+	if !loaded.PidProcess(1).FirstSeen().IsZero() {
+		t.Errorf("Process 1 of a loaded tree has a first seen time")
+	}
+}
+
+func TestGeneration(t *testing.T) {
+	fs := newFakeSource(
+		ProcInfo{Pid: 100, Executable: "init", StartTime: 1},
+		ProcInfo{Pid: 101, PPid: 100, Executable: "sh", StartTime: 2},
+	)
+	pt, err := New(WithProcessSource(fs))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+	init, sh := pt.PidProcess(100), pt.PidProcess(101)
+	update := func(prune bool) uint64 {
+		err := pt.Update(prune)
+		if err != nil {
+			t.Fatalf("Update() returned error: %s", err)
+		}
+		return pt.Generation()
+	}
+	if pt.Generation() != 1 || init.LastChangedGeneration() != 1 {
+		t.Fatalf("Generation() returned %d after the initial update, expected 1", pt.Generation())
+	}
+	if gen := update(false); gen != 1 {
+		t.Errorf("Generation() returned %d after an update without changes, expected 1", gen)
+	}
+
+	fs.set(ProcInfo{Pid: 102, PPid: 101, Executable: "cc", StartTime: 3})
+	if gen := update(false); gen != 2 || pt.PidProcess(102).LastChangedGeneration() != 2 ||
+		sh.LastChangedGeneration() != 1 {
+		t.Errorf("Generation() returned %d after a process started, expected 2 with only the new process changed", gen)
+	}
+
+	err = pt.Reconfigure(WithRootPid(101))
+	if err != nil {
+		t.Fatalf("Reconfigure() returned error: %s", err)
+	}
+	if gen := pt.Generation(); gen != 3 || init.LastChangedGeneration() != 3 || sh.LastChangedGeneration() != 1 {
+		t.Errorf("Generation() returned %d after process 100 was excluded, expected 3 with only process 100 changed", gen)
+	}
+
+	fs.remove(102)
+	update(false)
+	if gen := update(true); gen != 5 {
+		t.Errorf("Generation() returned %d after a process exited and was pruned, expected 5", gen)
+	}
+}
+
+func TestTombstoneRetention(t *testing.T) {
+	fs := newFakeSource(ProcInfo{Pid: 1, Executable: "init", StartTime: 1})
+	for pid := 100; pid < 104; pid++ {
+		fs.set(ProcInfo{Pid: pid, PPid: 1, Executable: "sh", StartTime: uint64(pid)})
+	}
+	pt, err := New(WithProcessSource(fs), WithTombstoneRetention(time.Hour, 2))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+	_, err = New(WithProcessSource(fs), WithTombstoneRetention(-time.Second, 0))
+	if err == nil {
+		t.Errorf("New() with a negative tombstone age did not return an error")
+	}
+
+	// The tombstones of the processes that exited earliest are pruned first
+	for pid := 100; pid < 104; pid++ {
+		fs.remove(pid)
+		err = pt.Update(false)
+		if err != nil {
+			t.Fatalf("Update() returned error: %s", err)
+		}
+	}
+	procs := pt.AbsProcesses()
+	if len(procs) != 3 || procs[1].Pid() != 102 || procs[2].Pid() != 103 {
+		t.Errorf("AbsProcesses() returned %v, expected init and the two newest tombstones", procs)
+	}
+
+	err = pt.Reconfigure(WithTombstoneRetention(10*time.Millisecond, 0))
+	if err != nil {
+		t.Fatalf("Reconfigure() returned error: %s", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+	procs = pt.AbsProcesses()
+	if len(procs) != 1 {
+		t.Errorf("AbsProcesses() returned %v, expected the tombstones to have expired", procs)
+	}
+}
@@ -0,0 +1,198 @@
+package proctree
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// procfs is the path at which a procfs is mounted, from which process information is read on Linux (see
+// WithProcfsPath). It is ignored on other platforms, which read process information from the system.
+type procfs string
+
+// defaultProcfs is the path of the procfs of the calling process.
+const defaultProcfs procfs = "/proc"
+
+// parseStat splits the contents of a /proc/<pid>/stat file into the executable name, which is parenthesized and
+// may itself contain spaces and parentheses, and the fields that follow it. The first returned field is the
+// process state (field 3).
+func parseStat(stat string) (string, []string, error) {
+	i := strings.Index(stat, "(")
+	j := strings.LastIndex(stat, ")")
+	if i < 0 || j < i {
+		return "", nil, fmt.Errorf("Malformed stat")
+	}
+	return stat[i+1 : j], strings.Fields(stat[j+1:]), nil
+}
+
+// parseStatusUID returns the effective user id from the contents of a /proc/<pid>/status file.
+func parseStatusUID(status string) (int, error) {
+	for _, line := range strings.Split(status, "\n") {
+		if !strings.HasPrefix(line, "Uid:") {
+			continue
+		}
+		// The Uid line lists the real, effective, saved and filesystem uids
+		fields := strings.Fields(line[len("Uid:"):])
+		if len(fields) < 2 {
+			break
+		}
+		return strconv.Atoi(fields[1])
+	}
+	return -1, fmt.Errorf("Uid not found in status")
+}
+
+// parseStatusNSpid returns the pids of a process in each of its nested PID namespaces from the contents of a
+// /proc/<pid>/status file, from the outermost namespace to the innermost.
+func parseStatusNSpid(status string) ([]int, error) {
+	for _, line := range strings.Split(status, "\n") {
+		if !strings.HasPrefix(line, "NSpid:") {
+			continue
+		}
+		fields := strings.Fields(line[len("NSpid:"):])
+		if len(fields) == 0 {
+			break
+		}
+		pids := make([]int, len(fields))
+		for i, field := range fields {
+			pid, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("Malformed NSpid %q in status", line)
+			}
+			pids[i] = pid
+		}
+		return pids, nil
+	}
+	return nil, fmt.Errorf("NSpid not found in status")
+}
+
+// parseBootTime returns the time at which the system booted from the contents of a /proc/stat file.
+func parseBootTime(stat string) (time.Time, error) {
+	for _, line := range strings.Split(stat, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "btime" {
+			continue
+		}
+		sec, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Malformed boot time %q in stat", line)
+		}
+		return time.Unix(sec, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("Boot time not found in stat")
+}
+
+// parseCmdline splits the contents of a /proc/<pid>/cmdline file into arguments. Returns nil if the command line
+// is empty, as it is for kernel threads and zombies.
+func parseCmdline(cmdline string) []string {
+	if cmdline == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(cmdline, "\x00"), "\x00")
+}
+
+// parseCgroup returns the cgroup path from the contents of /proc/<pid>/cgroup: the path in the unified (cgroup
+// v2) hierarchy if there is one, otherwise the path in the first listed hierarchy.
+func parseCgroup(cgroup string) (string, error) {
+	first := ""
+	found := false
+	for _, line := range strings.Split(cgroup, "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			return parts[2], nil
+		}
+		if !found {
+			first, found = parts[2], true
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("Cgroup not found")
+	}
+	return first, nil
+}
+
+// parseSmapsRollup returns the memory statistics in the contents of /proc/<pid>/smaps_rollup, whose values are
+// in kB.
+func parseSmapsRollup(smaps string) (MemoryStats, error) {
+	stats := MemoryStats{}
+	found := false
+	for _, line := range strings.Split(smaps, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[2] != "kB" {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return MemoryStats{}, fmt.Errorf("Malformed memory statistic %q", line)
+		}
+		bytes := kb * 1024
+		switch fields[0] {
+		case "Rss:":
+			stats.RSS = bytes
+			found = true
+		case "Pss:":
+			stats.PSS = bytes
+		case "Shared_Clean:", "Shared_Dirty:":
+			stats.Shared += bytes
+		case "Private_Clean:", "Private_Dirty:":
+			stats.Private += bytes
+		case "Swap:":
+			stats.Swap = bytes
+		}
+	}
+	if !found {
+		return MemoryStats{}, fmt.Errorf("Memory statistics not found")
+	}
+	return stats, nil
+}
+
+// parseProcargs2 splits the value of the Darwin kern.procargs2 sysctl into the command line and environment of
+// a process. The value is the argument count, as a 32-bit integer, followed by the executable path, padding,
+// and then the arguments and environment variables, each terminated by a NUL.
+func parseProcargs2(data []byte) ([]string, []string, error) {
+	if len(data) < 4 {
+		return nil, nil, fmt.Errorf("Malformed procargs")
+	}
+	argc := int(uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16 | uint32(data[3])<<24)
+	data = data[4:]
+
+	// Skip the executable path and its padding
+	i := 0
+	for i < len(data) && data[i] != 0 {
+		i++
+	}
+	for i < len(data) && data[i] == 0 {
+		i++
+	}
+	data = data[i:]
+
+	args := []string{}
+	environ := []string{}
+	for len(data) > 0 {
+		j := 0
+		for j < len(data) && data[j] != 0 {
+			j++
+		}
+		s := string(data[:j])
+		if j < len(data) {
+			j++
+		}
+		data = data[j:]
+		if len(args) < argc {
+			args = append(args, s)
+			continue
+		}
+		// The environment ends at the first empty string
+		if s == "" {
+			break
+		}
+		environ = append(environ, s)
+	}
+	if len(args) < argc {
+		return nil, nil, fmt.Errorf("Malformed procargs")
+	}
+	return args, environ, nil
+}
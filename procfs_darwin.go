@@ -0,0 +1,316 @@
+package proctree
+
+import (
+	"encoding/binary"
+	"fmt"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Darwin sysctl and proc_info constants, from <sys/sysctl.h> and <sys/proc_info.h>.
+const (
+	ctlKern          = 1
+	kernProc         = 14
+	kernProcAll      = 0
+	kernProcPid      = 1
+	kernProcargs2    = 49
+	procInfoCallPid  = 2
+	procPidListFDs   = 1
+	procPidTaskInfo  = 4
+	procFDInfoSize   = 8
+	procTaskInfoSize = 96
+	statZombie       = 5
+)
+
+// Offsets of the fields of struct kinfo_proc that are used, which are the same on amd64 and arm64.
+const (
+	kinfoProcSize     = 648
+	kinfoStartSecOff  = 0
+	kinfoStartUsecOff = 8
+	kinfoStatOff      = 36
+	kinfoPidOff       = 40
+	kinfoCommOff      = 243
+	kinfoCommLen      = 16
+	kinfoUIDOff       = 420
+	kinfoPPidOff      = 560
+)
+
+// sysctl returns the value of the sysctl identified by a MIB.
+func sysctl(mib []int32) ([]byte, error) {
+	size := uintptr(0)
+	_, _, errno := syscall.Syscall6(syscall.SYS___SYSCTL, uintptr(unsafe.Pointer(&mib[0])), uintptr(len(mib)), 0,
+		uintptr(unsafe.Pointer(&size)), 0, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	if size == 0 {
+		return []byte{}, nil
+	}
+	// The value may grow between the calls, e.g., if processes are created
+	size += size / 8
+	buf := make([]byte, size)
+	_, _, errno = syscall.Syscall6(syscall.SYS___SYSCTL, uintptr(unsafe.Pointer(&mib[0])), uintptr(len(mib)),
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)), 0, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	return buf[:size], nil
+}
+
+// kinfoProc is a struct kinfo_proc, as returned by the kern.proc sysctls.
+type kinfoProc []byte
+
+func (k kinfoProc) int32At(off int) int32 {
+	return int32(binary.LittleEndian.Uint32(k[off:]))
+}
+
+func (k kinfoProc) pid() int {
+	return int(k.int32At(kinfoPidOff))
+}
+
+func (k kinfoProc) ppid() int {
+	return int(k.int32At(kinfoPPidOff))
+}
+
+func (k kinfoProc) uid() int {
+	return int(binary.LittleEndian.Uint32(k[kinfoUIDOff:]))
+}
+
+func (k kinfoProc) isZombie() bool {
+	return k[kinfoStatOff] == statZombie
+}
+
+// comm returns the executable name, which is truncated to 16 characters.
+func (k kinfoProc) comm() string {
+	comm := k[kinfoCommOff : kinfoCommOff+kinfoCommLen]
+	for i, c := range comm {
+		if c == 0 {
+			return string(comm[:i])
+		}
+	}
+	return string(comm)
+}
+
+// startTime returns the time at which the process started, in microseconds since the epoch.
+func (k kinfoProc) startTime() uint64 {
+	sec := binary.LittleEndian.Uint64(k[kinfoStartSecOff:])
+	usec := binary.LittleEndian.Uint32(k[kinfoStartUsecOff:])
+	return sec*1000000 + uint64(usec)
+}
+
+// processKinfo returns the kinfo_proc of the process with the given pid.
+func processKinfo(pid int) (kinfoProc, error) {
+	buf, err := sysctl([]int32{ctlKern, kernProc, kernProcPid, int32(pid)})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read process %d: %s", pid, err)
+	}
+	if len(buf) < kinfoProcSize {
+		return nil, fmt.Errorf("Process %d does not exist", pid)
+	}
+	return kinfoProc(buf[:kinfoProcSize]), nil
+}
+
+// allKinfos returns the kinfo_procs of all processes.
+func allKinfos() ([]kinfoProc, error) {
+	buf, err := sysctl([]int32{ctlKern, kernProc, kernProcAll, 0})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list processes: %s", err)
+	}
+	kinfos := make([]kinfoProc, 0, len(buf)/kinfoProcSize)
+	for off := 0; off+kinfoProcSize <= len(buf); off += kinfoProcSize {
+		kinfos = append(kinfos, kinfoProc(buf[off:off+kinfoProcSize]))
+	}
+	return kinfos, nil
+}
+
+// procPidInfo reads information about the process with the given pid with the proc_info system call, as with
+// libproc's proc_pidinfo. Returns the number of bytes read into buf.
+func procPidInfo(pid int, flavor int, buf []byte) (int, error) {
+	var ptr uintptr
+	if len(buf) > 0 {
+		ptr = uintptr(unsafe.Pointer(&buf[0]))
+	}
+	r1, _, errno := syscall.Syscall6(syscall.SYS_PROC_INFO, procInfoCallPid, uintptr(pid), uintptr(flavor), 0, ptr,
+		uintptr(len(buf)))
+	if errno != 0 {
+		return 0, fmt.Errorf("Unable to read information of process %d: %s", pid, errno)
+	}
+	return int(r1), nil
+}
+
+// procTaskInfo is the struct proc_taskinfo of a process.
+type procTaskInfo struct {
+	residentSize uint64
+	cpuTime      time.Duration
+	threads      int
+}
+
+// processTaskInfo returns the task information of the process with the given pid. Reading the task information
+// of a process owned by another user requires privileges.
+func processTaskInfo(pid int) (procTaskInfo, error) {
+	buf := make([]byte, procTaskInfoSize)
+	n, err := procPidInfo(pid, procPidTaskInfo, buf)
+	if err != nil {
+		return procTaskInfo{}, err
+	}
+	if n < procTaskInfoSize {
+		return procTaskInfo{}, fmt.Errorf("Unable to read task information of process %d", pid)
+	}
+	// CPU times are in Mach absolute time units, which are nanoseconds on Intel, and 125/3 nanoseconds on Apple
+	// silicon
+	ticks := binary.LittleEndian.Uint64(buf[16:]) + binary.LittleEndian.Uint64(buf[24:])
+	if runtime.GOARCH == "arm64" {
+		ticks = ticks * 125 / 3
+	}
+	return procTaskInfo{
+		residentSize: binary.LittleEndian.Uint64(buf[8:]),
+		cpuTime:      time.Duration(ticks),
+		threads:      int(int32(binary.LittleEndian.Uint32(buf[84:]))),
+	}, nil
+}
+
+// readProcfsFile returns the contents of <pid>/<name> in the procfs. Not supported on this platform.
+func (fs procfs) readProcfsFile(pid int, name string) ([]byte, error) {
+	return nil, fmt.Errorf("procfs is not supported on this platform")
+}
+
+// isZombie returns true if the process with the given pid has terminated but has not yet been reaped.
+func (fs procfs) isZombie(pid int) bool {
+	k, err := processKinfo(pid)
+	return err == nil && k.isZombie()
+}
+
+// processStartTime returns the time at which the process with the given pid started, in microseconds since the
+// epoch. Together with the pid, it uniquely identifies a process.
+func (fs procfs) processStartTime(pid int) (uint64, error) {
+	k, err := processKinfo(pid)
+	if err != nil {
+		return 0, err
+	}
+	return k.startTime(), nil
+}
+
+// processStartWallTime returns the time at which the process with the given pid started.
+func (fs procfs) processStartWallTime(pid int) (time.Time, error) {
+	startTime, err := fs.processStartTime(pid)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, int64(startTime)*int64(time.Microsecond)), nil
+}
+
+// processUID returns the effective user id of the process with the given pid.
+func (fs procfs) processUID(pid int) (int, error) {
+	k, err := processKinfo(pid)
+	if err != nil {
+		return -1, err
+	}
+	return k.uid(), nil
+}
+
+// processNamespacePids returns the pids of the process with the given pid in each of its nested PID namespaces.
+// Not supported on this platform.
+func (fs procfs) processNamespacePids(pid int) ([]int, error) {
+	return nil, fmt.Errorf("PID namespaces are only supported on Linux")
+}
+
+// namespaceInitPid returns the pid of the init process of the PID namespace of the process with the given pid.
+// Not supported on this platform.
+func (fs procfs) namespaceInitPid(pid int) (int, error) {
+	return -1, fmt.Errorf("PID namespaces are only supported on Linux")
+}
+
+// processSID returns the security identifier of the user of the process with the given pid. Not supported on
+// this platform; see processUID.
+func (fs procfs) processSID(pid int) (string, error) {
+	return "", fmt.Errorf("Process security identifiers are only supported on Windows")
+}
+
+// processSessionID returns the session id of the process with the given pid, which is the pid of the session
+// leader.
+func (fs procfs) processSessionID(pid int) (int, error) {
+	r1, _, errno := syscall.RawSyscall(syscall.SYS_GETSID, uintptr(pid), 0, 0)
+	if errno != 0 {
+		return -1, fmt.Errorf("Unable to read session of process %d: %s", pid, errno)
+	}
+	return int(r1), nil
+}
+
+// processGroupID returns the process group id of the process with the given pid, which is the pid of the
+// process group leader.
+func (fs procfs) processGroupID(pid int) (int, error) {
+	pgid, err := syscall.Getpgid(pid)
+	if err != nil {
+		return -1, fmt.Errorf("Unable to read process group of process %d: %s", pid, err)
+	}
+	return pgid, nil
+}
+
+// processArgs returns the command line and environment of the process with the given pid. Reading the
+// arguments of a process owned by another user requires privileges.
+func processArgs(pid int) ([]string, []string, error) {
+	buf, err := sysctl([]int32{ctlKern, kernProcargs2, int32(pid)})
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to read arguments of process %d: %s", pid, err)
+	}
+	args, environ, err := parseProcargs2(buf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s of pid %d", err, pid)
+	}
+	return args, environ, nil
+}
+
+// processCmdline returns the command line of the process with the given pid.
+func (fs procfs) processCmdline(pid int) ([]string, error) {
+	args, _, err := processArgs(pid)
+	return args, err
+}
+
+// processEnviron returns the environment of the process with the given pid, as it was when the process
+// started.
+func (fs procfs) processEnviron(pid int) ([]string, error) {
+	_, environ, err := processArgs(pid)
+	return environ, err
+}
+
+// processMemory returns the memory statistics of the process with the given pid. Only RSS is reported.
+func (fs procfs) processMemory(pid int) (MemoryStats, error) {
+	ti, err := processTaskInfo(pid)
+	if err != nil {
+		return MemoryStats{}, err
+	}
+	return MemoryStats{RSS: ti.residentSize}, nil
+}
+
+// processCgroup returns the cgroup path of the process with the given pid. Not supported on this platform.
+func (fs procfs) processCgroup(pid int) (string, error) {
+	return "", fmt.Errorf("Cgroups are not supported on this platform")
+}
+
+// processUsage returns the total user and system CPU time consumed by the process with the given pid, its
+// resident set size in bytes, and its number of threads, as a Usage of one process. FDs is not set; see
+// processFDCount.
+func (fs procfs) processUsage(pid int) (Usage, error) {
+	ti, err := processTaskInfo(pid)
+	if err != nil {
+		return Usage{}, err
+	}
+	return Usage{Processes: 1, CPUTime: ti.cpuTime, RSS: ti.residentSize, Threads: ti.threads}, nil
+}
+
+// processFDCount returns the number of open file descriptors of the process with the given pid.
+func (fs procfs) processFDCount(pid int) (int, error) {
+	// With no buffer, proc_info returns an upper bound of the size of the list
+	n, err := procPidInfo(pid, procPidListFDs, nil)
+	if err != nil {
+		return 0, err
+	}
+	buf := make([]byte, n+procFDInfoSize)
+	n, err = procPidInfo(pid, procPidListFDs, buf)
+	if err != nil {
+		return 0, err
+	}
+	return n / procFDInfoSize, nil
+}
@@ -0,0 +1,259 @@
+package proctree
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// readProcfsFile returns the contents of <pid>/<name> in the procfs.
+func (fs procfs) readProcfsFile(pid int, name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(fs), strconv.Itoa(pid), name))
+}
+
+// readStatFields returns the fields of /proc/<pid>/stat that follow the parenthesized executable name, which
+// may itself contain spaces and parentheses. The first returned field is the process state (field 3).
+func (fs procfs) readStatFields(pid int) ([]string, error) {
+	data, err := fs.readProcfsFile(pid, "stat")
+	if err != nil {
+		return nil, err
+	}
+	_, fields, err := parseStat(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s for pid %d", err, pid)
+	}
+	return fields, nil
+}
+
+// isZombie returns true if the process with the given pid has terminated but has not yet been reaped.
+func (fs procfs) isZombie(pid int) bool {
+	fields, err := fs.readStatFields(pid)
+	if err != nil || len(fields) < 1 {
+		return false
+	}
+	return fields[0] == "Z"
+}
+
+// processStartTime returns the time at which the process with the given pid started, in clock ticks since
+// boot. Together with the pid, it uniquely identifies a process.
+func (fs procfs) processStartTime(pid int) (uint64, error) {
+	fields, err := fs.readStatFields(pid)
+	if err != nil {
+		return 0, err
+	}
+	// starttime is field 22; fields begins at field 3
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("Start time not found in stat of pid %d", pid)
+	}
+	return strconv.ParseUint(fields[19], 10, 64)
+}
+
+// processStartWallTime returns the time at which the process with the given pid started, from its start time
+// in clock ticks since boot and the boot time in the procfs's stat file.
+func (fs procfs) processStartWallTime(pid int) (time.Time, error) {
+	startTime, err := fs.processStartTime(pid)
+	if err != nil {
+		return time.Time{}, err
+	}
+	data, err := os.ReadFile(filepath.Join(string(fs), "stat"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	bootTime, err := parseBootTime(string(data))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return bootTime.Add(time.Duration(startTime) * time.Second / userHZ), nil
+}
+
+// processUID returns the effective user id of the process with the given pid.
+func (fs procfs) processUID(pid int) (int, error) {
+	data, err := fs.readProcfsFile(pid, "status")
+	if err != nil {
+		return -1, err
+	}
+	uid, err := parseStatusUID(string(data))
+	if err != nil {
+		return -1, fmt.Errorf("%s of pid %d", err, pid)
+	}
+	return uid, nil
+}
+
+// processNamespacePids returns the pids of the process with the given pid in each of its nested PID namespaces,
+// from the outermost namespace, which is that of the procfs, to the innermost. Requires Linux 4.1 or later.
+func (fs procfs) processNamespacePids(pid int) ([]int, error) {
+	data, err := fs.readProcfsFile(pid, "status")
+	if err != nil {
+		return nil, err
+	}
+	pids, err := parseStatusNSpid(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s of pid %d", err, pid)
+	}
+	return pids, nil
+}
+
+// processPidNamespace returns the PID namespace of the process with the given pid, e.g., "pid:[4026531836]".
+// Processes are in the same namespace if and only if their namespaces are equal.
+func (fs procfs) processPidNamespace(pid int) (string, error) {
+	return os.Readlink(filepath.Join(string(fs), strconv.Itoa(pid), "ns", "pid"))
+}
+
+// namespaceInitPid returns the pid of the init process (the process with pid 1 in the namespace) of the PID
+// namespace of the process with the given pid.
+func (fs procfs) namespaceInitPid(pid int) (int, error) {
+	ns, err := fs.processPidNamespace(pid)
+	if err != nil {
+		return -1, fmt.Errorf("Unable to read PID namespace of pid %d: %s", pid, err)
+	}
+	infos, err := systemProcesses(context.Background(), fs, nil)
+	if err != nil {
+		return -1, err
+	}
+	for _, info := range infos {
+		pids, err := fs.processNamespacePids(info.Pid)
+		if err != nil || pids[len(pids)-1] != 1 {
+			continue
+		}
+		initNs, err := fs.processPidNamespace(info.Pid)
+		if err == nil && initNs == ns {
+			return info.Pid, nil
+		}
+	}
+	return -1, fmt.Errorf("Init process not found in PID namespace of pid %d", pid)
+}
+
+// processSID returns the security identifier of the user of the process with the given pid. Not supported on
+// this platform; see processUID.
+func (fs procfs) processSID(pid int) (string, error) {
+	return "", fmt.Errorf("Process security identifiers are only supported on Windows")
+}
+
+// processSessionID returns the session id of the process with the given pid, which is the pid of the session
+// leader.
+func (fs procfs) processSessionID(pid int) (int, error) {
+	fields, err := fs.readStatFields(pid)
+	if err != nil {
+		return -1, err
+	}
+	// session is field 6; fields begins at field 3
+	if len(fields) < 4 {
+		return -1, fmt.Errorf("Session not found in stat of pid %d", pid)
+	}
+	return strconv.Atoi(fields[3])
+}
+
+// processGroupID returns the process group id of the process with the given pid, which is the pid of the
+// process group leader.
+func (fs procfs) processGroupID(pid int) (int, error) {
+	fields, err := fs.readStatFields(pid)
+	if err != nil {
+		return -1, err
+	}
+	// pgrp is field 5; fields begins at field 3
+	if len(fields) < 3 {
+		return -1, fmt.Errorf("Process group not found in stat of pid %d", pid)
+	}
+	return strconv.Atoi(fields[2])
+}
+
+// processCmdline returns the command line of the process with the given pid.
+func (fs procfs) processCmdline(pid int) ([]string, error) {
+	data, err := fs.readProcfsFile(pid, "cmdline")
+	if err != nil {
+		return nil, err
+	}
+	return parseCmdline(string(data)), nil
+}
+
+// processEnviron returns the environment of the process with the given pid, as it was when the process
+// started. Reading the environment of a process owned by another user requires privileges.
+func (fs procfs) processEnviron(pid int) ([]string, error) {
+	data, err := fs.readProcfsFile(pid, "environ")
+	if err != nil {
+		return nil, err
+	}
+	return parseCmdline(string(data)), nil
+}
+
+// processMemory returns the memory statistics of the process with the given pid.
+func (fs procfs) processMemory(pid int) (MemoryStats, error) {
+	data, err := fs.readProcfsFile(pid, "smaps_rollup")
+	if err != nil {
+		return MemoryStats{}, err
+	}
+	stats, err := parseSmapsRollup(string(data))
+	if err != nil {
+		return MemoryStats{}, fmt.Errorf("%s for pid %d", err, pid)
+	}
+	return stats, nil
+}
+
+// processCgroup returns the cgroup path of the process with the given pid (see parseCgroup).
+func (fs procfs) processCgroup(pid int) (string, error) {
+	data, err := fs.readProcfsFile(pid, "cgroup")
+	if err != nil {
+		return "", err
+	}
+	cgroup, err := parseCgroup(string(data))
+	if err != nil {
+		return "", fmt.Errorf("%s for pid %d", err, pid)
+	}
+	return cgroup, nil
+}
+
+// userHZ is the unit of the time fields in /proc/<pid>/stat, which is fixed at 100 per second by the kernel ABI.
+const userHZ = 100
+
+// processUsage returns the total user and system CPU time consumed by the process with the given pid, its
+// resident set size in bytes, and its number of threads, as a Usage of one process. FDs is not set; see
+// processFDCount.
+func (fs procfs) processUsage(pid int) (Usage, error) {
+	fields, err := fs.readStatFields(pid)
+	if err != nil {
+		return Usage{}, err
+	}
+	// utime and stime are fields 14 and 15, num_threads is field 20, and rss (in pages) is field 24; fields
+	// begins at field 3
+	if len(fields) < 22 {
+		return Usage{}, fmt.Errorf("Usage not found in stat of pid %d", pid)
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return Usage{}, err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return Usage{}, err
+	}
+	threads, err := strconv.Atoi(fields[17])
+	if err != nil {
+		return Usage{}, err
+	}
+	rss, err := strconv.ParseInt(fields[21], 10, 64)
+	if err != nil {
+		return Usage{}, err
+	}
+	if rss < 0 {
+		rss = 0
+	}
+	return Usage{
+		Processes: 1,
+		CPUTime:   time.Duration(utime+stime) * time.Second / userHZ,
+		RSS:       uint64(rss) * uint64(os.Getpagesize()),
+		Threads:   threads,
+	}, nil
+}
+
+// processFDCount returns the number of open file descriptors of the process with the given pid. Reading the
+// file descriptors of a process owned by another user normally requires privileges.
+func (fs procfs) processFDCount(pid int) (int, error) {
+	entries, err := os.ReadDir(filepath.Join(string(fs), strconv.Itoa(pid), "fd"))
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
@@ -0,0 +1,184 @@
+package proctree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// writeFakeProcess creates the stat and cmdline entries of a process in a fake procfs.
+func writeFakeProcess(t *testing.T, dir string, pid int, ppid int, executable string, startTime uint64) {
+	pidDir := filepath.Join(dir, strconv.Itoa(pid))
+	err := os.Mkdir(pidDir, 0755)
+	if err != nil {
+		t.Fatalf("os.Mkdir() returned error: %s", err)
+	}
+	stat := fmt.Sprintf("%d (%s) S %d 0 0 0 -1 0 0 0 0 0 0 0 0 0 20 0 1 0 %d 0 0\n", pid, executable, ppid, startTime)
+	err = os.WriteFile(filepath.Join(pidDir, "stat"), []byte(stat), 0644)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(pidDir, "cmdline"), []byte(executable+"\x00--fake\x00"), 0644)
+	}
+	if err != nil {
+		t.Fatalf("os.WriteFile() returned error: %s", err)
+	}
+}
+
+func TestProcfsPath(t *testing.T) {
+	dir := t.TempDir()
+	writeFakeProcess(t, dir, 1, 0, "init", 1)
+	writeFakeProcess(t, dir, 10, 1, "my shell", 100)
+	writeFakeProcess(t, dir, 11, 10, "make", 200)
+	writeFakeProcess(t, dir, 12, 10, "less", 300)
+	// Entries that are not pids are ignored
+	err := os.Mkdir(filepath.Join(dir, "self"), 0755)
+	if err != nil {
+		t.Fatalf("os.Mkdir() returned error: %s", err)
+	}
+
+	_, err = New(WithProcfsPath(dir), WithRootPid(13))
+	if err == nil {
+		t.Errorf("proctree.New() succeeded with a root pid that is not in the procfs")
+	}
+
+	pt, err := New(WithProcfsPath(dir), WithRootPid(10))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	pids := []int{}
+	for _, proc := range pt.Processes() {
+		pids = append(pids, proc.Pid())
+	}
+	if fmt.Sprint(pids) != "[10 11 12]" {
+		t.Errorf("Included pids are %v, expected [10 11 12]", pids)
+	}
+	proc := pt.PidProcess(10)
+	if proc == nil || proc.Executable() != "my shell" || len(proc.Children()) != 2 {
+		t.Fatalf("Process 10 was not read from the procfs")
+	}
+	cmdline, err := proc.SystemCmdline()
+	if err != nil {
+		t.Fatalf("proc.SystemCmdline() returned error: %s", err)
+	}
+	if fmt.Sprint(cmdline) != "[my shell --fake]" {
+		t.Errorf("proc.SystemCmdline() returned %q", cmdline)
+	}
+
+	err = os.RemoveAll(filepath.Join(dir, "12"))
+	if err != nil {
+		t.Fatalf("os.RemoveAll() returned error: %s", err)
+	}
+	err = pt.Update(true)
+	if err != nil {
+		t.Fatalf("pt.Update() returned error: %s", err)
+	}
+	if pt.PidProcess(12) != nil {
+		t.Errorf("Process 12 was not pruned after it was removed from the procfs")
+	}
+
+	err = pt.Reconfigure(WithProcfsPath("/proc"))
+	if err == nil {
+		t.Errorf("pt.Reconfigure() succeeded with a different procfs path")
+	}
+	_, err = New(WithProcfsPath(""))
+	if err == nil {
+		t.Errorf("proctree.New() succeeded with an empty procfs path")
+	}
+}
+
+func TestChildSortByUsage(t *testing.T) {
+	dir := t.TempDir()
+	// writeStat writes the stat entry of a child of process 10 with the given CPU time in ticks and RSS in pages
+	writeStat := func(pid int, executable string, ticks int, pages int) {
+		stat := fmt.Sprintf("%d (%s) S 10 0 0 0 -1 0 0 0 0 0 %d 0 0 0 20 0 1 0 %d 0 %d\n", pid, executable, ticks,
+			pid, pages)
+		err := os.WriteFile(filepath.Join(dir, strconv.Itoa(pid), "stat"), []byte(stat), 0644)
+		if err != nil {
+			t.Fatalf("os.WriteFile() returned error: %s", err)
+		}
+	}
+	writeFakeProcess(t, dir, 10, 1, "make", 10)
+	for _, pid := range []int{11, 12, 13} {
+		writeFakeProcess(t, dir, pid, 10, "cc", uint64(pid))
+	}
+	writeStat(11, "cc", 100, 30)
+	writeStat(12, "cc", 300, 10)
+	writeStat(13, "cc", 200, 20)
+
+	pt, err := New(WithProcfsPath(dir), WithRootPid(10), WithChildSort(ByCPUTime))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+	children := func() string {
+		return pidList(pt.PidProcess(10).Children())
+	}
+	if children() != "[12 13 11]" {
+		t.Errorf("Children sorted by CPU time are %s", children())
+	}
+
+	writeStat(11, "cc", 400, 30)
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("pt.Update() returned error: %s", err)
+	}
+	if children() != "[11 12 13]" {
+		t.Errorf("Children sorted by CPU time are %s after an update", children())
+	}
+
+	err = pt.Reconfigure(WithChildSort(ByMemory))
+	if err != nil {
+		t.Fatalf("pt.Reconfigure() returned error: %s", err)
+	}
+	if children() != "[11 13 12]" {
+		t.Errorf("Children sorted by memory are %s", children())
+	}
+}
+
+func TestUsageSampler(t *testing.T) {
+	dir := t.TempDir()
+	// writeStat writes the stat entry of a child of process 10 with the given CPU time in ticks
+	writeStat := func(pid int, ticks int) {
+		stat := fmt.Sprintf("%d (worker) S 10 0 0 0 -1 0 0 0 0 0 %d 0 0 0 20 0 1 0 %d 0 0\n", pid, ticks, pid)
+		err := os.WriteFile(filepath.Join(dir, strconv.Itoa(pid), "stat"), []byte(stat), 0644)
+		if err != nil {
+			t.Fatalf("os.WriteFile() returned error: %s", err)
+		}
+	}
+	writeFakeProcess(t, dir, 10, 1, "server", 10)
+	writeFakeProcess(t, dir, 11, 10, "worker", 11)
+	writeFakeProcess(t, dir, 12, 10, "worker", 12)
+	writeStat(11, 100)
+	writeStat(12, 200)
+
+	pt, err := New(WithProcfsPath(dir), WithRootPid(10))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+	sampler := pt.NewUsageSampler()
+	samples, err := sampler.Sample()
+	if err != nil {
+		t.Fatalf("sampler.Sample() returned error: %s", err)
+	}
+	if len(samples) != 3 || samples[0].Process.Pid() != 12 || samples[0].CPURate != 0 {
+		t.Errorf("The first sample returned %+v", samples)
+	}
+
+	// Process 11 consumes one second of CPU time in less than a second, and process 12 is idle
+	writeStat(11, 200)
+	samples, err = sampler.Sample()
+	if err != nil {
+		t.Fatalf("sampler.Sample() returned error: %s", err)
+	}
+	rates := make(map[int]float64)
+	for _, sample := range samples {
+		rates[sample.Process.Pid()] = sample.CPURate
+	}
+	if rates[11] <= 1 || rates[12] != 0 {
+		t.Errorf("The second sample returned CPU rates %v", rates)
+	}
+}
@@ -0,0 +1,97 @@
+//go:build !linux && !windows && !darwin
+// +build !linux,!windows,!darwin
+
+package proctree
+
+import (
+	"fmt"
+	"time"
+)
+
+// readProcfsFile returns the contents of <pid>/<name> in the procfs. Not supported on this platform.
+func (fs procfs) readProcfsFile(pid int, name string) ([]byte, error) {
+	return nil, fmt.Errorf("procfs is not supported on this platform")
+}
+
+// isZombie returns true if the process with the given pid has terminated but has not yet been reaped. Zombie
+// detection is not supported on this platform.
+func (fs procfs) isZombie(pid int) bool {
+	return false
+}
+
+// processUID returns the effective user id of the process with the given pid. Not supported on this platform.
+func (fs procfs) processUID(pid int) (int, error) {
+	return -1, fmt.Errorf("Process user ids are not supported on this platform")
+}
+
+// processNamespacePids returns the pids of the process with the given pid in each of its nested PID namespaces.
+// Not supported on this platform.
+func (fs procfs) processNamespacePids(pid int) ([]int, error) {
+	return nil, fmt.Errorf("PID namespaces are only supported on Linux")
+}
+
+// namespaceInitPid returns the pid of the init process of the PID namespace of the process with the given pid.
+// Not supported on this platform.
+func (fs procfs) namespaceInitPid(pid int) (int, error) {
+	return -1, fmt.Errorf("PID namespaces are only supported on Linux")
+}
+
+// processSID returns the security identifier of the user of the process with the given pid. Not supported on
+// this platform.
+func (fs procfs) processSID(pid int) (string, error) {
+	return "", fmt.Errorf("Process security identifiers are only supported on Windows")
+}
+
+// processSessionID returns the session of the process with the given pid. Not supported on this platform.
+func (fs procfs) processSessionID(pid int) (int, error) {
+	return -1, fmt.Errorf("Process sessions are not supported on this platform")
+}
+
+// processGroupID returns the process group of the process with the given pid. Not supported on this platform.
+func (fs procfs) processGroupID(pid int) (int, error) {
+	return -1, fmt.Errorf("Process groups are not supported on this platform")
+}
+
+// processCmdline returns the command line of the process with the given pid. Not supported on this platform.
+func (fs procfs) processCmdline(pid int) ([]string, error) {
+	return nil, fmt.Errorf("Process command lines are not supported on this platform")
+}
+
+// processStartTime returns the time at which the process with the given pid started. Not supported on this
+// platform.
+func (fs procfs) processStartTime(pid int) (uint64, error) {
+	return 0, fmt.Errorf("Process start times are not supported on this platform")
+}
+
+// processStartWallTime returns the time at which the process with the given pid started. Not supported on this
+// platform.
+func (fs procfs) processStartWallTime(pid int) (time.Time, error) {
+	return time.Time{}, fmt.Errorf("Process start times are not supported on this platform")
+}
+
+// processEnviron returns the environment of the process with the given pid. Not supported on this platform.
+func (fs procfs) processEnviron(pid int) ([]string, error) {
+	return nil, fmt.Errorf("Process environments are not supported on this platform")
+}
+
+// processMemory returns the memory statistics of the process with the given pid. Not supported on this
+// platform.
+func (fs procfs) processMemory(pid int) (MemoryStats, error) {
+	return MemoryStats{}, fmt.Errorf("Process memory statistics are not supported on this platform")
+}
+
+// processCgroup returns the cgroup path of the process with the given pid. Not supported on this platform.
+func (fs procfs) processCgroup(pid int) (string, error) {
+	return "", fmt.Errorf("Cgroups are not supported on this platform")
+}
+
+// processUsage returns the resource usage of the process with the given pid. Not supported on this platform.
+func (fs procfs) processUsage(pid int) (Usage, error) {
+	return Usage{}, fmt.Errorf("Process resource usage is not supported on this platform")
+}
+
+// processFDCount returns the number of open file descriptors of the process with the given pid. Not supported
+// on this platform.
+func (fs procfs) processFDCount(pid int) (int, error) {
+	return 0, fmt.Errorf("Process resource usage is not supported on this platform")
+}
@@ -0,0 +1,289 @@
+package proctree
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	// processCommandLineInformation is the PROCESSINFOCLASS that returns the command line of a process as a
+	// UNICODE_STRING. It requires Windows 8.1 or later.
+	processCommandLineInformation = 60
+
+	statusInfoLengthMismatch = 0xC0000004
+	statusBufferTooSmall     = 0xC0000023
+)
+
+var (
+	modntdll                      = syscall.NewLazyDLL("ntdll.dll")
+	procNtQueryInformationProcess = modntdll.NewProc("NtQueryInformationProcess")
+	procGetProcessMemoryInfo      = modkernel32.NewProc("K32GetProcessMemoryInfo")
+	procGetProcessHandleCount     = modkernel32.NewProc("GetProcessHandleCount")
+	procProcessIdToSessionId      = modkernel32.NewProc("ProcessIdToSessionId")
+)
+
+// unicodeString is the layout of the UNICODE_STRING structure.
+type unicodeString struct {
+	Length        uint16
+	MaximumLength uint16
+	Buffer        *uint16
+}
+
+// processMemoryCountersEx is the layout of the PROCESS_MEMORY_COUNTERS_EX structure.
+type processMemoryCountersEx struct {
+	CB                         uint32
+	PageFaultCount             uint32
+	PeakWorkingSetSize         uintptr
+	WorkingSetSize             uintptr
+	QuotaPeakPagedPoolUsage    uintptr
+	QuotaPagedPoolUsage        uintptr
+	QuotaPeakNonPagedPoolUsage uintptr
+	QuotaNonPagedPoolUsage     uintptr
+	PagefileUsage              uintptr
+	PeakPagefileUsage          uintptr
+	PrivateUsage               uintptr
+}
+
+// readProcfsFile returns the contents of <pid>/<name> in the procfs. Not supported on this platform.
+func (fs procfs) readProcfsFile(pid int, name string) ([]byte, error) {
+	return nil, fmt.Errorf("procfs is not supported on this platform")
+}
+
+// isZombie returns true if the process with the given pid has terminated but has not yet been reaped. Zombie
+// detection is not supported on this platform.
+func (fs procfs) isZombie(pid int) bool {
+	return false
+}
+
+// openProcess opens a handle to the process with the given pid with limited query access, which is granted for
+// most processes of other users, but not for protected processes.
+func openProcess(pid int) (syscall.Handle, error) {
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return 0, fmt.Errorf("Unable to open process %d: %s", pid, err)
+	}
+	return h, nil
+}
+
+// processTimes returns the creation time, and the total kernel and user CPU time, of the process with the
+// given pid.
+func processTimes(pid int) (syscall.Filetime, time.Duration, error) {
+	var creation, exit, kernel, user syscall.Filetime
+	h, err := openProcess(pid)
+	if err != nil {
+		return creation, 0, err
+	}
+	defer syscall.CloseHandle(h)
+	err = syscall.GetProcessTimes(h, &creation, &exit, &kernel, &user)
+	if err != nil {
+		return creation, 0, fmt.Errorf("Unable to read times of process %d: %s", pid, err)
+	}
+	// Kernel and user times are in units of 100ns
+	cpu := time.Duration(filetimeTicks(kernel)+filetimeTicks(user)) * 100
+	return creation, cpu, nil
+}
+
+// filetimeTicks returns the value of a FILETIME, in units of 100ns.
+func filetimeTicks(ft syscall.Filetime) uint64 {
+	return uint64(ft.HighDateTime)<<32 | uint64(ft.LowDateTime)
+}
+
+// processStartTime returns the time at which the process with the given pid was created, in units of 100ns
+// since January 1, 1601 (UTC). Together with the pid, it uniquely identifies a process.
+func (fs procfs) processStartTime(pid int) (uint64, error) {
+	creation, _, err := processTimes(pid)
+	if err != nil {
+		return 0, err
+	}
+	return filetimeTicks(creation), nil
+}
+
+// filetimeEpochDelta is the number of 100ns units between January 1, 1601 and January 1, 1970.
+const filetimeEpochDelta = 116444736000000000
+
+// processStartWallTime returns the time at which the process with the given pid was created.
+func (fs procfs) processStartWallTime(pid int) (time.Time, error) {
+	startTime, err := fs.processStartTime(pid)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, (int64(startTime)-filetimeEpochDelta)*100), nil
+}
+
+// processUID returns the effective user id of the process with the given pid. Not supported on this platform;
+// see processSID.
+func (fs procfs) processUID(pid int) (int, error) {
+	return -1, fmt.Errorf("Process user ids are not supported on this platform")
+}
+
+// processNamespacePids returns the pids of the process with the given pid in each of its nested PID namespaces.
+// Not supported on this platform.
+func (fs procfs) processNamespacePids(pid int) ([]int, error) {
+	return nil, fmt.Errorf("PID namespaces are only supported on Linux")
+}
+
+// namespaceInitPid returns the pid of the init process of the PID namespace of the process with the given pid.
+// Not supported on this platform.
+func (fs procfs) namespaceInitPid(pid int) (int, error) {
+	return -1, fmt.Errorf("PID namespaces are only supported on Linux")
+}
+
+// processSID returns the security identifier of the user of the process with the given pid, e.g.,
+// "S-1-5-18".
+func (fs procfs) processSID(pid int) (string, error) {
+	h, err := openProcess(pid)
+	if err != nil {
+		return "", err
+	}
+	defer syscall.CloseHandle(h)
+	var token syscall.Token
+	err = syscall.OpenProcessToken(h, syscall.TOKEN_QUERY, &token)
+	if err != nil {
+		return "", fmt.Errorf("Unable to open token of process %d: %s", pid, err)
+	}
+	defer token.Close()
+	tu, err := token.GetTokenUser()
+	if err != nil {
+		return "", fmt.Errorf("Unable to read user of process %d: %s", pid, err)
+	}
+	return tu.User.Sid.String()
+}
+
+// processSessionID returns the Remote Desktop Services session of the process with the given pid.
+func (fs procfs) processSessionID(pid int) (int, error) {
+	var session uint32
+	r1, _, err := procProcessIdToSessionId.Call(uintptr(pid), uintptr(unsafe.Pointer(&session)))
+	if r1 == 0 {
+		return -1, fmt.Errorf("Unable to read session of process %d: %s", pid, err)
+	}
+	return int(session), nil
+}
+
+// processCmdline returns the command line of the process with the given pid, split into arguments with the
+// rules of CommandLineToArgvW.
+func (fs procfs) processCmdline(pid int) ([]string, error) {
+	err := procNtQueryInformationProcess.Find()
+	if err != nil {
+		return nil, fmt.Errorf("Process command lines are not supported on this platform: %s", err)
+	}
+	h, err := openProcess(pid)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.CloseHandle(h)
+
+	// The buffer holds a UNICODE_STRING followed by the command line that it refers to
+	buf := make([]byte, 1024)
+	for {
+		var length uint32
+		status, _, _ := procNtQueryInformationProcess.Call(uintptr(h), processCommandLineInformation,
+			uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)), uintptr(unsafe.Pointer(&length)))
+		if (status == statusInfoLengthMismatch || status == statusBufferTooSmall) && int(length) > len(buf) {
+			buf = make([]byte, length)
+			continue
+		}
+		if status != 0 {
+			return nil, fmt.Errorf("Unable to read command line of process %d: NTSTATUS 0x%08X", pid, status)
+		}
+		break
+	}
+	us := (*unicodeString)(unsafe.Pointer(&buf[0]))
+	if us.Length == 0 || us.Buffer == nil {
+		return []string{}, nil
+	}
+	n := int(us.Length / 2)
+	chars := (*[1 << 29]uint16)(unsafe.Pointer(us.Buffer))[:n:n]
+	cmdline := append(make([]uint16, 0, len(chars)+1), chars...)
+	cmdline = append(cmdline, 0)
+
+	var argc int32
+	argv, err := syscall.CommandLineToArgv(&cmdline[0], &argc)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse command line of process %d: %s", pid, err)
+	}
+	defer syscall.LocalFree(syscall.Handle(uintptr(unsafe.Pointer(argv))))
+	args := make([]string, argc)
+	for i := range args {
+		args[i] = syscall.UTF16ToString(argv[i][:])
+	}
+	return args, nil
+}
+
+// processEnviron returns the environment of the process with the given pid. Not supported on this platform.
+func (fs procfs) processEnviron(pid int) ([]string, error) {
+	return nil, fmt.Errorf("Process environments are not supported on this platform")
+}
+
+// processMemoryCounters returns the memory counters of the process with the given pid.
+func processMemoryCounters(pid int) (*processMemoryCountersEx, error) {
+	err := procGetProcessMemoryInfo.Find()
+	if err != nil {
+		return nil, fmt.Errorf("Process memory statistics are not supported on this platform: %s", err)
+	}
+	h, err := openProcess(pid)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.CloseHandle(h)
+	pmc := &processMemoryCountersEx{}
+	pmc.CB = uint32(unsafe.Sizeof(*pmc))
+	r1, _, err := procGetProcessMemoryInfo.Call(uintptr(h), uintptr(unsafe.Pointer(pmc)), uintptr(pmc.CB))
+	if r1 == 0 {
+		return nil, fmt.Errorf("Unable to read memory statistics of process %d: %s", pid, err)
+	}
+	return pmc, nil
+}
+
+// processMemory returns the memory statistics of the process with the given pid. RSS is the working set, and
+// Private is the commit charge of the process; proportional, shared and swapped memory are not reported.
+func (fs procfs) processMemory(pid int) (MemoryStats, error) {
+	pmc, err := processMemoryCounters(pid)
+	if err != nil {
+		return MemoryStats{}, err
+	}
+	return MemoryStats{RSS: uint64(pmc.WorkingSetSize), Private: uint64(pmc.PrivateUsage)}, nil
+}
+
+// processGroupID returns the process group of the process with the given pid. Not supported on this platform.
+func (fs procfs) processGroupID(pid int) (int, error) {
+	return -1, fmt.Errorf("Process groups are not supported on this platform")
+}
+
+// processCgroup returns the cgroup path of the process with the given pid. Not supported on this platform.
+func (fs procfs) processCgroup(pid int) (string, error) {
+	return "", fmt.Errorf("Cgroups are not supported on this platform")
+}
+
+// processUsage returns the total kernel and user CPU time consumed by the process with the given pid, and its
+// working set size in bytes, as a Usage of one process. Threads are not reported, and FDs is not set; see
+// processFDCount.
+func (fs procfs) processUsage(pid int) (Usage, error) {
+	_, cpu, err := processTimes(pid)
+	if err != nil {
+		return Usage{}, err
+	}
+	usage := Usage{Processes: 1, CPUTime: cpu}
+	pmc, err := processMemoryCounters(pid)
+	if err == nil {
+		usage.RSS = uint64(pmc.WorkingSetSize)
+	}
+	return usage, nil
+}
+
+// processFDCount returns the number of open handles of the process with the given pid, which is the closest
+// equivalent of open file descriptors on this platform.
+func (fs procfs) processFDCount(pid int) (int, error) {
+	h, err := openProcess(pid)
+	if err != nil {
+		return 0, err
+	}
+	defer syscall.CloseHandle(h)
+	var count uint32
+	r1, _, err := procGetProcessHandleCount.Call(uintptr(h), uintptr(unsafe.Pointer(&count)))
+	if r1 == 0 {
+		return 0, fmt.Errorf("Unable to read handle count of process %d: %s", pid, err)
+	}
+	return int(count), nil
+}
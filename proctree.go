@@ -4,11 +4,14 @@ Package proctree provides tools for inspecting, monitoring, and manipulating the
 package proctree
 
 import (
+	"context"
 	"fmt"
+	"os"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
-
-	gops "github.com/mitchellh/go-ps"
+	"time"
 )
 
 const (
@@ -18,13 +21,30 @@ const (
 
 // ProcTree represents a session that inspects, monitors, and manipulates the system process tree
 type ProcTree struct {
-	// lock is a general-purpose mutex for the proctree, used for updating the tree.
-	lock sync.Mutex
+	// scanSeq is the sequence number of the most recently started scan of the system. It is accessed
+	// atomically, and is the first field so that it is 64-bit aligned on 32-bit platforms.
+	scanSeq uint64
+
+	// processSeq is the ID of the most recently created Process. It is accessed atomically, and follows scanSeq
+	// so that it is also 64-bit aligned.
+	processSeq uint64
+
+	// lock is a general-purpose reader/writer lock for the proctree. It is held exclusively while the tree is
+	// updated, and shared by methods that only read the tree.
+	lock sync.RWMutex
+
+	// appliedScanSeq is the sequence number of the scan most recently applied to the tree.
+	appliedScanSeq uint64
+
+	// generation is incremented by each update that changes the tree (see Generation).
+	generation uint64
 
 	// Config is the immutable configuration provided at New time.
 	cfg *Config
 
 	// pidMap is a map of all known pids an their associated processes. Includes Processes excluded by configuration and unpruned tombstones.
+	// A pid maps to the Process that most recently had it: when an update or notification finds that the pid was
+	// reused, the stale Process is removed before the new one is added, so a pid never resolves to it.
 	pidMap map[int]*Process
 
 	// absProcs is a slice of all Process objects, sorted by pid.  Includes Processes excluded by configuration and unpruned tombstones.
@@ -36,6 +56,10 @@ type ProcTree struct {
 	// cfgRootProcs is a slice of all Process objects that were explicitly configured roots, sorted by pid.  Includes unpruned tombstones.
 	cfgRootProcs []*Process
 
+	// ownedRootProcs is a slice of all Process objects that were configured as owned roots with WithOwnedRoot,
+	// in configured order. Their subtrees are terminated when the ProcTree is closed.
+	ownedRootProcs []*Process
+
 	// includedProcs is a slice of all Process objects that are roots or descendants of rootsof the process tree, sorted by pid.
 	// Includes unpruned tombstones. If roots were not provided and config time, this will be identical to procs.
 	includedProcs []*Process
@@ -44,27 +68,183 @@ type ProcTree struct {
 	// explicit roots were not configured, these will be the true roots of the absolute process tree. If explicitRoots were configured with includeAncestors,
 	// these will be the roots of the absolute process tree that are ancestors of at least one configured root.
 	includedRootProcs []*Process
+
+	// done is closed by Close to signal background goroutines to exit.
+	done chan struct{}
+
+	// ctx is cancelled by Close, to cancel scans of the system that are in flight. cancel cancels it.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// closeOnce ensures that Close only shuts down the session once.
+	closeOnce sync.Once
+
+	// wg tracks background goroutines, so Close can wait for them to exit.
+	wg sync.WaitGroup
+
+	// reapLock serializes reaping of terminated children in subreaper mode. It is also held while
+	// starting commands, so that a spawned child cannot be reaped before it is registered.
+	reapLock sync.Mutex
+
+	// subs is the set of active event subscriptions.
+	subs map[*Subscription]struct{}
+
+	// pendingEvents is a list of events generated by lockedUpdate that have not yet been dispatched to subscribers.
+	pendingEvents []Event
+
+	// eventSeq is the sequence number of the most recently generated event.
+	eventSeq uint64
+
+	// pendingSummaries is a list of summaries of updates that have not yet been passed to update hooks.
+	pendingSummaries []*UpdateSummary
+
+	// dispatchLock is held while a batch of events is delivered, so that closing a subscription can wait for an
+	// in-progress delivery to abandon it.
+	dispatchLock sync.Mutex
+
+	// dispatchQueueLock protects dispatchQueue and dispatching. It may be acquired with the tree lock held.
+	dispatchQueueLock sync.Mutex
+
+	// dispatchQueue is a list of batches of events and update summaries that are waiting to be dispatched, in the
+	// order in which they were generated.
+	dispatchQueue []func()
+
+	// dispatching is true while a goroutine is draining dispatchQueue.
+	dispatching bool
+
+	// rtBackend is the real-time monitor backend, if one is running.
+	rtBackend realtimeBackend
+
+	// pendingCmdlines is a map of pids to command lines reported by exec notifications, for processes that
+	// have not yet been discovered or refreshed by an update.
+	pendingCmdlines map[int][]string
+
+	// spawned is a map of pids of processes started with StartCommand to their bookkeeping records.
+	spawned map[int]*spawnedCmd
+
+	// monitored is true if a background goroutine is updating the ProcTree.
+	monitored bool
+
+	// pendingRootPids is a list of pids added with AddRoot or Reconfigure, or lenient roots that did not exist
+	// yet, that have not yet been resolved to Processes by an update.
+	pendingRootPids []int
+
+	// pidFileRoots is the state of each pid file configured with WithRootPidFile that has been read, by path.
+	pidFileRoots map[string]*pidFileRoot
+
+	// counts summarizes the size of the tree as of the most recent update.
+	counts Counts
+
+	// stats accumulates the summaries of all updates.
+	stats updateStats
+
+	// changes is working storage for updates, reused to reduce allocation.
+	changes map[*Process]eventMask
+
+	// childOrderProcs is a list of all Process objects in the order configured with WithChildSort, if
+	// childOrderValid is true, maintained incrementally by lockedUpdateIndexes. childOrderIndexed is the order
+	// of the list.
+	childOrderProcs   []*Process
+	childOrderValid   bool
+	childOrderIndexed ChildOrder
+
+	// addedProcs, spareProcs and childSpareProcs are working storage for lockedUpdateIndexes.
+	addedProcs      []*Process
+	spareProcs      []*Process
+	childSpareProcs []*Process
+
+	// containers caches the Containers returned by Process.Container, by id.
+	containers map[string]*Container
+
+	// pods caches the PodInfos returned by Process.PodInfo, by pod uid and container id.
+	pods map[string]*PodInfo
+
+	// source lists the processes in the tree. It is not changed after construction.
+	source ProcessSource
+
+	// clock is the source of the current time. It is not changed after construction.
+	clock Clock
+
+	// procfs is the procfs from which processes and their metadata are read on Linux. It is not changed after
+	// construction.
+	procfs procfs
+
+	// readOnly is true for a ProcTree that was loaded from a serialized tree, rather than from the system.
+	readOnly bool
 }
 
 // New creates a new process tree management object and populates it with an initial snapshot
 func New(opts ...ConfigOption) (*ProcTree, error) {
+	return NewWithContext(context.Background(), opts...)
+}
+
+// NewWithContext is like New, but the initial snapshot is cancelled, and NewWithContext returns the context's
+// error, if the context is done before it completes, e.g., because a deadline passed while listing the
+// processes of a slow ProcessSource. The context only bounds construction; to close the ProcTree when a context
+// is done, use WithCloseContext.
+func NewWithContext(ctx context.Context, opts ...ConfigOption) (*ProcTree, error) {
 	cfg := NewConfig(opts...)
+	err := cfg.validate()
+	if err != nil {
+		return nil, err
+	}
+	err = cfg.resolveNamespaceRoots()
+	if err != nil {
+		return nil, err
+	}
+	source := cfg.source
+	if source == nil {
+		source = systemSource{procfs: procfs(cfg.procfsPath)}
+	}
 
 	pt := &ProcTree{
 		cfg:               cfg,
+		source:            source,
+		clock:             cfg.Clock(),
+		procfs:            procfs(cfg.procfsPath),
 		pidMap:            make(map[int]*Process),
 		absProcs:          nil,
 		absRootProcs:      nil,
 		cfgRootProcs:      nil,
 		includedProcs:     nil,
 		includedRootProcs: nil,
+		done:              make(chan struct{}),
+		spawned:           make(map[int]*spawnedCmd),
+		subs:              make(map[*Subscription]struct{}),
+		pendingCmdlines:   make(map[int][]string),
+		pendingEvents:     nil,
+		pendingSummaries:  nil,
+	}
+	pt.ctx, pt.cancel = context.WithCancel(context.Background())
+
+	if cfg.closeCtx != nil {
+		pt.wg.Add(1)
+		go func() {
+			defer pt.wg.Done()
+			select {
+			case <-pt.done:
+			case <-cfg.closeCtx.Done():
+				pt.shutdown()
+			}
+		}()
+	}
+
+	if cfg.subreaper {
+		err := pt.startReaper()
+		if err != nil {
+			pt.Close()
+			return nil, err
+		}
 	}
 
-	err := pt.Update(false)
+	err = pt.UpdateContext(ctx, false)
 	if err != nil {
+		pt.Close()
 		return nil, err
 	}
 
+	pt.startMonitoring()
+
 	return pt, nil
 }
 
@@ -76,48 +256,202 @@ func (pt *ProcTree) punlock() {
 	pt.lock.Unlock()
 }
 
+// prlock takes the tree lock for reading. Methods that hold the lock for reading must not modify the tree,
+// including caches such as the user id of a Process.
+func (pt *ProcTree) prlock() {
+	pt.lock.RLock()
+}
+
+func (pt *ProcTree) prunlock() {
+	pt.lock.RUnlock()
+}
+
 func (pt *ProcTree) lockedSortProcessesByPid(procs []*Process) {
-	sort.Slice(procs, func(i, j int) bool { return procs[i].lockedPid() < procs[j].lockedPid() })
+	sort.Slice(procs, func(i, j int) bool { return lessByPid(procs[i], procs[j]) })
+}
+
+// lockedSortChildren sorts a child list in the order configured with WithChildSort. Ties are broken by pid.
+func (pt *ProcTree) lockedSortChildren(procs []*Process) {
+	less := pt.lockedChildLess()
+	sort.Slice(procs, func(i, j int) bool { return less(procs[i], procs[j]) })
+}
+
+// resetProcs empties a slice of Processes so that its storage can be reused, clearing its elements so that it
+// does not keep pruned Processes reachable.
+func resetProcs(procs []*Process) []*Process {
+	for i := range procs {
+		procs[i] = nil
+	}
+	return procs[:0]
 }
 
 // SortProcessesByPid sorts a slice of Processes in increasing pid order.
 func (pt *ProcTree) SortProcessesByPid(procs []*Process) {
-	pt.plock()
-	defer pt.punlock()
+	pt.prlock()
+	defer pt.prunlock()
 	pt.lockedSortProcessesByPid(procs)
 }
 
-func (pt *ProcTree) lockedUpdate(pruneTombstones bool) error {
-	fixedRoots := (len(pt.cfg.rootPids) > 0)
+// lockedAttachPendingCmdline attaches a command line reported by an exec notification to a Process that has
+// just been discovered or refreshed.
+func (pt *ProcTree) lockedAttachPendingCmdline(proc *Process) {
+	pid := proc.lockedPid()
+	cmdline, ok := pt.pendingCmdlines[pid]
+	if ok {
+		proc.cmdline = cmdline
+		delete(pt.pendingCmdlines, pid)
+	}
+}
+
+// scanForUpdate scans the system with the current configuration, without holding the tree lock, so that readers
+// are not blocked by a slow scan. The snapshot is applied with lockedApplySnapshot.
+func (pt *ProcTree) scanForUpdate(ctx context.Context) (*procSnapshot, error) {
+	pt.prlock()
+	readOnly := pt.readOnly
+	includeKernelThreads := pt.cfg.includeKernelThreads
+	readUsage := pt.cfg.childOrder.readsUsage()
+	pt.prunlock()
+	if readOnly {
+		return nil, fmt.Errorf("Unable to update a read-only ProcTree")
+	}
+	return pt.scanProcesses(ctx, includeKernelThreads, readUsage, false)
+}
 
-	gopsProcs, err := gops.Processes()
+// lockedApplySnapshot refreshes the tree from a scan of the system. If the scan was taken without holding the
+// tree lock, and another scan that started later has since been applied, or the configuration of kernel
+// threads or child order has changed, the system is rescanned, so that the tree never moves backwards in time,
+// and the resource usage of processes is read when the child order needs it. The context cancels the rescan.
+func (pt *ProcTree) lockedApplySnapshot(ctx context.Context, snap *procSnapshot, pruneTombstones bool) error {
+	if pt.readOnly {
+		return fmt.Errorf("Unable to update a read-only ProcTree")
+	}
+	if snap.seq < pt.appliedScanSeq || snap.includeKernelThreads != pt.cfg.includeKernelThreads ||
+		snap.readUsage != pt.cfg.childOrder.readsUsage() {
+		var err error
+		snap, err = pt.scanProcesses(ctx, pt.cfg.includeKernelThreads, pt.cfg.childOrder.readsUsage(), true)
+		if err != nil {
+			return err
+		}
+	}
+	first := pt.appliedScanSeq == 0
+	pt.appliedScanSeq = snap.seq
+	updateStart := snap.start
+	err := pt.lockedRefreshPidFiles(first)
 	if err != nil {
 		return err
 	}
+	fixedRoots := pt.cfg.hasRoots()
 
-	// All existing processes are tombstoned unless they are found again, and child lists are rederived on each update
+	// Changes observed by this update, used to generate events. The map is reused by later updates.
+	if pt.changes == nil {
+		pt.changes = make(map[*Process]eventMask)
+	}
+	changes := pt.changes
+	defer func() {
+		for proc := range changes {
+			delete(changes, proc)
+		}
+	}()
+
+	// All existing processes are tombstoned unless they are found again, and child lists are rederived on each
+	// update, reusing their storage
+	prevAbsCount := len(pt.absProcs)
 	for _, proc := range pt.pidMap {
+		proc.wasAlive = !proc.isTombstone
+		proc.wasIncluded = proc.isIncluded
 		proc.isTombstone = true
-		proc.absChildProcs = []*Process{}
-		proc.includedChildProcs = []*Process{}
+		proc.absChildProcs = resetProcs(proc.absChildProcs)
+		proc.includedChildProcs = resetProcs(proc.includedChildProcs)
 	}
+	// Processes dropped because their pids were reused
+	var reused []*Process
+
+	self := os.Getpid()
+	refreshed := 0
+	pruned := 0
 
 	// Create all new Processes, and refresh old ones
-	for _, gopsProc := range gopsProcs {
-		pid := gopsProc.Pid()
-		ppid := gopsProc.PPid()
-		if pt.cfg.includeKernelThreads || (pid != 2 && ppid != 2) {
-			proc, ok := pt.pidMap[pid]
-			if ok {
-				// refresh existing process
-				proc.gopsProcess = gopsProc
-				proc.isTombstone = false
-			} else {
-				// add a new process
-				proc = newProcess(pt, gopsProc)
-				pt.pidMap[pid] = proc
-				proc.isIncluded = !fixedRoots
+	for _, info := range snap.procs {
+		pid := info.Pid
+		ppid := info.PPid
+		startTime := info.StartTime
+		proc, ok := pt.pidMap[pid]
+		if ok && proc.exitScanSeq != 0 && !proc.wasAlive && snap.seq <= proc.exitScanSeq {
+			// The process was reported to have exited by a real-time notification after this scan started, so
+			// the scan is stale for it, and it remains a tombstone
+			continue
+		}
+		if ok && ((proc.startTime != 0 && startTime != 0 && proc.startTime != startTime) ||
+			(proc.exitScanSeq != 0 && !proc.wasAlive)) {
+			// The pid has been reused by a new process, or by any process found by a scan that started after
+			// the old one was reported to have exited. The old Process is dropped from the tree, but is still
+			// reported as exited if it was previously alive.
+			delete(pt.pidMap, pid)
+			reused = append(reused, proc)
+			sc, spawned := pt.spawned[pid]
+			if spawned && sc.proc == proc {
+				delete(pt.spawned, pid)
 			}
+			ok = false
+		}
+		if ok {
+			// refresh existing process
+			if proc.gopsProcess.Executable() != info.Executable {
+				changes[proc] |= eventMaskExeced
+				proc.execCount++
+				proc.lockedInvalidateMetadata()
+				proc.resort = true
+			}
+			if proc.gopsProcess.Executable() != info.Executable || proc.gopsProcess.PPid() != ppid {
+				proc.gopsProcess = &staticProcess{pid: pid, ppid: ppid, executable: info.Executable}
+			}
+			proc.isTombstone = false
+			proc.lastSeen = updateStart
+			if proc.startTime == 0 && startTime != 0 {
+				proc.startTime = startTime
+				proc.resort = true
+			}
+			if snap.usage != nil {
+				usage := snap.usage[pid]
+				if proc.cpuTime != usage.CPUTime || proc.rss != usage.RSS {
+					proc.cpuTime, proc.rss = usage.CPUTime, usage.RSS
+					proc.resort = true
+				}
+			}
+			refreshed++
+			pt.lockedAttachPendingCmdline(proc)
+		} else {
+			// add a new process
+			proc = newProcess(pt, &staticProcess{pid: pid, ppid: ppid, executable: info.Executable})
+			proc.startTime = startTime
+			proc.firstSeen, proc.lastSeen = updateStart, updateStart
+			if snap.usage != nil {
+				usage := snap.usage[pid]
+				proc.cpuTime, proc.rss = usage.CPUTime, usage.RSS
+			}
+			pt.pidMap[pid] = proc
+			proc.isIncluded = !fixedRoots
+			changes[proc] |= eventMaskStarted
+			pt.lockedAttachPendingCmdline(proc)
+			if pt.rtBackend != nil {
+				pt.rtBackend.watch(pid, ppid)
+			}
+		}
+		if ppid == self && proc.exitStatus == nil {
+			// Children of the calling process that have terminated but have not yet been waited on
+			// remain visible, so their exit status can be recorded before they are reaped
+			proc.exitStatus = peekExitStatus(pid)
+		}
+	}
+
+	for _, proc := range pt.pidMap {
+		if proc.wasAlive && proc.isTombstone {
+			changes[proc] |= eventMaskExited
+		}
+	}
+	for _, proc := range reused {
+		if proc.wasAlive {
+			changes[proc] |= eventMaskExited
 		}
 	}
 
@@ -125,45 +459,88 @@ func (pt *ProcTree) lockedUpdate(pruneTombstones bool) error {
 		// Remove all Processes that were not rediscovered by this update
 		for pid, proc := range pt.pidMap {
 			if proc.isTombstone {
-				delete(pt.pidMap, pid)
+				pt.lockedPruneTombstone(pid, proc)
+				pruned++
 			}
 		}
+	} else if pt.cfg.tombstoneMaxAge > 0 || pt.cfg.tombstoneMaxCount > 0 {
+		pruned += pt.lockedApplyTombstoneRetention(updateStart)
 	}
 
 	if fixedRoots && pt.cfgRootProcs == nil {
 		// On the first update, build the list of configured root Processes. This will return
-		// an error at New() time if one of the pids is not found.
+		// an error at New() time if one of the pids is not found, unless roots are lenient, in which case
+		// it is left pending.
 		pt.cfgRootProcs = make([]*Process, 0, len(pt.cfg.rootPids))
+		pt.ownedRootProcs = make([]*Process, 0, len(pt.cfg.ownedRootPids))
 		for _, pid := range pt.cfg.rootPids {
-			proc, ok := pt.pidMap[pid]
-			if !ok {
+			proc := pt.lockedResolveRoot(pid)
+			if proc == nil {
+				if pt.cfg.lenientRoots {
+					pt.pendingRootPids = append(pt.pendingRootPids, pid)
+					continue
+				}
 				pt.cfgRootProcs = nil
-				return fmt.Errorf("Configured root pid %d does not exist", pid)
+				pt.ownedRootProcs = nil
+				return &PidError{Op: "find configured root", Pid: pid, Err: ErrRootPidNotFound}
 			}
 			pt.cfgRootProcs = append(pt.cfgRootProcs, proc)
+			for _, ownedPid := range pt.cfg.ownedRootPids {
+				if ownedPid == pid {
+					pt.ownedRootProcs = append(pt.ownedRootProcs, proc)
+				}
+			}
 		}
 	}
 
-	// Fill in the absolute child lists for each process, Build a sorted list of absolute processes,
-	// and build a sorted list of absolute root processes
-	pt.absProcs = make([]*Process, len(pt.pidMap))
-	pt.absRootProcs = []*Process{}
-	i := 0
-	for _, proc := range pt.pidMap {
-		pt.absProcs[i] = proc
-		i++
+	// Resolve roots added with AddRoot or Reconfigure, and lenient roots that did not exist yet. Roots that
+	// exited before they were found are dropped, unless roots are lenient.
+	var stillPending []int
+	for _, pid := range pt.pendingRootPids {
+		proc := pt.lockedResolveRoot(pid)
+		if proc != nil {
+			pt.cfgRootProcs = append(pt.cfgRootProcs, proc)
+			for _, ownedPid := range pt.cfg.ownedRootPids {
+				if ownedPid == pid {
+					pt.ownedRootProcs = append(pt.ownedRootProcs, proc)
+				}
+			}
+		} else if pt.cfg.lenientRoots {
+			stillPending = append(stillPending, pid)
+		} else {
+			pt.cfg = pt.cfg.Refine(withoutRoot(pid))
+		}
+	}
+	pt.pendingRootPids = stillPending
+	fixedRoots = pt.cfg.hasRoots()
+
+	// Bring the sorted lists of absolute processes up to date, build a sorted list of absolute root processes,
+	// and link each process to its parent
+	pt.lockedUpdateIndexes()
+	pt.absRootProcs = resetProcs(pt.absRootProcs)
+	for _, proc := range pt.absProcs {
 		ppid := proc.gopsProcess.PPid()
 		var pproc *Process
-		if ppid != 0 {
+		// A process that reports itself as its own parent is treated as having no parent
+		if ppid != 0 && ppid != proc.lockedPid() {
 			var ok bool
 			pproc, ok = pt.pidMap[ppid]
 			if !ok {
 				pproc = nil
 			}
 		}
+		if pproc != nil && pproc.startTime != 0 && proc.startTime != 0 && pproc.startTime > proc.startTime {
+			// The parent pid has been reused by a process that started after this one, e.g., because the source
+			// does not update the ppid of orphaned processes, so the process is treated as an orphan
+			pproc = nil
+		}
+		if proc.parentProc != nil && proc.parentProc != pproc && !proc.isTombstone {
+			// The parent of a live process has changed, typically because it was adopted after its parent exited
+			changes[proc] |= eventMaskReparented
+			proc.prevParentProc = proc.parentProc
+		}
+		proc.parentProc = pproc
 		if pproc != nil {
-			pproc.absChildProcs = append(pproc.absChildProcs, proc)
-			proc.parentProc = pproc
 			if proc.origParentProc == nil {
 				proc.origParentProc = pproc
 			}
@@ -171,18 +548,31 @@ func (pt *ProcTree) lockedUpdate(pruneTombstones bool) error {
 			pt.absRootProcs = append(pt.absRootProcs, proc)
 		}
 	}
-	pt.lockedSortProcessesByPid(pt.absProcs)
-	pt.lockedSortProcessesByPid(pt.absRootProcs)
 
-	// Make sure each Process's child list is sorted in pid order
-	for _, proc := range pt.absProcs {
-		pt.lockedSortProcessesByPid(proc.absChildProcs)
+	// Fill in the absolute child lists for each process. Children are appended in the configured order, so
+	// that each child list is sorted by a single global pass rather than sorting every list.
+	childOrderProcs := pt.lockedChildOrderProcs()
+	for _, proc := range childOrderProcs {
+		pproc := proc.parentProc
+		if pproc != nil {
+			pproc.absChildProcs = append(pproc.absChildProcs, proc)
+		}
+	}
+
+	// Bind newly started commands to their Processes
+	for pid, sc := range pt.spawned {
+		if sc.proc == nil {
+			sc.proc = pt.pidMap[pid]
+		}
 	}
 
 	if fixedRoots {
 		// If we have configured roots, then by default everything is excluded. We will walk the subtree for each
-		// root and enable all of the reachable processes
-		err = pt.lockedFullWalkFromRoots(pt.cfgRootProcs, func(proc *Process) error {
+		// root (including processes started with StartCommand) and enable all of the reachable processes
+		for _, proc := range pt.absProcs {
+			proc.isIncluded = false
+		}
+		err = pt.lockedFullWalkFromRoots(append(pt.lockedSpawnedProcs(), pt.cfgRootProcs...), func(proc *Process) error {
 			if !proc.isIncluded {
 				proc.isIncluded = true
 			}
@@ -191,6 +581,16 @@ func (pt *ProcTree) lockedUpdate(pruneTombstones bool) error {
 		if err != nil {
 			return fmt.Errorf("Unable to compute rooted tree subset: %s", err)
 		}
+		// Descendants of roots configured with WithRootSelf or WithRootParent remain included after they are
+		// reparented
+		for _, pid := range pt.cfg.selfRootPids {
+			root := pt.pidMap[pid]
+			for _, proc := range pt.absProcs {
+				if !proc.isIncluded && proc.lockedIsOrigDescendantOf(root) {
+					proc.isIncluded = true
+				}
+			}
+		}
 		if pt.cfg.includeRootAncestors {
 			// If we are including ancestors then we also need to walk up from each configured root and enable those processes
 			for _, root := range pt.cfgRootProcs {
@@ -227,44 +627,246 @@ func (pt *ProcTree) lockedUpdate(pruneTombstones bool) error {
 
 	}
 
+	// Exclude configured subtrees
+	err = pt.lockedExcludeSubtrees()
+	if err != nil {
+		return fmt.Errorf("Unable to exclude subtrees: %s", err)
+	}
+
+	// Exclude Processes rejected by filters
+	err = pt.lockedApplyFilters()
+	if err != nil {
+		return fmt.Errorf("Unable to apply filters: %s", err)
+	}
+
+	// Exclude Processes beyond the maximum depth
+	pt.lockedApplyMaxDepth()
+
 	// Build the list of included processes and included root processes, and fill in included child list for
 	// each Process
-	pt.includedProcs = make([]*Process, 0, len(pt.absProcs))
-	pt.includedRootProcs = []*Process{}
+	pt.includedProcs = resetProcs(pt.includedProcs)
+	pt.includedRootProcs = resetProcs(pt.includedRootProcs)
 	for _, proc := range pt.absProcs {
 		if proc.isIncluded {
 			pt.includedProcs = append(pt.includedProcs, proc)
 			pproc := proc.parentProc
-			if pproc != nil {
-				pproc.includedChildProcs = append(pproc.includedChildProcs, proc)
-			}
 			if pproc == nil || pproc == proc || !pproc.isIncluded {
 				pt.includedRootProcs = append(pt.includedRootProcs, proc)
 			}
+		}
+	}
+	for _, proc := range childOrderProcs {
+		pproc := proc.parentProc
+		if proc.isIncluded && pproc != nil {
+			pproc.includedChildProcs = append(pproc.includedChildProcs, proc)
+		}
+	}
+	pt.lockedComputeCounts()
+	pt.lockedAdvanceGeneration(changes, len(pt.absProcs) != prevAbsCount)
+
+	pt.lockedQueueEvents(changes)
 
+	// Summaries are always computed, since they also accumulate the churn statistics published by PublishExpvar
+	{
+		summary := &UpdateSummary{
+			Time:      updateStart,
+			Duration:  pt.clock.Now().Sub(updateStart),
+			Processes: len(pt.pidMap),
+			Refreshed: refreshed,
+			Pruned:    pruned,
 		}
+		for _, mask := range changes {
+			if mask&eventMaskStarted != 0 {
+				summary.Added++
+			}
+			if mask&eventMaskExited != 0 {
+				summary.Removed++
+			}
+			if mask&eventMaskReparented != 0 {
+				summary.Reparented++
+			}
+			if mask&eventMaskExeced != 0 {
+				summary.Execed++
+			}
+		}
+		pt.stats.lockedAdd(summary)
+		if len(pt.cfg.updateHooks) > 0 || pt.cfg.logger != nil {
+			pt.pendingSummaries = append(pt.pendingSummaries, summary)
+		}
+	}
+
+	return nil
+}
+
+// lockedPruneTombstone removes a tombstone from the tree.
+func (pt *ProcTree) lockedPruneTombstone(pid int, proc *Process) {
+	delete(pt.pidMap, pid)
+	sc, ok := pt.spawned[pid]
+	if ok && sc.proc == proc {
+		delete(pt.spawned, pid)
 	}
+}
 
-	pt.lockedSortProcessesByPid(pt.includedProcs)
-	pt.lockedSortProcessesByPid(pt.includedRootProcs)
-	// Make sure each Process's included child list is sorted in pid order
+// lockedApplyTombstoneRetention prunes the tombstones that are older than the configured maximum age, and then
+// the oldest tombstones in excess of the configured maximum count. Returns the number of tombstones pruned.
+func (pt *ProcTree) lockedApplyTombstoneRetention(now time.Time) int {
+	pruned := 0
+	tombstones := []*Process{}
+	for pid, proc := range pt.pidMap {
+		if !proc.isTombstone {
+			continue
+		}
+		if pt.cfg.tombstoneMaxAge > 0 && now.Sub(proc.lastSeen) > pt.cfg.tombstoneMaxAge {
+			pt.lockedPruneTombstone(pid, proc)
+			pruned++
+		} else {
+			tombstones = append(tombstones, proc)
+		}
+	}
+	if pt.cfg.tombstoneMaxCount > 0 && len(tombstones) > pt.cfg.tombstoneMaxCount {
+		sort.Slice(tombstones, func(i, j int) bool {
+			a, b := tombstones[i], tombstones[j]
+			if !a.lastSeen.Equal(b.lastSeen) {
+				return a.lastSeen.Before(b.lastSeen)
+			}
+			return a.id < b.id
+		})
+		for _, proc := range tombstones[:len(tombstones)-pt.cfg.tombstoneMaxCount] {
+			pt.lockedPruneTombstone(proc.lockedPid(), proc)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// lockedAdvanceGeneration increments the generation of the tree if an update changed it: if any Process changed,
+// became included or excluded, or if Processes were removed from the tree. The changed Processes are marked
+// with the new generation.
+func (pt *ProcTree) lockedAdvanceGeneration(changes map[*Process]eventMask, removed bool) {
+	gen := pt.generation + 1
+	changed := removed
+	for proc, mask := range changes {
+		if mask != 0 {
+			proc.changedGen = gen
+			changed = true
+		}
+	}
 	for _, proc := range pt.absProcs {
-		pt.lockedSortProcessesByPid(proc.includedChildProcs)
+		if proc.isIncluded != proc.wasIncluded {
+			proc.wasIncluded = proc.isIncluded
+			proc.changedGen = gen
+			changed = true
+		}
+	}
+	if changed {
+		pt.generation = gen
 	}
+}
 
-	return nil
+// Generation returns a counter that is incremented by each update that changes the tree: when Processes are
+// discovered, exit, exec, are reparented or pruned, or are included or excluded, e.g., after Reconfigure. A
+// caller that saves the generation can cheaply tell whether anything has changed since, and find the Processes
+// that changed with Process.LastChangedGeneration. Updates that find no changes leave the generation unchanged.
+// The generation of a ProcTree loaded from a serialized tree is 0, and is incremented by each event applied to
+// it, e.g., with ApplyEventProto.
+func (pt *ProcTree) Generation() uint64 {
+	pt.prlock()
+	defer pt.prunlock()
+	return pt.generation
+}
+
+// Config returns a copy of the current configuration of the ProcTree, including changes made by AddRoot,
+// RemoveRoot and Reconfigure, e.g., to log it.
+func (pt *ProcTree) Config() *Config {
+	pt.prlock()
+	defer pt.prunlock()
+	return pt.cfg.Refine()
 }
 
 // Update refreshes the ProcTree session with a new snapshot view of current processes. Process objects
 // from the previous snapshot are preserved, but may become tombstoned.
 func (pt *ProcTree) Update(pruneTombstones bool) error {
+	return pt.UpdateContext(context.Background(), pruneTombstones)
+}
+
+// withCloseCancel returns a context that is done when either the provided context is done or the ProcTree is
+// closed, with a function that releases it.
+func (pt *ProcTree) withCloseCancel(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx.Done() == nil {
+		return pt.ctx, func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-pt.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// UpdateContext is like Update, but the scan of the system is cancelled, and UpdateContext returns the context's
+// error, if the context is done or the ProcTree is closed before the scan completes. A cancelled update leaves
+// the tree unchanged.
+func (pt *ProcTree) UpdateContext(ctx context.Context, pruneTombstones bool) error {
+	ctx, cancel := pt.withCloseCancel(ctx)
+	defer cancel()
+	// The system is scanned before the tree lock is taken, so that readers are not blocked by a slow scan
+	pt.prlock()
+	readOnly := pt.readOnly
+	includeKernelThreads := pt.cfg.includeKernelThreads
+	readUsage := pt.cfg.childOrder.readsUsage()
+	log := pt.cfg.logger
+	pt.prunlock()
+	if readOnly {
+		return fmt.Errorf("Unable to update a read-only ProcTree")
+	}
+	snap, err := pt.scanProcesses(ctx, includeKernelThreads, readUsage, false)
+	if err != nil {
+		logDebug(log, "Unable to scan processes", "error", err)
+		return err
+	}
 	pt.plock()
-	defer pt.punlock()
-	return pt.lockedUpdate(pruneTombstones)
+	err = pt.lockedApplySnapshot(ctx, snap, pruneTombstones)
+	if err == nil {
+		// Prefetched metadata is read without holding the tree lock, and cached before events are dispatched
+		now := pt.clock.Now()
+		reads := pt.lockedMetadataReads(now)
+		if len(reads) > 0 {
+			workers := pt.cfg.metadataWorkers
+			pt.punlock()
+			prefetchMetadata(pt.procfs, reads, workers)
+			pt.plock()
+			pt.lockedStoreMetadataReads(reads, now)
+		}
+	}
+	pt.punlockAndDispatch()
+	if err != nil {
+		logDebug(log, "Unable to update process tree", "error", err)
+	}
+	return err
 }
 
-// Close implements io.Closer. Shuts down the ProcTree and releases resources
+// shutdown terminates owned subtrees and signals background goroutines to exit. It is safe to call
+// more than once, and does not wait for background goroutines.
+func (pt *ProcTree) shutdown() {
+	pt.closeOnce.Do(func() {
+		// Updates that are in flight are cancelled first, so that shutting down does not wait for them
+		pt.cancel()
+		pt.killSpawned()
+		pt.terminateOwnedRoots()
+		close(pt.done)
+		pt.closeSubscriptions()
+	})
+}
+
+// Close implements io.Closer. Shuts down the ProcTree and releases resources, waiting for
+// any background goroutines to exit. Subtrees of commands started with killOnClose are killed, and
+// subtrees of roots configured with WithOwnedRoot are terminated.
 func (pt *ProcTree) Close() error {
+	pt.shutdown()
+	pt.wg.Wait()
 	return nil
 }
 
@@ -272,8 +874,8 @@ func (pt *ProcTree) Close() error {
 // If root pids were provided at configuration time, only processes descended from the provided root
 // Processes will be returned.
 func (pt *ProcTree) Processes() []*Process {
-	pt.plock()
-	defer pt.punlock()
+	pt.prlock()
+	defer pt.prunlock()
 	result := make([]*Process, len(pt.includedProcs))
 	copy(result, pt.includedProcs)
 	return result
@@ -282,19 +884,41 @@ func (pt *ProcTree) Processes() []*Process {
 // Roots returns a snapshot of the list of all included Process objects that are toplevel roots,
 // sorted in ascending PID order.
 func (pt *ProcTree) Roots() []*Process {
-	pt.plock()
-	defer pt.punlock()
+	pt.prlock()
+	defer pt.prunlock()
 	result := make([]*Process, len(pt.includedRootProcs))
 	copy(result, pt.includedRootProcs)
 	return result
 }
 
+// AbsProcesses returns a snapshot of the list of all known Process objects, sorted in ascending PID order,
+// regardless of the configured roots and filters. Includes unpruned tombstones. Kernel threads are only
+// known if they were enabled with WithKernelThreads.
+func (pt *ProcTree) AbsProcesses() []*Process {
+	pt.prlock()
+	defer pt.prunlock()
+	result := make([]*Process, len(pt.absProcs))
+	copy(result, pt.absProcs)
+	return result
+}
+
+// AbsRoots returns a snapshot of the list of all known Process objects that are roots of the absolute
+// process tree (i.e., whose parent is not known), sorted in ascending PID order, regardless of the configured
+// roots and filters. Includes unpruned tombstones.
+func (pt *ProcTree) AbsRoots() []*Process {
+	pt.prlock()
+	defer pt.prunlock()
+	result := make([]*Process, len(pt.absRootProcs))
+	copy(result, pt.absRootProcs)
+	return result
+}
+
 // PidProcess looks up a Process in the current snapshot by PID. If there
 // is no process with the provided PID, of if the process is excluded by config,
 // nil is returned.
 func (pt *ProcTree) PidProcess(pid int) *Process {
-	pt.plock()
-	defer pt.punlock()
+	pt.prlock()
+	defer pt.prunlock()
 	proc, ok := pt.pidMap[pid]
 	if !ok || !proc.isIncluded {
 		proc = nil
@@ -302,6 +926,151 @@ func (pt *ProcTree) PidProcess(pid int) *Process {
 	return proc
 }
 
+func (pt *ProcTree) lockedPidProcessErr(pid int) (*Process, error) {
+	proc, ok := pt.pidMap[pid]
+	if !ok {
+		return nil, &PidError{Op: "look up", Pid: pid, Err: ErrNoSuchPid}
+	}
+	if !proc.isIncluded {
+		return nil, &PidError{Op: "look up", Pid: pid, Err: ErrPidExcluded}
+	}
+	return proc, nil
+}
+
+// PidProcessErr looks up a Process in the current snapshot by PID, as with PidProcess, but returns a PidError
+// wrapping ErrNoSuchPid if there is no Process with the provided PID, or ErrPidExcluded if the Process is
+// excluded by config.
+func (pt *ProcTree) PidProcessErr(pid int) (*Process, error) {
+	pt.prlock()
+	defer pt.prunlock()
+	return pt.lockedPidProcessErr(pid)
+}
+
+// PidProcesses looks up the Processes with many PIDs, e.g., the contents of a cgroup.procs file, taking the tree
+// lock once. The returned map contains the included Process of each PID that was found. If any PID was not found,
+// the error returned by PidProcessErr for the first such PID is also returned.
+func (pt *ProcTree) PidProcesses(pids []int) (map[int]*Process, error) {
+	pt.prlock()
+	defer pt.prunlock()
+	result := make(map[int]*Process, len(pids))
+	var firstErr error
+	for _, pid := range pids {
+		proc, err := pt.lockedPidProcessErr(pid)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		result[pid] = proc
+	}
+	return result, firstErr
+}
+
+func (pt *ProcTree) lockedSelf() *Process {
+	if pt.readOnly {
+		return nil
+	}
+	if _, ok := pt.source.(systemSource); !ok {
+		return nil
+	}
+	proc, ok := pt.pidMap[os.Getpid()]
+	if !ok || !proc.isIncluded {
+		return nil
+	}
+	return proc
+}
+
+// Self returns the Process of the calling process, or nil if it is excluded by config, or if the tree was not
+// built from the processes of the local system (e.g., it was loaded from a serialized tree, or built with
+// WithProcessSource).
+func (pt *ProcTree) Self() *Process {
+	pt.prlock()
+	defer pt.prunlock()
+	return pt.lockedSelf()
+}
+
+// SelfParent returns the parent of the Process returned by Self, or nil if Self returns nil or its parent is
+// excluded by config.
+func (pt *ProcTree) SelfParent() *Process {
+	pt.prlock()
+	defer pt.prunlock()
+	self := pt.lockedSelf()
+	if self == nil {
+		return nil
+	}
+	return self.lockedParent()
+}
+
+// ProcessByPath looks up an included Process by the path returned by Process.Path, e.g.,
+// "systemd(1)/sshd(812)/bash(3401)". The Process is found by the pid in the final element of the path, and is
+// only returned if its entire path matches, so a stale path does not match a process that has since been
+// reparented, or a new process that has reused a pid. Returns nil if no included Process has the path.
+func (pt *ProcTree) ProcessByPath(path string) *Process {
+	if !strings.HasSuffix(path, ")") {
+		return nil
+	}
+	i := strings.LastIndexByte(path, '(')
+	if i < 0 {
+		return nil
+	}
+	pid, err := strconv.Atoi(path[i+1 : len(path)-1])
+	if err != nil {
+		return nil
+	}
+	pt.prlock()
+	defer pt.prunlock()
+	proc, ok := pt.pidMap[pid]
+	if !ok || !proc.isIncluded || proc.lockedPath() != path {
+		return nil
+	}
+	return proc
+}
+
+// lockedIncludedLineage returns an included Process followed by its included ancestors, up to its root.
+func (pt *ProcTree) lockedIncludedLineage(proc *Process) []*Process {
+	lineage := []*Process{proc}
+	proc.lockedForEachAncestor(false, func(ancestor *Process) bool {
+		if !ancestor.isIncluded {
+			return false
+		}
+		lineage = append(lineage, ancestor)
+		return true
+	})
+	return lineage
+}
+
+// CommonAncestor returns the deepest included Process that is an ancestor of all of the provided Processes,
+// where each Process is considered to be an ancestor of itself; e.g., the common ancestor of a set of worker
+// processes is normally their supervisor. Returns nil if no Processes are provided, if any of them is not
+// included in this ProcTree, or if they are not all in the same included subtree.
+func (pt *ProcTree) CommonAncestor(procs ...*Process) *Process {
+	pt.prlock()
+	defer pt.prunlock()
+	if len(procs) == 0 {
+		return nil
+	}
+	for _, proc := range procs {
+		if proc == nil || proc.pt != pt || !proc.isIncluded {
+			return nil
+		}
+	}
+	// Count the lineages that each candidate appears in; the first Process in the first lineage that
+	// appears in all of them is the deepest
+	counts := make(map[*Process]int)
+	for _, proc := range procs {
+		for _, ancestor := range pt.lockedIncludedLineage(proc) {
+			counts[ancestor]++
+		}
+	}
+	for _, candidate := range pt.lockedIncludedLineage(procs[0]) {
+		if counts[candidate] == len(procs) {
+			return candidate
+		}
+	}
+	return nil
+}
+
 func (pt *ProcTree) lockedFullWalkFromRoots(roots []*Process, h ProcessHandler) error {
 	for _, proc := range roots {
 		err := proc.lockedWalkFullSubtree(h)
@@ -322,14 +1091,70 @@ func (pt *ProcTree) lockedWalkFromRoots(roots []*Process, h ProcessHandler) erro
 	return nil
 }
 
+// WalkOption is an opaque option for WalkFromRoots created by one of the With functions.
+type WalkOption func(*walkConfig)
+
+// walkConfig holds the options of a walk.
+type walkConfig struct {
+	// rejectOverlappingRoots causes overlapping roots to fail the walk, rather than being walked once.
+	rejectOverlappingRoots bool
+}
+
+// WithOverlappingRootsError causes WalkFromRoots to return an error wrapping ErrOverlappingRoots, without
+// walking any Processes, if a root is provided more than once or is an included descendant of another root. By
+// default, overlapping roots are walked once.
+func WithOverlappingRootsError() WalkOption {
+	return func(wc *walkConfig) {
+		wc.rejectOverlappingRoots = true
+	}
+}
+
+// lockedCheckOverlappingRoots returns an error wrapping ErrOverlappingRoots if a root is repeated, or is an
+// included descendant of another root.
+func (pt *ProcTree) lockedCheckOverlappingRoots(roots []*Process) error {
+	isRoot := make(map[*Process]bool, len(roots))
+	for _, root := range roots {
+		if isRoot[root] {
+			return fmt.Errorf("%w: pid %d is repeated", ErrOverlappingRoots, root.lockedPid())
+		}
+		isRoot[root] = true
+	}
+	for _, root := range roots {
+		if !root.isIncluded {
+			continue
+		}
+		for _, ancestor := range pt.lockedIncludedLineage(root)[1:] {
+			if isRoot[ancestor] {
+				return fmt.Errorf("%w: pid %d is a descendant of pid %d", ErrOverlappingRoots, root.lockedPid(),
+					ancestor.lockedPid())
+			}
+		}
+	}
+	return nil
+}
+
 // WalkFromRoots walks all subtrees starting at this provided root Process objects, invoking
 // a handler for each. Roots are walked in provided order; within each root Processes are walked in
-// depth-first order with children sorted in pid order. It is the caller's responsibility to ensure
-// that no root is a descendant of another; otherwise the handler will be called multiple
-// times for the same Process.
-func (pt *ProcTree) WalkFromRoots(roots []*Process, h ProcessHandler) error {
+// depth-first order with children in the configured order (see WithChildSort). The handler is called once for
+// each Process, even if a root is a descendant of another root, or is provided more than once; a root that has
+// already been walked as part of an earlier root's subtree is skipped. Use WithOverlappingRootsError to reject
+// overlapping roots instead.
+func (pt *ProcTree) WalkFromRoots(roots []*Process, h ProcessHandler, opts ...WalkOption) error {
+	wc := &walkConfig{}
+	for _, opt := range opts {
+		opt(wc)
+	}
+	if wc.rejectOverlappingRoots {
+		pt.prlock()
+		err := pt.lockedCheckOverlappingRoots(roots)
+		pt.prunlock()
+		if err != nil {
+			return err
+		}
+	}
+	visited := make(map[*Process]bool)
 	for _, proc := range roots {
-		err := proc.WalkSubtree(h)
+		err := proc.walkSubtreeOnce(h, visited)
 		if err != nil {
 			return err
 		}
@@ -347,7 +1172,14 @@ func (pt *ProcTree) lockedWalk(h ProcessHandler) error {
 
 // Walk walks all subtrees starting at the configured root Process objects, invoking
 // a handler for each. Roots are walked in pid order; within each root Processes are walked in
-// depth-first order with children sorted in pid order.
+// depth-first order with children in the configured order (see WithChildSort).
 func (pt *ProcTree) Walk(h ProcessHandler) error {
 	return pt.WalkFromRoots(pt.Roots(), h)
 }
+
+// WalkBFS walks all subtrees starting at the configured root Process objects, invoking a handler for each,
+// as with Walk, but in breadth-first order: all roots first, in pid order, then their children, and so on, so
+// that shallower Processes are always visited before deeper ones.
+func (pt *ProcTree) WalkBFS(h ProcessHandler) error {
+	return walkBFS(pt.Roots(), h)
+}
@@ -4,8 +4,13 @@ Package proctree provides tools for inspecting, monitoring, and manipulating the
 package proctree
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"os/exec"
+	"runtime"
 	"testing"
+	"time"
 )
 
 func TestCurrentProcess(t *testing.T) {
@@ -50,6 +55,12 @@ func TestCurrentProcess(t *testing.T) {
 			if !found {
 				t.Error("myProc not in myParentProc.Children()")
 			}
+			if pt.SelfParent() != myParentProc {
+				t.Errorf("pt.SelfParent() returned %v, expected %v", pt.SelfParent(), myParentProc)
+			}
+		}
+		if pt.Self() != myProc {
+			t.Errorf("pt.Self() returned %v, expected %v", pt.Self(), myProc)
 		}
 	}
 
@@ -58,3 +69,437 @@ func TestCurrentProcess(t *testing.T) {
 		t.Errorf("pt.Close() returned error: %f", err)
 	}
 }
+
+func TestAutoUpdate(t *testing.T) {
+	pt, err := New(WithAutoUpdate(5*time.Millisecond, true))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	sub, err := pt.Subscribe()
+	if err != nil {
+		t.Fatalf("pt.Subscribe() returned error: %s", err)
+	}
+
+	cmd := exec.Command("sleep", "10")
+	err = cmd.Start()
+	if err != nil {
+		t.Fatalf("cmd.Start() returned error: %s", err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	// Readers must see consistent snapshots while the monitor is updating
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			pt.Walk(func(proc *Process) error {
+				proc.Children()
+				proc.Depth()
+				return nil
+			})
+			pt.Processes()
+		}
+	}()
+
+	ev := nextEvent(t, sub, cmd.Process.Pid)
+	if ev.Type != ProcessStarted {
+		t.Errorf("Event type %s is not expected", ev.Type)
+	}
+	<-done
+
+	err = pt.Close()
+	if err != nil {
+		t.Errorf("pt.Close() returned error: %s", err)
+	}
+}
+
+func TestRootSelf(t *testing.T) {
+	cmd, stdin, childPid := startShellWithChild(t)
+	defer signalPid(childPid, os.Kill)
+
+	pt, err := New(WithRootSelf())
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+	roots := pt.Roots()
+	if len(roots) != 1 || roots[0].Pid() != os.Getpid() {
+		t.Fatalf("pt.Roots() does not contain only the calling process")
+	}
+	if pt.PidProcess(childPid) == nil {
+		t.Fatalf("Descendant pid %d is not included", childPid)
+	}
+
+	// The child is orphaned when the shell exits, and remains included
+	stdin.Close()
+	cmd.Wait()
+	err = pt.Update(true)
+	if err != nil {
+		t.Fatalf("pt.Update() returned error: %s", err)
+	}
+	child := pt.PidProcess(childPid)
+	if child == nil {
+		t.Fatalf("Reparented descendant pid %d is not included", childPid)
+	}
+	if child.Parent() != nil && child.Parent().Pid() == cmd.Process.Pid {
+		t.Errorf("Descendant pid %d was not reparented", childPid)
+	}
+}
+
+func TestAbsTree(t *testing.T) {
+	pt, err := New(WithRootPid(os.Getpid()))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	if pt.PidProcess(os.Getppid()) != nil {
+		t.Fatalf("Parent process is included")
+	}
+	var parent *Process
+	for _, proc := range pt.AbsProcesses() {
+		if proc.Pid() == os.Getppid() {
+			parent = proc
+		}
+	}
+	if parent == nil {
+		t.Fatalf("Parent process not found in pt.AbsProcesses()")
+	}
+	found := false
+	for _, child := range parent.AbsChildren() {
+		found = found || child.Pid() == os.Getpid()
+	}
+	if !found {
+		t.Errorf("Current process not found in parent.AbsChildren()")
+	}
+	if len(pt.AbsRoots()) == 0 || len(pt.AbsProcesses()) <= len(pt.Processes()) {
+		t.Errorf("Absolute tree is not larger than the included tree")
+	}
+}
+
+func TestAddRemoveRoot(t *testing.T) {
+	pt, err := New(WithRootPid(os.Getpid()))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	err = pt.AddRoot(os.Getppid())
+	if err != nil {
+		t.Fatalf("pt.AddRoot() returned error: %s", err)
+	}
+	if pt.PidProcess(os.Getppid()) != nil {
+		t.Errorf("Added root is included before the next update")
+	}
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("pt.Update() returned error: %s", err)
+	}
+	if pt.PidProcess(os.Getppid()) == nil {
+		t.Errorf("Added root is not included after update")
+	}
+
+	err = pt.RemoveRoot(os.Getppid())
+	if err != nil {
+		t.Fatalf("pt.RemoveRoot() returned error: %s", err)
+	}
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("pt.Update() returned error: %s", err)
+	}
+	if pt.PidProcess(os.Getppid()) != nil {
+		t.Errorf("Removed root is included after update")
+	}
+	if pt.PidProcess(os.Getpid()) == nil {
+		t.Errorf("Remaining root is not included after update")
+	}
+
+	err = pt.RemoveRoot(os.Getppid())
+	if err == nil {
+		t.Errorf("pt.RemoveRoot() did not return an error for a pid that is not a root")
+	}
+	err = pt.AddRoot(-5)
+	if err == nil {
+		t.Errorf("pt.AddRoot() did not return an error for a nonexistent pid")
+	}
+
+	// With no roots remaining, all processes are included
+	err = pt.RemoveRoot(os.Getpid())
+	if err != nil {
+		t.Fatalf("pt.RemoveRoot() returned error: %s", err)
+	}
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("pt.Update() returned error: %s", err)
+	}
+	if pt.PidProcess(os.Getppid()) == nil {
+		t.Errorf("Parent is not included after removing all roots")
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	pt, err := New(WithRootPid(os.Getpid()))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+	myProc := pt.PidProcess(os.Getpid())
+
+	err = pt.Reconfigure(WithoutRootPid(), WithRootPid(os.Getppid()))
+	if err != nil {
+		t.Fatalf("pt.Reconfigure() returned error: %s", err)
+	}
+	if pt.PidProcess(os.Getpid()) != myProc {
+		t.Errorf("Process identity was not preserved by pt.Reconfigure()")
+	}
+	roots := pt.Roots()
+	if len(roots) != 1 || roots[0].Pid() != os.Getppid() {
+		t.Errorf("pt.Roots() does not contain only the new root")
+	}
+
+	err = pt.Reconfigure(WithFilter(func(info ProcessInfo) bool { return info.Pid != os.Getpid() }))
+	if err != nil {
+		t.Fatalf("pt.Reconfigure() returned error: %s", err)
+	}
+	if pt.PidProcess(os.Getpid()) != nil {
+		t.Errorf("Filter added by pt.Reconfigure() was not applied")
+	}
+
+	err = pt.Reconfigure(WithAutoUpdate(time.Second, false))
+	if err == nil {
+		t.Errorf("pt.Reconfigure() did not return an error when changing auto-update")
+	}
+	err = pt.Reconfigure(WithRootPid(-5))
+	if err == nil {
+		t.Errorf("pt.Reconfigure() did not return an error for a nonexistent root")
+	}
+	roots = pt.Roots()
+	if len(roots) != 1 || roots[0].Pid() != os.Getppid() {
+		t.Errorf("Failed pt.Reconfigure() changed the configuration")
+	}
+}
+
+func TestChildSort(t *testing.T) {
+	sleepCmd := exec.Command("sleep", "10")
+	err := sleepCmd.Start()
+	if err != nil {
+		t.Fatalf("sleepCmd.Start() returned error: %s", err)
+	}
+	defer sleepCmd.Wait()
+	defer sleepCmd.Process.Kill()
+	catCmd := exec.Command("cat")
+	_, err = catCmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("catCmd.StdinPipe() returned error: %s", err)
+	}
+	err = catCmd.Start()
+	if err != nil {
+		t.Fatalf("catCmd.Start() returned error: %s", err)
+	}
+	defer catCmd.Wait()
+	defer catCmd.Process.Kill()
+
+	// childOrder returns the pids of the two commands in the order in which they are listed as children
+	childOrder := func(order ChildOrder) []int {
+		pt, err := New(WithRootPid(os.Getpid()), WithChildSort(order))
+		if err != nil {
+			t.Fatalf("proctree.New() returned error: %s", err)
+		}
+		defer pt.Close()
+		pids := []int{}
+		for _, child := range pt.PidProcess(os.Getpid()).Children() {
+			if child.Pid() == sleepCmd.Process.Pid || child.Pid() == catCmd.Process.Pid {
+				pids = append(pids, child.Pid())
+			}
+		}
+		return pids
+	}
+
+	pids := childOrder(ByExecutable)
+	if len(pids) != 2 || pids[0] != catCmd.Process.Pid {
+		t.Errorf("Children are not sorted by executable")
+	}
+	if runtime.GOOS == "linux" {
+		pids = childOrder(ByStartTime)
+		if len(pids) != 2 || pids[0] != sleepCmd.Process.Pid {
+			t.Errorf("Children are not sorted by start time")
+		}
+	}
+	_, err = New(WithChildSort(ChildOrder(17)))
+	if err == nil {
+		t.Errorf("proctree.New() accepted an invalid child order")
+	}
+}
+
+func TestSubtreeUsage(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("resource usage is only supported on Linux")
+	}
+	cmd, stdin, childPid := startShellWithChild(t)
+	defer cmd.Wait()
+	defer stdin.Close()
+	defer signalPid(childPid, os.Kill)
+
+	pt, err := New(WithRootPid(cmd.Process.Pid))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	usage, err := pt.PidProcess(cmd.Process.Pid).SubtreeUsage()
+	if err != nil {
+		t.Fatalf("SubtreeUsage() returned error: %s", err)
+	}
+	if usage.Processes != 2 || usage.Threads < 2 || usage.RSS == 0 || usage.FDs < 3 {
+		t.Errorf("SubtreeUsage() returned unexpected usage %+v", usage)
+	}
+	childUsage, err := pt.PidProcess(childPid).SubtreeUsage()
+	if err != nil {
+		t.Fatalf("SubtreeUsage() returned error: %s", err)
+	}
+	if childUsage.Processes != 1 || childUsage.Threads > usage.Threads {
+		t.Errorf("SubtreeUsage() of child returned unexpected usage %+v", childUsage)
+	}
+}
+
+func TestTopBy(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("resource usage is only supported on Linux")
+	}
+	cmd, stdin, childPid := startShellWithChild(t)
+	defer cmd.Wait()
+	defer stdin.Close()
+	defer signalPid(childPid, os.Kill)
+
+	pt, err := New(WithRootPid(cmd.Process.Pid))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	top, err := pt.TopBy(MetricRSS, 10)
+	if err != nil {
+		t.Fatalf("TopBy() returned error: %s", err)
+	}
+	if len(top) != 2 || top[0].Usage.RSS < top[1].Usage.RSS {
+		t.Errorf("TopBy(MetricRSS, 10) returned unexpected result %+v", top)
+	}
+	top, err = pt.TopBy(MetricFDs, 1)
+	if err != nil {
+		t.Fatalf("TopBy() returned error: %s", err)
+	}
+	if len(top) != 1 || top[0].Usage.FDs == 0 {
+		t.Errorf("TopBy(MetricFDs, 1) returned unexpected result %+v", top)
+	}
+	_, err = pt.TopBy(UsageMetric(-1), 1)
+	if err == nil {
+		t.Errorf("TopBy() with an invalid metric did not return an error")
+	}
+}
+
+func TestConcurrentReadersAndUpdates(t *testing.T) {
+	pt, err := New()
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	done := make(chan struct{})
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			for {
+				select {
+				case <-done:
+					errs <- nil
+					return
+				default:
+				}
+				for _, proc := range pt.Processes() {
+					proc.Depth()
+					proc.Children()
+					proc.Path()
+				}
+				err := pt.Walk(func(proc *Process) error {
+					proc.Executable()
+					return nil
+				})
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		err = pt.Update(i%2 == 0)
+		if err != nil {
+			t.Errorf("Update() returned error: %s", err)
+		}
+	}
+	close(done)
+	for i := 0; i < 2; i++ {
+		err = <-errs
+		if err != nil {
+			t.Errorf("Walk() returned error: %s", err)
+		}
+	}
+}
+
+func pidList(procs []*Process) string {
+	pids := []int{}
+	for _, proc := range procs {
+		pids = append(pids, proc.Pid())
+	}
+	return fmt.Sprint(pids)
+}
+
+func TestWalkFromRootsOverlap(t *testing.T) {
+	fs := newFakeSource(
+		ProcInfo{Pid: 1, Executable: "init", StartTime: 1},
+		ProcInfo{Pid: 100, PPid: 1, Executable: "sh", StartTime: 2},
+		ProcInfo{Pid: 101, PPid: 100, Executable: "make", StartTime: 3},
+		ProcInfo{Pid: 102, PPid: 101, Executable: "cc", StartTime: 4},
+		ProcInfo{Pid: 200, PPid: 1, Executable: "cron", StartTime: 5},
+	)
+	pt, err := New(WithProcessSource(fs))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	roots := []*Process{pt.PidProcess(101), pt.PidProcess(100), pt.PidProcess(200), pt.PidProcess(100)}
+	visits := make(map[int]int)
+	err = pt.WalkFromRoots(roots, func(proc *Process) error {
+		visits[proc.Pid()]++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkFromRoots() returned error: %s", err)
+	}
+	if len(visits) != 4 {
+		t.Errorf("WalkFromRoots() visited %v, expected pids 100, 101, 102 and 200", visits)
+	}
+	for pid, n := range visits {
+		if n != 1 {
+			t.Errorf("WalkFromRoots() visited pid %d %d times", pid, n)
+		}
+	}
+
+	err = pt.WalkFromRoots(roots[:3], func(proc *Process) error {
+		t.Errorf("WalkFromRoots() with overlapping roots visited pid %d", proc.Pid())
+		return nil
+	}, WithOverlappingRootsError())
+	if !errors.Is(err, ErrOverlappingRoots) {
+		t.Errorf("WalkFromRoots() with a descendant root returned error %v, expected ErrOverlappingRoots", err)
+	}
+	err = pt.WalkFromRoots(roots[1:], func(proc *Process) error { return nil }, WithOverlappingRootsError())
+	if !errors.Is(err, ErrOverlappingRoots) {
+		t.Errorf("WalkFromRoots() with a repeated root returned error %v, expected ErrOverlappingRoots", err)
+	}
+	err = pt.WalkFromRoots(roots[1:3], func(proc *Process) error { return nil }, WithOverlappingRootsError())
+	if err != nil {
+		t.Errorf("WalkFromRoots() with disjoint roots returned error: %s", err)
+	}
+}
@@ -0,0 +1,41 @@
+package proctreetest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a fake proctree.Clock whose time only changes when it is advanced or set, so that the times at which
+// processes are first and last seen, the CPU rates of a proctree.UsageSampler, and the expiry of cached metadata
+// and tombstones can be tested deterministically (see proctree.WithClock). A Clock is safe for concurrent use.
+type Clock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+// NewClock creates a Clock whose current time is start.
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now implements proctree.Clock.
+func (c *Clock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+// Advance moves the current time forward by d, and returns the new current time.
+func (c *Clock) Advance(d time.Duration) time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+	return c.now
+}
+
+// Set sets the current time.
+func (c *Clock) Set(now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = now
+}
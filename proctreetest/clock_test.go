@@ -0,0 +1,71 @@
+package proctreetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sammck-go/proctree"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := NewClock(start)
+	src := NewSource()
+	pt, err := proctree.New(proctree.WithProcessSource(src), proctree.WithClock(clock),
+		proctree.WithTombstoneRetention(time.Minute, 0))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+	if pt.Config().Clock() != proctree.Clock(clock) {
+		t.Errorf("Config().Clock() did not return the configured clock")
+	}
+	sub, err := pt.Subscribe()
+	if err != nil {
+		t.Fatalf("Subscribe() returned error: %s", err)
+	}
+
+	pid := src.Fork(InitPid, "sh")
+	forked := clock.Advance(10 * time.Second)
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+	proc := pt.PidProcess(pid)
+	if proc == nil || !proc.FirstSeen().Equal(forked) || !proc.LastSeen().Equal(forked) {
+		t.Fatalf("Process %d was not first seen at %s", pid, forked)
+	}
+	for _, ev := range drainEvents(sub) {
+		if !ev.Time.Equal(forked) {
+			t.Errorf("Event %s has time %s, expected %s", ev.Type, ev.Time, forked)
+		}
+	}
+
+	src.Exit(pid, 0)
+	exited := clock.Advance(10 * time.Second)
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+	if !proc.IsTombstone() || !proc.FirstSeen().Equal(forked) || !proc.LastSeen().Equal(forked) {
+		t.Errorf("Tombstone %d was seen from %s to %s, expected %s", pid, proc.FirstSeen(), proc.LastSeen(), forked)
+	}
+
+	// The tombstone is retained until it is older than the maximum age by the clock
+	clock.Set(exited.Add(45 * time.Second))
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+	if pt.PidProcess(pid) == nil {
+		t.Errorf("Tombstone %d was pruned before it expired", pid)
+	}
+	clock.Advance(time.Minute)
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+	if pt.PidProcess(pid) != nil {
+		t.Errorf("Tombstone %d was not pruned after it expired", pid)
+	}
+}
@@ -0,0 +1,234 @@
+// Package proctreetest provides a scriptable fake process source for testing code that uses proctree. Tests
+// fork, exec, reparent and exit processes on a Source, and then call Update on a ProcTree that lists the Source,
+// so that tombstone, reparenting and pid reuse behavior can be exercised deterministically, without depending on
+// the processes running on the test host. A Clock supplied with proctree.WithClock makes the times recorded by
+// the ProcTree, e.g., Process.LastSeen, deterministic too.
+//
+// For example:
+//
+//	src := proctreetest.NewSource()
+//	pt, err := proctree.New(proctree.WithProcessSource(src))
+//	...
+//	shell := src.Fork(proctreetest.InitPid, "sh")
+//	child := src.Fork(shell, "sleep")
+//	src.Exit(shell, 0)
+//	err = pt.Update(false)
+//	// shell is now a tombstone, and child has been reparented to init
+package proctreetest
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/sammck-go/proctree"
+)
+
+// InitPid is the pid of the init process of a Source, which adopts the children of processes that exit.
+const InitPid = 1
+
+// FirstPid is the first pid allocated by Fork. Pids are allocated in sequence from FirstPid, which is high
+// enough that they are never mistaken for Linux kernel threads (see proctree.WithKernelThreads).
+const FirstPid = 100
+
+// watcherBufferSize is the number of events that are buffered for each watcher. Events are dropped if a
+// watcher falls behind; a ProcTree catches up on its next update.
+const watcherBufferSize = 1024
+
+// process is a simulated process.
+type process struct {
+	pid        int
+	ppid       int
+	executable string
+	startTime  uint64
+}
+
+// Source is a fake proctree.ProcessEventSource whose processes are created, changed and destroyed by calls to
+// its methods. A new Source contains only an init process. Snapshots list processes in pid order. Start times
+// are taken from a counter that is advanced by each Fork, so that reuse of a pid by Spawn is detected by a
+// ProcTree. Changes are also reported to watchers, so a ProcTree configured with proctree.WithRealtimeMonitor
+// updates shortly after each change. A Source is safe for concurrent use.
+type Source struct {
+	lock     sync.Mutex
+	procs    map[int]*process
+	nextPid  int
+	clock    uint64
+	err      error
+	watchers map[chan proctree.SourceEvent]struct{}
+}
+
+// NewSource creates a Source that contains only an init process, with pid InitPid and executable name "init".
+func NewSource() *Source {
+	s := &Source{
+		procs:    make(map[int]*process),
+		nextPid:  FirstPid,
+		watchers: make(map[chan proctree.SourceEvent]struct{}),
+	}
+	s.clock++
+	s.procs[InitPid] = &process{pid: InitPid, executable: "init", startTime: s.clock}
+	return s
+}
+
+// Snapshot implements proctree.ProcessSource. Returns the error set with SetError, if any.
+func (s *Source) Snapshot() ([]proctree.ProcInfo, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	infos := make([]proctree.ProcInfo, 0, len(s.procs))
+	for _, p := range s.procs {
+		infos = append(infos, proctree.ProcInfo{Pid: p.pid, PPid: p.ppid, Executable: p.executable, StartTime: p.startTime})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Pid < infos[j].Pid })
+	return infos, nil
+}
+
+// Watch implements proctree.ProcessEventSource, reporting each change made to the Source until done is closed.
+func (s *Source) Watch(done <-chan struct{}, notify func(proctree.SourceEvent)) error {
+	ch := make(chan proctree.SourceEvent, watcherBufferSize)
+	s.lock.Lock()
+	s.watchers[ch] = struct{}{}
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		delete(s.watchers, ch)
+		s.lock.Unlock()
+	}()
+	for {
+		select {
+		case <-done:
+			return nil
+		case ev := <-ch:
+			notify(ev)
+		}
+	}
+}
+
+// Watchers returns the number of active watchers. Changes made before a ProcTree's real-time monitor starts
+// watching are only seen by its next update, so tests of real-time updates wait for a watcher first.
+func (s *Source) Watchers() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.watchers)
+}
+
+// lockedEmit reports a change to the watchers.
+func (s *Source) lockedEmit(ev proctree.SourceEvent) {
+	for ch := range s.watchers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// SetError causes later snapshots to fail with err, e.g., to simulate an unreadable process table. A nil error
+// restores normal operation.
+func (s *Source) SetError(err error) {
+	s.lock.Lock()
+	s.err = err
+	s.lock.Unlock()
+}
+
+// Fork creates a process with the next unused pid, as a child of ppid, and returns its pid. The parent does not
+// need to exist, so orphans can be simulated.
+func (s *Source) Fork(ppid int, executable string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for s.procs[s.nextPid] != nil {
+		s.nextPid++
+	}
+	pid := s.nextPid
+	s.nextPid++
+	s.lockedCreate(pid, ppid, executable)
+	return pid
+}
+
+// Spawn creates a process with a specific pid, as a child of ppid. Spawning a pid that was previously used
+// simulates pid reuse. Returns an error if a process with the pid exists.
+func (s *Source) Spawn(pid int, ppid int, executable string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.procs[pid] != nil {
+		return fmt.Errorf("Process with pid %d already exists", pid)
+	}
+	s.lockedCreate(pid, ppid, executable)
+	return nil
+}
+
+func (s *Source) lockedCreate(pid int, ppid int, executable string) {
+	s.clock++
+	s.procs[pid] = &process{pid: pid, ppid: ppid, executable: executable, startTime: s.clock}
+	s.lockedEmit(proctree.SourceEvent{Type: proctree.SourceFork, Pid: pid, PPid: ppid})
+}
+
+// Exec changes the executable name of a process, as if it exec'd. The command line, if provided, is reported
+// to watchers. Returns an error if the process does not exist.
+func (s *Source) Exec(pid int, executable string, cmdline ...string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	p, ok := s.procs[pid]
+	if !ok {
+		return fmt.Errorf("Process with pid %d does not exist", pid)
+	}
+	p.executable = executable
+	ev := proctree.SourceEvent{Type: proctree.SourceExec, Pid: pid, PPid: p.ppid, Executable: executable}
+	if len(cmdline) > 0 {
+		ev.Cmdline = append([]string{}, cmdline...)
+	}
+	s.lockedEmit(ev)
+	return nil
+}
+
+// Reparent changes the parent of a process. Returns an error if the process does not exist.
+func (s *Source) Reparent(pid int, ppid int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	p, ok := s.procs[pid]
+	if !ok {
+		return fmt.Errorf("Process with pid %d does not exist", pid)
+	}
+	p.ppid = ppid
+	return nil
+}
+
+// Exit removes a process, reporting its exit code to watchers, and reparents its children to init. Returns an
+// error if the process does not exist, or if it is init.
+func (s *Source) Exit(pid int, code int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	p, ok := s.procs[pid]
+	if !ok {
+		return fmt.Errorf("Process with pid %d does not exist", pid)
+	}
+	if pid == InitPid {
+		return fmt.Errorf("Init cannot exit")
+	}
+	delete(s.procs, pid)
+	for _, child := range s.procs {
+		if child.ppid == pid {
+			child.ppid = InitPid
+		}
+	}
+	s.lockedEmit(proctree.SourceEvent{
+		Type:       proctree.SourceExit,
+		Pid:        pid,
+		PPid:       p.ppid,
+		Executable: p.executable,
+		ExitStatus: &proctree.ExitStatus{Code: code},
+	})
+	return nil
+}
+
+// Pids returns the pids of the processes in the Source, in ascending order.
+func (s *Source) Pids() []int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	pids := make([]int, 0, len(s.procs))
+	for pid := range s.procs {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+	return pids
+}
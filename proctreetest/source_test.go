@@ -0,0 +1,180 @@
+package proctreetest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sammck-go/proctree"
+)
+
+// drainEvents returns the events that have been delivered to a subscription.
+func drainEvents(sub *proctree.Subscription) []proctree.Event {
+	events := []proctree.Event{}
+	for {
+		select {
+		case ev := <-sub.Events():
+			events = append(events, ev)
+		default:
+			return events
+		}
+	}
+}
+
+func newTree(t *testing.T, src *Source) (*proctree.ProcTree, *proctree.Subscription) {
+	pt, err := proctree.New(proctree.WithProcessSource(src))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	sub, err := pt.Subscribe()
+	if err != nil {
+		pt.Close()
+		t.Fatalf("Subscribe() returned error: %s", err)
+	}
+	return pt, sub
+}
+
+func TestForkExecExit(t *testing.T) {
+	src := NewSource()
+	pt, sub := newTree(t, src)
+	defer pt.Close()
+	defer sub.Close()
+
+	shell := src.Fork(InitPid, "sh")
+	child := src.Fork(shell, "sleep")
+	err := pt.Update(false)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+	events := drainEvents(sub)
+	if len(events) != 2 || events[0].Type != proctree.ProcessStarted || events[1].Type != proctree.ProcessStarted {
+		t.Fatalf("Update() produced events %v, expected two started events", events)
+	}
+	shellProc, childProc := pt.PidProcess(shell), pt.PidProcess(child)
+	if childProc.Parent() != shellProc {
+		t.Fatalf("Parent() of child returned %v, expected %v", childProc.Parent(), shellProc)
+	}
+
+	src.Exec(child, "make")
+	src.Exit(shell, 1)
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+	types := map[proctree.EventType]*proctree.Process{}
+	for _, ev := range drainEvents(sub) {
+		types[ev.Type] = ev.Process
+	}
+	if types[proctree.ProcessExited] != shellProc || types[proctree.ProcessReparented] != childProc ||
+		types[proctree.ProcessExeced] != childProc {
+		t.Errorf("Update() produced events %v, expected exit of shell, and reparent and exec of child", types)
+	}
+	if childProc.Parent() != pt.PidProcess(InitPid) || childProc.OrigParent() != shellProc {
+		t.Errorf("Child has parent %v and original parent %v after its parent exited", childProc.Parent(), childProc.OrigParent())
+	}
+	if childProc.Executable() != "make" {
+		t.Errorf("Executable() of child returned %q, expected \"make\"", childProc.Executable())
+	}
+
+	// The tombstone is pruned by the next pruning update
+	err = pt.Update(true)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+	if pt.PidProcess(shell) != nil {
+		t.Errorf("Tombstone of shell was not pruned")
+	}
+}
+
+func TestPidReuse(t *testing.T) {
+	src := NewSource()
+	pt, sub := newTree(t, src)
+	defer pt.Close()
+	defer sub.Close()
+
+	pid := src.Fork(InitPid, "old")
+	pt.Update(false)
+	old := pt.PidProcess(pid)
+	drainEvents(sub)
+
+	src.Exit(pid, 0)
+	err := src.Spawn(pid, InitPid, "new")
+	if err != nil {
+		t.Fatalf("Spawn() returned error: %s", err)
+	}
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+	proc := pt.PidProcess(pid)
+	if proc == nil || proc == old || proc.Executable() != "new" {
+		t.Fatalf("PidProcess() returned %v after pid reuse, expected a new Process", proc)
+	}
+	types := map[proctree.EventType]*proctree.Process{}
+	for _, ev := range drainEvents(sub) {
+		types[ev.Type] = ev.Process
+	}
+	if len(types) != 2 || types[proctree.ProcessExited] != old || types[proctree.ProcessStarted] != proc {
+		t.Errorf("Update() produced events %v, expected exit of the old Process and start of the new one", types)
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	src := NewSource()
+	pt, sub := newTree(t, src)
+	defer pt.Close()
+	defer sub.Close()
+
+	if src.Spawn(InitPid, 0, "init") == nil {
+		t.Errorf("Spawn() of an existing pid did not return an error")
+	}
+	if src.Exit(InitPid, 0) == nil {
+		t.Errorf("Exit() of init did not return an error")
+	}
+	if src.Exec(999, "sh") == nil || src.Reparent(999, InitPid) == nil || src.Exit(999, 0) == nil {
+		t.Errorf("Changes to a nonexistent process did not return an error")
+	}
+
+	src.SetError(fmt.Errorf("Unreadable"))
+	if pt.Update(false) == nil {
+		t.Errorf("Update() did not return the error of the source")
+	}
+	src.SetError(nil)
+	if pt.Update(false) != nil {
+		t.Errorf("Update() returned an error after the error of the source was cleared")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	src := NewSource()
+	pt, err := proctree.New(proctree.WithProcessSource(src), proctree.WithRealtimeMonitor())
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+	sub, err := pt.Subscribe()
+	if err != nil {
+		t.Fatalf("Subscribe() returned error: %s", err)
+	}
+	defer sub.Close()
+
+	timeout := time.After(5 * time.Second)
+	for src.Watchers() == 0 {
+		select {
+		case <-timeout:
+			t.Fatalf("Timed out waiting for the ProcTree to watch the source")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	pid := src.Fork(InitPid, "sh")
+	for {
+		select {
+		case ev := <-sub.Events():
+			if ev.Type == proctree.ProcessStarted && ev.Process.Pid() == pid {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for process %d to start", pid)
+		}
+	}
+}
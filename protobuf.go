@@ -0,0 +1,404 @@
+package proctree
+
+import (
+	"fmt"
+	"time"
+)
+
+// The protobuf encoding follows the schema in proctree.proto. Messages are encoded and decoded directly in the
+// protobuf wire format, so that generated code is not required.
+
+// Protobuf wire types.
+const (
+	protoWireVarint  = 0
+	protoWireFixed64 = 1
+	protoWireBytes   = 2
+	protoWireFixed32 = 5
+)
+
+// Field numbers of the Tree message.
+const (
+	protoTreeRoots = 1
+)
+
+// Field numbers of the Process message.
+const (
+	protoProcessPid        = 1
+	protoProcessPPid       = 2
+	protoProcessExecutable = 3
+	protoProcessCmdline    = 4
+	protoProcessUID        = 5
+	protoProcessExecCount  = 6
+	protoProcessTombstone  = 7
+	protoProcessExitStatus = 8
+	protoProcessChildren   = 9
+)
+
+// Field numbers of the ExitStatus message.
+const (
+	protoExitStatusCode       = 1
+	protoExitStatusSignal     = 2
+	protoExitStatusCoreDumped = 3
+)
+
+// Field numbers of the Event message.
+const (
+	protoEventType         = 1
+	protoEventProcess      = 2
+	protoEventTime         = 3
+	protoEventOldParentPid = 4
+	protoEventNewParentPid = 5
+)
+
+func protoAppendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func protoAppendTag(b []byte, field int, wireType int) []byte {
+	return protoAppendVarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+// protoAppendInt appends an int64 or int32 field, unless it has the default value of 0.
+func protoAppendInt(b []byte, field int, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	return protoAppendOptionalInt(b, field, v)
+}
+
+// protoAppendOptionalInt appends an int64 field with explicit presence, even if it is 0.
+func protoAppendOptionalInt(b []byte, field int, v int64) []byte {
+	b = protoAppendTag(b, field, protoWireVarint)
+	return protoAppendVarint(b, uint64(v))
+}
+
+// protoAppendSint appends a zigzag-encoded sint32 or sint64 field, unless it has the default value of 0.
+func protoAppendSint(b []byte, field int, v int64) []byte {
+	return protoAppendInt(b, field, int64(uint64(v<<1)^uint64(v>>63)))
+}
+
+func protoAppendBool(b []byte, field int, v bool) []byte {
+	if !v {
+		return b
+	}
+	return protoAppendInt(b, field, 1)
+}
+
+func protoAppendBytes(b []byte, field int, v []byte) []byte {
+	b = protoAppendTag(b, field, protoWireBytes)
+	b = protoAppendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// protoAppendString appends a string field, unless it has the default value of "".
+func protoAppendString(b []byte, field int, v string) []byte {
+	if v == "" {
+		return b
+	}
+	return protoAppendBytes(b, field, []byte(v))
+}
+
+func (ep *encodedProcess) appendProto(b []byte) []byte {
+	b = protoAppendInt(b, protoProcessPid, int64(ep.Pid))
+	b = protoAppendInt(b, protoProcessPPid, int64(ep.PPid))
+	b = protoAppendString(b, protoProcessExecutable, ep.Executable)
+	for _, arg := range ep.Cmdline {
+		// Repeated strings are always present, even if empty
+		b = protoAppendBytes(b, protoProcessCmdline, []byte(arg))
+	}
+	if ep.UID != nil {
+		b = protoAppendOptionalInt(b, protoProcessUID, int64(*ep.UID))
+	}
+	b = protoAppendInt(b, protoProcessExecCount, int64(ep.ExecCount))
+	b = protoAppendBool(b, protoProcessTombstone, ep.Tombstone)
+	if ep.ExitStatus != nil {
+		var es []byte
+		es = protoAppendSint(es, protoExitStatusCode, int64(ep.ExitStatus.Code))
+		es = protoAppendInt(es, protoExitStatusSignal, int64(ep.ExitStatus.Signal))
+		es = protoAppendBool(es, protoExitStatusCoreDumped, ep.ExitStatus.CoreDumped)
+		b = protoAppendBytes(b, protoProcessExitStatus, es)
+	}
+	for _, child := range ep.Children {
+		b = protoAppendBytes(b, protoProcessChildren, child.appendProto(nil))
+	}
+	return b
+}
+
+func (et *encodedTree) appendProto(b []byte) []byte {
+	for _, root := range et.Roots {
+		b = protoAppendBytes(b, protoTreeRoots, root.appendProto(nil))
+	}
+	return b
+}
+
+func (ee *encodedEvent) appendProto(b []byte) []byte {
+	b = protoAppendInt(b, protoEventType, int64(ee.Type))
+	b = protoAppendBytes(b, protoEventProcess, ee.Process.appendProto(nil))
+	if !ee.Time.IsZero() {
+		b = protoAppendInt(b, protoEventTime, ee.Time.UnixNano())
+	}
+	if ee.OldParentPid != nil {
+		b = protoAppendOptionalInt(b, protoEventOldParentPid, int64(*ee.OldParentPid))
+	}
+	if ee.NewParentPid != nil {
+		b = protoAppendOptionalInt(b, protoEventNewParentPid, int64(*ee.NewParentPid))
+	}
+	return b
+}
+
+// protoReader decodes the fields of a protobuf message.
+type protoReader struct {
+	data []byte
+}
+
+func (r *protoReader) varint() (uint64, error) {
+	var v uint64
+	for i := 0; i < 10; i++ {
+		if i >= len(r.data) {
+			return 0, fmt.Errorf("Truncated protobuf varint")
+		}
+		c := r.data[i]
+		v |= uint64(c&0x7f) << (7 * uint(i))
+		if c < 0x80 {
+			r.data = r.data[i+1:]
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("Invalid protobuf varint")
+}
+
+// next returns the field number and wire type of the next field, or a field number of 0 at the end of the
+// message.
+func (r *protoReader) next() (int, int, error) {
+	if len(r.data) == 0 {
+		return 0, 0, nil
+	}
+	tag, err := r.varint()
+	if err != nil {
+		return 0, 0, err
+	}
+	field := int(tag >> 3)
+	if field == 0 {
+		return 0, 0, fmt.Errorf("Invalid protobuf field number 0")
+	}
+	return field, int(tag & 7), nil
+}
+
+func (r *protoReader) bytes() ([]byte, error) {
+	n, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(r.data)) {
+		return nil, fmt.Errorf("Truncated protobuf field")
+	}
+	v := r.data[:n]
+	r.data = r.data[n:]
+	return v, nil
+}
+
+// value reads the value of a field of the expected wire type. Varint values are returned as v; length-delimited
+// values are returned as data. Fields of other wire types are skipped.
+func (r *protoReader) value(wireType int, expected int) (v uint64, data []byte, ok bool, err error) {
+	switch wireType {
+	case protoWireVarint:
+		v, err = r.varint()
+	case protoWireBytes:
+		data, err = r.bytes()
+	case protoWireFixed64, protoWireFixed32:
+		n := 8
+		if wireType == protoWireFixed32 {
+			n = 4
+		}
+		if len(r.data) < n {
+			return 0, nil, false, fmt.Errorf("Truncated protobuf field")
+		}
+		r.data = r.data[n:]
+	default:
+		return 0, nil, false, fmt.Errorf("Unsupported protobuf wire type %d", wireType)
+	}
+	return v, data, err == nil && wireType == expected, err
+}
+
+// protoDecode calls handler for each field of a message, with its varint or length-delimited value. Unknown
+// fields, and fields whose wire type does not match the schema, are skipped.
+func protoDecode(data []byte, wireTypes map[int]int, handler func(field int, v uint64, data []byte) error) error {
+	r := &protoReader{data: data}
+	for {
+		field, wireType, err := r.next()
+		if err != nil {
+			return err
+		}
+		if field == 0 {
+			return nil
+		}
+		v, data, ok, err := r.value(wireType, wireTypes[field])
+		if err != nil {
+			return err
+		}
+		_, known := wireTypes[field]
+		if ok && known {
+			err = handler(field, v, data)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+var protoProcessWireTypes = map[int]int{
+	protoProcessPid:        protoWireVarint,
+	protoProcessPPid:       protoWireVarint,
+	protoProcessExecutable: protoWireBytes,
+	protoProcessCmdline:    protoWireBytes,
+	protoProcessUID:        protoWireVarint,
+	protoProcessExecCount:  protoWireVarint,
+	protoProcessTombstone:  protoWireVarint,
+	protoProcessExitStatus: protoWireBytes,
+	protoProcessChildren:   protoWireBytes,
+}
+
+var protoExitStatusWireTypes = map[int]int{
+	protoExitStatusCode:       protoWireVarint,
+	protoExitStatusSignal:     protoWireVarint,
+	protoExitStatusCoreDumped: protoWireVarint,
+}
+
+var protoTreeWireTypes = map[int]int{
+	protoTreeRoots: protoWireBytes,
+}
+
+var protoEventWireTypes = map[int]int{
+	protoEventType:         protoWireVarint,
+	protoEventProcess:      protoWireBytes,
+	protoEventTime:         protoWireVarint,
+	protoEventOldParentPid: protoWireVarint,
+	protoEventNewParentPid: protoWireVarint,
+}
+
+func decodeProtoExitStatus(data []byte) (*encodedExitStatus, error) {
+	ees := &encodedExitStatus{}
+	err := protoDecode(data, protoExitStatusWireTypes, func(field int, v uint64, data []byte) error {
+		switch field {
+		case protoExitStatusCode:
+			ees.Code = int(int64(v>>1) ^ -int64(v&1))
+		case protoExitStatusSignal:
+			ees.Signal = int(int32(v))
+		case protoExitStatusCoreDumped:
+			ees.CoreDumped = v != 0
+		}
+		return nil
+	})
+	return ees, err
+}
+
+func decodeProtoProcess(data []byte) (*encodedProcess, error) {
+	ep := &encodedProcess{}
+	err := protoDecode(data, protoProcessWireTypes, func(field int, v uint64, data []byte) error {
+		var err error
+		switch field {
+		case protoProcessPid:
+			ep.Pid = int(int64(v))
+		case protoProcessPPid:
+			ep.PPid = int(int64(v))
+		case protoProcessExecutable:
+			ep.Executable = string(data)
+		case protoProcessCmdline:
+			ep.Cmdline = append(ep.Cmdline, string(data))
+		case protoProcessUID:
+			uid := int(int64(v))
+			ep.UID = &uid
+		case protoProcessExecCount:
+			ep.ExecCount = int(int64(v))
+		case protoProcessTombstone:
+			ep.Tombstone = v != 0
+		case protoProcessExitStatus:
+			ep.ExitStatus, err = decodeProtoExitStatus(data)
+		case protoProcessChildren:
+			var child *encodedProcess
+			child, err = decodeProtoProcess(data)
+			ep.Children = append(ep.Children, child)
+		}
+		return err
+	})
+	return ep, err
+}
+
+func decodeProtoTree(data []byte) (*encodedTree, error) {
+	et := &encodedTree{Roots: []*encodedProcess{}}
+	err := protoDecode(data, protoTreeWireTypes, func(field int, v uint64, data []byte) error {
+		root, err := decodeProtoProcess(data)
+		et.Roots = append(et.Roots, root)
+		return err
+	})
+	return et, err
+}
+
+func decodeProtoEvent(data []byte) (*encodedEvent, error) {
+	ee := &encodedEvent{}
+	err := protoDecode(data, protoEventWireTypes, func(field int, v uint64, data []byte) error {
+		var err error
+		switch field {
+		case protoEventType:
+			ee.Type = EventType(int32(v))
+		case protoEventProcess:
+			ee.Process, err = decodeProtoProcess(data)
+		case protoEventTime:
+			ee.Time = time.Unix(0, int64(v))
+		case protoEventOldParentPid:
+			pid := int(int64(v))
+			ee.OldParentPid = &pid
+		case protoEventNewParentPid:
+			pid := int(int64(v))
+			ee.NewParentPid = &pid
+		}
+		return err
+	})
+	return ee, err
+}
+
+// MarshalProto encodes the included tree as a Tree message, as defined in proctree.proto.
+func (pt *ProcTree) MarshalProto() ([]byte, error) {
+	pt.prlock()
+	et := pt.lockedEncodedTree()
+	pt.prunlock()
+	return et.appendProto(nil), nil
+}
+
+// LoadProto creates a read-only ProcTree from a Tree message encoded with ProcTree.MarshalProto. The loaded
+// tree behaves as described for LoadJSON.
+func LoadProto(data []byte) (*ProcTree, error) {
+	et, err := decodeProtoTree(data)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decode process tree: %s", err)
+	}
+	return loadEncodedTree(et)
+}
+
+// MarshalProto encodes an Event as an Event message, as defined in proctree.proto.
+func (ev Event) MarshalProto() ([]byte, error) {
+	if ev.Process == nil {
+		return nil, fmt.Errorf("Unable to encode event without a process")
+	}
+	ev.Process.prlock()
+	ee := lockedEncodedEvent(&ev)
+	ev.Process.prunlock()
+	return ee.appendProto(nil), nil
+}
+
+// ApplyEventProto decodes an Event message encoded with Event.MarshalProto, and applies it to a read-only ProcTree
+// created by LoadProto or LoadJSON, so that the ProcTree follows the changes to the tree from which the event was
+// generated. The resulting Event, which refers to this ProcTree's Processes, is returned and delivered to
+// subscribers. Returns an error if the ProcTree is updated from the system, or if the event is inconsistent with
+// the tree (e.g., it refers to an unknown pid).
+func (pt *ProcTree) ApplyEventProto(data []byte) (Event, error) {
+	ee, err := decodeProtoEvent(data)
+	if err != nil {
+		return Event{}, fmt.Errorf("Unable to decode event: %s", err)
+	}
+	return pt.applyEncodedEvent(ee)
+}
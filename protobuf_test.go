@@ -0,0 +1,108 @@
+package proctree
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func TestProtoProcessRoundTrip(t *testing.T) {
+	uid := 0
+	ep := &encodedProcess{
+		Pid:        1234,
+		PPid:       1,
+		Executable: "sh",
+		Cmdline:    []string{"sh", "", "-c"},
+		UID:        &uid,
+		ExecCount:  2,
+		Tombstone:  true,
+		ExitStatus: &encodedExitStatus{Code: -1, Signal: 9, CoreDumped: true},
+		Children:   []*encodedProcess{{Pid: 1235, PPid: 1234, Executable: "sleep"}},
+	}
+	decoded, err := decodeProtoProcess(ep.appendProto(nil))
+	if err != nil {
+		t.Fatalf("decodeProtoProcess() returned error: %s", err)
+	}
+	if !reflect.DeepEqual(ep, decoded) {
+		t.Errorf("Decoded process %+v does not match encoded process %+v", decoded, ep)
+	}
+}
+
+func TestProtoTreeAndEvents(t *testing.T) {
+	pt, err := New()
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+	sub, err := pt.Subscribe()
+	if err != nil {
+		t.Fatalf("pt.Subscribe() returned error: %s", err)
+	}
+
+	data, err := pt.MarshalProto()
+	if err != nil {
+		t.Fatalf("pt.MarshalProto() returned error: %s", err)
+	}
+	replica, err := LoadProto(data)
+	if err != nil {
+		t.Fatalf("LoadProto() returned error: %s", err)
+	}
+	defer replica.Close()
+	expected, _ := json.Marshal(pt)
+	actual, _ := json.Marshal(replica)
+	if !bytes.Equal(expected, actual) {
+		t.Fatalf("Loaded tree does not match encoded tree")
+	}
+
+	cmd := exec.Command("sleep", "10")
+	err = cmd.Start()
+	if err != nil {
+		t.Fatalf("cmd.Start() returned error: %s", err)
+	}
+	pid := cmd.Process.Pid
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("pt.Update() returned error: %s", err)
+	}
+	cmd.Process.Kill()
+	cmd.Wait()
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("pt.Update() returned error: %s", err)
+	}
+
+	// Replay the events for the command on the replica
+	for _, expectedType := range []EventType{ProcessStarted, ProcessExited} {
+		ev := nextEvent(t, sub, pid)
+		if ev.Type != expectedType {
+			t.Fatalf("Event type %s is not expected", ev.Type)
+		}
+		data, err = ev.MarshalProto()
+		if err != nil {
+			t.Fatalf("ev.MarshalProto() returned error: %s", err)
+		}
+		applied, err := replica.ApplyEventProto(data)
+		if err != nil {
+			t.Fatalf("replica.ApplyEventProto() returned error: %s", err)
+		}
+		if applied.Type != ev.Type || applied.Process.Pid() != pid || !applied.Time.Equal(ev.Time) {
+			t.Errorf("Applied event does not match encoded event")
+		}
+	}
+	proc := replica.PidProcess(pid)
+	if proc == nil || proc.Parent() == nil || proc.Parent().Pid() != pt.PidProcess(pid).Parent().Pid() {
+		t.Fatalf("Started process is not in the expected place in the replica")
+	}
+	expected, _ = json.Marshal(pt.PidProcess(pid))
+	actual, _ = json.Marshal(proc)
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("Replicated process %s does not match %s", actual, expected)
+	}
+
+	_, err = pt.ApplyEventProto(data)
+	if err == nil {
+		t.Errorf("pt.ApplyEventProto() applied an event to a live tree")
+	}
+}
@@ -0,0 +1,376 @@
+package proctree
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// queryNode is a node of a compiled query.
+type queryNode interface {
+	lockedMatch(proc *Process) bool
+}
+
+type queryAnd struct {
+	left, right queryNode
+}
+
+func (q *queryAnd) lockedMatch(proc *Process) bool {
+	return q.left.lockedMatch(proc) && q.right.lockedMatch(proc)
+}
+
+type queryOr struct {
+	left, right queryNode
+}
+
+func (q *queryOr) lockedMatch(proc *Process) bool {
+	return q.left.lockedMatch(proc) || q.right.lockedMatch(proc)
+}
+
+type queryNot struct {
+	operand queryNode
+}
+
+func (q *queryNot) lockedMatch(proc *Process) bool {
+	return !q.operand.lockedMatch(proc)
+}
+
+// queryIntCompare compares an integer field with a value.
+type queryIntCompare struct {
+	field func(proc *Process) int
+	op    string
+	value int
+}
+
+func (q *queryIntCompare) lockedMatch(proc *Process) bool {
+	v := q.field(proc)
+	switch q.op {
+	case "==":
+		return v == q.value
+	case "!=":
+		return v != q.value
+	case "<":
+		return v < q.value
+	case "<=":
+		return v <= q.value
+	case ">":
+		return v > q.value
+	default:
+		return v >= q.value
+	}
+}
+
+// queryStringCompare compares a string field with a value.
+type queryStringCompare struct {
+	field func(proc *Process) string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+func (q *queryStringCompare) lockedMatch(proc *Process) bool {
+	v := q.field(proc)
+	switch q.op {
+	case "==":
+		return v == q.value
+	case "!=":
+		return v != q.value
+	case "~", "!~":
+		matched, _ := path.Match(q.value, v)
+		return matched == (q.op == "~")
+	default:
+		return q.re.MatchString(v)
+	}
+}
+
+var queryIntFields = map[string]func(proc *Process) int{
+	"pid":   (*Process).lockedPid,
+	"ppid":  func(proc *Process) int { return proc.gopsProcess.PPid() },
+	"depth": (*Process).lockedDepth,
+	"uid":   (*Process).lockedUID,
+	"execs": (*Process).lockedExecCount,
+}
+
+var queryStringFields = map[string]func(proc *Process) string{
+	"exe": (*Process).lockedExecutable,
+	"cmdline": func(proc *Process) string {
+		return strings.Join(proc.lockedSystemCmdline(), " ")
+	},
+}
+
+// queryToken is a lexical token of a query: an operator or parenthesis, an identifier, a number, or a quoted
+// string (which retains its quotes).
+type queryToken struct {
+	text string
+	pos  int
+}
+
+var queryOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "~", "!", "(", ")"}
+
+func lexQuery(expr string) ([]queryToken, error) {
+	tokens := []queryToken{}
+	i := 0
+	for i < len(expr) {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"':
+			j := i + 1
+			for j < len(expr) && expr[j] != '"' {
+				if expr[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(expr) {
+				return nil, fmt.Errorf("Unterminated string at offset %d", i)
+			}
+			tokens = append(tokens, queryToken{text: expr[i : j+1], pos: i})
+			i = j + 1
+		case c == '_' || c == '-' || unicode.IsLetter(c) || unicode.IsDigit(c):
+			j := i
+			for j < len(expr) && (expr[j] == '_' || expr[j] == '-' || unicode.IsLetter(rune(expr[j])) || unicode.IsDigit(rune(expr[j]))) {
+				j++
+			}
+			tokens = append(tokens, queryToken{text: expr[i:j], pos: i})
+			i = j
+		default:
+			found := false
+			for _, op := range queryOperators {
+				if strings.HasPrefix(expr[i:], op) {
+					tokens = append(tokens, queryToken{text: op, pos: i})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("Unexpected character %q at offset %d", c, i)
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// queryParser is a recursive-descent parser for queries.
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+
+	// usesUID is set if the query refers to the user of a Process.
+	usesUID bool
+}
+
+func (qp *queryParser) peek() string {
+	if qp.pos >= len(qp.tokens) {
+		return ""
+	}
+	return qp.tokens[qp.pos].text
+}
+
+func (qp *queryParser) next() (queryToken, error) {
+	if qp.pos >= len(qp.tokens) {
+		return queryToken{}, fmt.Errorf("Unexpected end of query")
+	}
+	tok := qp.tokens[qp.pos]
+	qp.pos++
+	return tok, nil
+}
+
+func (qp *queryParser) parseOr() (queryNode, error) {
+	left, err := qp.parseAnd()
+	for err == nil && qp.peek() == "||" {
+		qp.pos++
+		var right queryNode
+		right, err = qp.parseAnd()
+		left = &queryOr{left: left, right: right}
+	}
+	return left, err
+}
+
+func (qp *queryParser) parseAnd() (queryNode, error) {
+	left, err := qp.parseUnary()
+	for err == nil && qp.peek() == "&&" {
+		qp.pos++
+		var right queryNode
+		right, err = qp.parseUnary()
+		left = &queryAnd{left: left, right: right}
+	}
+	return left, err
+}
+
+func (qp *queryParser) parseUnary() (queryNode, error) {
+	switch qp.peek() {
+	case "!":
+		qp.pos++
+		operand, err := qp.parseUnary()
+		return &queryNot{operand: operand}, err
+	case "(":
+		qp.pos++
+		node, err := qp.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		tok, err := qp.next()
+		if err != nil {
+			return nil, err
+		}
+		if tok.text != ")" {
+			return nil, fmt.Errorf("Expected \")\" at offset %d", tok.pos)
+		}
+		return node, nil
+	default:
+		return qp.parseComparison()
+	}
+}
+
+func (qp *queryParser) parseComparison() (queryNode, error) {
+	fieldTok, err := qp.next()
+	if err != nil {
+		return nil, err
+	}
+	opTok, err := qp.next()
+	if err != nil {
+		return nil, err
+	}
+	valueTok, err := qp.next()
+	if err != nil {
+		return nil, err
+	}
+	field, op, value := fieldTok.text, opTok.text, valueTok.text
+	invalidOp := fmt.Errorf("Invalid operator %q for field %q at offset %d", op, field, opTok.pos)
+
+	if intField, ok := queryIntFields[field]; ok {
+		switch op {
+		case "==", "!=", "<", "<=", ">", ">=":
+		default:
+			return nil, invalidOp
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("Expected an integer at offset %d", valueTok.pos)
+		}
+		if field == "uid" {
+			qp.usesUID = true
+		}
+		return &queryIntCompare{field: intField, op: op, value: n}, nil
+	}
+
+	if stringField, ok := queryStringFields[field]; ok {
+		s, err := strconv.Unquote(value)
+		if err != nil || !strings.HasPrefix(value, "\"") {
+			return nil, fmt.Errorf("Expected a quoted string at offset %d", valueTok.pos)
+		}
+		q := &queryStringCompare{field: stringField, op: op, value: s}
+		switch op {
+		case "==", "!=":
+		case "~", "!~":
+			_, err = path.Match(s, "")
+			if err != nil {
+				return nil, fmt.Errorf("Invalid glob pattern %s at offset %d: %s", value, valueTok.pos, err)
+			}
+		case "=~":
+			q.re, err = regexp.Compile(s)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid regular expression %s at offset %d: %s", value, valueTok.pos, err)
+			}
+		default:
+			return nil, invalidOp
+		}
+		return q, nil
+	}
+
+	switch field {
+	case "user":
+		if op != "==" && op != "!=" {
+			return nil, invalidOp
+		}
+		name, err := strconv.Unquote(value)
+		if err != nil {
+			name = value
+		}
+		uid, err := lookupUID(name)
+		if err != nil {
+			return nil, err
+		}
+		qp.usesUID = true
+		return &queryIntCompare{field: (*Process).lockedUID, op: op, value: uid}, nil
+	case "alive":
+		if op != "==" && op != "!=" {
+			return nil, invalidOp
+		}
+		alive, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("Expected true or false at offset %d", valueTok.pos)
+		}
+		q := queryNode(&queryAlive{})
+		if alive != (op == "==") {
+			q = &queryNot{operand: q}
+		}
+		return q, nil
+	}
+	return nil, fmt.Errorf("Unknown field %q at offset %d", field, fieldTok.pos)
+}
+
+type queryAlive struct{}
+
+func (q *queryAlive) lockedMatch(proc *Process) bool {
+	return !proc.isTombstone
+}
+
+// compileQuery parses a query. Returns the compiled query, and whether it refers to the user of a Process.
+func compileQuery(expr string) (queryNode, bool, error) {
+	tokens, err := lexQuery(expr)
+	if err != nil {
+		return nil, false, err
+	}
+	qp := &queryParser{tokens: tokens}
+	node, err := qp.parseOr()
+	if err != nil {
+		return nil, false, err
+	}
+	if qp.pos < len(tokens) {
+		return nil, false, fmt.Errorf("Unexpected %q at offset %d", tokens[qp.pos].text, tokens[qp.pos].pos)
+	}
+	return node, qp.usesUID, nil
+}
+
+// Query returns the included Processes that match a query expression, sorted by pid. A query is a boolean
+// expression over the fields of a Process, e.g.:
+//
+//	exe ~ "nginx*" && user == "www-data" && depth < 3
+//
+// Comparisons are combined with && (and), || (or) and ! (not), and may be grouped with parentheses. The
+// fields are:
+//
+//	pid, ppid, depth, uid, execs    integers, compared with ==, !=, <, <=, >, >=
+//	exe, cmdline                    strings, compared with ==, !=, ~ (glob match), !~ (glob mismatch)
+//	                                and =~ (regular expression match)
+//	user                            a user name or numeric user id, compared with == and !=
+//	alive                           true or false, compared with == and !=
+//
+// String values are double-quoted, with Go escape sequences. Globs use the syntax of path.Match, and regular
+// expressions the syntax of the regexp package. Depth is the depth in the included tree (see Process.Depth),
+// execs is the number of observed execs (see Process.ExecCount), and cmdline is the command line with
+// arguments joined by spaces, as matched by FindByCmdline. Returns an error if the query is malformed, or if it
+// refers to the user of a Process on a platform that does not support user ids (see FindByUser).
+func (pt *ProcTree) Query(expr string) ([]*Process, error) {
+	node, usesUID, err := compileQuery(expr)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid query %q: %s", expr, err)
+	}
+	pt.plock()
+	defer pt.punlock()
+	if usesUID && !pt.readOnly {
+		_, err = defaultProcfs.processUID(os.Getpid())
+		if err != nil {
+			return nil, fmt.Errorf("Unable to query processes by user: %s", err)
+		}
+	}
+	return pt.lockedFind(node.lockedMatch), nil
+}
@@ -0,0 +1,58 @@
+package proctree
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	pt, err := LoadJSON(strings.NewReader(`{"roots":[{"pid":1,"executable":"init","uid":0,"children":[
+		{"pid":10,"ppid":1,"executable":"nginx","uid":33,"children":[
+			{"pid":12,"ppid":10,"executable":"nginx-worker","uid":33,"cmdline":["nginx: worker","process"]}]},
+		{"pid":11,"ppid":1,"executable":"cron","uid":0,"tombstone":true}]}]}`))
+	if err != nil {
+		t.Fatalf("LoadJSON() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	tests := []struct {
+		expr string
+		pids []int
+	}{
+		{`exe ~ "nginx*" && uid == 33 && depth < 2`, []int{10}},
+		{`exe ~ "nginx*" || pid == 1`, []int{1, 10, 12}},
+		{`!(exe ~ "nginx*") && alive == true`, []int{1}},
+		{`alive == false`, []int{11}},
+		{`ppid != 1 && cmdline =~ "^nginx: w"`, []int{12}},
+		{`user == 0 && depth >= 1`, []int{11}},
+		{`exe !~ "*n*"`, []int{}},
+	}
+	for _, test := range tests {
+		procs, err := pt.Query(test.expr)
+		if err != nil {
+			t.Errorf("pt.Query(%q) returned error: %s", test.expr, err)
+			continue
+		}
+		pids := []int{}
+		for _, proc := range procs {
+			pids = append(pids, proc.Pid())
+		}
+		if len(pids) != len(test.pids) {
+			t.Errorf("pt.Query(%q) returned pids %v, expected %v", test.expr, pids, test.pids)
+			continue
+		}
+		for i := range pids {
+			if pids[i] != test.pids[i] {
+				t.Errorf("pt.Query(%q) returned pids %v, expected %v", test.expr, pids, test.pids)
+				break
+			}
+		}
+	}
+
+	for _, expr := range []string{``, `pid ==`, `pid == "1"`, `exe < "a"`, `exe ~ "["`, `(pid == 1`, `pid == 1 pid`, `bogus == 1`, `exe == "x`} {
+		_, err := pt.Query(expr)
+		if err == nil {
+			t.Errorf("pt.Query(%q) did not return an error", expr)
+		}
+	}
+}
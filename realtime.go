@@ -0,0 +1,233 @@
+package proctree
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// notificationKind identifies the kind of process change reported by a real-time backend.
+type notificationKind int
+
+const (
+	notificationFork notificationKind = iota
+	notificationExec
+	notificationExit
+)
+
+// procNotification is a process change reported by a real-time backend.
+type procNotification struct {
+	// kind is the kind of change.
+	kind notificationKind
+
+	// pid is the pid of the process that forked, exec'd or exited. For fork notifications it is the new child,
+	// or 0 if the backend only knows which process forked.
+	pid int
+
+	// parentPid is the pid of the parent of a newly forked process, or 0 if not known.
+	parentPid int
+
+	// exitStatus is the exit status of an exited process, or nil if not known.
+	exitStatus *ExitStatus
+
+	// executable is the executable name of the process, or "" if not known.
+	executable string
+
+	// cmdline is the command line of a process that exec'd, or nil if not known.
+	cmdline []string
+}
+
+// maxPendingCmdlines bounds the number of command lines reported by exec notifications that are held for
+// processes that have not yet been discovered by an update.
+const maxPendingCmdlines = 4096
+
+// startRealtimeBackend creates and starts a real-time backend, if it is available, which invokes notify
+// for each process change until the ProcTree is closed. notify is called from a background goroutine.
+func (pt *ProcTree) startRealtimeBackend(newBackend func() (realtimeBackend, error), notify func(procNotification)) error {
+	backend, err := newBackend()
+	if err != nil {
+		return err
+	}
+
+	// Backends that must be told which processes to watch start with every live process in the tree;
+	// processes discovered by later updates are added as they are found.
+	pt.plock()
+	pt.rtBackend = backend
+	for _, proc := range pt.absProcs {
+		if !proc.isTombstone {
+			backend.watch(proc.lockedPid(), proc.gopsProcess.PPid())
+		}
+	}
+	pt.punlock()
+
+	pt.wg.Add(2)
+	go func() {
+		defer pt.wg.Done()
+		<-pt.done
+		backend.close()
+	}()
+	go func() {
+		defer pt.wg.Done()
+		backend.run(notify)
+	}()
+	return nil
+}
+
+// realtimeBackend is a platform-specific source of real-time process change notifications.
+type realtimeBackend interface {
+	// run reads notifications and invokes notify for each one, until the backend is closed.
+	run(notify func(procNotification))
+
+	// watch asks the backend to report changes to a specific process, for backends that cannot observe
+	// all processes at once. Called with the tree lock held, so it must not block.
+	watch(pid int, parentPid int)
+
+	// close shuts down the backend, causing run to return.
+	close() error
+}
+
+// applyNotification merges information carried by a real-time notification into the tree. Command lines
+// reported by exec notifications are attached to their Processes, and exit statuses reported by exit
+// notifications are recorded on their Processes. Exit notifications that carry an executable
+// name (i.e., from the eBPF backend) for processes that were never seen by an update produce transient
+// Processes, which are added to the tree as tombstones with their command line and exit status, and reported
+// to subscribers as started and exited.
+func (pt *ProcTree) applyNotification(n procNotification) {
+	pt.plock()
+	switch n.kind {
+	case notificationExec:
+		if n.cmdline != nil {
+			proc, ok := pt.pidMap[n.pid]
+			if ok && !proc.isTombstone {
+				proc.cmdline = n.cmdline
+				proc.lockedInvalidateMetadata()
+			}
+			if len(pt.pendingCmdlines) < maxPendingCmdlines {
+				pt.pendingCmdlines[n.pid] = n.cmdline
+			}
+		}
+	case notificationExit:
+		proc, ok := pt.pidMap[n.pid]
+		if ok && n.exitStatus != nil && proc.exitStatus == nil &&
+			(!proc.isTombstone || n.executable == "" || n.executable == proc.lockedExecutable()) {
+			// The Process may already have been tombstoned by an update that ran before the notification
+			// was delivered
+			proc.exitStatus = n.exitStatus
+		} else if n.executable != "" && (!ok || proc.isTombstone) {
+			pt.lockedAddTransient(n)
+		}
+		delete(pt.pendingCmdlines, n.pid)
+	}
+	pt.punlockAndDispatch()
+}
+
+// lockedAddTransient adds a tombstoned Process for a process that exited before it was discovered by an update,
+// and queues events reporting that it started and exited. The transient replaces a tombstone with the same pid,
+// but is not added if the pid belongs to a live Process. It is linked into its parent's child lists, and the
+// included lists and counts of the tree, as an update would link it, so that walks and counts include it before
+// the next update.
+func (pt *ProcTree) lockedAddTransient(n procNotification) {
+	if !pt.cfg.includeKernelThreads && (n.pid == kthreadPid || n.parentPid == kthreadPid) {
+		return
+	}
+	old, ok := pt.pidMap[n.pid]
+	if ok && !old.isTombstone {
+		return
+	}
+	if ok {
+		pt.lockedUnlinkTombstone(old)
+		pt.lockedPruneTombstone(n.pid, old)
+	}
+	proc := newProcess(pt, &staticProcess{pid: n.pid, ppid: n.parentPid, executable: n.executable})
+	proc.isTombstone = true
+	// Scans that started before the exit was reported may still list the process, and must not revive it
+	proc.exitScanSeq = atomic.LoadUint64(&pt.scanSeq)
+	now := pt.clock.Now()
+	proc.firstSeen, proc.lastSeen = now, now
+	pt.generation++
+	proc.changedGen = pt.generation
+	proc.exitStatus = n.exitStatus
+	proc.cmdline = pt.pendingCmdlines[n.pid]
+	var pproc *Process
+	if n.parentPid != n.pid {
+		pproc = pt.pidMap[n.parentPid]
+	}
+	proc.parentProc = pproc
+	proc.origParentProc = pproc
+	proc.isIncluded = !pt.cfg.hasRoots() || (pproc != nil && pproc.isIncluded)
+	pt.pidMap[n.pid] = proc
+	pt.counts.Total++
+
+	less := pt.lockedChildLess()
+	if pproc != nil {
+		pproc.absChildProcs = insertProc(pproc.absChildProcs, proc, less)
+	}
+	if proc.isIncluded {
+		pt.includedProcs = insertProc(pt.includedProcs, proc, lessByPid)
+		if pproc != nil && pproc.isIncluded {
+			pproc.includedChildProcs = insertProc(pproc.includedChildProcs, proc, less)
+		} else {
+			pt.includedRootProcs = insertProc(pt.includedRootProcs, proc, lessByPid)
+			pt.counts.Roots++
+		}
+		pt.counts.Included++
+		pt.counts.Tombstones++
+		proc.subtreeCount = 1
+		pt.lockedAdjustAncestorSubtreeCounts(proc, 1)
+	}
+	pt.lockedQueueEvents(map[*Process]eventMask{proc: eventMaskStarted | eventMaskExited})
+}
+
+// lockedUnlinkTombstone removes a tombstone from its parent's child lists, and from the included lists and counts
+// of the tree, before it is replaced by a transient Process with the same pid. A tombstone with children is
+// replaced in the child lists of its parent only; its children are relinked by the next update.
+func (pt *ProcTree) lockedUnlinkTombstone(proc *Process) {
+	pt.counts.Total--
+	if pproc := proc.parentProc; pproc != nil {
+		pproc.absChildProcs = removeProc(pproc.absChildProcs, proc)
+		pproc.includedChildProcs = removeProc(pproc.includedChildProcs, proc)
+	}
+	if proc.isIncluded {
+		pt.includedProcs = removeProc(pt.includedProcs, proc)
+		n := len(pt.includedRootProcs)
+		pt.includedRootProcs = removeProc(pt.includedRootProcs, proc)
+		if len(pt.includedRootProcs) != n {
+			pt.counts.Roots--
+		}
+		pt.counts.Included--
+		pt.counts.Tombstones--
+		pt.lockedAdjustAncestorSubtreeCounts(proc, -proc.subtreeCount)
+	}
+}
+
+// lockedAdjustAncestorSubtreeCounts adds delta to the subtree count of each included ancestor of a Process.
+func (pt *ProcTree) lockedAdjustAncestorSubtreeCounts(proc *Process, delta int) {
+	proc.lockedForEachAncestor(false, func(ancestor *Process) bool {
+		if !ancestor.isIncluded {
+			return false
+		}
+		ancestor.subtreeCount += delta
+		return true
+	})
+}
+
+// insertProc inserts a Process into a slice of Processes that is sorted by less, and returns the result.
+func insertProc(procs []*Process, proc *Process, less func(p, q *Process) bool) []*Process {
+	i := sort.Search(len(procs), func(i int) bool { return less(proc, procs[i]) })
+	procs = append(procs, nil)
+	copy(procs[i+1:], procs[i:])
+	procs[i] = proc
+	return procs
+}
+
+// removeProc removes a Process from a slice of Processes, preserving the order of the others, and returns the
+// result.
+func removeProc(procs []*Process, proc *Process) []*Process {
+	for i, p := range procs {
+		if p == proc {
+			copy(procs[i:], procs[i+1:])
+			procs[len(procs)-1] = nil
+			return procs[:len(procs)-1]
+		}
+	}
+	return procs
+}
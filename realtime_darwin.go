@@ -0,0 +1,21 @@
+package proctree
+
+import (
+	"syscall"
+)
+
+// kqueueProcFflags returns the EVFILT_PROC flags used to watch a process. Darwin does not support NOTE_TRACK,
+// so forks are reported without the child pid, and the child is registered by the resulting update. Exit
+// statuses are only available for children of the calling process.
+func kqueueProcFflags(isChild bool) uint32 {
+	fflags := uint32(syscall.NOTE_EXIT | syscall.NOTE_FORK | syscall.NOTE_EXEC)
+	if isChild {
+		fflags |= syscall.NOTE_EXITSTATUS
+	}
+	return fflags
+}
+
+// kqueueExitStatusValid returns true if a NOTE_EXIT event carries the exit status of the process.
+func kqueueExitStatusValid(fflags uint32) bool {
+	return fflags&syscall.NOTE_EXITSTATUS != 0
+}
@@ -0,0 +1,17 @@
+package proctree
+
+import (
+	"syscall"
+)
+
+// kqueueProcFflags returns the EVFILT_PROC flags used to watch a process. NOTE_TRACK causes children to be
+// watched automatically, reporting NOTE_CHILD with the parent pid as soon as they are forked.
+func kqueueProcFflags(isChild bool) uint32 {
+	return uint32(syscall.NOTE_EXIT | syscall.NOTE_FORK | syscall.NOTE_EXEC | syscall.NOTE_TRACK)
+}
+
+// kqueueExitStatusValid returns true if a NOTE_EXIT event carries the exit status of the process, which
+// is always the case on FreeBSD.
+func kqueueExitStatusValid(fflags uint32) bool {
+	return true
+}
@@ -0,0 +1,96 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package proctree
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// kqueueWakeIdent is the identifier of the EVFILT_USER event used to wake the backend when it is closed.
+const kqueueWakeIdent = 0
+
+// kqueueBackend is a real-time backend that receives fork, exec and exit notifications through kqueue
+// EVFILT_PROC filters. Each process must be registered individually with watch.
+type kqueueBackend struct {
+	kq int
+}
+
+// newRealtimeBackend creates the real-time backend for this platform, using kqueue process filters.
+func newRealtimeBackend() (realtimeBackend, error) {
+	kq, err := syscall.Kqueue()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create kqueue: %s", err)
+	}
+	syscall.CloseOnExec(kq)
+	var ev syscall.Kevent_t
+	syscall.SetKevent(&ev, kqueueWakeIdent, syscall.EVFILT_USER, syscall.EV_ADD|syscall.EV_CLEAR)
+	_, err = syscall.Kevent(kq, []syscall.Kevent_t{ev}, nil, nil)
+	if err != nil {
+		syscall.Close(kq)
+		return nil, fmt.Errorf("Unable to register kqueue wakeup event: %s", err)
+	}
+	kb := &kqueueBackend{
+		kq: kq,
+	}
+	return kb, nil
+}
+
+// watch registers an EVFILT_PROC filter for a process. Errors are ignored, since the process may already
+// have exited; the next update will tombstone it.
+func (kb *kqueueBackend) watch(pid int, parentPid int) {
+	var ev syscall.Kevent_t
+	syscall.SetKevent(&ev, pid, syscall.EVFILT_PROC, syscall.EV_ADD|syscall.EV_CLEAR)
+	ev.Fflags = kqueueProcFflags(parentPid == os.Getpid())
+	syscall.Kevent(kb.kq, []syscall.Kevent_t{ev}, nil, nil)
+}
+
+func (kb *kqueueBackend) run(notify func(procNotification)) {
+	defer syscall.Close(kb.kq)
+	events := make([]syscall.Kevent_t, 64)
+	for {
+		n, err := syscall.Kevent(kb.kq, nil, events, nil)
+		if err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			return
+		}
+		for _, ev := range events[:n] {
+			if ev.Filter == syscall.EVFILT_USER {
+				return
+			}
+			if ev.Filter != syscall.EVFILT_PROC {
+				continue
+			}
+			pid := int(ev.Ident)
+			if ev.Fflags&syscall.NOTE_FORK != 0 {
+				notify(procNotification{kind: notificationFork, pid: 0, parentPid: pid})
+			}
+			if ev.Fflags&syscall.NOTE_CHILD != 0 {
+				notify(procNotification{kind: notificationFork, pid: pid, parentPid: int(ev.Data)})
+			}
+			if ev.Fflags&syscall.NOTE_EXEC != 0 {
+				notify(procNotification{kind: notificationExec, pid: pid})
+			}
+			if ev.Fflags&syscall.NOTE_EXIT != 0 {
+				pn := procNotification{kind: notificationExit, pid: pid}
+				if kqueueExitStatusValid(ev.Fflags) {
+					pn.exitStatus = newExitStatus(syscall.WaitStatus(ev.Data))
+				}
+				notify(pn)
+			}
+		}
+	}
+}
+
+// close wakes the run loop, which closes the kqueue and returns.
+func (kb *kqueueBackend) close() error {
+	var ev syscall.Kevent_t
+	syscall.SetKevent(&ev, kqueueWakeIdent, syscall.EVFILT_USER, 0)
+	ev.Fflags = syscall.NOTE_TRIGGER
+	_, err := syscall.Kevent(kb.kq, []syscall.Kevent_t{ev}, nil, nil)
+	return err
+}
@@ -0,0 +1,168 @@
+package proctree
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Constants from linux/connector.h and linux/cn_proc.h
+const (
+	cnIdxProc = 1
+	cnValProc = 1
+
+	procCnMcastListen = 1
+
+	procEventFork = 0x00000001
+	procEventExec = 0x00000002
+	procEventExit = 0x80000000
+
+	nlMsgHdrLen   = 16
+	cnMsgLen      = 20
+	procEventHdr  = 16
+	netlinkBufLen = 4096
+)
+
+// nativeEndian is the byte order of netlink messages, which use host byte order.
+var nativeEndian binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// netlinkBackend is a real-time backend that receives fork, exec and exit notifications from the
+// kernel through the netlink process connector. Requires CAP_NET_ADMIN.
+type netlinkBackend struct {
+	file *os.File
+}
+
+// newRealtimeBackend creates the real-time backend for this platform, using the netlink process connector.
+func newRealtimeBackend() (realtimeBackend, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, syscall.NETLINK_CONNECTOR)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create netlink connector socket: %s", err)
+	}
+	err = syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: cnIdxProc})
+	if err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("Unable to bind netlink connector socket: %s", err)
+	}
+	err = syscall.Sendto(fd, netlinkProcControlMsg(procCnMcastListen), 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK})
+	if err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("Unable to subscribe to process connector events: %s", err)
+	}
+	// A nonblocking file participates in the runtime poller, so that Close interrupts a pending Read
+	err = syscall.SetNonblock(fd, true)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("Unable to configure netlink connector socket: %s", err)
+	}
+	nb := &netlinkBackend{
+		file: os.NewFile(uintptr(fd), "netlink-proc-connector"),
+	}
+	return nb, nil
+}
+
+// netlinkProcControlMsg builds a netlink message that sends a control operation to the process connector.
+func netlinkProcControlMsg(op uint32) []byte {
+	msg := make([]byte, nlMsgHdrLen+cnMsgLen+4)
+	nativeEndian.PutUint32(msg[0:], uint32(len(msg)))
+	nativeEndian.PutUint16(msg[4:], syscall.NLMSG_DONE)
+	nativeEndian.PutUint32(msg[12:], uint32(os.Getpid()))
+	cn := msg[nlMsgHdrLen:]
+	nativeEndian.PutUint32(cn[0:], cnIdxProc)
+	nativeEndian.PutUint32(cn[4:], cnValProc)
+	nativeEndian.PutUint16(cn[16:], 4)
+	nativeEndian.PutUint32(cn[cnMsgLen:], op)
+	return msg
+}
+
+func (nb *netlinkBackend) run(notify func(procNotification)) {
+	buf := make([]byte, netlinkBufLen)
+	for {
+		n, err := nb.file.Read(buf)
+		if err != nil {
+			if err == syscall.ENOBUFS {
+				// Notifications were dropped; keep reading. Polling backstops anything missed.
+				continue
+			}
+			return
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			continue
+		}
+		for _, msg := range msgs {
+			pn, ok := parseProcEvent(msg.Data)
+			if ok {
+				notify(pn)
+			}
+		}
+	}
+}
+
+// watch is a no-op, because the process connector reports changes to all processes.
+func (nb *netlinkBackend) watch(pid int, parentPid int) {
+}
+
+func (nb *netlinkBackend) close() error {
+	return nb.file.Close()
+}
+
+// parseProcEvent parses the cn_msg payload of a process connector netlink message. Only fork, exec and exit
+// events for whole processes (not individual threads) are reported.
+func parseProcEvent(data []byte) (procNotification, bool) {
+	if len(data) < cnMsgLen+procEventHdr {
+		return procNotification{}, false
+	}
+	if nativeEndian.Uint32(data[0:]) != cnIdxProc || nativeEndian.Uint32(data[4:]) != cnValProc {
+		return procNotification{}, false
+	}
+	ev := data[cnMsgLen:]
+	what := nativeEndian.Uint32(ev[0:])
+	body := ev[procEventHdr:]
+	switch what {
+	case procEventFork:
+		if len(body) < 16 {
+			return procNotification{}, false
+		}
+		childPid := int(nativeEndian.Uint32(body[8:]))
+		childTgid := int(nativeEndian.Uint32(body[12:]))
+		if childPid != childTgid {
+			return procNotification{}, false
+		}
+		return procNotification{
+			kind:      notificationFork,
+			pid:       childTgid,
+			parentPid: int(nativeEndian.Uint32(body[4:])),
+		}, true
+	case procEventExec:
+		if len(body) < 8 {
+			return procNotification{}, false
+		}
+		return procNotification{
+			kind: notificationExec,
+			pid:  int(nativeEndian.Uint32(body[4:])),
+		}, true
+	case procEventExit:
+		if len(body) < 16 {
+			return procNotification{}, false
+		}
+		pid := int(nativeEndian.Uint32(body[0:]))
+		tgid := int(nativeEndian.Uint32(body[4:]))
+		if pid != tgid {
+			return procNotification{}, false
+		}
+		return procNotification{
+			kind:       notificationExit,
+			pid:        tgid,
+			exitStatus: newExitStatus(syscall.WaitStatus(nativeEndian.Uint32(body[8:]))),
+		}, true
+	}
+	return procNotification{}, false
+}
@@ -0,0 +1,42 @@
+package proctree
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestNetlinkBackend(t *testing.T) {
+	backend, err := newRealtimeBackend()
+	if err != nil {
+		t.Skipf("Netlink process connector unavailable: %s", err)
+	}
+	notifications := make(chan procNotification, 1024)
+	go backend.run(func(n procNotification) {
+		notifications <- n
+	})
+	defer backend.close()
+
+	cmd := exec.Command("sh", "-c", "exit 3")
+	err = cmd.Start()
+	if err != nil {
+		t.Fatalf("cmd.Start() returned error: %s", err)
+	}
+	pid := cmd.Process.Pid
+	cmd.Wait()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case n := <-notifications:
+			if n.pid == pid && n.kind == notificationExit {
+				if n.exitStatus == nil || n.exitStatus.Code != 3 {
+					t.Errorf("Exit notification for pid %d has unexpected status %+v", pid, n.exitStatus)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for exit notification for pid %d", pid)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd && !windows
+// +build !linux,!darwin,!freebsd,!windows
+
+package proctree
+
+import (
+	"fmt"
+)
+
+// newRealtimeBackend creates the real-time backend for this platform. No real-time backend is
+// available on this platform.
+func newRealtimeBackend() (realtimeBackend, error) {
+	return nil, fmt.Errorf("Real-time process monitoring is not supported on this platform")
+}
@@ -0,0 +1,199 @@
+package proctree
+
+import (
+	"fmt"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// windowsStartPollInterval is the interval at which the Windows backend scans for newly started processes.
+// Process creation cannot be observed without WMI or ETW, but a Toolhelp32 pid scan is far cheaper than a
+// full update, so it can run frequently.
+const windowsStartPollInterval = 100 * time.Millisecond
+
+const (
+	processQueryLimitedInformation = 0x1000
+	wtExecuteOnlyOnce              = 0x00000008
+	infinite                       = 0xFFFFFFFF
+)
+
+var (
+	modkernel32                 = syscall.NewLazyDLL("kernel32.dll")
+	procRegisterWaitForSingle   = modkernel32.NewProc("RegisterWaitForSingleObject")
+	procUnregisterWaitEx        = modkernel32.NewProc("UnregisterWaitEx")
+	windowsWaitCallbackOnce     sync.Once
+	windowsWaitCallback         uintptr
+	windowsWaitRegistryLock     sync.Mutex
+	windowsWaitRegistry         = make(map[uintptr]*windowsWatch)
+	windowsWaitRegistryNextCtxt uintptr
+)
+
+// windowsWatch is a registered wait for the exit of a single process.
+type windowsWatch struct {
+	backend    *windowsBackend
+	pid        int
+	handle     syscall.Handle
+	waitHandle syscall.Handle
+	ctxt       uintptr
+}
+
+// windowsBackend is a real-time backend that is notified of process exits through thread-pool waits on
+// process handles, and detects new processes with a frequent Toolhelp32 pid scan.
+type windowsBackend struct {
+	lock    sync.Mutex
+	closed  bool
+	watches map[int]*windowsWatch
+	exited  chan *windowsWatch
+	done    chan struct{}
+}
+
+// newRealtimeBackend creates the real-time backend for this platform.
+func newRealtimeBackend() (realtimeBackend, error) {
+	err := procRegisterWaitForSingle.Find()
+	if err != nil {
+		return nil, fmt.Errorf("Real-time process monitoring is not available: %s", err)
+	}
+	windowsWaitCallbackOnce.Do(func() {
+		windowsWaitCallback = syscall.NewCallback(onWindowsProcessExit)
+	})
+	wb := &windowsBackend{
+		watches: make(map[int]*windowsWatch),
+		exited:  make(chan *windowsWatch, 256),
+		done:    make(chan struct{}),
+	}
+	return wb, nil
+}
+
+// onWindowsProcessExit is invoked on a thread-pool thread when a watched process handle is signalled.
+func onWindowsProcessExit(ctxt uintptr, timedOut uintptr) uintptr {
+	windowsWaitRegistryLock.Lock()
+	w, ok := windowsWaitRegistry[ctxt]
+	windowsWaitRegistryLock.Unlock()
+	if ok {
+		select {
+		case w.backend.exited <- w:
+		case <-w.backend.done:
+		}
+	}
+	return 0
+}
+
+// watch opens a handle to a process and registers a wait for its exit. Errors are ignored, since the process
+// may already have exited or may not be accessible to this user.
+func (wb *windowsBackend) watch(pid int, parentPid int) {
+	wb.lock.Lock()
+	defer wb.lock.Unlock()
+	if wb.closed {
+		return
+	}
+	if _, ok := wb.watches[pid]; ok {
+		return
+	}
+	h, err := syscall.OpenProcess(syscall.SYNCHRONIZE|processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return
+	}
+	windowsWaitRegistryLock.Lock()
+	windowsWaitRegistryNextCtxt++
+	w := &windowsWatch{
+		backend: wb,
+		pid:     pid,
+		handle:  h,
+		ctxt:    windowsWaitRegistryNextCtxt,
+	}
+	windowsWaitRegistry[w.ctxt] = w
+	windowsWaitRegistryLock.Unlock()
+
+	r1, _, _ := procRegisterWaitForSingle.Call(uintptr(unsafe.Pointer(&w.waitHandle)), uintptr(h),
+		windowsWaitCallback, w.ctxt, infinite, wtExecuteOnlyOnce)
+	if r1 == 0 {
+		wb.releaseWatch(w)
+		return
+	}
+	wb.watches[pid] = w
+}
+
+// releaseWatch unregisters a wait and closes its process handle.
+func (wb *windowsBackend) releaseWatch(w *windowsWatch) {
+	if w.waitHandle != 0 {
+		// Wait for any in-progress callback to complete before the handle is closed
+		procUnregisterWaitEx.Call(uintptr(w.waitHandle), uintptr(syscall.InvalidHandle))
+	}
+	windowsWaitRegistryLock.Lock()
+	delete(windowsWaitRegistry, w.ctxt)
+	windowsWaitRegistryLock.Unlock()
+	syscall.CloseHandle(w.handle)
+}
+
+// snapshotPids returns the pids and parent pids of all processes, using a Toolhelp32 snapshot.
+func snapshotPids() (map[int]int, error) {
+	snapshot, err := syscall.CreateToolhelp32Snapshot(syscall.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.CloseHandle(snapshot)
+	result := make(map[int]int)
+	var entry syscall.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	err = syscall.Process32First(snapshot, &entry)
+	for err == nil {
+		result[int(entry.ProcessID)] = int(entry.ParentProcessID)
+		err = syscall.Process32Next(snapshot, &entry)
+	}
+	return result, nil
+}
+
+func (wb *windowsBackend) run(notify func(procNotification)) {
+	ticker := time.NewTicker(windowsStartPollInterval)
+	defer ticker.Stop()
+	known, _ := snapshotPids()
+	for {
+		select {
+		case <-wb.done:
+			return
+		case w := <-wb.exited:
+			pn := procNotification{kind: notificationExit, pid: w.pid}
+			var code uint32
+			if syscall.GetExitCodeProcess(w.handle, &code) == nil {
+				pn.exitStatus = &ExitStatus{Code: int(code)}
+			}
+			wb.lock.Lock()
+			if wb.watches[w.pid] == w {
+				delete(wb.watches, w.pid)
+			}
+			wb.lock.Unlock()
+			wb.releaseWatch(w)
+			notify(pn)
+		case <-ticker.C:
+			current, err := snapshotPids()
+			if err != nil {
+				continue
+			}
+			for pid, ppid := range current {
+				if _, ok := known[pid]; !ok {
+					notify(procNotification{kind: notificationFork, pid: pid, parentPid: ppid})
+				}
+			}
+			known = current
+		}
+	}
+}
+
+func (wb *windowsBackend) close() error {
+	wb.lock.Lock()
+	if wb.closed {
+		wb.lock.Unlock()
+		return nil
+	}
+	wb.closed = true
+	close(wb.done)
+	watches := wb.watches
+	wb.watches = nil
+	wb.lock.Unlock()
+	for _, w := range watches {
+		wb.releaseWatch(w)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package proctree
+
+import (
+	"context"
+	"fmt"
+)
+
+// Reconfigure applies ConfigOptions to the configuration of an existing ProcTree, as with Config.Refine, and
+// updates the tree with the new configuration. Process identities, tombstones and subscriptions are preserved.
+// The options that control inclusion (roots, ancestors, kernel threads, filters, exclusions and maximum depth)
+// and update hooks may be changed; pass WithConfig first to replace the configuration entirely. Options that
+// control background activity (subreaper mode, auto-update, real-time monitors and the close context) and the
+// procfs path cannot be changed, and an error is returned if they differ. The process source and clock cannot be
+// changed either; WithProcessSource and WithClock are ignored. Roots that are added must exist, as for AddRoot,
+// unless the new configuration has WithLenientRoots. Kernel threads that are excluded by the new configuration
+// are dropped from the tree without generating events.
+func (pt *ProcTree) Reconfigure(opts ...ConfigOption) error {
+	// The system is scanned with the new configuration before the tree lock is taken, so that readers are not
+	// blocked by a slow scan
+	pt.prlock()
+	base := pt.cfg
+	readOnly := pt.readOnly
+	pt.prunlock()
+	cfg := base.Refine(opts...)
+	var snap *procSnapshot
+	var err error
+	ctx := context.Background()
+	if !readOnly {
+		snap, err = pt.scanProcesses(ctx, cfg.includeKernelThreads, cfg.childOrder.readsUsage(), false)
+	}
+
+	pt.plock()
+	if err == nil {
+		if pt.cfg != base {
+			// The tree was reconfigured concurrently, so the options are applied to its new configuration
+			cfg = pt.cfg.Refine(opts...)
+		}
+		err = pt.lockedReconfigure(cfg)
+	}
+	if err == nil {
+		err = pt.lockedApplySnapshot(ctx, snap, false)
+	}
+	log := pt.cfg.logger
+	pt.punlockAndDispatch()
+	logOp(log, "Reconfigure", err)
+	return err
+}
+
+func (pt *ProcTree) lockedReconfigure(cfg *Config) error {
+	if pt.readOnly {
+		return fmt.Errorf("Unable to reconfigure a read-only ProcTree")
+	}
+	err := cfg.validate()
+	if err != nil {
+		return err
+	}
+	err = cfg.resolveNamespaceRoots()
+	if err != nil {
+		return err
+	}
+	old := pt.cfg
+	if cfg.subreaper != old.subreaper ||
+		cfg.autoUpdateInterval != old.autoUpdateInterval ||
+		cfg.autoUpdatePruneTombstones != old.autoUpdatePruneTombstones ||
+		cfg.realtimeMonitor != old.realtimeMonitor ||
+		cfg.ebpfMonitor != old.ebpfMonitor ||
+		cfg.closeCtx != old.closeCtx {
+		return fmt.Errorf("Subreaper, auto-update, real-time monitor and close context options cannot be reconfigured")
+	}
+	if cfg.procfsPath != old.procfsPath {
+		return fmt.Errorf("The procfs path cannot be reconfigured")
+	}
+
+	for _, path := range cfg.rootPidFiles {
+		_, ok := pt.pidFileRoots[path]
+		if !ok && !cfg.lenientRoots {
+			_, err = readPidFile(path)
+			if err != nil {
+				return fmt.Errorf("Unable to read root pid file: %s", err)
+			}
+		}
+	}
+	pt.lockedReconfigurePidFiles(cfg)
+
+	// Roots that remain configured keep their Processes, which may be tombstones; new roots are resolved by the
+	// next update
+	cfgRootProcs := []*Process{}
+	pendingRootPids := []int{}
+	for _, pid := range cfg.rootPids {
+		found := false
+		for _, proc := range pt.cfgRootProcs {
+			if proc.lockedPid() == pid {
+				cfgRootProcs = append(cfgRootProcs, proc)
+				found = true
+				break
+			}
+		}
+		if !found && !cfg.lenientRoots {
+			err = pt.lockedCheckPidExists(pid)
+			if err != nil {
+				return err
+			}
+		}
+		if !found {
+			pendingRootPids = append(pendingRootPids, pid)
+		}
+	}
+	ownedRootProcs := []*Process{}
+	for _, pid := range cfg.ownedRootPids {
+		for _, proc := range cfgRootProcs {
+			if proc.lockedPid() == pid {
+				ownedRootProcs = append(ownedRootProcs, proc)
+				break
+			}
+		}
+	}
+
+	if old.includeKernelThreads && !cfg.includeKernelThreads {
+		for pid, proc := range pt.pidMap {
+			if pid == kthreadPid || proc.gopsProcess.PPid() == kthreadPid {
+				delete(pt.pidMap, pid)
+			}
+		}
+	}
+
+	// The source and clock are fixed at construction, and may not be comparable
+	cfg.source = old.source
+	cfg.clock = old.clock
+	pt.cfg = cfg
+	// The container and pod resolvers may have changed
+	pt.containers = nil
+	pt.pods = nil
+	pt.cfgRootProcs = cfgRootProcs
+	pt.ownedRootProcs = ownedRootProcs
+	pt.pendingRootPids = pendingRootPids
+	return nil
+}
@@ -0,0 +1,267 @@
+package proctree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Field numbers of the Record message.
+const (
+	protoRecordTime     = 1
+	protoRecordSnapshot = 2
+	protoRecordEvent    = 3
+)
+
+// maxRecordSize is the largest record accepted by NewPlayer. It guards against allocating an unbounded buffer
+// for the length prefix of a corrupt recording.
+const maxRecordSize = 256 << 20
+
+var protoRecordWireTypes = map[int]int{
+	protoRecordTime:     protoWireVarint,
+	protoRecordSnapshot: protoWireBytes,
+	protoRecordEvent:    protoWireBytes,
+}
+
+// record is an entry in a recording: either a snapshot of the included tree, or an event.
+type record struct {
+	time     time.Time
+	snapshot *encodedTree
+	event    *encodedEvent
+}
+
+func (rec *record) appendProto(b []byte) []byte {
+	b = protoAppendInt(b, protoRecordTime, rec.time.UnixNano())
+	if rec.snapshot != nil {
+		b = protoAppendBytes(b, protoRecordSnapshot, rec.snapshot.appendProto(nil))
+	}
+	if rec.event != nil {
+		b = protoAppendBytes(b, protoRecordEvent, rec.event.appendProto(nil))
+	}
+	return b
+}
+
+func decodeProtoRecord(data []byte) (*record, error) {
+	rec := &record{}
+	err := protoDecode(data, protoRecordWireTypes, func(field int, v uint64, data []byte) error {
+		var err error
+		switch field {
+		case protoRecordTime:
+			rec.time = time.Unix(0, int64(v))
+		case protoRecordSnapshot:
+			rec.snapshot, err = decodeProtoTree(data)
+		case protoRecordEvent:
+			rec.event, err = decodeProtoEvent(data)
+		}
+		return err
+	})
+	if err == nil && (rec.snapshot == nil) == (rec.event == nil) {
+		err = fmt.Errorf("Record must contain exactly one of a snapshot or an event")
+	}
+	return rec, err
+}
+
+// Recorder records the history of a ProcTree: a snapshot of the included tree when recording starts, followed
+// by every event generated by subsequent updates, and optionally further snapshots at a fixed interval. The
+// recording is written as a sequence of length-prefixed Record messages, as defined in proctree.proto, and can
+// be replayed with a Player.
+type Recorder struct {
+	// pt is the ProcTree being recorded.
+	pt *ProcTree
+
+	// w buffers writes to the recording.
+	w *bufio.Writer
+
+	// sub is the subscription that receives the events to be recorded.
+	sub *Subscription
+
+	// stopped is closed when the recording goroutine exits.
+	stopped chan struct{}
+
+	// err is the first error encountered while writing the recording. It is only accessed by the recording
+	// goroutine until stopped is closed.
+	err error
+}
+
+// NewRecorder starts recording a ProcTree to w. If snapshotInterval is nonzero, a full snapshot is recorded at
+// that interval, so that a Player can reconstruct the tree without replaying the whole recording. Events are
+// recorded from a background goroutine; since updates block while it writes (see OverflowBlock), w should not
+// block for long periods. Recording continues until Close is called, the ProcTree is closed, or a write fails.
+func NewRecorder(pt *ProcTree, w io.Writer, snapshotInterval time.Duration) (*Recorder, error) {
+	r := &Recorder{
+		pt:      pt,
+		w:       bufio.NewWriter(w),
+		stopped: make(chan struct{}),
+	}
+
+	// The initial snapshot is taken together with the subscription, so that the recorded events apply to it
+	pt.plock()
+	r.sub = pt.lockedSubscribe(newSubscribeConfig(), nil)
+	rec := &record{time: pt.clock.Now(), snapshot: pt.lockedEncodedTree()}
+	pt.punlock()
+
+	err := r.writeRecord(rec)
+	if err == nil {
+		err = r.w.Flush()
+	}
+	if err != nil {
+		r.sub.Close()
+		return nil, fmt.Errorf("Unable to write recording: %s", err)
+	}
+
+	go r.run(snapshotInterval)
+	return r, nil
+}
+
+func (r *Recorder) writeRecord(rec *record) error {
+	data := rec.appendProto(nil)
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], uint64(len(data)))
+	_, err := r.w.Write(prefix[:n])
+	if err == nil {
+		_, err = r.w.Write(data)
+	}
+	return err
+}
+
+// run records events and periodic snapshots until the subscription is closed.
+func (r *Recorder) run(snapshotInterval time.Duration) {
+	defer close(r.stopped)
+	var tick <-chan time.Time
+	if snapshotInterval > 0 {
+		ticker := time.NewTicker(snapshotInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	// Events that were generated before the most recent snapshot are already reflected in it
+	var snapshotSeq uint64
+	events := r.sub.Events()
+	for r.err == nil {
+		var rec *record
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				r.err = r.w.Flush()
+				return
+			}
+			if ev.seq <= snapshotSeq {
+				continue
+			}
+			r.pt.plock()
+			rec = &record{time: ev.Time, event: lockedEncodedEvent(&ev)}
+			r.pt.punlock()
+		case <-tick:
+			r.pt.plock()
+			rec = &record{time: r.pt.clock.Now(), snapshot: r.pt.lockedEncodedTree()}
+			snapshotSeq = r.pt.eventSeq
+			r.pt.punlock()
+		}
+		r.err = r.writeRecord(rec)
+		if r.err == nil && len(events) == 0 {
+			r.err = r.w.Flush()
+		}
+	}
+	r.sub.Close()
+}
+
+// Close stops recording, and flushes the recording. Returns the first error encountered while writing the
+// recording, if any. The underlying writer is not closed.
+func (r *Recorder) Close() error {
+	r.sub.Close()
+	<-r.stopped
+	if r.err != nil {
+		return fmt.Errorf("Unable to write recording: %s", r.err)
+	}
+	return nil
+}
+
+// Player reconstructs the state of a recorded ProcTree at any time covered by a recording made by a Recorder.
+type Player struct {
+	// records is the list of records in the recording, in recorded order.
+	records []*record
+}
+
+// NewPlayer reads a recording made by a Recorder. A truncated final record, e.g., from a recording that was
+// interrupted by a crash, is ignored.
+func NewPlayer(r io.Reader) (*Player, error) {
+	br := bufio.NewReader(r)
+	p := &Player{records: []*record{}}
+	for {
+		n, err := binary.ReadUvarint(br)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read recording: %s", err)
+		}
+		if n > maxRecordSize {
+			return nil, fmt.Errorf("Unable to read recording: record %d has size %d, which exceeds the maximum of %d",
+				len(p.records), n, maxRecordSize)
+		}
+		data := make([]byte, n)
+		_, err = io.ReadFull(br, data)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read recording: %s", err)
+		}
+		rec, err := decodeProtoRecord(data)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to decode record %d of recording: %s", len(p.records), err)
+		}
+		p.records = append(p.records, rec)
+	}
+	if len(p.records) == 0 || p.records[0].snapshot == nil {
+		return nil, fmt.Errorf("Recording does not begin with a snapshot")
+	}
+	return p, nil
+}
+
+// Start returns the time at which the recording started.
+func (p *Player) Start() time.Time {
+	return p.records[0].time
+}
+
+// End returns the time of the last record in the recording.
+func (p *Player) End() time.Time {
+	return p.records[len(p.records)-1].time
+}
+
+// TreeAt returns a read-only ProcTree (see LoadJSON) with the state of the recorded tree at time t, reconstructed
+// from the most recent snapshot before t and the events recorded after it. Processes that exited are retained
+// as tombstones. Events that are inconsistent with the reconstructed tree are ignored. Returns an error if t is
+// before the start of the recording.
+func (p *Player) TreeAt(t time.Time) (*ProcTree, error) {
+	base := -1
+	for i, rec := range p.records {
+		if rec.time.After(t) {
+			break
+		}
+		if rec.snapshot != nil {
+			base = i
+		}
+	}
+	if base < 0 {
+		return nil, fmt.Errorf("Time %s is before the start of the recording", t)
+	}
+
+	pt, err := loadEncodedTree(p.records[base].snapshot)
+	if err != nil {
+		return nil, err
+	}
+	pt.plock()
+	defer pt.punlock()
+	for _, rec := range p.records[base+1:] {
+		if rec.time.After(t) {
+			break
+		}
+		if rec.event != nil {
+			pt.lockedApplyEncodedEvent(rec.event)
+		}
+	}
+	return pt, nil
+}
@@ -0,0 +1,100 @@
+package proctree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestRecorderPlayer(t *testing.T) {
+	pt, err := New()
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	var buf bytes.Buffer
+	recorder, err := NewRecorder(pt, &buf, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewRecorder() returned error: %s", err)
+	}
+	beforeStart := time.Now()
+
+	cmd := exec.Command("sleep", "10")
+	err = cmd.Start()
+	if err != nil {
+		t.Fatalf("cmd.Start() returned error: %s", err)
+	}
+	pid := cmd.Process.Pid
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("pt.Update() returned error: %s", err)
+	}
+	// Allow a periodic snapshot to be recorded while the command is running
+	time.Sleep(50 * time.Millisecond)
+	afterStart := time.Now()
+
+	cmd.Process.Kill()
+	cmd.Wait()
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("pt.Update() returned error: %s", err)
+	}
+	afterExit := time.Now()
+	err = recorder.Close()
+	if err != nil {
+		t.Fatalf("recorder.Close() returned error: %s", err)
+	}
+
+	player, err := NewPlayer(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("NewPlayer() returned error: %s", err)
+	}
+	for _, tc := range []struct {
+		time      time.Time
+		found     bool
+		tombstone bool
+	}{
+		{beforeStart, false, false},
+		{afterStart, true, false},
+		{afterExit, true, true},
+	} {
+		tree, err := player.TreeAt(tc.time)
+		if err != nil {
+			t.Fatalf("player.TreeAt() returned error: %s", err)
+		}
+		proc := tree.PidProcess(pid)
+		if (proc != nil) != tc.found || (proc != nil && proc.isTombstone != tc.tombstone) {
+			t.Errorf("Recorded state of pid %d at %s is not expected", pid, tc.time)
+		}
+	}
+
+	_, err = player.TreeAt(player.Start().Add(-time.Second))
+	if err == nil {
+		t.Errorf("player.TreeAt() returned a tree before the start of the recording")
+	}
+
+	// A truncated recording can still be played
+	_, err = NewPlayer(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	if err != nil {
+		t.Errorf("NewPlayer() returned error for truncated recording: %s", err)
+	}
+}
+
+func TestPlayerCorruptRecording(t *testing.T) {
+	// A length prefix larger than any valid record is rejected without allocating it
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], 1<<62)
+	_, err := NewPlayer(bytes.NewReader(prefix[:n]))
+	if err == nil {
+		t.Errorf("NewPlayer() did not return error for oversized record")
+	}
+
+	// A truncated length prefix is treated as a truncated final record
+	_, err = NewPlayer(bytes.NewReader([]byte{0x80, 0x80}))
+	if err == nil {
+		t.Errorf("NewPlayer() did not return error for recording without a snapshot")
+	}
+}
@@ -0,0 +1,327 @@
+// Package remote provides a gRPC agent that serves the processes of a host, and a proctree.ProcessSource that
+// lists and watches them from another host, so that a single ProcTree-based tool can inspect and manipulate the
+// process trees of many machines from a central place.
+//
+// On each monitored host, an Agent is registered with a gRPC server:
+//
+//	lis, err := net.Listen("tcp", ":7070")
+//	...
+//	s := grpc.NewServer(grpc.Creds(creds))
+//	remote.NewAgent(nil, remote.WithSignals()).Register(s)
+//	err = s.Serve(lis)
+//
+// and a central tool creates a ProcTree for each host from a Source:
+//
+//	conn, err := grpc.NewClient("host1:7070", grpc.WithTransportCredentials(creds))
+//	...
+//	pt, err := proctree.New(proctree.WithProcessSource(remote.NewSource(conn)), proctree.WithRealtimeMonitor())
+//
+// The agent does not authenticate its callers; use transport credentials, or listen only on a trusted network.
+// The service is described by agent.proto.
+//
+// For hosts where an agent cannot be installed, an SSHSource lists processes by running a shell command over
+// SSH:
+//
+//	pt, err := proctree.New(proctree.WithProcessSource(remote.NewSSHSource("admin@host2")))
+package remote
+
+import (
+	"context"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sammck-go/proctree"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	serviceName = "proctree.ProcessAgent"
+
+	listProcessesMethod = "/" + serviceName + "/ListProcesses"
+	watchMethod         = "/" + serviceName + "/Watch"
+	signalMethod        = "/" + serviceName + "/Signal"
+)
+
+const (
+	defaultPollInterval = time.Second
+	defaultSignals      = false
+)
+
+// Agent serves the ProcessAgent service, which lists, watches and signals the processes listed by a
+// proctree.ProcessSource, normally the processes of the local host.
+type Agent struct {
+	// source lists the served processes.
+	source proctree.ProcessSource
+
+	// pollInterval is the interval at which the source is listed to detect changes for watchers, if it is not a
+	// proctree.ProcessEventSource.
+	pollInterval time.Duration
+
+	// signals is true if callers may send signals to processes.
+	signals bool
+}
+
+// AgentOption is an opaque agent option setter created by one of the With functions.
+// It follows the Golang "options" pattern.
+type AgentOption func(*Agent)
+
+// NewAgent creates an Agent that serves the processes listed by source. A nil source serves the processes of
+// the local host, as listed by proctree.SystemSource.
+func NewAgent(source proctree.ProcessSource, opts ...AgentOption) *Agent {
+	if source == nil {
+		source = proctree.SystemSource()
+	}
+	a := &Agent{
+		source:       source,
+		pollInterval: defaultPollInterval,
+		signals:      defaultSignals,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// WithPollInterval sets the interval at which the processes are listed to detect changes for watchers, if the
+// source is not a proctree.ProcessEventSource. The default is 1 second.
+func WithPollInterval(interval time.Duration) AgentOption {
+	return func(a *Agent) {
+		a.pollInterval = interval
+	}
+}
+
+// WithSignals allows callers to send signals to the served processes. Any caller that can reach the agent can
+// then terminate its processes, so this should only be enabled when callers are authenticated by the server's
+// transport credentials.
+func WithSignals() AgentOption {
+	return func(a *Agent) {
+		a.signals = true
+	}
+}
+
+// WithoutSignals rejects requests to send signals to the served processes. This is the default option.
+func WithoutSignals() AgentOption {
+	return func(a *Agent) {
+		a.signals = false
+	}
+}
+
+// Register registers the ProcessAgent service with a gRPC server.
+func (a *Agent) Register(s *grpc.Server) {
+	s.RegisterService(&agentServiceDesc, a)
+}
+
+// agentService is the handler type of the ProcessAgent service.
+type agentService interface {
+	listProcesses(ctx context.Context, req *emptyMessage) (*listProcessesResponse, error)
+	watch(req *emptyMessage, stream grpc.ServerStream) error
+	signal(ctx context.Context, req *signalRequest) (*emptyMessage, error)
+}
+
+var agentServiceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*agentService)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "ListProcesses", Handler: listProcessesHandler},
+		{MethodName: "Signal", Handler: signalHandler},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Watch", Handler: watchHandler, ServerStreams: true},
+	},
+	Metadata: "agent.proto",
+}
+
+func listProcessesHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := &emptyMessage{}
+	err := dec(req)
+	if err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(agentService).listProcesses(ctx, req)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: listProcessesMethod}
+	return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(agentService).listProcesses(ctx, req.(*emptyMessage))
+	})
+}
+
+func signalHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := &signalRequest{}
+	err := dec(req)
+	if err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(agentService).signal(ctx, req)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: signalMethod}
+	return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(agentService).signal(ctx, req.(*signalRequest))
+	})
+}
+
+func watchHandler(srv interface{}, stream grpc.ServerStream) error {
+	req := &emptyMessage{}
+	err := stream.RecvMsg(req)
+	if err != nil {
+		return err
+	}
+	return srv.(agentService).watch(req, stream)
+}
+
+// snapshot lists the processes of the source, cancelling the listing when the call's context is done if the
+// source supports it.
+func (a *Agent) snapshot(ctx context.Context) ([]proctree.ProcInfo, error) {
+	if cs, ok := a.source.(proctree.ContextProcessSource); ok {
+		return cs.SnapshotContext(ctx)
+	}
+	return a.source.Snapshot()
+}
+
+func (a *Agent) listProcesses(ctx context.Context, req *emptyMessage) (*listProcessesResponse, error) {
+	infos, err := a.snapshot(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "Unable to list processes: %s", err)
+	}
+	return &listProcessesResponse{processes: infos}, nil
+}
+
+func (a *Agent) signal(ctx context.Context, req *signalRequest) (*emptyMessage, error) {
+	if !a.signals {
+		return nil, status.Errorf(codes.PermissionDenied, "Signals are not allowed by this agent")
+	}
+	infos, err := a.snapshot(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "Unable to list processes: %s", err)
+	}
+	found := false
+	for _, info := range infos {
+		if info.Pid == req.pid {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, status.Errorf(codes.NotFound, "Process %d does not exist", req.pid)
+	}
+	proc, err := os.FindProcess(req.pid)
+	if err == nil {
+		err = proc.Signal(req.signal)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "Unable to signal process %d: %s", req.pid, err)
+	}
+	return &emptyMessage{}, nil
+}
+
+func (a *Agent) watch(req *emptyMessage, stream grpc.ServerStream) error {
+	ctx := stream.Context()
+	if eventSource, ok := a.source.(proctree.ProcessEventSource); ok {
+		// The source's Watch is stopped when the call is cancelled, or when an event cannot be sent
+		done := make(chan struct{})
+		var once sync.Once
+		stop := func() {
+			once.Do(func() { close(done) })
+		}
+		go func() {
+			select {
+			case <-ctx.Done():
+				stop()
+			case <-done:
+			}
+		}()
+		var sendErr error
+		err := eventSource.Watch(done, func(ev proctree.SourceEvent) {
+			if sendErr != nil {
+				return
+			}
+			sendErr = stream.SendMsg(&sourceEvent{ev: ev})
+			if sendErr != nil {
+				stop()
+			}
+		})
+		stop()
+		if sendErr != nil {
+			return sendErr
+		}
+		if err != nil {
+			return status.Errorf(codes.Unavailable, "Unable to watch processes: %s", err)
+		}
+		return ctx.Err()
+	}
+	return a.pollWatch(ctx, stream)
+}
+
+// pollWatch reports the changes between successive listings of the source, for sources that do not report
+// changes themselves. A pid whose start time changes is reported as the exit of the old process and the fork of
+// a new one.
+func (a *Agent) pollWatch(ctx context.Context, stream grpc.ServerStream) error {
+	prev := map[int]proctree.ProcInfo{}
+	infos, err := a.source.Snapshot()
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "Unable to list processes: %s", err)
+	}
+	for _, info := range infos {
+		prev[info.Pid] = info
+	}
+	ticker := time.NewTicker(a.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		infos, err := a.source.Snapshot()
+		if err != nil {
+			return status.Errorf(codes.Unavailable, "Unable to list processes: %s", err)
+		}
+		cur := make(map[int]proctree.ProcInfo, len(infos))
+		for _, info := range infos {
+			cur[info.Pid] = info
+		}
+		for _, ev := range diffProcesses(prev, cur) {
+			err = stream.SendMsg(&sourceEvent{ev: ev})
+			if err != nil {
+				return err
+			}
+		}
+		prev = cur
+	}
+}
+
+// diffProcesses returns the events that describe the changes between two listings of processes, in pid order.
+func diffProcesses(prev map[int]proctree.ProcInfo, cur map[int]proctree.ProcInfo) []proctree.SourceEvent {
+	events := []proctree.SourceEvent{}
+	for pid, old := range prev {
+		info, ok := cur[pid]
+		if !ok || (old.StartTime != 0 && info.StartTime != 0 && old.StartTime != info.StartTime) {
+			events = append(events, proctree.SourceEvent{Type: proctree.SourceExit, Pid: pid, PPid: old.PPid,
+				Executable: old.Executable})
+		}
+	}
+	for pid, info := range cur {
+		old, ok := prev[pid]
+		switch {
+		case !ok || (old.StartTime != 0 && info.StartTime != 0 && old.StartTime != info.StartTime):
+			events = append(events, proctree.SourceEvent{Type: proctree.SourceFork, Pid: pid, PPid: info.PPid,
+				Executable: info.Executable})
+		case old.Executable != info.Executable:
+			events = append(events, proctree.SourceEvent{Type: proctree.SourceExec, Pid: pid, PPid: info.PPid,
+				Executable: info.Executable})
+		}
+	}
+	// Exits are reported before forks of the same pid
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Pid != events[j].Pid {
+			return events[i].Pid < events[j].Pid
+		}
+		return events[i].Type == proctree.SourceExit && events[j].Type != proctree.SourceExit
+	})
+	return events
+}
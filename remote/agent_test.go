@@ -0,0 +1,165 @@
+package remote
+
+import (
+	"context"
+	"net"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sammck-go/proctree"
+	"github.com/sammck-go/proctree/proctreetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// startAgent serves an Agent on a loopback port, and returns a Source connected to it.
+func startAgent(t *testing.T, agent *Agent) *Source {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() returned error: %s", err)
+	}
+	s := grpc.NewServer()
+	agent.Register(s)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("grpc.NewClient() returned error: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewSource(conn)
+}
+
+func TestRemoteSource(t *testing.T) {
+	src := proctreetest.NewSource()
+	shell := src.Fork(proctreetest.InitPid, "sh")
+	rs := startAgent(t, NewAgent(src))
+
+	pt, err := proctree.New(proctree.WithProcessSource(rs), proctree.WithRealtimeMonitor())
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+	proc := pt.PidProcess(shell)
+	if proc == nil || proc.Executable() != "sh" || proc.Parent() != pt.PidProcess(proctreetest.InitPid) {
+		t.Fatalf("Remote process %d was not listed", shell)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for src.Watchers() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	child := src.Fork(shell, "make")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	proc, err = pt.WaitForPid(ctx, child)
+	if err != nil {
+		t.Fatalf("pt.WaitForPid() returned error: %s", err)
+	}
+	if proc.Parent() != pt.PidProcess(shell) {
+		t.Errorf("Remote process %d does not have the expected parent", child)
+	}
+}
+
+func TestPollWatch(t *testing.T) {
+	src := proctreetest.NewSource()
+	shell := src.Fork(proctreetest.InitPid, "sh")
+	// Hide the source's events, so that the agent polls for changes
+	snapshotOnly := struct{ proctree.ProcessSource }{src}
+	rs := startAgent(t, NewAgent(snapshotOnly, WithPollInterval(10*time.Millisecond)))
+
+	events := make(chan proctree.SourceEvent, 16)
+	done := make(chan struct{})
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- rs.Watch(done, func(ev proctree.SourceEvent) {
+			events <- ev
+		})
+	}()
+	// Wait for the agent's first listing, so that the changes are not missed
+	time.Sleep(100 * time.Millisecond)
+
+	child := src.Fork(shell, "make")
+	src.Exec(shell, "bash")
+	src.Exit(shell, 0)
+	expected := map[proctree.SourceEventType]int{proctree.SourceFork: child, proctree.SourceExit: shell}
+	for len(expected) > 0 {
+		select {
+		case ev := <-events:
+			if pid, ok := expected[ev.Type]; ok && pid == ev.Pid {
+				delete(expected, ev.Type)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Events %v were not reported", expected)
+		}
+	}
+
+	close(done)
+	err := <-watchErr
+	if err != nil {
+		t.Errorf("rs.Watch() returned error: %s", err)
+	}
+}
+
+func TestDiffProcesses(t *testing.T) {
+	prev := map[int]proctree.ProcInfo{
+		10: {Pid: 10, PPid: 1, Executable: "sh", StartTime: 100},
+		11: {Pid: 11, PPid: 10, Executable: "make", StartTime: 200},
+		12: {Pid: 12, PPid: 10, Executable: "cc", StartTime: 300},
+	}
+	cur := map[int]proctree.ProcInfo{
+		10: {Pid: 10, PPid: 1, Executable: "bash", StartTime: 100},
+		11: {Pid: 11, PPid: 1, Executable: "sleep", StartTime: 400},
+		13: {Pid: 13, PPid: 10, Executable: "ld", StartTime: 500},
+	}
+	expected := []proctree.SourceEvent{
+		{Type: proctree.SourceExec, Pid: 10, PPid: 1, Executable: "bash"},
+		{Type: proctree.SourceExit, Pid: 11, PPid: 10, Executable: "make"},
+		{Type: proctree.SourceFork, Pid: 11, PPid: 1, Executable: "sleep"},
+		{Type: proctree.SourceExit, Pid: 12, PPid: 10, Executable: "cc"},
+		{Type: proctree.SourceFork, Pid: 13, PPid: 10, Executable: "ld"},
+	}
+	events := diffProcesses(prev, cur)
+	if len(events) != len(expected) {
+		t.Fatalf("diffProcesses() returned %d events, expected %d", len(events), len(expected))
+	}
+	for i := range events {
+		ev, e := events[i], expected[i]
+		if ev.Type != e.Type || ev.Pid != e.Pid || ev.PPid != e.PPid || ev.Executable != e.Executable {
+			t.Errorf("Event %d is %s %d, expected %s %d", i, ev.Type, ev.Pid, e.Type, e.Pid)
+		}
+	}
+}
+
+func TestSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Signals are not supported on this platform")
+	}
+	cmd := exec.Command("sleep", "10")
+	err := cmd.Start()
+	if err != nil {
+		t.Fatalf("cmd.Start() returned error: %s", err)
+	}
+	defer cmd.Process.Kill()
+
+	rs := startAgent(t, NewAgent(nil))
+	err = rs.Signal(cmd.Process.Pid, syscall.SIGTERM)
+	if err == nil {
+		t.Errorf("rs.Signal() succeeded on an agent that does not allow signals")
+	}
+
+	rs = startAgent(t, NewAgent(nil, WithSignals()))
+	err = rs.Signal(cmd.Process.Pid, syscall.SIGTERM)
+	if err != nil {
+		t.Fatalf("rs.Signal() returned error: %s", err)
+	}
+	err = cmd.Wait()
+	ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if err == nil || !ok || !ws.Signaled() || ws.Signal() != syscall.SIGTERM {
+		t.Errorf("Process was not terminated by SIGTERM: %v", err)
+	}
+}
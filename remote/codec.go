@@ -0,0 +1,310 @@
+package remote
+
+import (
+	"fmt"
+	"syscall"
+
+	"github.com/sammck-go/proctree"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The messages of the ProcessAgent service follow the schema in agent.proto. They are encoded and decoded
+// directly in the protobuf wire format, so that generated code is not required, by a codec that is registered
+// with gRPC under its own content subtype so that it does not replace the default protobuf codec.
+
+// codecName is the name of the codec, and the content subtype of calls to the ProcessAgent service.
+const codecName = "proctree"
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+// message is a message of the ProcessAgent service.
+type message interface {
+	appendProto(b []byte) []byte
+	unmarshalProto(data []byte) error
+}
+
+// codec is a gRPC codec for messages of the ProcessAgent service.
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(message)
+	if !ok {
+		return nil, fmt.Errorf("Unable to marshal unexpected message type %T", v)
+	}
+	return m.appendProto(nil), nil
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(message)
+	if !ok {
+		return fmt.Errorf("Unable to unmarshal unexpected message type %T", v)
+	}
+	return m.unmarshalProto(data)
+}
+
+func (codec) Name() string {
+	return codecName
+}
+
+// Field numbers of the ListProcessesResponse message.
+const (
+	protoListProcesses = 1
+)
+
+// Field numbers of the ProcInfo message.
+const (
+	protoProcInfoPid        = 1
+	protoProcInfoPPid       = 2
+	protoProcInfoExecutable = 3
+	protoProcInfoStartTime  = 4
+)
+
+// Field numbers of the SourceEvent message.
+const (
+	protoEventType       = 1
+	protoEventPid        = 2
+	protoEventPPid       = 3
+	protoEventExecutable = 4
+	protoEventCmdline    = 5
+	protoEventExitStatus = 6
+)
+
+// Field numbers of the ExitStatus message.
+const (
+	protoExitStatusCode       = 1
+	protoExitStatusSignal     = 2
+	protoExitStatusCoreDumped = 3
+)
+
+// Field numbers of the SignalRequest message.
+const (
+	protoSignalPid    = 1
+	protoSignalSignal = 2
+)
+
+func protoAppendInt(b []byte, field protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, field, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func protoAppendSint(b []byte, field protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, field, protowire.VarintType)
+	return protowire.AppendVarint(b, protowire.EncodeZigZag(v))
+}
+
+func protoAppendBool(b []byte, field protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = protowire.AppendTag(b, field, protowire.VarintType)
+	return protowire.AppendVarint(b, 1)
+}
+
+func protoAppendString(b []byte, field protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func protoAppendMessage(b []byte, field protowire.Number, m []byte) []byte {
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendBytes(b, m)
+}
+
+// protoDecode calls handler for each varint and length-delimited field of an encoded message, with the value of
+// a varint field, or the contents of a length-delimited field. Fields of other wire types are skipped.
+func protoDecode(data []byte, handler func(field protowire.Number, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		field, wireType, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		var v uint64
+		var b []byte
+		switch wireType {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(data)
+		case protowire.BytesType:
+			b, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(field, wireType, data)
+			if n >= 0 {
+				data = data[n:]
+				continue
+			}
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		err := handler(field, v, b)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emptyMessage is a message with no fields, used for requests and responses that carry no data. Unknown fields
+// are ignored.
+type emptyMessage struct{}
+
+func (m *emptyMessage) appendProto(b []byte) []byte {
+	return b
+}
+
+func (m *emptyMessage) unmarshalProto(data []byte) error {
+	return protoDecode(data, func(field protowire.Number, v uint64, b []byte) error {
+		return nil
+	})
+}
+
+// listProcessesResponse is a ListProcessesResponse message.
+type listProcessesResponse struct {
+	processes []proctree.ProcInfo
+}
+
+func appendProtoProcInfo(b []byte, info *proctree.ProcInfo) []byte {
+	b = protoAppendInt(b, protoProcInfoPid, int64(info.Pid))
+	b = protoAppendInt(b, protoProcInfoPPid, int64(info.PPid))
+	b = protoAppendString(b, protoProcInfoExecutable, info.Executable)
+	return protoAppendInt(b, protoProcInfoStartTime, int64(info.StartTime))
+}
+
+func decodeProtoProcInfo(data []byte) (proctree.ProcInfo, error) {
+	info := proctree.ProcInfo{}
+	err := protoDecode(data, func(field protowire.Number, v uint64, b []byte) error {
+		switch field {
+		case protoProcInfoPid:
+			info.Pid = int(int64(v))
+		case protoProcInfoPPid:
+			info.PPid = int(int64(v))
+		case protoProcInfoExecutable:
+			info.Executable = string(b)
+		case protoProcInfoStartTime:
+			info.StartTime = v
+		}
+		return nil
+	})
+	return info, err
+}
+
+func (m *listProcessesResponse) appendProto(b []byte) []byte {
+	var pb []byte
+	for i := range m.processes {
+		pb = appendProtoProcInfo(pb[:0], &m.processes[i])
+		b = protoAppendMessage(b, protoListProcesses, pb)
+	}
+	return b
+}
+
+func (m *listProcessesResponse) unmarshalProto(data []byte) error {
+	m.processes = []proctree.ProcInfo{}
+	return protoDecode(data, func(field protowire.Number, v uint64, b []byte) error {
+		if field != protoListProcesses {
+			return nil
+		}
+		info, err := decodeProtoProcInfo(b)
+		if err != nil {
+			return err
+		}
+		m.processes = append(m.processes, info)
+		return nil
+	})
+}
+
+// sourceEvent is a SourceEvent message.
+type sourceEvent struct {
+	ev proctree.SourceEvent
+}
+
+func (m *sourceEvent) appendProto(b []byte) []byte {
+	b = protoAppendInt(b, protoEventType, int64(m.ev.Type))
+	b = protoAppendInt(b, protoEventPid, int64(m.ev.Pid))
+	b = protoAppendInt(b, protoEventPPid, int64(m.ev.PPid))
+	b = protoAppendString(b, protoEventExecutable, m.ev.Executable)
+	for _, arg := range m.ev.Cmdline {
+		b = protowire.AppendTag(b, protoEventCmdline, protowire.BytesType)
+		b = protowire.AppendString(b, arg)
+	}
+	if es := m.ev.ExitStatus; es != nil {
+		var eb []byte
+		eb = protoAppendSint(eb, protoExitStatusCode, int64(es.Code))
+		eb = protoAppendInt(eb, protoExitStatusSignal, int64(es.Signal))
+		eb = protoAppendBool(eb, protoExitStatusCoreDumped, es.CoreDumped)
+		b = protoAppendMessage(b, protoEventExitStatus, eb)
+	}
+	return b
+}
+
+func (m *sourceEvent) unmarshalProto(data []byte) error {
+	m.ev = proctree.SourceEvent{}
+	return protoDecode(data, func(field protowire.Number, v uint64, b []byte) error {
+		switch field {
+		case protoEventType:
+			m.ev.Type = proctree.SourceEventType(v)
+		case protoEventPid:
+			m.ev.Pid = int(int64(v))
+		case protoEventPPid:
+			m.ev.PPid = int(int64(v))
+		case protoEventExecutable:
+			m.ev.Executable = string(b)
+		case protoEventCmdline:
+			m.ev.Cmdline = append(m.ev.Cmdline, string(b))
+		case protoEventExitStatus:
+			es := &proctree.ExitStatus{}
+			err := protoDecode(b, func(field protowire.Number, v uint64, b []byte) error {
+				switch field {
+				case protoExitStatusCode:
+					es.Code = int(protowire.DecodeZigZag(v))
+				case protoExitStatusSignal:
+					es.Signal = syscall.Signal(int32(v))
+				case protoExitStatusCoreDumped:
+					es.CoreDumped = v != 0
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			m.ev.ExitStatus = es
+		}
+		return nil
+	})
+}
+
+// signalRequest is a SignalRequest message.
+type signalRequest struct {
+	pid    int
+	signal syscall.Signal
+}
+
+func (m *signalRequest) appendProto(b []byte) []byte {
+	b = protoAppendInt(b, protoSignalPid, int64(m.pid))
+	return protoAppendInt(b, protoSignalSignal, int64(m.signal))
+}
+
+func (m *signalRequest) unmarshalProto(data []byte) error {
+	*m = signalRequest{}
+	return protoDecode(data, func(field protowire.Number, v uint64, b []byte) error {
+		switch field {
+		case protoSignalPid:
+			m.pid = int(int64(v))
+		case protoSignalSignal:
+			m.signal = syscall.Signal(int32(v))
+		}
+		return nil
+	})
+}
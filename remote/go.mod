@@ -0,0 +1,18 @@
+module github.com/sammck-go/proctree/remote
+
+go 1.19
+
+require (
+	github.com/sammck-go/proctree v0.0.0-20261016163736-7bdb827a3019
+	google.golang.org/grpc v1.64.1
+	google.golang.org/protobuf v1.33.0
+)
+
+require (
+	github.com/mitchellh/go-ps v1.0.0 // indirect
+	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -0,0 +1,94 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/sammck-go/proctree"
+	"google.golang.org/grpc"
+)
+
+// defaultCallTimeout is the time allowed for a call to list processes or send a signal.
+const defaultCallTimeout = 30 * time.Second
+
+// Source is a proctree.ProcessEventSource that lists and watches the processes served by an Agent on another
+// host. Pass it to proctree.WithProcessSource to build a ProcTree of the remote host's processes; with
+// proctree.WithRealtimeMonitor, the ProcTree updates shortly after each change reported by the agent. Details
+// that a ProcTree reads from the local system, e.g., command lines, users and resource usage, are not
+// available for remote processes. Source is also a proctree.SignalingProcessSource, so ProcTree.TerminateSubtree
+// signals remote processes through the agent. A Source is safe for concurrent use.
+type Source struct {
+	conn grpc.ClientConnInterface
+}
+
+// NewSource creates a Source that calls the Agent at the other end of a gRPC connection. The connection is owned
+// by the caller, and must remain open while the Source is in use.
+func NewSource(conn grpc.ClientConnInterface) *Source {
+	return &Source{conn: conn}
+}
+
+// Snapshot implements proctree.ProcessSource, listing the processes served by the agent.
+func (s *Source) Snapshot() ([]proctree.ProcInfo, error) {
+	return s.SnapshotContext(context.Background())
+}
+
+// SnapshotContext implements proctree.ContextProcessSource, listing the processes served by the agent until the
+// context is done.
+func (s *Source) SnapshotContext(ctx context.Context) ([]proctree.ProcInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultCallTimeout)
+	defer cancel()
+	resp := &listProcessesResponse{}
+	err := s.conn.Invoke(ctx, listProcessesMethod, &emptyMessage{}, resp, grpc.CallContentSubtype(codecName))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list remote processes: %s", err)
+	}
+	return resp.processes, nil
+}
+
+// Watch implements proctree.ProcessEventSource, reporting the changes reported by the agent until done is closed.
+func (s *Source) Watch(done <-chan struct{}, notify func(proctree.SourceEvent)) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	stream, err := s.conn.NewStream(ctx, &agentServiceDesc.Streams[0], watchMethod, grpc.CallContentSubtype(codecName))
+	if err == nil {
+		err = stream.SendMsg(&emptyMessage{})
+	}
+	if err == nil {
+		err = stream.CloseSend()
+	}
+	for err == nil {
+		ev := &sourceEvent{}
+		err = stream.RecvMsg(ev)
+		if err == nil {
+			notify(ev.ev)
+		}
+	}
+	select {
+	case <-done:
+		return nil
+	default:
+		return fmt.Errorf("Unable to watch remote processes: %s", err)
+	}
+}
+
+// Signal sends a signal to a remote process. Signal numbers are those of the agent's platform. Returns an error
+// if the agent does not allow signals (see WithSignals), or if the process does not exist.
+func (s *Source) Signal(pid int, sig syscall.Signal) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCallTimeout)
+	defer cancel()
+	err := s.conn.Invoke(ctx, signalMethod, &signalRequest{pid: pid, signal: sig}, &emptyMessage{},
+		grpc.CallContentSubtype(codecName))
+	if err != nil {
+		return fmt.Errorf("Unable to signal remote process %d: %s", pid, err)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sammck-go/proctree"
+)
+
+// sshListScript lists the processes of a host. On hosts with procfs, the stat entries of all processes are
+// printed, which include their start times; otherwise, ps is used. The first line of output identifies the
+// format. The script must not contain single quotes, since it is quoted for the remote shell.
+const sshListScript = `if [ -r /proc/1/stat ]; then echo stat; cat /proc/[0-9]*/stat 2>/dev/null; true; ` +
+	`else echo ps; ps -A -o pid= -o ppid= -o comm=; fi`
+
+const (
+	defaultSSHPath    = "ssh"
+	defaultSSHTimeout = 30 * time.Second
+)
+
+// SSHSource is a proctree.ProcessSource that lists the processes of a host by running a shell command on it over
+// SSH, for hosts where an Agent cannot be installed. Only the ssh client and a POSIX shell are required; on Linux
+// hosts, processes are read from /proc, with their start times, and on other hosts they are listed with ps.
+// Changes are not reported as they happen, so a ProcTree that lists an SSHSource is only updated by Update and
+// WithAutoUpdate. Each snapshot opens a new SSH session; use the ssh client's connection sharing (e.g.,
+// ControlMaster) to avoid the cost of authenticating each time. An SSHSource is safe for concurrent use.
+type SSHSource struct {
+	// host is the destination passed to ssh, e.g., "user@host".
+	host string
+
+	// sshPath is the path of the ssh client.
+	sshPath string
+
+	// args are additional arguments passed to ssh before the destination.
+	args []string
+
+	// timeout is the time allowed for each snapshot.
+	timeout time.Duration
+}
+
+// SSHOption is an opaque SSH source option setter created by one of the With functions.
+// It follows the Golang "options" pattern.
+type SSHOption func(*SSHSource)
+
+// NewSSHSource creates an SSHSource that lists the processes of host, which is any destination accepted by ssh,
+// e.g., "user@host" or the name of a host configured in ssh_config. ssh is run in batch mode, so authentication
+// must not require a password or passphrase to be entered.
+func NewSSHSource(host string, opts ...SSHOption) *SSHSource {
+	s := &SSHSource{
+		host:    host,
+		sshPath: defaultSSHPath,
+		args:    []string{},
+		timeout: defaultSSHTimeout,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// WithSSHPath sets the path of the ssh client. The default is "ssh", found in the PATH.
+func WithSSHPath(path string) SSHOption {
+	return func(s *SSHSource) {
+		s.sshPath = path
+	}
+}
+
+// WithSSHArgs adds arguments that are passed to ssh before the destination, e.g., "-p", "2222" or "-i", keyPath.
+// May be repeated.
+func WithSSHArgs(args ...string) SSHOption {
+	return func(s *SSHSource) {
+		s.args = append(s.args, args...)
+	}
+}
+
+// WithSSHTimeout sets the time allowed for each snapshot, including connecting to the host. The default is 30
+// seconds.
+func WithSSHTimeout(timeout time.Duration) SSHOption {
+	return func(s *SSHSource) {
+		s.timeout = timeout
+	}
+}
+
+// Snapshot implements proctree.ProcessSource, listing the processes of the host.
+func (s *SSHSource) Snapshot() ([]proctree.ProcInfo, error) {
+	return s.SnapshotContext(context.Background())
+}
+
+// SnapshotContext implements proctree.ContextProcessSource, listing the processes of the host until the context
+// is done, which kills ssh.
+func (s *SSHSource) SnapshotContext(ctx context.Context) ([]proctree.ProcInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	args := append([]string{"-o", "BatchMode=yes"}, s.args...)
+	args = append(args, "--", s.host, "sh -c '"+sshListScript+"'")
+	cmd := exec.CommandContext(ctx, s.sshPath, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			return nil, fmt.Errorf("Unable to list processes on %q: %s: %s", s.host, err, msg)
+		}
+		return nil, fmt.Errorf("Unable to list processes on %q: %s", s.host, err)
+	}
+	infos, err := parseSSHListing(out)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list processes on %q: %s", s.host, err)
+	}
+	return infos, nil
+}
+
+// parseSSHListing parses the output of sshListScript. Lines that cannot be parsed, e.g., the stat entries of
+// processes whose executable names contain newlines, are skipped.
+func parseSSHListing(out []byte) ([]proctree.ProcInfo, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(nil, 1024*1024)
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("No output from listing")
+	}
+	var parse func(line string) (proctree.ProcInfo, bool)
+	switch format := scanner.Text(); format {
+	case "stat":
+		parse = parseStatLine
+	case "ps":
+		parse = parsePsLine
+	default:
+		return nil, fmt.Errorf("Unrecognized listing format %q", format)
+	}
+	infos := []proctree.ProcInfo{}
+	for scanner.Scan() {
+		info, ok := parse(scanner.Text())
+		if ok {
+			infos = append(infos, info)
+		}
+	}
+	return infos, scanner.Err()
+}
+
+// parseStatLine parses the contents of a /proc/<pid>/stat file. The executable name is parenthesized, and may
+// itself contain spaces and parentheses.
+func parseStatLine(line string) (proctree.ProcInfo, bool) {
+	i := strings.Index(line, " (")
+	j := strings.LastIndex(line, ")")
+	if i < 0 || j < i {
+		return proctree.ProcInfo{}, false
+	}
+	pid, err := strconv.Atoi(line[:i])
+	// ppid is field 4 and starttime is field 22; fields begins at field 3
+	fields := strings.Fields(line[j+1:])
+	if err != nil || len(fields) < 20 {
+		return proctree.ProcInfo{}, false
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return proctree.ProcInfo{}, false
+	}
+	startTime, _ := strconv.ParseUint(fields[19], 10, 64)
+	return proctree.ProcInfo{Pid: pid, PPid: ppid, Executable: line[i+2 : j], StartTime: startTime}, true
+}
+
+// parsePsLine parses a line of "ps -o pid= -o ppid= -o comm=" output. Some platforms print the full path of the
+// executable, which is reduced to its base name.
+func parsePsLine(line string) (proctree.ProcInfo, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return proctree.ProcInfo{}, false
+	}
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return proctree.ProcInfo{}, false
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return proctree.ProcInfo{}, false
+	}
+	// The executable name may contain spaces
+	rest := strings.TrimSpace(line)
+	for n := 0; n < 2; n++ {
+		rest = strings.TrimLeft(rest[strings.IndexAny(rest, " \t"):], " \t")
+	}
+	if strings.HasPrefix(rest, "/") {
+		rest = rest[strings.LastIndex(rest, "/")+1:]
+	}
+	return proctree.ProcInfo{Pid: pid, PPid: ppid, Executable: rest}, true
+}
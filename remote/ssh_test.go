@@ -0,0 +1,78 @@
+package remote
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/sammck-go/proctree"
+)
+
+func TestParseSSHListing(t *testing.T) {
+	stat := "stat\n" +
+		"1 (init) S 0 1 1 0 -1 4194560 0 0 0 0 0 0 0 0 20 0 1 0 5 0 0\n" +
+		"10 (my (odd) shell) S 1 10 10 0 -1 4194560 0 0 0 0 0 0 0 0 20 0 1 0 300 0 0\n" +
+		"truncated\n"
+	infos, err := parseSSHListing([]byte(stat))
+	if err != nil {
+		t.Fatalf("parseSSHListing() returned error: %s", err)
+	}
+	expected := []proctree.ProcInfo{
+		{Pid: 1, PPid: 0, Executable: "init", StartTime: 5},
+		{Pid: 10, PPid: 1, Executable: "my (odd) shell", StartTime: 300},
+	}
+	if len(infos) != len(expected) || infos[0] != expected[0] || infos[1] != expected[1] {
+		t.Errorf("parseSSHListing() returned %v, expected %v", infos, expected)
+	}
+
+	ps := "ps\n" +
+		"    1     0 /sbin/launchd\n" +
+		"  420     1 /Applications/My App.app/Contents/MacOS/My App\n" +
+		"  421   420 kworker/0:1\n"
+	infos, err = parseSSHListing([]byte(ps))
+	if err != nil {
+		t.Fatalf("parseSSHListing() returned error: %s", err)
+	}
+	expected = []proctree.ProcInfo{
+		{Pid: 1, PPid: 0, Executable: "launchd"},
+		{Pid: 420, PPid: 1, Executable: "My App"},
+		{Pid: 421, PPid: 420, Executable: "kworker/0:1"},
+	}
+	if len(infos) != len(expected) || infos[0] != expected[0] || infos[1] != expected[1] || infos[2] != expected[2] {
+		t.Errorf("parseSSHListing() returned %v, expected %v", infos, expected)
+	}
+
+	_, err = parseSSHListing([]byte("Welcome to host\n"))
+	if err == nil {
+		t.Errorf("parseSSHListing() succeeded with unrecognized output")
+	}
+}
+
+func TestSSHSource(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The fake ssh client requires a POSIX shell")
+	}
+	// The fake ssh client runs the remote command locally
+	sshPath := filepath.Join(t.TempDir(), "ssh")
+	err := os.WriteFile(sshPath, []byte("#!/bin/sh\nfor cmd; do :; done\nexec sh -c \"$cmd\"\n"), 0755)
+	if err != nil {
+		t.Fatalf("os.WriteFile() returned error: %s", err)
+	}
+
+	pt, err := proctree.New(
+		proctree.WithProcessSource(NewSSHSource("localhost", WithSSHPath(sshPath), WithSSHArgs("-p", "22"))),
+		proctree.WithRootPid(os.Getpid()))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+	if pt.PidProcess(os.Getpid()) == nil {
+		t.Errorf("Current process was not listed")
+	}
+
+	_, err = NewSSHSource("localhost", WithSSHPath(filepath.Join(t.TempDir(), "missing"))).Snapshot()
+	if err == nil {
+		t.Errorf("Snapshot() succeeded with a missing ssh client")
+	}
+}
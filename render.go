@@ -0,0 +1,371 @@
+package proctree
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LabelField identifies a field included in the label of each Process rendered by ProcTree.Render.
+type LabelField int
+
+const (
+	// LabelPid renders the pid of the Process, in brackets.
+	LabelPid LabelField = iota
+
+	// LabelPPid renders the parent pid of the Process, as "ppid=<pid>".
+	LabelPPid
+
+	// LabelExecutable renders the executable name of the Process.
+	LabelExecutable
+
+	// LabelCmdline renders the command line of the Process: the captured command line, if any (see
+	// Process.Cmdline), or the command line read from the system for a live Process (see Process.SystemCmdline).
+	LabelCmdline
+
+	// LabelUser renders the name of the effective user of the Process, if it is known.
+	LabelUser
+
+	// LabelExitStatus renders the exit status of a tombstoned Process, e.g., "(exited: code 1)".
+	LabelExitStatus
+
+	// LabelCPUTime renders the CPU time consumed by a live Process, e.g., "cpu=1.25s" (see Process.Usage).
+	LabelCPUTime
+
+	// LabelRSS renders the resident set size of a live Process, e.g., "rss=12.5M" (see Process.Usage).
+	LabelRSS
+
+	// LabelStartTime renders the local time at which a live Process started, e.g., "start=2021-06-01T09:30:00"
+	// (see Process.StartTime).
+	LabelStartTime
+)
+
+// lineArt is the set of strings used to draw the branches of a rendered tree.
+type lineArt struct {
+	link string
+	mid  string
+	end  string
+}
+
+var (
+	unicodeLineArt = lineArt{link: "│   ", mid: "├── ", end: "└── "}
+	asciiLineArt   = lineArt{link: "|   ", mid: "|-- ", end: "`-- "}
+)
+
+// RenderOption is an opaque rendering option setter created by one of the With functions.
+// It follows the Golang "options" pattern.
+type RenderOption func(*renderConfig)
+
+type renderConfig struct {
+	// labelFields are the fields included in each label, in order.
+	labelFields []LabelField
+
+	// art is the line art used to draw branches.
+	art lineArt
+
+	// decorator, if not nil, rewrites the label of each Process.
+	decorator func(proc *Process, label string) string
+
+	// maxDepth, if not negative, is the maximum depth of rendered Processes below each root.
+	maxDepth int
+
+	// collapseSiblings merges sibling leaf Processes with the same executable name into a single line.
+	collapseSiblings bool
+}
+
+func newRenderConfig(opts ...RenderOption) *renderConfig {
+	rc := &renderConfig{
+		labelFields: []LabelField{LabelPid, LabelExecutable},
+		art:         unicodeLineArt,
+		maxDepth:    -1,
+	}
+	for _, opt := range opts {
+		opt(rc)
+	}
+	return rc
+}
+
+// WithLabelFields sets the fields included in the label of each Process, in order. The default is LabelPid
+// followed by LabelExecutable.
+func WithLabelFields(fields ...LabelField) RenderOption {
+	return func(rc *renderConfig) {
+		rc.labelFields = append([]LabelField{}, fields...)
+	}
+}
+
+// WithLabelDecorator sets a function that rewrites the label of each rendered Process, e.g., to highlight it
+// with terminal escape sequences. The function is called without holding the tree lock, so it may call methods
+// of the Process. By default, labels are not rewritten.
+func WithLabelDecorator(decorator func(proc *Process, label string) string) RenderOption {
+	return func(rc *renderConfig) {
+		rc.decorator = decorator
+	}
+}
+
+// WithRenderDepth limits the rendered tree to Processes at most depth levels below each root, e.g., a depth of 0
+// renders only the roots. Processes whose children are not rendered are labeled with the number of descendants
+// that are hidden, e.g., "[1234]  make (+37)". Unlike WithMaxDepth, the hidden Processes remain in the tree. By
+// default, the entire included tree is rendered.
+func WithRenderDepth(depth int) RenderOption {
+	return func(rc *renderConfig) {
+		rc.maxDepth = depth
+	}
+}
+
+// WithCollapsedSiblings merges sibling Processes that have the same executable name and no children into a
+// single line, labeled with their number and executable name, e.g., "12*[chrome]", as pstree does. This keeps
+// trees with many identical workers, e.g., browsers and build farms, readable. By default, every Process is
+// rendered on its own line.
+func WithCollapsedSiblings() RenderOption {
+	return func(rc *renderConfig) {
+		rc.collapseSiblings = true
+	}
+}
+
+// WithASCIILineArt draws branches with ASCII characters, for terminals and logs that cannot display Unicode.
+func WithASCIILineArt() RenderOption {
+	return func(rc *renderConfig) {
+		rc.art = asciiLineArt
+	}
+}
+
+// WithUnicodeLineArt draws branches with Unicode box-drawing characters. This is the default.
+func WithUnicodeLineArt() RenderOption {
+	return func(rc *renderConfig) {
+		rc.art = unicodeLineArt
+	}
+}
+
+// renderLine is a single rendered Process, captured while the tree is locked, or a heading.
+type renderLine struct {
+	prefix     string
+	heading    string
+	proc       *Process
+	hidden     int
+	pid        int
+	ppid       int
+	executable string
+	cmdline    []string
+	uid        int
+	exitStatus *ExitStatus
+	tombstone  bool
+}
+
+// lockedRenderLine returns the line for a Process.
+func (p *Process) lockedRenderLine(rc *renderConfig, prefix string) renderLine {
+	line := renderLine{
+		prefix:     prefix,
+		proc:       p,
+		pid:        p.lockedPid(),
+		ppid:       p.gopsProcess.PPid(),
+		executable: p.lockedExecutable(),
+		cmdline:    p.lockedCmdline(),
+		uid:        -1,
+		exitStatus: p.lockedExitStatus(),
+		tombstone:  p.isTombstone,
+	}
+	for _, field := range rc.labelFields {
+		if field == LabelUser {
+			line.uid = p.lockedUID()
+		}
+	}
+	return line
+}
+
+// lockedRenderLines appends the lines for a Process at a depth below its root, and its included subtree.
+func (p *Process) lockedRenderLines(lines []renderLine, rc *renderConfig, indent string, last bool, depth int) []renderLine {
+	edge, childIndent := rc.art.mid, indent+rc.art.link
+	if last {
+		edge, childIndent = rc.art.end, indent+strings.Repeat(" ", len([]rune(rc.art.link)))
+	}
+	line := p.lockedRenderLine(rc, indent+edge)
+	if rc.maxDepth >= 0 && depth >= rc.maxDepth {
+		line.hidden = p.subtreeCount - 1
+		return append(lines, line)
+	}
+	lines = append(lines, line)
+	groups := rc.lockedSiblingGroups(p.lockedChildren())
+	for i, group := range groups {
+		if len(group) == 1 {
+			lines = group[0].lockedRenderLines(lines, rc, childIndent, i == len(groups)-1, depth+1)
+			continue
+		}
+		edge := rc.art.mid
+		if i == len(groups)-1 {
+			edge = rc.art.end
+		}
+		heading := strconv.Itoa(len(group)) + "*[" + group[0].lockedExecutable() + "]"
+		lines = append(lines, renderLine{prefix: childIndent + edge, heading: heading})
+	}
+	return lines
+}
+
+// lockedSiblingGroups returns the groups of sibling Processes that are rendered on the same line, in order: each
+// Process alone, or with WithCollapsedSiblings, each set of Processes with the same executable name and no
+// children, at the position of the first.
+func (rc *renderConfig) lockedSiblingGroups(children []*Process) [][]*Process {
+	groups := make([][]*Process, 0, len(children))
+	leafGroups := make(map[string]int)
+	for _, child := range children {
+		if rc.collapseSiblings && len(child.lockedChildren()) == 0 {
+			executable := child.lockedExecutable()
+			i, ok := leafGroups[executable]
+			if ok {
+				groups[i] = append(groups[i], child)
+				continue
+			}
+			leafGroups[executable] = len(groups)
+		}
+		groups = append(groups, []*Process{child})
+	}
+	return groups
+}
+
+// renderPrefixes returns a function that returns the prefix of each of count lines beneath a parent line, and
+// the indent of the lines beneath it.
+func renderPrefixes(rc *renderConfig, indent string, count int) func() (string, string) {
+	i := 0
+	return func() (string, string) {
+		i++
+		if i == count {
+			return indent + rc.art.end, indent + strings.Repeat(" ", len([]rune(rc.art.link)))
+		}
+		return indent + rc.art.mid, indent + rc.art.link
+	}
+}
+
+// label formats the label of a rendered Process, or returns the heading.
+func (line *renderLine) label(rc *renderConfig, users userNames) string {
+	if line.heading != "" {
+		return line.heading
+	}
+	var sb strings.Builder
+	var usage *Usage
+	for _, field := range rc.labelFields {
+		var s string
+		switch field {
+		case LabelPid:
+			// The pid is separated from the following field by two spaces
+			s = "[" + strconv.Itoa(line.pid) + "] "
+		case LabelPPid:
+			s = "ppid=" + strconv.Itoa(line.ppid)
+		case LabelExecutable:
+			s = line.executable
+		case LabelCmdline:
+			cmdline := line.cmdline
+			if cmdline == nil && !line.tombstone && line.proc != nil {
+				cmdline, _ = line.proc.SystemCmdline()
+			}
+			s = strings.Join(cmdline, " ")
+		case LabelUser:
+			s = users.lookup(line.uid)
+		case LabelExitStatus:
+			if line.tombstone {
+				es := line.exitStatus
+				switch {
+				case es == nil:
+					s = "(exited)"
+				case es.Signal != 0:
+					s = fmt.Sprintf("(exited: signal %s)", es.Signal)
+				default:
+					s = fmt.Sprintf("(exited: code %d)", es.Code)
+				}
+			}
+		case LabelCPUTime, LabelRSS:
+			if usage == nil {
+				usage = &Usage{Processes: -1}
+				if !line.tombstone && line.proc != nil {
+					u, err := line.proc.Usage()
+					if err == nil {
+						usage = &u
+					}
+				}
+			}
+			if usage.Processes < 0 {
+				break
+			}
+			if field == LabelCPUTime {
+				s = "cpu=" + usage.CPUTime.Round(10*time.Millisecond).String()
+			} else {
+				s = "rss=" + formatBytes(usage.RSS)
+			}
+		case LabelStartTime:
+			if !line.tombstone && line.proc != nil {
+				start, err := line.proc.StartTime()
+				if err == nil {
+					s = "start=" + start.Format("2006-01-02T15:04:05")
+				}
+			}
+		}
+		if s == "" {
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(s)
+	}
+	label := strings.TrimRight(sb.String(), " ")
+	if line.hidden > 0 {
+		label += " (+" + strconv.Itoa(line.hidden) + ")"
+	}
+	return label
+}
+
+// formatBytes formats a number of bytes with a binary unit suffix, e.g., "12.5M".
+func formatBytes(n uint64) string {
+	const units = "KMGTPE"
+	if n < 1024 {
+		return strconv.FormatUint(n, 10)
+	}
+	value := float64(n)
+	i := -1
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	return strconv.FormatFloat(value, 'f', 1, 64) + units[i:i+1]
+}
+
+// Render writes the included tree to w as indented text with line art, beneath a root line of ".", e.g.:
+//
+//	.
+//	└── [1234]  bash
+//	    ├── [1240]  make
+//	    └── [1251]  less
+//
+// This is the format printed by the proctree command. Options select the label fields and the line art.
+func (pt *ProcTree) Render(w io.Writer, opts ...RenderOption) error {
+	rc := newRenderConfig(opts...)
+
+	pt.plock()
+	lines := []renderLine{}
+	for i, root := range pt.includedRootProcs {
+		lines = root.lockedRenderLines(lines, rc, "", i == len(pt.includedRootProcs)-1, 0)
+	}
+	pt.punlock()
+
+	return writeRenderLines(w, rc, ".", lines)
+}
+
+// writeRenderLines writes a root line followed by rendered lines. User names are looked up without holding the
+// tree lock.
+func writeRenderLines(w io.Writer, rc *renderConfig, root string, lines []renderLine) error {
+	users := userNames{}
+	bw := bufio.NewWriter(w)
+	bw.WriteString(root)
+	bw.WriteByte('\n')
+	for i := range lines {
+		bw.WriteString(lines[i].prefix)
+		label := lines[i].label(rc, users)
+		if rc.decorator != nil && lines[i].proc != nil {
+			label = rc.decorator(lines[i].proc, label)
+		}
+		bw.WriteString(label)
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
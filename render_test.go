@@ -0,0 +1,147 @@
+package proctree
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	pt, err := LoadJSON(strings.NewReader(`{"roots":[{"pid":1,"executable":"init","children":[
+		{"pid":10,"ppid":1,"executable":"bash","children":[{"pid":12,"ppid":10,"executable":"make"}]},
+		{"pid":11,"ppid":1,"executable":"cron","tombstone":true,"exitStatus":{"code":2}}]}]}`))
+	if err != nil {
+		t.Fatalf("LoadJSON() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	var buf bytes.Buffer
+	err = pt.Render(&buf)
+	if err != nil {
+		t.Fatalf("pt.Render() returned error: %s", err)
+	}
+	expected := ".\n" +
+		"└── [1]  init\n" +
+		"    ├── [10]  bash\n" +
+		"    │   └── [12]  make\n" +
+		"    └── [11]  cron\n"
+	if buf.String() != expected {
+		t.Errorf("pt.Render() wrote:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+
+	buf.Reset()
+	err = pt.Render(&buf, WithASCIILineArt(), WithLabelFields(LabelExecutable, LabelPid, LabelExitStatus))
+	if err != nil {
+		t.Fatalf("pt.Render() returned error: %s", err)
+	}
+	expected = ".\n" +
+		"`-- init [1]\n" +
+		"    |-- bash [10]\n" +
+		"    |   `-- make [12]\n" +
+		"    `-- cron [11]  (exited: code 2)\n"
+	if buf.String() != expected {
+		t.Errorf("pt.Render() wrote:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+
+	buf.Reset()
+	err = pt.Render(&buf, WithLabelDecorator(func(proc *Process, label string) string {
+		if proc.Pid() == 11 {
+			return "~" + label + "~"
+		}
+		return label
+	}))
+	if err != nil {
+		t.Fatalf("pt.Render() returned error: %s", err)
+	}
+	if !strings.HasSuffix(buf.String(), "    └── ~[11]  cron~\n") {
+		t.Errorf("pt.Render() with a label decorator wrote:\n%s", buf.String())
+	}
+}
+
+func TestRenderDepthAndCollapse(t *testing.T) {
+	pt, err := LoadJSON(strings.NewReader(`{"roots":[{"pid":1,"executable":"init","children":[
+		{"pid":10,"ppid":1,"executable":"chrome","children":[
+			{"pid":11,"ppid":10,"executable":"renderer"},
+			{"pid":12,"ppid":10,"executable":"gpu"},
+			{"pid":13,"ppid":10,"executable":"renderer"},
+			{"pid":14,"ppid":10,"executable":"renderer","children":[{"pid":15,"ppid":14,"executable":"helper"}]},
+			{"pid":16,"ppid":10,"executable":"renderer"}]},
+		{"pid":20,"ppid":1,"executable":"make","children":[{"pid":21,"ppid":20,"executable":"cc","children":[
+			{"pid":22,"ppid":21,"executable":"as"}]}]}]}]}`))
+	if err != nil {
+		t.Fatalf("LoadJSON() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	var buf bytes.Buffer
+	err = pt.Render(&buf, WithASCIILineArt(), WithCollapsedSiblings())
+	if err != nil {
+		t.Fatalf("pt.Render() returned error: %s", err)
+	}
+	expected := ".\n" +
+		"`-- [1]  init\n" +
+		"    |-- [10]  chrome\n" +
+		"    |   |-- 3*[renderer]\n" +
+		"    |   |-- [12]  gpu\n" +
+		"    |   `-- [14]  renderer\n" +
+		"    |       `-- [15]  helper\n" +
+		"    `-- [20]  make\n" +
+		"        `-- [21]  cc\n" +
+		"            `-- [22]  as\n"
+	if buf.String() != expected {
+		t.Errorf("pt.Render() wrote:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+
+	buf.Reset()
+	err = pt.Render(&buf, WithASCIILineArt(), WithRenderDepth(1))
+	if err != nil {
+		t.Fatalf("pt.Render() returned error: %s", err)
+	}
+	expected = ".\n" +
+		"`-- [1]  init\n" +
+		"    |-- [10]  chrome (+6)\n" +
+		"    `-- [20]  make (+2)\n"
+	if buf.String() != expected {
+		t.Errorf("pt.Render() wrote:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestRenderUsage(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("resource usage labels are only tested on Linux")
+	}
+	pt, err := New(WithRootSelf())
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	var buf bytes.Buffer
+	err = pt.Render(&buf, WithLabelFields(LabelPid, LabelCPUTime, LabelRSS, LabelStartTime, LabelCmdline))
+	if err != nil {
+		t.Fatalf("pt.Render() returned error: %s", err)
+	}
+	line := strings.Split(buf.String(), "\n")[1]
+	fields := strings.Fields(line)
+	if len(fields) < 6 || !strings.HasPrefix(fields[2], "cpu=") || !strings.HasPrefix(fields[3], "rss=") ||
+		!strings.HasPrefix(fields[4], "start=") || fields[5] != os.Args[0] {
+		t.Errorf("pt.Render() wrote %q for the calling process", line)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[uint64]string{
+		0:                  "0",
+		1023:               "1023",
+		1024:               "1.0K",
+		12*1024*1024 + 1e5: "12.1M",
+		3 << 40:            "3.0T",
+	}
+	for n, expected := range tests {
+		if s := formatBytes(n); s != expected {
+			t.Errorf("formatBytes(%d) returned %q, expected %q", n, s, expected)
+		}
+	}
+}
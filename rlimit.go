@@ -0,0 +1,98 @@
+package proctree
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RlimInfinity is the resource limit value that represents no limit.
+const RlimInfinity = ^uint64(0)
+
+// livePid returns the pid of the Process, or a PidError for op reporting ErrNotLocal if the ProcTree is read-only
+// or was not built from the processes of the local system, or ErrProcessGone if the Process is a tombstone, or if
+// its pid has been reused by a new process since the last update, where start times are known.
+func (p *Process) livePid(op string) (int, error) {
+	p.prlock()
+	pid := p.lockedPid()
+	isTombstone := p.isTombstone
+	startTime := p.startTime
+	source := p.pt.source
+	readOnly := p.pt.readOnly
+	p.prunlock()
+	ss, ok := source.(systemSource)
+	if !ok || readOnly {
+		return pid, &PidError{Op: op, Pid: pid, Err: ErrNotLocal}
+	}
+	if isTombstone {
+		return pid, &PidError{Op: op, Pid: pid, Err: ErrProcessGone}
+	}
+	if startTime != 0 {
+		curStartTime, err := ss.procfs.processStartTime(pid)
+		if err == nil && curStartTime != 0 && curStartTime != startTime {
+			return pid, &PidError{Op: op, Pid: pid, Err: ErrProcessGone}
+		}
+	}
+	return pid, nil
+}
+
+// Rlimit returns the current soft and hard limits of a Process for a resource (e.g., syscall.RLIMIT_NOFILE),
+// using prlimit(2). Returns a PidError reporting ErrProcessGone if the Process has exited, or its pid has been
+// reused, or ErrNotLocal if it is not a process of the local system. Only supported on Linux.
+func (p *Process) Rlimit(resource int) (soft uint64, hard uint64, err error) {
+	op := fmt.Sprintf("get resource %d limit of", resource)
+	pid, err := p.livePid(op)
+	if err != nil {
+		return 0, 0, err
+	}
+	soft, hard, err = getPidRlimit(pid, resource)
+	if err != nil {
+		return 0, 0, &PidError{Op: op, Pid: pid, Err: err}
+	}
+	return soft, hard, nil
+}
+
+// SetRlimit sets the soft and hard limits of a running Process for a resource (e.g., syscall.RLIMIT_NOFILE),
+// using prlimit(2). Use RlimInfinity for an unlimited value. Raising a hard limit requires CAP_SYS_RESOURCE.
+// Returns a PidError reporting ErrProcessGone, without setting any limit, if the Process has exited, or its pid
+// has been reused by a new process, or ErrNotLocal if it is not a process of the local system. Only supported on
+// Linux.
+func (p *Process) SetRlimit(resource int, soft uint64, hard uint64) error {
+	op := fmt.Sprintf("set resource %d limit of", resource)
+	pid, err := p.livePid(op)
+	if err == nil {
+		err = setPidRlimit(pid, resource, soft, hard)
+		if err != nil {
+			err = &PidError{Op: op, Pid: pid, Err: err}
+		}
+	}
+	logOp(p.pt.currentLogger(), "Set resource limit", err, "pid", pid, "resource", resource, "soft", soft,
+		"hard", hard)
+	return err
+}
+
+// SetSubtreeRlimit sets the soft and hard limits for a resource on every live Process in the subtree rooted
+// at this Process, as with SetRlimit. Only subtrees enabled by configuration are included. All processes are
+// attempted even if some fail; the returned error describes every failure.
+func (p *Process) SetSubtreeRlimit(resource int, soft uint64, hard uint64) error {
+	failures := []string{}
+	err := p.WalkSubtree(func(proc *Process) error {
+		proc.plock()
+		isTombstone := proc.isTombstone
+		proc.punlock()
+		if isTombstone {
+			return nil
+		}
+		err := proc.SetRlimit(resource, soft, hard)
+		if err != nil {
+			failures = append(failures, err.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("Unable to set resource limits for %d processes: %s", len(failures), strings.Join(failures, "; "))
+	}
+	return nil
+}
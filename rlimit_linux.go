@@ -0,0 +1,29 @@
+package proctree
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+func prlimit(pid int, resource int, newLimit *syscall.Rlimit, oldLimit *syscall.Rlimit) error {
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), uintptr(resource),
+		uintptr(unsafe.Pointer(newLimit)), uintptr(unsafe.Pointer(oldLimit)), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func getPidRlimit(pid int, resource int) (soft uint64, hard uint64, err error) {
+	var limit syscall.Rlimit
+	err = prlimit(pid, resource, nil, &limit)
+	if err != nil {
+		return 0, 0, err
+	}
+	return limit.Cur, limit.Max, nil
+}
+
+func setPidRlimit(pid int, resource int, soft uint64, hard uint64) error {
+	limit := syscall.Rlimit{Cur: soft, Max: hard}
+	return prlimit(pid, resource, &limit, nil)
+}
@@ -0,0 +1,79 @@
+package proctree
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+	"testing"
+)
+
+func TestSetRlimit(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	err := cmd.Start()
+	if err != nil {
+		t.Fatalf("cmd.Start() returned error: %s", err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	pt, err := New(WithRootPid(cmd.Process.Pid))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	proc := pt.PidProcess(cmd.Process.Pid)
+	_, hard, err := proc.Rlimit(syscall.RLIMIT_NOFILE)
+	if err != nil {
+		t.Fatalf("proc.Rlimit() returned error: %s", err)
+	}
+	err = proc.SetSubtreeRlimit(syscall.RLIMIT_NOFILE, 64, hard)
+	if err != nil {
+		t.Fatalf("proc.SetSubtreeRlimit() returned error: %s", err)
+	}
+	soft, newHard, err := proc.Rlimit(syscall.RLIMIT_NOFILE)
+	if err != nil {
+		t.Fatalf("proc.Rlimit() returned error: %s", err)
+	}
+	if soft != 64 || newHard != hard {
+		t.Errorf("Resource limits (%d, %d) do not match expected (64, %d)", soft, newHard, hard)
+	}
+}
+
+func TestSetRlimitExited(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	err := cmd.Start()
+	if err != nil {
+		t.Fatalf("cmd.Start() returned error: %s", err)
+	}
+	pt, err := New(WithRootPid(cmd.Process.Pid))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+	proc := pt.PidProcess(cmd.Process.Pid)
+
+	// A pid whose start time has changed has been reused by a new process
+	pt.plock()
+	startTime := proc.startTime
+	proc.startTime = startTime + 1
+	pt.punlock()
+	err = proc.SetRlimit(syscall.RLIMIT_NOFILE, 64, RlimInfinity)
+	if !errors.Is(err, ErrProcessGone) {
+		t.Errorf("proc.SetRlimit() of a reused pid returned %v, expected ErrProcessGone", err)
+	}
+	pt.plock()
+	proc.startTime = startTime
+	pt.punlock()
+
+	cmd.Process.Kill()
+	cmd.Wait()
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("pt.Update() returned error: %s", err)
+	}
+	err = proc.SetRlimit(syscall.RLIMIT_NOFILE, 64, RlimInfinity)
+	if !errors.Is(err, ErrProcessGone) {
+		t.Errorf("proc.SetRlimit() of a tombstone returned %v, expected ErrProcessGone", err)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package proctree
+
+import (
+	"fmt"
+)
+
+func getPidRlimit(pid int, resource int) (soft uint64, hard uint64, err error) {
+	return 0, 0, fmt.Errorf("prlimit is not supported on this platform")
+}
+
+func setPidRlimit(pid int, resource int, soft uint64, hard uint64) error {
+	return fmt.Errorf("prlimit is not supported on this platform")
+}
@@ -0,0 +1,131 @@
+package proctree
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// GroupBy selects the key by which ProcTree.Rollup groups Processes.
+type GroupBy int
+
+const (
+	// GroupByUser groups Processes by the name of their effective user.
+	GroupByUser GroupBy = iota
+
+	// GroupByExecutable groups Processes by executable name.
+	GroupByExecutable
+
+	// GroupByCgroup groups Processes by cgroup path (see Rollup).
+	GroupByCgroup
+)
+
+func (g GroupBy) String() string {
+	switch g {
+	case GroupByUser:
+		return "GroupByUser"
+	case GroupByExecutable:
+		return "GroupByExecutable"
+	case GroupByCgroup:
+		return "GroupByCgroup"
+	default:
+		return "GroupBy(unknown)"
+	}
+}
+
+// RollupGroup is the aggregate of a group of Processes returned by ProcTree.Rollup.
+type RollupGroup struct {
+	// Key is the user name, executable name or cgroup path shared by the Processes in the group. It is "" for
+	// Processes whose key is not known.
+	Key string
+
+	// Count is the number of live included Processes in the group.
+	Count int
+
+	// Usage is the aggregate resource usage of the Processes in the group (see Process.SubtreeUsage). It is zero
+	// if resource usage is not available, e.g., for a ProcTree that is not updated from the system.
+	Usage Usage
+}
+
+// Rollup groups the live included Processes by user, executable name or cgroup, and returns the number of
+// Processes and their aggregate resource usage for each group, sorted by key. With GroupByCgroup, Processes are
+// grouped by their path in the unified (cgroup v2) hierarchy, or in the first listed hierarchy on systems with
+// only cgroup v1. Usage and cgroups are read from the system without holding the tree lock, so processes that
+// exit during the call are counted but contribute no usage. Returns an error if GroupByUser is requested on a
+// platform that does not support user ids, or GroupByCgroup on a platform other than Linux or for a ProcTree
+// that is not updated from the system.
+func (pt *ProcTree) Rollup(by GroupBy) ([]RollupGroup, error) {
+	type member struct {
+		pid        int
+		executable string
+		uid        int
+	}
+	members := []member{}
+	pt.plock()
+	readOnly := pt.readOnly
+	fds := pt.cfg.MetadataEnabled(MetadataFDs)
+	cgroupErr := pt.cfg.checkMetadata(MetadataCgroup)
+	for _, proc := range pt.includedProcs {
+		if proc.isTombstone {
+			continue
+		}
+		m := member{pid: proc.lockedPid(), executable: proc.lockedExecutable(), uid: -1}
+		if by == GroupByUser {
+			m.uid = proc.lockedUID()
+		}
+		members = append(members, m)
+	}
+	pt.punlock()
+
+	switch by {
+	case GroupByUser:
+		if !readOnly {
+			_, err := defaultProcfs.processUID(os.Getpid())
+			if err != nil {
+				return nil, fmt.Errorf("Unable to group processes by user: %s", err)
+			}
+		}
+	case GroupByExecutable:
+	case GroupByCgroup:
+		if readOnly {
+			return nil, fmt.Errorf("Unable to group processes by cgroup in a ProcTree that is not updated from the system")
+		}
+		if cgroupErr != nil {
+			return nil, fmt.Errorf("Unable to group processes by cgroup: %w", cgroupErr)
+		}
+		_, err := defaultProcfs.processCgroup(os.Getpid())
+		if err != nil {
+			return nil, fmt.Errorf("Unable to group processes by cgroup: %s", err)
+		}
+	default:
+		return nil, fmt.Errorf("Invalid GroupBy value %d", int(by))
+	}
+
+	// Keys, usage and user names are looked up without holding the tree lock
+	users := userNames{}
+	pidsByKey := make(map[string][]int)
+	for _, m := range members {
+		var key string
+		switch by {
+		case GroupByUser:
+			key = users.lookup(m.uid)
+		case GroupByExecutable:
+			key = m.executable
+		default:
+			key, _ = pt.procfs.processCgroup(m.pid)
+		}
+		pidsByKey[key] = append(pidsByKey[key], m.pid)
+	}
+	groups := make([]RollupGroup, 0, len(pidsByKey))
+	for key, pids := range pidsByKey {
+		group := RollupGroup{Key: key, Count: len(pids)}
+		if !readOnly {
+			group.Usage = livePidsUsage(pt.procfs, pids, fds)
+		}
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Key < groups[j].Key
+	})
+	return groups, nil
+}
@@ -0,0 +1,81 @@
+package proctree
+
+import (
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestRollupByExecutable(t *testing.T) {
+	pt := loadTestTree(t)
+	defer pt.Close()
+
+	groups, err := pt.Rollup(GroupByExecutable)
+	if err != nil {
+		t.Fatalf("Rollup() returned error: %s", err)
+	}
+	expected := []RollupGroup{
+		{Key: "cron", Count: 1},
+		{Key: "helper", Count: 1},
+		{Key: "init", Count: 1},
+		{Key: "supervisor", Count: 1},
+		{Key: "worker", Count: 2},
+	}
+	if len(groups) != len(expected) {
+		t.Fatalf("Rollup() returned %+v, expected %+v", groups, expected)
+	}
+	for i := range groups {
+		if groups[i] != expected[i] {
+			t.Errorf("Rollup() returned %+v, expected %+v", groups, expected)
+			break
+		}
+	}
+
+	_, err = pt.Rollup(GroupByCgroup)
+	if err == nil {
+		t.Errorf("Rollup(GroupByCgroup) of a read-only tree did not return an error")
+	}
+}
+
+func TestRollupByCgroup(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("cgroups are only supported on Linux")
+	}
+	pt, err := New(WithRootPid(os.Getpid()))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	cgroup, err := defaultProcfs.processCgroup(os.Getpid())
+	if err != nil {
+		t.Fatalf("processCgroup() returned error: %s", err)
+	}
+	groups, err := pt.Rollup(GroupByCgroup)
+	if err != nil {
+		t.Fatalf("Rollup() returned error: %s", err)
+	}
+	if len(groups) != 1 || groups[0].Key != cgroup || groups[0].Count != 1 || groups[0].Usage.Processes != 1 {
+		t.Errorf("Rollup() returned %+v, expected a single group for cgroup %q", groups, cgroup)
+	}
+}
+
+func TestParseCgroup(t *testing.T) {
+	for _, tc := range []struct {
+		cgroup   string
+		expected string
+	}{
+		{"0::/user.slice/session-1.scope\n", "/user.slice/session-1.scope"},
+		{"12:pids:/docker/abc\n1:name=systemd:/docker/abc\n0::/docker/abc\n", "/docker/abc"},
+		{"12:pids:/job\n11:cpu,cpuacct:/other\n", "/job"},
+	} {
+		cgroup, err := parseCgroup(tc.cgroup)
+		if err != nil || cgroup != tc.expected {
+			t.Errorf("parseCgroup(%q) returned %q, %v; expected %q", tc.cgroup, cgroup, err, tc.expected)
+		}
+	}
+	_, err := parseCgroup("")
+	if err == nil {
+		t.Errorf("parseCgroup(\"\") did not return an error")
+	}
+}
@@ -0,0 +1,121 @@
+package proctree
+
+import (
+	"fmt"
+	"sort"
+)
+
+// AddRoot adds a pid to the configured roots of the tree, as with WithRootPid, without recreating the ProcTree.
+// The included tree is adjusted by the next update. If the ProcTree previously had no configured roots, only the
+// subtrees of roots added with AddRoot are included after the next update. Returns an error if the process does
+// not exist (see ErrRootPidNotFound) and roots are not lenient (see WithLenientRoots), or if the ProcTree is
+// read-only. Adding a pid that is already a root has no effect.
+func (pt *ProcTree) AddRoot(pid int) error {
+	pt.plock()
+	err := pt.lockedAddRoot(pid)
+	log := pt.cfg.logger
+	pt.punlock()
+	logOp(log, "Add root", err, "pid", pid)
+	return err
+}
+
+func (pt *ProcTree) lockedAddRoot(pid int) error {
+	if pt.readOnly {
+		return fmt.Errorf("Unable to add a root to a read-only ProcTree")
+	}
+	if pid <= 0 {
+		return fmt.Errorf("Invalid root pid %d", pid)
+	}
+	if containsPid(pt.cfg.rootPids, pid) {
+		return nil
+	}
+	if !pt.cfg.lenientRoots {
+		err := pt.lockedCheckPidExists(pid)
+		if err != nil {
+			return err
+		}
+	}
+	if pt.cfgRootProcs == nil {
+		pt.cfgRootProcs = []*Process{}
+	}
+	pt.cfg = pt.cfg.Refine(WithRootPid(pid))
+	pt.pendingRootPids = append(pt.pendingRootPids, pid)
+	return nil
+}
+
+// lockedResolveRoot returns the Process of a configured root pid, or nil if there is no Process with the pid,
+// or its executable name is not the one configured with WithRootPidExecutable.
+func (pt *ProcTree) lockedResolveRoot(pid int) *Process {
+	proc, ok := pt.pidMap[pid]
+	if !ok {
+		return nil
+	}
+	executable, ok := pt.cfg.rootExecutables[pid]
+	if ok && proc.lockedExecutable() != executable {
+		return nil
+	}
+	return proc
+}
+
+// PendingRootPids returns the configured root pids that have not yet been resolved to Processes, sorted in
+// ascending order. With WithLenientRoots, these are the roots whose processes have not yet been found.
+func (pt *ProcTree) PendingRootPids() []int {
+	pt.prlock()
+	defer pt.prunlock()
+	result := make([]int, len(pt.pendingRootPids))
+	copy(result, pt.pendingRootPids)
+	sort.Ints(result)
+	return result
+}
+
+// lockedCheckPidExists returns a PidError wrapping ErrRootPidNotFound if there is no live process with the
+// provided root pid.
+func (pt *ProcTree) lockedCheckPidExists(pid int) error {
+	proc, ok := pt.pidMap[pid]
+	if ok && !proc.isTombstone {
+		return nil
+	}
+	found, err := sourceHasProcess(pt.source, pid)
+	if err != nil {
+		return &PidError{Op: "find root", Pid: pid, Err: err}
+	}
+	if !found {
+		return &PidError{Op: "find root", Pid: pid, Err: ErrRootPidNotFound}
+	}
+	return nil
+}
+
+// RemoveRoot removes a pid from the configured roots of the tree, without recreating the ProcTree. The included
+// tree is adjusted by the next update. If the pid was configured with WithOwnedRoot, its subtree is no longer
+// terminated when the ProcTree is closed. If no configured roots remain, all orphaned processes are roots after
+// the next update, as if no roots had been configured. Returns an error if the pid is not a configured root.
+func (pt *ProcTree) RemoveRoot(pid int) error {
+	pt.plock()
+	err := pt.lockedRemoveRoot(pid)
+	log := pt.cfg.logger
+	pt.punlock()
+	logOp(log, "Remove root", err, "pid", pid)
+	return err
+}
+
+func (pt *ProcTree) lockedRemoveRoot(pid int) error {
+	if !containsPid(pt.cfg.rootPids, pid) {
+		return fmt.Errorf("Pid %d is not a configured root", pid)
+	}
+	pt.cfg = pt.cfg.Refine(withoutRoot(pid))
+	pt.pendingRootPids = removePid(pt.pendingRootPids, pid)
+	pt.cfgRootProcs = removeProcessWithPid(pt.cfgRootProcs, pid)
+	pt.ownedRootProcs = removeProcessWithPid(pt.ownedRootProcs, pid)
+	return nil
+}
+
+// removeProcessWithPid returns a copy of a list of Processes with every Process with the provided pid removed.
+func removeProcessWithPid(procs []*Process, pid int) []*Process {
+	result := make([]*Process, 0, len(procs))
+	for _, proc := range procs {
+		if proc.lockedPid() != pid {
+			result = append(result, proc)
+		}
+	}
+	return result
+}
@@ -0,0 +1,155 @@
+package proctree
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// Session is a session of Processes, returned by ProcTree.Sessions.
+type Session struct {
+	// ID is the session id, which is the pid of the session leader.
+	ID int
+
+	// Leader is the session leader, or nil if it is not a live included Process, e.g., because it has exited.
+	Leader *Process
+
+	// Groups are the process groups of the session, sorted by id.
+	Groups []*ProcessGroup
+}
+
+// ProcessGroup is a process group of a Session.
+type ProcessGroup struct {
+	// ID is the process group id, which is the pid of the process group leader.
+	ID int
+
+	// Leader is the process group leader, or nil if it is not a live included Process, e.g., because it has
+	// exited.
+	Leader *Process
+
+	// Session is the session of the process group.
+	Session *Session
+
+	// Processes are the Processes of the process group, sorted by pid.
+	Processes []*Process
+}
+
+// Sessions returns a view of the live included Processes arranged for job control, rather than by parent pid:
+// the sessions that they belong to, the process groups of each session, and the Processes of each process group
+// (see Process.SessionID and Process.ProcessGroupID). Sessions are sorted by id. The view is a snapshot of the
+// Processes in the tree, which are the same Process objects as in the tree. Processes whose session or process
+// group cannot be read, e.g., because they have exited since the last update, are omitted. Sessions and process
+// groups are read from the system without holding the tree lock; configure WithMetadataPrefetch(MetadataSession,
+// MetadataProcessGroup) to read them during updates instead. Returns an error on platforms other than Linux and
+// macOS, or for a ProcTree that is not updated from the system.
+func (pt *ProcTree) Sessions() ([]*Session, error) {
+	procs := []*Process{}
+	pt.prlock()
+	readOnly := pt.readOnly
+	metadataErr := pt.cfg.checkMetadata(MetadataSession, MetadataProcessGroup)
+	for _, proc := range pt.includedProcs {
+		if !proc.isTombstone {
+			procs = append(procs, proc)
+		}
+	}
+	pt.prunlock()
+	if readOnly {
+		return nil, fmt.Errorf("Unable to arrange processes by session in a ProcTree that is not updated from the system")
+	}
+	if metadataErr != nil {
+		return nil, fmt.Errorf("Unable to arrange processes by session: %w", metadataErr)
+	}
+	// Windows reports Remote Desktop Services sessions, which have no process groups
+	_, err := defaultProcfs.processGroupID(os.Getpid())
+	if err != nil {
+		return nil, fmt.Errorf("Unable to arrange processes by session: %s", err)
+	}
+
+	sessions := make(map[int]*Session)
+	groups := make(map[int]*ProcessGroup)
+	// The included Processes are sorted by pid, so each process group's Processes are too
+	for _, proc := range procs {
+		sid, err := proc.SessionID()
+		if err != nil {
+			continue
+		}
+		pgid, err := proc.ProcessGroupID()
+		if err != nil {
+			continue
+		}
+		session := sessions[sid]
+		if session == nil {
+			session = &Session{ID: sid, Groups: []*ProcessGroup{}}
+			sessions[sid] = session
+		}
+		group := groups[pgid]
+		if group == nil {
+			group = &ProcessGroup{ID: pgid, Session: session, Processes: []*Process{}}
+			groups[pgid] = group
+			session.Groups = append(session.Groups, group)
+		}
+		group.Processes = append(group.Processes, proc)
+		pid := proc.Pid()
+		if pid == sid {
+			session.Leader = proc
+		}
+		if pid == pgid {
+			group.Leader = proc
+		}
+	}
+
+	result := make([]*Session, 0, len(sessions))
+	for _, session := range sessions {
+		sort.Slice(session.Groups, func(i, j int) bool {
+			return session.Groups[i].ID < session.Groups[j].ID
+		})
+		result = append(result, session)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+// RenderSessions writes the Sessions view to w as indented text with line art, beneath a root line of ".". Each
+// session is listed, followed by its process groups, each followed by the Processes that it contains, e.g.:
+//
+//	.
+//	└── session 1234
+//	    ├── group 1234
+//	    │   └── [1234]  bash
+//	    └── group 1240
+//	        ├── [1240]  make
+//	        └── [1251]  cc
+//
+// Options select the label fields of Processes and the line art, as with Render.
+func (pt *ProcTree) RenderSessions(w io.Writer, opts ...RenderOption) error {
+	rc := newRenderConfig(opts...)
+	sessions, err := pt.Sessions()
+	if err != nil {
+		return err
+	}
+
+	pt.plock()
+	lines := []renderLine{}
+	nextSession := renderPrefixes(rc, "", len(sessions))
+	for _, session := range sessions {
+		prefix, indent := nextSession()
+		lines = append(lines, renderLine{prefix: prefix, heading: "session " + strconv.Itoa(session.ID)})
+		nextGroup := renderPrefixes(rc, indent, len(session.Groups))
+		for _, group := range session.Groups {
+			prefix, indent := nextGroup()
+			lines = append(lines, renderLine{prefix: prefix, heading: "group " + strconv.Itoa(group.ID)})
+			nextProc := renderPrefixes(rc, indent, len(group.Processes))
+			for _, proc := range group.Processes {
+				prefix, _ := nextProc()
+				lines = append(lines, proc.lockedRenderLine(rc, prefix))
+			}
+		}
+	}
+	pt.punlock()
+
+	return writeRenderLines(w, rc, ".", lines)
+}
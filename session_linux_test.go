@@ -0,0 +1,81 @@
+package proctree
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestSessions(t *testing.T) {
+	dir := t.TempDir()
+	jobs := []struct {
+		pid, ppid, pgid, sid int
+		executable           string
+	}{
+		{10, 1, 10, 10, "bash"},
+		{11, 10, 11, 10, "make"},
+		{12, 11, 11, 10, "cc"},
+		// The pipeline's first process has exited, so the group has no leader
+		{14, 10, 13, 10, "less"},
+		// The daemon double-forked into its own session, but its parent is still the shell
+		{15, 10, 15, 15, "daemon"},
+	}
+	for i, job := range jobs {
+		writeFakeProcess(t, dir, job.pid, job.ppid, job.executable, uint64(100*(i+1)))
+		stat := fmt.Sprintf("%d (%s) S %d %d %d 0 -1 0 0 0 0 0 0 0 0 0 20 0 1 0 %d 0 0\n", job.pid, job.executable,
+			job.ppid, job.pgid, job.sid, 100*(i+1))
+		err := os.WriteFile(filepath.Join(dir, strconv.Itoa(job.pid), "stat"), []byte(stat), 0644)
+		if err != nil {
+			t.Fatalf("os.WriteFile() returned error: %s", err)
+		}
+	}
+
+	pt, err := New(WithProcfsPath(dir), WithRootPid(10))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	sessions, err := pt.Sessions()
+	if err != nil {
+		t.Fatalf("pt.Sessions() returned error: %s", err)
+	}
+	summary := []string{}
+	for _, session := range sessions {
+		for _, group := range session.Groups {
+			summary = append(summary, fmt.Sprintf("%d:%d:%s", session.ID, group.ID, pidList(group.Processes)))
+		}
+	}
+	expected := "[10:10:[10] 10:11:[11 12] 10:13:[14] 15:15:[15]]"
+	if fmt.Sprint(summary) != expected {
+		t.Errorf("pt.Sessions() returned %v, expected %s", summary, expected)
+	}
+	if len(sessions) != 2 || sessions[0].Leader != pt.PidProcess(10) || sessions[0].Groups[1].Leader != pt.PidProcess(11) ||
+		sessions[0].Groups[2].Leader != nil || sessions[0].Groups[2].Session != sessions[0] {
+		t.Errorf("pt.Sessions() returned the wrong leaders")
+	}
+
+	var buf bytes.Buffer
+	err = pt.RenderSessions(&buf, WithASCIILineArt())
+	if err != nil {
+		t.Fatalf("pt.RenderSessions() returned error: %s", err)
+	}
+	expectedRender := ".\n" +
+		"|-- session 10\n" +
+		"|   |-- group 10\n" +
+		"|   |   `-- [10]  bash\n" +
+		"|   |-- group 11\n" +
+		"|   |   |-- [11]  make\n" +
+		"|   |   `-- [12]  cc\n" +
+		"|   `-- group 13\n" +
+		"|       `-- [14]  less\n" +
+		"`-- session 15\n" +
+		"    `-- group 15\n" +
+		"        `-- [15]  daemon\n"
+	if buf.String() != expectedRender {
+		t.Errorf("pt.RenderSessions() wrote:\n%s\nexpected:\n%s", buf.String(), expectedRender)
+	}
+}
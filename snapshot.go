@@ -0,0 +1,106 @@
+package proctree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// procSnapshot is a scan of the processes listed by the ProcessSource, taken without holding the tree lock so
+// that readers are not blocked while /proc is read.
+type procSnapshot struct {
+	// seq orders snapshots by the time their scans started.
+	seq uint64
+
+	// start is the time at which the scan started.
+	start time.Time
+
+	// includeKernelThreads is true if kernel threads were scanned.
+	includeKernelThreads bool
+
+	// readUsage is true if the resource usage of processes was requested.
+	readUsage bool
+
+	// procs are the scanned processes.
+	procs []ProcInfo
+
+	// usage is the resource usage of each scanned process, by pid, if it was read (see ChildOrder.readsUsage),
+	// or nil.
+	usage map[int]Usage
+}
+
+// scanProcesses takes a snapshot of the processes listed by the ProcessSource. Kernel threads are omitted unless
+// includeKernelThreads is true. If readUsage is true, and the processes are listed from the local system, the
+// resource usage of each process is also read. The scan stops with the context's error if it is done. It does
+// not require the tree lock; locked is true if the caller holds it.
+func (pt *ProcTree) scanProcesses(ctx context.Context, includeKernelThreads bool, readUsage bool, locked bool) (*procSnapshot, error) {
+	snap := &procSnapshot{
+		seq:                  atomic.AddUint64(&pt.scanSeq, 1),
+		start:                pt.clock.Now(),
+		includeKernelThreads: includeKernelThreads,
+		readUsage:            readUsage,
+	}
+	var procs []ProcInfo
+	var err error
+	if ss, ok := pt.source.(systemSource); ok {
+		known := pt.knownStartTime
+		if locked {
+			known = pt.lockedKnownStartTime
+		}
+		procs, err = ss.snapshotKnown(ctx, known)
+	} else {
+		procs, err = sourceSnapshot(ctx, pt.source)
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return nil, fmt.Errorf("%w: %s", ErrPermissionDenied, err)
+		}
+		return nil, err
+	}
+	if !includeKernelThreads {
+		// The listed processes belong to the source, so they are not filtered in place
+		kept := make([]ProcInfo, 0, len(procs))
+		for _, info := range procs {
+			if info.Pid != kthreadPid && info.PPid != kthreadPid {
+				kept = append(kept, info)
+			}
+		}
+		procs = kept
+	}
+	snap.procs = procs
+	if _, ok := pt.source.(systemSource); ok && readUsage {
+		// Processes that exit before their usage is read sort as if they are idle
+		snap.usage = make(map[int]Usage, len(procs))
+		for _, info := range procs {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			usage, err := pt.procfs.processUsage(info.Pid)
+			if err == nil {
+				snap.usage[info.Pid] = usage
+			}
+		}
+	}
+	return snap, nil
+}
+
+// knownStartTime returns the start time of the live Process with the provided pid, if it is known and the Process
+// still has the provided parent pid, or 0 otherwise, so that scans need not read the start times of processes
+// that are already in the tree. A process whose parent pid has changed may be a new process that reused the pid,
+// so its start time is read again.
+func (pt *ProcTree) knownStartTime(pid int, ppid int) uint64 {
+	pt.prlock()
+	defer pt.prunlock()
+	return pt.lockedKnownStartTime(pid, ppid)
+}
+
+func (pt *ProcTree) lockedKnownStartTime(pid int, ppid int) uint64 {
+	proc, ok := pt.pidMap[pid]
+	if !ok || proc.isTombstone || proc.gopsProcess.PPid() != ppid {
+		return 0
+	}
+	return proc.startTime
+}
@@ -0,0 +1,238 @@
+package proctree
+
+import (
+	"context"
+	"syscall"
+)
+
+// ProcInfo describes a process listed by a ProcessSource.
+type ProcInfo struct {
+	// Pid is the pid of the process.
+	Pid int
+
+	// PPid is the pid of the parent process, or 0 if it has none.
+	PPid int
+
+	// Executable is the executable name of the process.
+	Executable string
+
+	// StartTime is the time at which the process started, in any units that increase monotonically for the
+	// lifetime of the source, or 0 if it is not known. Start times allow reuse of a pid by a new process to be
+	// detected. The system source reports clock ticks since boot, where available.
+	StartTime uint64
+}
+
+// ProcessSource lists the processes that populate a ProcTree (see WithProcessSource). By default, a ProcTree
+// lists the processes on the local system with SystemSource. Alternative sources, e.g., a remote host or a
+// simulated tree for tests, can be provided without changing the rest of the package.
+type ProcessSource interface {
+	// Snapshot returns every process that currently exists, in any order. It is called by each update without
+	// the tree lock held, and may be called concurrently by updates in different goroutines.
+	Snapshot() ([]ProcInfo, error)
+}
+
+// ContextProcessSource is a ProcessSource whose listings can be cancelled, e.g., a source that lists the
+// processes of a remote host. Updates started with UpdateContext or NewWithContext, and updates that are in
+// flight when the ProcTree is closed, cancel the listing through its context.
+type ContextProcessSource interface {
+	ProcessSource
+
+	// SnapshotContext is like Snapshot, but returns early, with an error, if the context is done.
+	SnapshotContext(ctx context.Context) ([]ProcInfo, error)
+}
+
+// sourceSnapshot lists the processes of a ProcessSource, returning the context's error if it is done first. The
+// listing of a source that is not a ContextProcessSource cannot be interrupted, so it is left to finish in the
+// background, and its result is discarded.
+func sourceSnapshot(ctx context.Context, source ProcessSource) ([]ProcInfo, error) {
+	if cs, ok := source.(ContextProcessSource); ok {
+		return cs.SnapshotContext(ctx)
+	}
+	if ctx.Done() == nil {
+		return source.Snapshot()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	type result struct {
+		infos []ProcInfo
+		err   error
+	}
+	results := make(chan result, 1)
+	go func() {
+		infos, err := source.Snapshot()
+		results <- result{infos: infos, err: err}
+	}()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-results:
+		return r.infos, r.err
+	}
+}
+
+// SourceEventType identifies the kind of process change reported by a ProcessEventSource.
+type SourceEventType int
+
+const (
+	// SourceFork reports that a process was created.
+	SourceFork SourceEventType = iota
+
+	// SourceExec reports that a process exec'd a new executable.
+	SourceExec
+
+	// SourceExit reports that a process exited.
+	SourceExit
+)
+
+func (t SourceEventType) String() string {
+	switch t {
+	case SourceFork:
+		return "SourceFork"
+	case SourceExec:
+		return "SourceExec"
+	case SourceExit:
+		return "SourceExit"
+	default:
+		return "SourceEventType(unknown)"
+	}
+}
+
+// SourceEvent is a process change reported by a ProcessEventSource.
+type SourceEvent struct {
+	// Type is the kind of change.
+	Type SourceEventType
+
+	// Pid is the pid of the process that forked, exec'd or exited. For SourceFork events it is the new child,
+	// or 0 if the source only knows which process forked.
+	Pid int
+
+	// PPid is the pid of the parent of the process, or 0 if it is not known.
+	PPid int
+
+	// Executable is the executable name of the process, or "" if it is not known. Exit events that carry an
+	// executable name for processes that were never seen by an update are added to the tree as transient
+	// Processes, as with WithEBPFMonitor.
+	Executable string
+
+	// Cmdline is the command line of a process that exec'd, or nil if it is not known.
+	Cmdline []string
+
+	// ExitStatus is the exit status of a process that exited, or nil if it is not known.
+	ExitStatus *ExitStatus
+}
+
+// ProcessEventSource is a ProcessSource that can also report process changes as they happen. When a ProcTree
+// with an event source is configured with WithRealtimeMonitor, it updates shortly after each reported change,
+// instead of using the platform's real-time backend.
+type ProcessEventSource interface {
+	ProcessSource
+
+	// Watch reports process changes by calling notify, which must not be called concurrently, until done is
+	// closed, and then returns. It is called once, from a background goroutine. If Watch returns an error, or
+	// returns before done is closed, the ProcTree is updated only at the interval configured with
+	// WithAutoUpdate, if any.
+	Watch(done <-chan struct{}, notify func(SourceEvent)) error
+}
+
+// SignalingProcessSource is a ProcessSource that can also send signals to the processes it lists, e.g., through
+// a remote agent. TerminateSubtree signals the processes of a ProcTree built with such a source through it.
+type SignalingProcessSource interface {
+	ProcessSource
+
+	// Signal sends a signal to the process with the provided pid.
+	Signal(pid int, sig syscall.Signal) error
+}
+
+// systemSource is the default ProcessSource, which lists the processes on the local system.
+type systemSource struct {
+	// procfs is the procfs from which processes are listed on Linux.
+	procfs procfs
+}
+
+// SystemSource returns the ProcessSource that lists the processes on the local system. This is the default
+// source. The platform's real-time backends (see WithRealtimeMonitor) are only used with this source, so they are
+// not available to sources that wrap it. On Linux, processes are listed from /proc (see WithProcfsPath), and
+// their start times are read from their stat entries. On Windows, processes are listed with a Toolhelp32
+// snapshot, and their start times are their creation times. On macOS, processes are listed with the
+// kern.proc.all sysctl. Start times are not available on other platforms.
+func SystemSource() ProcessSource {
+	return systemSource{procfs: defaultProcfs}
+}
+
+func (ss systemSource) Snapshot() ([]ProcInfo, error) {
+	return systemProcesses(context.Background(), ss.procfs, nil)
+}
+
+func (ss systemSource) SnapshotContext(ctx context.Context) ([]ProcInfo, error) {
+	return systemProcesses(ctx, ss.procfs, nil)
+}
+
+// startTimeLookup returns the known start time of the process with the provided pid and parent pid, or 0 if it
+// is not known.
+type startTimeLookup func(pid int, ppid int) uint64
+
+// snapshotKnown lists the processes on the local system as with SnapshotContext. On platforms where start times
+// are read separately from the listing, the start times of processes found by known are not read again.
+func (ss systemSource) snapshotKnown(ctx context.Context, known startTimeLookup) ([]ProcInfo, error) {
+	return systemProcesses(ctx, ss.procfs, known)
+}
+
+// hasProcess returns true if a live process with the provided pid exists.
+func (ss systemSource) hasProcess(pid int) (bool, error) {
+	return systemHasProcess(ss.procfs, pid)
+}
+
+// sourceHasProcess returns true if a ProcessSource lists a live process with the provided pid.
+func sourceHasProcess(source ProcessSource, pid int) (bool, error) {
+	if ss, ok := source.(systemSource); ok {
+		return ss.hasProcess(pid)
+	}
+	infos, err := source.Snapshot()
+	if err != nil {
+		return false, err
+	}
+	for _, info := range infos {
+		if info.Pid == pid {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// sourceBackend is a realtimeBackend that relays the changes reported by a ProcessEventSource.
+type sourceBackend struct {
+	source ProcessEventSource
+	done   chan struct{}
+}
+
+func (b *sourceBackend) run(notify func(procNotification)) {
+	b.source.Watch(b.done, func(ev SourceEvent) {
+		n := procNotification{
+			pid:        ev.Pid,
+			parentPid:  ev.PPid,
+			exitStatus: ev.ExitStatus,
+			executable: ev.Executable,
+			cmdline:    ev.Cmdline,
+		}
+		switch ev.Type {
+		case SourceFork:
+			n.kind = notificationFork
+		case SourceExec:
+			n.kind = notificationExec
+		case SourceExit:
+			n.kind = notificationExit
+		default:
+			return
+		}
+		notify(n)
+	})
+}
+
+func (b *sourceBackend) watch(pid int, parentPid int) {
+}
+
+func (b *sourceBackend) close() error {
+	close(b.done)
+	return nil
+}
@@ -0,0 +1,31 @@
+package proctree
+
+import (
+	"context"
+
+	gops "github.com/mitchellh/go-ps"
+)
+
+// systemProcesses lists the processes on the local system with the kern.proc.all sysctl, with their start
+// times. Executable names are truncated to 16 characters by the kernel. The procfs and known are ignored. The
+// context is checked before the sysctl, which cannot be interrupted.
+func systemProcesses(ctx context.Context, fs procfs, known startTimeLookup) ([]ProcInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	kinfos, err := allKinfos()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]ProcInfo, len(kinfos))
+	for i, k := range kinfos {
+		infos[i] = ProcInfo{Pid: k.pid(), PPid: k.ppid(), Executable: k.comm(), StartTime: k.startTime()}
+	}
+	return infos, nil
+}
+
+// systemHasProcess returns true if a live process with the provided pid exists. The procfs is ignored.
+func systemHasProcess(fs procfs, pid int) (bool, error) {
+	gopsProc, err := gops.FindProcess(pid)
+	return gopsProc != nil, err
+}
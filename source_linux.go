@@ -0,0 +1,59 @@
+package proctree
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// systemProcesses lists the processes in a procfs, with their start times. Processes that exit while they are
+// being listed are omitted. Start times are read with the rest of each stat entry, so known is ignored.
+// Listing stops with the context's error if it is done.
+func systemProcesses(ctx context.Context, fs procfs, known startTimeLookup) ([]ProcInfo, error) {
+	d, err := os.Open(string(fs))
+	if err != nil {
+		return nil, err
+	}
+	names, err := d.Readdirnames(-1)
+	d.Close()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]ProcInfo, 0, len(names))
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		pid, err := strconv.Atoi(name)
+		if err != nil || pid <= 0 {
+			continue
+		}
+		data, err := fs.readProcfsFile(pid, "stat")
+		if err != nil {
+			continue
+		}
+		executable, fields, err := parseStat(string(data))
+		// ppid is field 4 and starttime is field 22; fields begins at field 3
+		if err != nil || len(fields) < 20 {
+			continue
+		}
+		ppid, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		// A start time of 0 means it is unknown
+		startTime, _ := strconv.ParseUint(fields[19], 10, 64)
+		infos = append(infos, ProcInfo{Pid: pid, PPid: ppid, Executable: executable, StartTime: startTime})
+	}
+	return infos, nil
+}
+
+// systemHasProcess returns true if a live process with the provided pid exists in a procfs.
+func systemHasProcess(fs procfs, pid int) (bool, error) {
+	_, err := os.Stat(filepath.Join(string(fs), strconv.Itoa(pid)))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
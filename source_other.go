@@ -0,0 +1,45 @@
+//go:build !linux && !windows && !darwin
+// +build !linux,!windows,!darwin
+
+package proctree
+
+import (
+	"context"
+
+	gops "github.com/mitchellh/go-ps"
+)
+
+// systemProcesses lists the processes on the local system with go-ps. The procfs is ignored. Start times are
+// read only for processes whose start times are not found by known, which may be nil. Listing stops with the
+// context's error if it is done.
+func systemProcesses(ctx context.Context, fs procfs, known startTimeLookup) ([]ProcInfo, error) {
+	gopsProcs, err := gops.Processes()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]ProcInfo, len(gopsProcs))
+	for i, gopsProc := range gopsProcs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		pid := gopsProc.Pid()
+		ppid := gopsProc.PPid()
+		// A start time of 0 means it is unknown (the process may have just exited, or the platform does not
+		// provide start times).
+		var startTime uint64
+		if known != nil {
+			startTime = known(pid, ppid)
+		}
+		if startTime == 0 {
+			startTime, _ = fs.processStartTime(pid)
+		}
+		infos[i] = ProcInfo{Pid: pid, PPid: ppid, Executable: gopsProc.Executable(), StartTime: startTime}
+	}
+	return infos, nil
+}
+
+// systemHasProcess returns true if a live process with the provided pid exists. The procfs is ignored.
+func systemHasProcess(fs procfs, pid int) (bool, error) {
+	gopsProc, err := gops.FindProcess(pid)
+	return gopsProc != nil, err
+}
@@ -0,0 +1,687 @@
+package proctree
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeSource is a ProcessEventSource whose processes and events are controlled by a test.
+type fakeSource struct {
+	mu     sync.Mutex
+	procs  map[int]ProcInfo
+	events chan SourceEvent
+
+	// scanned, if not nil, is called by Snapshot after the processes are listed.
+	scanned func()
+}
+
+func newFakeSource(procs ...ProcInfo) *fakeSource {
+	fs := &fakeSource{procs: make(map[int]ProcInfo), events: make(chan SourceEvent, 16)}
+	for _, info := range procs {
+		fs.procs[info.Pid] = info
+	}
+	return fs
+}
+
+func (fs *fakeSource) set(info ProcInfo) {
+	fs.mu.Lock()
+	fs.procs[info.Pid] = info
+	fs.mu.Unlock()
+}
+
+func (fs *fakeSource) remove(pid int) {
+	fs.mu.Lock()
+	delete(fs.procs, pid)
+	fs.mu.Unlock()
+}
+
+func (fs *fakeSource) Snapshot() ([]ProcInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	infos := make([]ProcInfo, 0, len(fs.procs))
+	for _, info := range fs.procs {
+		infos = append(infos, info)
+	}
+	scanned := fs.scanned
+	fs.mu.Unlock()
+	if scanned != nil {
+		scanned()
+	}
+	fs.mu.Lock()
+	return infos, nil
+}
+
+func (fs *fakeSource) Watch(done <-chan struct{}, notify func(SourceEvent)) error {
+	for {
+		select {
+		case <-done:
+			return nil
+		case ev := <-fs.events:
+			notify(ev)
+		}
+	}
+}
+
+func TestProcessSource(t *testing.T) {
+	fs := newFakeSource(
+		ProcInfo{Pid: 100, Executable: "init", StartTime: 1},
+		ProcInfo{Pid: 101, PPid: 100, Executable: "sh", StartTime: 2},
+	)
+	pt, err := New(WithProcessSource(fs))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	roots := pt.Roots()
+	if len(roots) != 1 || roots[0].Pid() != 100 || len(roots[0].Children()) != 1 {
+		t.Fatalf("Roots() returned %v, expected init with one child", roots)
+	}
+	err = pt.AddRoot(200)
+	if err == nil {
+		t.Errorf("AddRoot() of a pid that is not in the source did not return an error")
+	}
+	if pt.Self() != nil {
+		t.Errorf("Self() of a tree built from a custom source returned %v, expected nil", pt.Self())
+	}
+
+	fs.set(ProcInfo{Pid: 101, PPid: 100, Executable: "make", StartTime: 2})
+	fs.set(ProcInfo{Pid: 102, PPid: 101, Executable: "cc", StartTime: 3})
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+	proc := pt.PidProcess(101)
+	if proc == nil || proc.Executable() != "make" || proc.ExecCount() != 1 {
+		t.Fatalf("Process 101 was not updated after exec")
+	}
+	children := proc.Children()
+	if len(children) != 1 || children[0].Pid() != 102 {
+		t.Errorf("Children() of process 101 returned %v, expected process 102", children)
+	}
+
+	// A new process that reuses a pid is distinguished by its start time
+	fs.set(ProcInfo{Pid: 102, PPid: 100, Executable: "cc", StartTime: 4})
+	err = pt.Update(true)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+	reused := pt.PidProcess(102)
+	if reused == children[0] {
+		t.Errorf("Process 102 was not replaced after its pid was reused")
+	}
+	if reused == nil || reused.ID() <= children[0].ID() {
+		t.Errorf("Process 102 that reused a pid does not have a new ID")
+	}
+	ids := make(map[uint64]bool)
+	for _, proc := range pt.AbsProcesses() {
+		if ids[proc.ID()] {
+			t.Errorf("ID %d is shared by more than one Process", proc.ID())
+		}
+		ids[proc.ID()] = true
+	}
+}
+
+func TestReusedPidIdentity(t *testing.T) {
+	fs := newFakeSource(ProcInfo{Pid: 100, Executable: "old", StartTime: 1})
+	pt, err := New(WithProcessSource(fs), WithRealtimeMonitor())
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+	sub, err := pt.Subscribe()
+	if err != nil {
+		t.Fatalf("Subscribe() returned error: %s", err)
+	}
+	defer sub.Close()
+	old := pt.PidProcess(100)
+
+	fs.set(ProcInfo{Pid: 100, Executable: "new", StartTime: 5})
+	fs.set(ProcInfo{Pid: 101, PPid: 100, Executable: "child", StartTime: 6})
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+
+	// Lookups by pid, walks and parent links all resolve to the new Process, never to the stale one
+	reused, err := pt.PidProcessErr(100)
+	if err != nil || reused == old || reused.ID() == old.ID() || reused.Executable() != "new" {
+		t.Fatalf("PidProcessErr() of a reused pid returned %v, %v, expected a new Process", reused, err)
+	}
+	if !old.IsTombstone() || old.Executable() != "old" {
+		t.Errorf("Stale Process was modified by the process that reused its pid")
+	}
+	if parent := pt.PidProcess(101).Parent(); parent != reused {
+		t.Errorf("Parent() of a child of the reused pid returned %v, expected the new Process", parent)
+	}
+	for _, proc := range pt.AbsProcesses() {
+		if proc == old {
+			t.Errorf("AbsProcesses() returned the stale Process")
+		}
+	}
+	err = pt.WalkBFS(func(proc *Process) error {
+		if proc == old {
+			t.Errorf("WalkBFS() visited the stale Process")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkBFS() returned error: %s", err)
+	}
+
+	// Real-time notifications for the pid are applied to the new Process
+	fs.remove(100)
+	fs.events <- SourceEvent{Type: SourceExit, Pid: 100, Executable: "new", ExitStatus: &ExitStatus{Code: 7}}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-sub.Events():
+			es := ev.Process.ExitStatus()
+			if ev.Type != ProcessExited || es == nil || es.Code != 7 {
+				continue
+			}
+			if ev.Process != reused {
+				t.Errorf("Exit of the reused pid was reported for %v, expected the new Process", ev.Process)
+			}
+			if old.ExitStatus() != nil {
+				t.Errorf("Exit of the reused pid was recorded on the stale Process")
+			}
+			return
+		case <-timeout:
+			t.Fatalf("Timed out waiting for the reused pid to exit")
+		}
+	}
+}
+
+func TestProcessEventSource(t *testing.T) {
+	fs := newFakeSource(ProcInfo{Pid: 100, Executable: "init", StartTime: 1})
+	pt, err := New(WithProcessSource(fs), WithRealtimeMonitor())
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+	sub, err := pt.Subscribe()
+	if err != nil {
+		t.Fatalf("Subscribe() returned error: %s", err)
+	}
+	defer sub.Close()
+
+	fs.set(ProcInfo{Pid: 101, PPid: 100, Executable: "sh", StartTime: 2})
+	fs.events <- SourceEvent{Type: SourceFork, Pid: 101, PPid: 100}
+	fs.remove(101)
+	fs.events <- SourceEvent{Type: SourceExit, Pid: 101, PPid: 100, Executable: "sh", ExitStatus: &ExitStatus{Code: 3}}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-sub.Events():
+			if ev.Type == ProcessExited && ev.Process.Pid() == 101 {
+				es := ev.Process.ExitStatus()
+				if es == nil || es.Code != 3 {
+					t.Errorf("Process 101 has exit status %+v, expected code 3", es)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for process 101 to exit")
+		}
+	}
+}
+
+// blockingSource is a ProcessSource whose listings block, while blocking is set, until they are cancelled.
+type blockingSource struct {
+	*fakeSource
+	blocking chan struct{}
+}
+
+func (bs *blockingSource) SnapshotContext(ctx context.Context) ([]ProcInfo, error) {
+	select {
+	case <-bs.blocking:
+		return bs.Snapshot()
+	default:
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestContextCancellation(t *testing.T) {
+	bs := &blockingSource{
+		fakeSource: newFakeSource(ProcInfo{Pid: 100, Executable: "init", StartTime: 1}),
+		blocking:   make(chan struct{}),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := NewWithContext(ctx, WithProcessSource(bs))
+	if err != context.DeadlineExceeded {
+		t.Fatalf("NewWithContext() returned error %v, expected %v", err, context.DeadlineExceeded)
+	}
+
+	// A source that cannot be cancelled is abandoned when the context is done
+	fs := newFakeSource(ProcInfo{Pid: 100, Executable: "init", StartTime: 1})
+	fs.mu.Lock()
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = NewWithContext(ctx, WithProcessSource(fs))
+	fs.mu.Unlock()
+	if err != context.DeadlineExceeded {
+		t.Fatalf("NewWithContext() returned error %v, expected %v", err, context.DeadlineExceeded)
+	}
+
+	close(bs.blocking)
+	pt, err := New(WithProcessSource(bs))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	bs.blocking = make(chan struct{})
+	bs.set(ProcInfo{Pid: 101, PPid: 100, Executable: "sh", StartTime: 2})
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	err = pt.UpdateContext(ctx, false)
+	if err != context.Canceled {
+		t.Errorf("UpdateContext() returned error %v, expected %v", err, context.Canceled)
+	}
+	if pt.PidProcess(101) != nil {
+		t.Errorf("Cancelled update added process 101")
+	}
+
+	// Close cancels updates that are in flight
+	errs := make(chan error, 1)
+	go func() {
+		errs <- pt.Update(false)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	pt.Close()
+	select {
+	case err = <-errs:
+		if err != context.Canceled {
+			t.Errorf("Update() returned error %v after Close, expected %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for Close to cancel Update")
+	}
+}
+
+func TestLenientRoots(t *testing.T) {
+	fs := newFakeSource(
+		ProcInfo{Pid: 1, Executable: "init", StartTime: 1},
+		ProcInfo{Pid: 200, PPid: 1, Executable: "cron", StartTime: 2},
+	)
+	_, err := New(WithProcessSource(fs), WithRootPid(300))
+	if err == nil {
+		t.Fatalf("New() with a missing root did not return an error")
+	}
+	_, err = New(WithProcessSource(fs), WithRootPidExecutable(200, "sshd"))
+	if err == nil {
+		t.Fatalf("New() with a root of the wrong executable did not return an error")
+	}
+
+	pt, err := New(WithProcessSource(fs), WithLenientRoots(), WithRootPid(300), WithRootPidExecutable(200, "sshd"))
+	if err != nil {
+		t.Fatalf("New() with lenient roots returned error: %s", err)
+	}
+	defer pt.Close()
+	pending := pt.PendingRootPids()
+	if len(pending) != 2 || pending[0] != 200 || pending[1] != 300 {
+		t.Errorf("PendingRootPids() returned %v, expected [200 300]", pending)
+	}
+	if len(pt.Processes()) != 0 {
+		t.Errorf("Processes() returned %v before the roots were found, expected none", pt.Processes())
+	}
+	err = pt.AddRoot(400)
+	if err != nil {
+		t.Errorf("AddRoot() of a missing pid with lenient roots returned error: %s", err)
+	}
+
+	// The pid reused by the wrong executable remains pending
+	fs.set(ProcInfo{Pid: 300, PPid: 1, Executable: "daemon", StartTime: 3})
+	fs.set(ProcInfo{Pid: 301, PPid: 300, Executable: "worker", StartTime: 4})
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+	if pt.PidProcess(300) == nil || pt.PidProcess(301) == nil || pt.PidProcess(200) != nil {
+		t.Errorf("Processes() returned %v after the daemon started, expected its subtree", pt.Processes())
+	}
+	pending = pt.PendingRootPids()
+	if len(pending) != 2 || pending[0] != 200 || pending[1] != 400 {
+		t.Errorf("PendingRootPids() returned %v, expected [200 400]", pending)
+	}
+
+	fs.remove(200)
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+	fs.set(ProcInfo{Pid: 200, PPid: 1, Executable: "sshd", StartTime: 5})
+	err = pt.Update(true)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+	if pt.PidProcess(200) == nil {
+		t.Errorf("Root with the configured executable was not included after it started")
+	}
+	pending = pt.PendingRootPids()
+	if len(pending) != 1 || pending[0] != 400 {
+		t.Errorf("PendingRootPids() returned %v, expected [400]", pending)
+	}
+}
+
+func TestSelfParent(t *testing.T) {
+	fs := newFakeSource(
+		ProcInfo{Pid: 100, PPid: 100, Executable: "init", StartTime: 1},
+		ProcInfo{Pid: 101, PPid: 100, Executable: "sh", StartTime: 2},
+	)
+	pt, err := New(WithProcessSource(fs))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	roots := pt.Roots()
+	if len(roots) != 1 || roots[0].Pid() != 100 || roots[0].Parent() != nil {
+		t.Fatalf("Roots() returned %v, expected init without a parent", roots)
+	}
+	if n := roots[0].SubtreeCount(); n != 2 {
+		t.Errorf("SubtreeCount() returned %d, expected 2", n)
+	}
+}
+
+func TestParentCycle(t *testing.T) {
+	fs := newFakeSource(
+		ProcInfo{Pid: 100, PPid: 101, Executable: "a", StartTime: 1},
+		ProcInfo{Pid: 101, PPid: 100, Executable: "b", StartTime: 1},
+		ProcInfo{Pid: 102, PPid: 101, Executable: "c", StartTime: 2},
+	)
+	pt, err := New(WithProcessSource(fs), WithRootPid(100))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	proc := pt.PidProcess(100)
+	walked := []*Process{}
+	err = proc.WalkSubtree(func(proc *Process) error {
+		walked = append(walked, proc)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkSubtree() returned error: %s", err)
+	}
+	if len(walked) != 3 {
+		t.Errorf("WalkSubtree() visited %d Processes, expected 3", len(walked))
+	}
+
+	walked = walked[:0]
+	err = proc.WalkSubtreeBFS(func(proc *Process) error {
+		walked = append(walked, proc)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkSubtreeBFS() returned error: %s", err)
+	}
+	if len(walked) != 3 {
+		t.Errorf("WalkSubtreeBFS() visited %d Processes, expected 3", len(walked))
+	}
+
+	var count int32
+	err = proc.WalkSubtreeParallel(func(proc *Process) error {
+		atomic.AddInt32(&count, 1)
+		return nil
+	}, 2)
+	if err != nil {
+		t.Fatalf("WalkSubtreeParallel() returned error: %s", err)
+	}
+	if count != 3 {
+		t.Errorf("WalkSubtreeParallel() visited %d Processes, expected 3", count)
+	}
+	if n := pt.Counts().Included; n != 3 {
+		t.Errorf("Counts().Included is %d, expected 3", n)
+	}
+}
+
+func TestReusedParentPid(t *testing.T) {
+	// 101 reports 100 as its parent, but pid 100 has been reused by a process that started after 101
+	fs := newFakeSource(
+		ProcInfo{Pid: 100, Executable: "newer", StartTime: 5},
+		ProcInfo{Pid: 101, PPid: 100, Executable: "orphan", StartTime: 2},
+	)
+	pt, err := New(WithProcessSource(fs))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	proc := pt.PidProcess(101)
+	if proc.Parent() != nil {
+		t.Errorf("Parent() of a process whose parent pid was reused returned %v, expected nil", proc.Parent())
+	}
+	if n := len(pt.PidProcess(100).Children()); n != 0 {
+		t.Errorf("Process that reused a parent pid has %d children, expected 0", n)
+	}
+}
+
+func TestExitNotificationDuringScan(t *testing.T) {
+	fs := newFakeSource(ProcInfo{Pid: 100, Executable: "init", StartTime: 1})
+	pt, err := New(WithProcessSource(fs))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+	sub, err := pt.Subscribe()
+	if err != nil {
+		t.Fatalf("Subscribe() returned error: %s", err)
+	}
+	defer sub.Close()
+
+	// A short-lived process is listed by a scan, and its exit is reported before the scan is applied
+	fs.set(ProcInfo{Pid: 101, PPid: 100, Executable: "short", StartTime: 2})
+	scanning := make(chan struct{})
+	resume := make(chan struct{})
+	fs.mu.Lock()
+	fs.scanned = func() {
+		close(scanning)
+		<-resume
+	}
+	fs.mu.Unlock()
+	updated := make(chan error)
+	go func() {
+		updated <- pt.Update(false)
+	}()
+	<-scanning
+	pt.applyNotification(procNotification{kind: notificationExit, pid: 101, parentPid: 100, executable: "short",
+		exitStatus: &ExitStatus{Code: 0}})
+	fs.mu.Lock()
+	fs.scanned = nil
+	fs.mu.Unlock()
+	fs.remove(101)
+	close(resume)
+	err = <-updated
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+
+	proc := pt.PidProcess(101)
+	if proc == nil || !proc.IsTombstone() {
+		t.Fatalf("Process that exited during a scan is %v, expected a tombstone", proc)
+	}
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+	exits := 0
+	for len(sub.Events()) > 0 {
+		ev := <-sub.Events()
+		if ev.Process == proc && ev.Type == ProcessExited {
+			exits++
+		}
+	}
+	if exits != 1 {
+		t.Errorf("Received %d exited events for a process that exited during a scan, expected 1", exits)
+	}
+}
+
+func TestTransientProcess(t *testing.T) {
+	fs := newFakeSource(
+		ProcInfo{Pid: 100, Executable: "init", StartTime: 1},
+		ProcInfo{Pid: 101, PPid: 100, Executable: "sh", StartTime: 2},
+	)
+	pt, err := New(WithProcessSource(fs))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	// An exit notification for a live Process does not replace it
+	live := pt.PidProcess(101)
+	pt.plock()
+	pt.lockedAddTransient(procNotification{kind: notificationExit, pid: 101, parentPid: 100, executable: "other"})
+	pt.punlock()
+	if pt.PidProcess(101) != live {
+		t.Errorf("Transient replaced a live Process")
+	}
+
+	// A transient is linked to its parent, and counted
+	pt.applyNotification(procNotification{kind: notificationExit, pid: 102, parentPid: 101, executable: "short",
+		exitStatus: &ExitStatus{Code: 0}})
+	proc := pt.PidProcess(102)
+	if proc == nil || !proc.IsTombstone() {
+		t.Fatalf("Transient is %v, expected a tombstone", proc)
+	}
+	children := live.Children()
+	if len(children) != 1 || children[0] != proc {
+		t.Errorf("Children() of the parent of a transient returned %v, expected the transient", children)
+	}
+	walked := 0
+	err = pt.PidProcess(100).WalkSubtree(func(proc *Process) error {
+		walked++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkSubtree() returned error: %s", err)
+	}
+	if walked != 3 {
+		t.Errorf("WalkSubtree() visited %d Processes, expected 3", walked)
+	}
+	if n := pt.PidProcess(100).SubtreeCount(); n != 3 {
+		t.Errorf("SubtreeCount() returned %d, expected 3", n)
+	}
+	counts := pt.Counts()
+	if counts.Total != 3 || counts.Included != 3 || counts.Tombstones != 1 {
+		t.Errorf("Counts() returned %+v, expected 3 processes with 1 tombstone", counts)
+	}
+
+	// An update agrees with the linked transient
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("Update() returned error: %s", err)
+	}
+	if n := pt.PidProcess(100).SubtreeCount(); n != 3 || pt.Counts() != counts {
+		t.Errorf("Update() changed the counts of a linked transient to %d, %+v", n, pt.Counts())
+	}
+}
+
+func TestKnownStartTime(t *testing.T) {
+	fs := newFakeSource(
+		ProcInfo{Pid: 100, Executable: "init", StartTime: 1},
+		ProcInfo{Pid: 101, PPid: 100, Executable: "sh", StartTime: 2},
+	)
+	pt, err := New(WithProcessSource(fs))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	for _, tc := range []struct {
+		pid, ppid int
+		expected  uint64
+	}{
+		{101, 100, 2},
+		{101, 1, 0},
+		{102, 100, 0},
+	} {
+		if st := pt.knownStartTime(tc.pid, tc.ppid); st != tc.expected {
+			t.Errorf("knownStartTime(%d, %d) returned %d, expected %d", tc.pid, tc.ppid, st, tc.expected)
+		}
+	}
+}
+
+// signalingSource is a fakeSource that records the signals it is asked to send, and removes the processes that
+// are signalled.
+type signalingSource struct {
+	*fakeSource
+	signalled []int
+}
+
+func (ss *signalingSource) Signal(pid int, sig syscall.Signal) error {
+	ss.mu.Lock()
+	ss.signalled = append(ss.signalled, pid)
+	ss.mu.Unlock()
+	ss.remove(pid)
+	return nil
+}
+
+func TestNonLocalSource(t *testing.T) {
+	// The pids are those of the calling process, so acting on the local process with the same pid would be
+	// noticed
+	pid := os.Getpid()
+	fs := newFakeSource(ProcInfo{Pid: pid, Executable: "remote", StartTime: 1})
+	pt, err := New(WithProcessSource(fs))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	proc := pt.PidProcess(pid)
+	_, _, err = proc.Rlimit(0)
+	if !errors.Is(err, ErrNotLocal) {
+		t.Errorf("Rlimit() on a Process of another source returned %v, expected ErrNotLocal", err)
+	}
+	_, err = pt.TerminateSubtree(proc, nil, 0)
+	if err == nil {
+		t.Errorf("TerminateSubtree() on a source that cannot signal succeeded")
+	}
+
+	ss := &signalingSource{fakeSource: newFakeSource(ProcInfo{Pid: pid, Executable: "remote", StartTime: 1})}
+	pt2, err := New(WithProcessSource(ss))
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt2.Close()
+
+	results, err := pt2.TerminateSubtree(pt2.PidProcess(pid), nil, time.Second)
+	if err != nil {
+		t.Fatalf("TerminateSubtree() returned error: %s", err)
+	}
+	if len(results) != 1 || results[0].Outcome != TerminateExited {
+		t.Errorf("TerminateSubtree() returned %v, expected one exited Process", results)
+	}
+	if len(ss.signalled) != 1 || ss.signalled[0] != pid {
+		t.Errorf("Source was asked to signal %v, expected [%d]", ss.signalled, pid)
+	}
+}
+
+func TestParentCycleRootAncestors(t *testing.T) {
+	fs := newFakeSource(
+		ProcInfo{Pid: 100, PPid: 101, Executable: "a", StartTime: 1},
+		ProcInfo{Pid: 101, PPid: 100, Executable: "b", StartTime: 1},
+		ProcInfo{Pid: 102, Executable: "c", StartTime: 2},
+	)
+	pt, err := New(WithProcessSource(fs), WithRootPid(100), WithRootAncestors())
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	if !pt.PidProcess(101).IsIncluded() {
+		t.Errorf("Ancestor in a parent cycle is not included")
+	}
+	if pt.PidProcess(102) != nil {
+		t.Errorf("Process outside the root's ancestry is included")
+	}
+}
@@ -0,0 +1,57 @@
+package proctree
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	gops "github.com/mitchellh/go-ps"
+)
+
+// systemProcesses lists the processes on the local system with a Toolhelp32 snapshot, with their creation
+// times. The procfs is ignored. Creation times are read only for processes whose start times are not found by
+// known, which may be nil. Listing stops with the context's error if it is done.
+func systemProcesses(ctx context.Context, fs procfs, known startTimeLookup) ([]ProcInfo, error) {
+	snapshot, err := syscall.CreateToolhelp32Snapshot(syscall.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list processes: %s", err)
+	}
+	defer syscall.CloseHandle(snapshot)
+	infos := []ProcInfo{}
+	var entry syscall.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	err = syscall.Process32First(snapshot, &entry)
+	for err == nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		pid := int(entry.ProcessID)
+		ppid := int(entry.ParentProcessID)
+		// A start time of 0 means it is unknown (the process may have just exited, or it may be protected).
+		var startTime uint64
+		if known != nil {
+			startTime = known(pid, ppid)
+		}
+		if startTime == 0 {
+			startTime, _ = fs.processStartTime(pid)
+		}
+		infos = append(infos, ProcInfo{
+			Pid:        pid,
+			PPid:       ppid,
+			Executable: syscall.UTF16ToString(entry.ExeFile[:]),
+			StartTime:  startTime,
+		})
+		err = syscall.Process32Next(snapshot, &entry)
+	}
+	if err != syscall.ERROR_NO_MORE_FILES {
+		return nil, fmt.Errorf("Unable to list processes: %s", err)
+	}
+	return infos, nil
+}
+
+// systemHasProcess returns true if a live process with the provided pid exists. The procfs is ignored.
+func systemHasProcess(fs procfs, pid int) (bool, error) {
+	gopsProc, err := gops.FindProcess(pid)
+	return gopsProc != nil, err
+}
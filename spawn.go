@@ -0,0 +1,129 @@
+package proctree
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// spawnedCmd records a process that was started with StartCommand.
+type spawnedCmd struct {
+	// cmd is the command that was started.
+	cmd *exec.Cmd
+
+	// proc is the Process for the started command, or nil if it has not yet been bound by an update.
+	proc *Process
+
+	// killOnClose causes the spawned subtree to be killed when the ProcTree is closed.
+	killOnClose bool
+}
+
+func (pt *ProcTree) lockedSpawnedProcs() []*Process {
+	result := make([]*Process, 0, len(pt.spawned))
+	for _, sc := range pt.spawned {
+		if sc.proc != nil {
+			result = append(result, sc.proc)
+		}
+	}
+	pt.lockedSortProcessesByPid(result)
+	return result
+}
+
+func (pt *ProcTree) isSpawnedPid(pid int) bool {
+	pt.plock()
+	defer pt.punlock()
+	_, ok := pt.spawned[pid]
+	return ok
+}
+
+// StartCommand starts an exec.Cmd and immediately registers the new process in the tree. If root pids were
+// configured, the started process becomes an additional root, so that it and its descendants are included
+// in the tree as they are discovered by later updates. If ctx is cancelled before the ProcTree is closed,
+// the started process and all of its known descendants are killed. If killOnClose is true, the same happens
+// when the ProcTree is closed. The caller remains responsible for waiting on cmd; in subreaper mode, started
+// commands are never reaped by the ProcTree.
+func (pt *ProcTree) StartCommand(ctx context.Context, cmd *exec.Cmd, killOnClose bool) (*Process, error) {
+	if pt.readOnly {
+		return nil, fmt.Errorf("Unable to start a command in a read-only ProcTree")
+	}
+
+	pt.reapLock.Lock()
+	defer pt.reapLock.Unlock()
+
+	err := cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	pid := cmd.Process.Pid
+
+	pt.plock()
+	sc := &spawnedCmd{
+		cmd:         cmd,
+		proc:        nil,
+		killOnClose: killOnClose,
+	}
+	pt.spawned[pid] = sc
+	pt.punlock()
+
+	snap, err := pt.scanForUpdate(context.Background())
+	pt.plock()
+	if err == nil {
+		err = pt.lockedApplySnapshot(context.Background(), snap, false)
+	}
+	proc := sc.proc
+	log := pt.cfg.logger
+	pt.punlockAndDispatch()
+	logOp(log, "Start command", err, "pid", pid, "path", cmd.Path)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to register started command pid %d: %s", pid, err)
+	}
+	if proc == nil {
+		return nil, &PidError{Op: "register started command", Pid: pid, Err: ErrProcessGone}
+	}
+
+	if ctx.Done() != nil {
+		pt.wg.Add(1)
+		go func() {
+			defer pt.wg.Done()
+			select {
+			case <-pt.done:
+			case <-ctx.Done():
+				pt.killSpawnedCmd(sc)
+			}
+		}()
+	}
+
+	return proc, nil
+}
+
+// killSpawnedCmd kills a started command and all of its known descendants, including descendants
+// that have been reparented after their parent exited.
+func (pt *ProcTree) killSpawnedCmd(sc *spawnedCmd) {
+	// os.Process knows whether the command has already been waited on, so it is safe against pid reuse
+	sc.cmd.Process.Kill()
+
+	pt.plock()
+	root := sc.proc
+	pt.punlock()
+	if root != nil {
+		pt.terminateSubtrees([]*Process{root}, os.Kill, 0)
+	}
+}
+
+// killSpawned kills the subtrees of all started commands that were started with killOnClose.
+func (pt *ProcTree) killSpawned() {
+	pt.plock()
+	scs := make([]*spawnedCmd, 0, len(pt.spawned))
+	for _, sc := range pt.spawned {
+		if sc.killOnClose {
+			scs = append(scs, sc)
+		}
+	}
+	pt.punlock()
+
+	for _, sc := range scs {
+		pt.killSpawnedCmd(sc)
+	}
+}
@@ -0,0 +1,56 @@
+package proctree
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestStartCommandKillOnClose(t *testing.T) {
+	root := exec.Command("sleep", "10")
+	err := root.Start()
+	if err != nil {
+		t.Fatalf("root.Start() returned error: %s", err)
+	}
+	defer root.Wait()
+	defer root.Process.Kill()
+
+	pt, err := New(WithRootPid(root.Process.Pid))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+
+	cmd := exec.Command("sh", "-c", "sleep 10 & wait")
+	proc, err := pt.StartCommand(context.Background(), cmd, true)
+	if err != nil {
+		t.Fatalf("pt.StartCommand() returned error: %s", err)
+	}
+	if proc.Pid() != cmd.Process.Pid {
+		t.Errorf("Started process pid %d does not match cmd pid %d", proc.Pid(), cmd.Process.Pid)
+	}
+	if pt.PidProcess(proc.Pid()) != proc {
+		t.Errorf("Started process pid %d not included in process tree", proc.Pid())
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(proc.Children()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Child of started process never appeared in process tree")
+		}
+		time.Sleep(10 * time.Millisecond)
+		err = pt.Update(false)
+		if err != nil {
+			t.Fatalf("pt.Update() returned error: %s", err)
+		}
+	}
+
+	err = pt.Close()
+	if err != nil {
+		t.Errorf("pt.Close() returned error: %s", err)
+	}
+	err = cmd.Wait()
+	if err == nil {
+		t.Errorf("Started command was not killed on Close")
+	}
+}
@@ -0,0 +1,176 @@
+package proctree
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// prSetChildSubreaper is the prctl(2) option that marks the calling process as a child subreaper.
+const prSetChildSubreaper = 36
+
+func setChildSubreaper() error {
+	_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 1, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// startReaper marks the calling process as a child subreaper and starts a goroutine that reaps
+// terminated children whenever SIGCHLD is received. The goroutine exits when the ProcTree is closed.
+func (pt *ProcTree) startReaper() error {
+	err := setChildSubreaper()
+	if err != nil {
+		return fmt.Errorf("Unable to enable child subreaper mode: %s", err)
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGCHLD)
+
+	pt.wg.Add(1)
+	go func() {
+		defer pt.wg.Done()
+		defer signal.Stop(sigCh)
+		// Children may have terminated before the signal handler was installed
+		pt.reapChildren()
+		for {
+			select {
+			case <-pt.done:
+				return
+			case <-sigCh:
+				pt.reapChildren()
+			}
+		}
+	}()
+
+	return nil
+}
+
+// reapChildren reaps all terminated children of the calling process, and records their exit
+// statuses on the corresponding Process objects, if they are known to the ProcTree. Children started
+// with StartCommand are left for their exec.Cmd to wait on. Terminated children are found with wait4(-1), or,
+// while started commands are outstanding, by peeking at the next terminated child without reaping it, so
+// reaping takes time proportional to the number of terminated children rather than the number of processes.
+func (pt *ProcTree) reapChildren() {
+	pt.reapLock.Lock()
+	defer pt.reapLock.Unlock()
+
+	// Commands cannot be started while reapLock is held, so none become outstanding while reaping
+	pt.plock()
+	spawned := len(pt.spawned) > 0
+	pt.punlock()
+
+	for {
+		var ws syscall.WaitStatus
+		var pid int
+		var err error
+		if !spawned {
+			pid, err = syscall.Wait4(-1, &ws, syscall.WNOHANG, nil)
+		} else {
+			pid, _ = peekTerminatedChild(pIDTypeAll, 0)
+			if pid <= 0 {
+				return
+			}
+			if pt.isSpawnedPid(pid) {
+				// A terminated started command is returned first until its owner waits on it, hiding any
+				// other terminated children behind it, so they are reaped individually
+				pt.reapKnownChildren()
+				return
+			}
+			pid, err = syscall.Wait4(pid, &ws, syscall.WNOHANG, nil)
+		}
+		if err != nil || pid <= 0 {
+			return
+		}
+		pt.recordExitStatus(pid, newExitStatus(ws))
+	}
+}
+
+// reapKnownChildren reaps the terminated children of the calling process that are known to the ProcTree, other
+// than started commands, and records their exit statuses.
+func (pt *ProcTree) reapKnownChildren() {
+	self := os.Getpid()
+	pids := []int{}
+	pt.plock()
+	for pid, proc := range pt.pidMap {
+		if _, ok := pt.spawned[pid]; !ok && !proc.isTombstone && proc.gopsProcess.PPid() == self {
+			pids = append(pids, pid)
+		}
+	}
+	pt.punlock()
+	for _, pid := range pids {
+		var ws syscall.WaitStatus
+		wpid, err := syscall.Wait4(pid, &ws, syscall.WNOHANG, nil)
+		if err == nil && wpid > 0 {
+			pt.recordExitStatus(wpid, newExitStatus(ws))
+		}
+	}
+}
+
+// recordExitStatus attaches an exit status to the live Process with the given pid, if there is one.
+func (pt *ProcTree) recordExitStatus(pid int, es *ExitStatus) {
+	pt.plock()
+	defer pt.punlock()
+	proc, ok := pt.pidMap[pid]
+	if ok && !proc.isTombstone {
+		proc.exitStatus = es
+	}
+}
+
+// idtype_t values that select the children waited on by waitid(2).
+const (
+	pIDTypeAll = 0
+	pIDTypePid = 1
+)
+
+// siginfo codes for SIGCHLD, describing how a child terminated.
+const (
+	cldExited = 1
+	cldKilled = 2
+	cldDumped = 3
+)
+
+// peekExitStatus returns the exit status of a terminated child of the calling process without reaping it, so
+// that its owner can still wait on it. Returns nil if pid is not a terminated child of the calling process.
+func peekExitStatus(pid int) *ExitStatus {
+	infoPid, es := peekTerminatedChild(pIDTypePid, pid)
+	if infoPid != pid {
+		// The child has not terminated
+		return nil
+	}
+	return es
+}
+
+// peekTerminatedChild returns the pid and exit status of a terminated child of the calling process selected by
+// idType and id, without reaping it. Returns a pid of 0 if no selected child has terminated, or -1 if there are
+// no selected children.
+func peekTerminatedChild(idType int, id int) (int, *ExitStatus) {
+	// siginfo_t is 128 bytes. The SIGCHLD fields follow si_signo, si_errno and si_code, aligned to the size
+	// of a pointer.
+	var info [128]byte
+	_, _, errno := syscall.Syscall6(syscall.SYS_WAITID, uintptr(idType), uintptr(id), uintptr(unsafe.Pointer(&info[0])),
+		syscall.WEXITED|syscall.WNOHANG|syscall.WNOWAIT, 0, 0)
+	if errno != 0 {
+		return -1, nil
+	}
+	fields := 3 * 4
+	if unsafe.Sizeof(uintptr(0)) == 8 {
+		fields = 4 * 4
+	}
+	code := *(*int32)(unsafe.Pointer(&info[8]))
+	infoPid := int(*(*int32)(unsafe.Pointer(&info[fields])))
+	status := int(*(*int32)(unsafe.Pointer(&info[fields+8])))
+	if infoPid == 0 {
+		return 0, nil
+	}
+	switch code {
+	case cldExited:
+		return infoPid, &ExitStatus{Code: status, Signal: 0, CoreDumped: false}
+	case cldKilled, cldDumped:
+		return infoPid, &ExitStatus{Code: -1, Signal: syscall.Signal(status), CoreDumped: code == cldDumped}
+	}
+	return infoPid, nil
+}
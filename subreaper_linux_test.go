@@ -0,0 +1,164 @@
+package proctree
+
+import (
+	"bufio"
+	"context"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSubreaperReapsOrphans(t *testing.T) {
+	pt, err := New(WithSubreaper())
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	// The shell exits immediately, orphaning the background sleep, which is then adopted by this process.
+	cmd := exec.Command("sh", "-c", "sleep 0.5 & echo $!")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("StdoutPipe() returned error: %s", err)
+	}
+	err = cmd.Start()
+	if err != nil {
+		t.Fatalf("cmd.Start() returned error: %s", err)
+	}
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Unable to read orphan pid: %s", err)
+	}
+	orphanPid, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		t.Fatalf("Invalid orphan pid \"%s\": %s", line, err)
+	}
+
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("pt.Update() returned error: %s", err)
+	}
+	orphan := pt.PidProcess(orphanPid)
+	if orphan == nil {
+		t.Fatalf("Orphan pid %d not found in process tree", orphanPid)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for orphan.ExitStatus() == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("Orphan pid %d was not reaped", orphanPid)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if orphan.ExitStatus().Code != 0 {
+		t.Errorf("Orphan exit code %d is not expected", orphan.ExitStatus().Code)
+	}
+}
+
+func TestChildExitStatus(t *testing.T) {
+	pt, err := New()
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	// The shell is killed by a signal once a line is written to its stdin
+	cmd := exec.Command("sh", "-c", "read x; kill -TERM $$")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("cmd.StdinPipe() returned error: %s", err)
+	}
+	err = cmd.Start()
+	if err != nil {
+		t.Fatalf("cmd.Start() returned error: %s", err)
+	}
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("pt.Update() returned error: %s", err)
+	}
+	proc := pt.PidProcess(cmd.Process.Pid)
+	if proc == nil {
+		t.Fatalf("Child pid %d not found in process tree", cmd.Process.Pid)
+	}
+
+	// The terminated child remains a zombie until it is waited on
+	stdin.Write([]byte("\n"))
+	deadline := time.Now().Add(5 * time.Second)
+	for proc.ExitStatus() == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("Exit status of child pid %d was not recorded", cmd.Process.Pid)
+		}
+		time.Sleep(10 * time.Millisecond)
+		err = pt.Update(false)
+		if err != nil {
+			t.Fatalf("pt.Update() returned error: %s", err)
+		}
+	}
+	cmd.Wait()
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("pt.Update() returned error: %s", err)
+	}
+
+	es := proc.ExitStatus()
+	if es.Code != -1 || es.Signal != syscall.SIGTERM {
+		t.Errorf("Exit status %+v of child pid %d is not expected", es, cmd.Process.Pid)
+	}
+}
+
+func TestSubreaperLeavesStartedCommands(t *testing.T) {
+	pt, err := New(WithSubreaper())
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	// A started command that terminates first must not hide the orphan from the reaper
+	started := exec.Command("true")
+	_, err = pt.StartCommand(context.Background(), started, false)
+	if err != nil {
+		t.Fatalf("pt.StartCommand() returned error: %s", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	cmd := exec.Command("sh", "-c", "sleep 0.2 & echo $!")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("StdoutPipe() returned error: %s", err)
+	}
+	err = cmd.Start()
+	if err != nil {
+		t.Fatalf("cmd.Start() returned error: %s", err)
+	}
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Unable to read orphan pid: %s", err)
+	}
+	orphanPid, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		t.Fatalf("Invalid orphan pid \"%s\": %s", line, err)
+	}
+	err = pt.Update(false)
+	if err != nil {
+		t.Fatalf("pt.Update() returned error: %s", err)
+	}
+	orphan := pt.PidProcess(orphanPid)
+	if orphan == nil {
+		t.Fatalf("Orphan pid %d not found in process tree", orphanPid)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for orphan.ExitStatus() == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("Orphan pid %d was not reaped", orphanPid)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	err = started.Wait()
+	if err != nil {
+		t.Errorf("Wait() on a started command returned error: %s", err)
+	}
+}
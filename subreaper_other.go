@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package proctree
+
+import (
+	"fmt"
+)
+
+// startReaper is not supported on this platform.
+func (pt *ProcTree) startReaper() error {
+	return fmt.Errorf("Child subreaper mode is not supported on this platform")
+}
+
+// peekExitStatus returns the exit status of a terminated child of the calling process without reaping it.
+// Not supported on this platform.
+func peekExitStatus(pid int) *ExitStatus {
+	return nil
+}
@@ -0,0 +1,107 @@
+package proctree
+
+import (
+	"context"
+	"fmt"
+)
+
+// SubtreeView is a scoped view of the included subtree of a ProcTree rooted at a single Process, created with
+// ProcTree.Subtree. It shares the Processes and update source of its ProcTree, so it always reflects the most
+// recent update, but it exposes only the root and its included descendants; a component that is handed a
+// SubtreeView cannot see or look up Processes outside of it.
+type SubtreeView struct {
+	pt   *ProcTree
+	root *Process
+}
+
+// Subtree returns a view of the included subtree rooted at a Process. Returns an error if the Process is not
+// included in this ProcTree.
+func (pt *ProcTree) Subtree(root *Process) (*SubtreeView, error) {
+	if root == nil || root.pt != pt {
+		return nil, fmt.Errorf("Unable to create a subtree view of a Process that is not in this ProcTree")
+	}
+	pt.prlock()
+	defer pt.prunlock()
+	if !root.isIncluded {
+		return nil, fmt.Errorf("Unable to create a subtree view of excluded pid %d", root.lockedPid())
+	}
+	return &SubtreeView{pt: pt, root: root}, nil
+}
+
+// lockedContains returns true if a Process is in the view.
+func (v *SubtreeView) lockedContains(proc *Process) bool {
+	if proc == nil || proc.pt != v.pt || !proc.isIncluded {
+		return false
+	}
+	for _, ancestor := range v.pt.lockedIncludedLineage(proc) {
+		if ancestor == v.root {
+			return true
+		}
+	}
+	return false
+}
+
+// Root returns the root Process of the view. The root remains the same Process, even after it exits; if it
+// has been excluded or pruned, the view is empty.
+func (v *SubtreeView) Root() *Process {
+	return v.root
+}
+
+// Contains returns true if a Process is the root of the view or one of its included descendants.
+func (v *SubtreeView) Contains(proc *Process) bool {
+	v.pt.prlock()
+	defer v.pt.prunlock()
+	return v.lockedContains(proc)
+}
+
+// Processes returns a snapshot of the list of Processes in the view, sorted in ascending PID order. Includes
+// unpruned tombstones.
+func (v *SubtreeView) Processes() []*Process {
+	v.pt.prlock()
+	defer v.pt.prunlock()
+	result := []*Process{}
+	for _, proc := range v.pt.includedProcs {
+		if v.lockedContains(proc) {
+			result = append(result, proc)
+		}
+	}
+	return result
+}
+
+// PidProcess looks up a Process in the view by PID. If there is no process in the view with the provided PID,
+// nil is returned.
+func (v *SubtreeView) PidProcess(pid int) *Process {
+	v.pt.prlock()
+	defer v.pt.prunlock()
+	proc := v.pt.pidMap[pid]
+	if !v.lockedContains(proc) {
+		proc = nil
+	}
+	return proc
+}
+
+// Count returns the number of Processes in the view, as with Process.SubtreeCount.
+func (v *SubtreeView) Count() int {
+	return v.root.SubtreeCount()
+}
+
+// Walk walks the Processes in the view, invoking a handler for each, as with Process.WalkSubtree.
+func (v *SubtreeView) Walk(h ProcessHandler) error {
+	return v.root.WalkSubtree(h)
+}
+
+// WalkBFS walks the Processes in the view in breadth-first order, invoking a handler for each, as with
+// Process.WalkSubtreeBFS.
+func (v *SubtreeView) WalkBFS(h ProcessHandler) error {
+	return v.root.WalkSubtreeBFS(h)
+}
+
+// Update refreshes the ProcTree that the view belongs to, as with ProcTree.Update.
+func (v *SubtreeView) Update(pruneTombstones bool) error {
+	return v.pt.Update(pruneTombstones)
+}
+
+// UpdateContext refreshes the ProcTree that the view belongs to, as with ProcTree.UpdateContext.
+func (v *SubtreeView) UpdateContext(ctx context.Context, pruneTombstones bool) error {
+	return v.pt.UpdateContext(ctx, pruneTombstones)
+}
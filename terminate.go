@@ -0,0 +1,261 @@
+package proctree
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// terminatePollInterval is the interval at which a terminating subtree is rescanned to see which
+// processes remain.
+const terminatePollInterval = 50 * time.Millisecond
+
+// killSettleTime is the time allowed for processes to disappear after being sent SIGKILL.
+const killSettleTime = time.Second
+
+// TerminateOutcome describes how a Process ended when its subtree was terminated by TerminateSubtree.
+type TerminateOutcome int
+
+const (
+	// TerminateExited indicates that the Process exited before it was sent SIGKILL.
+	TerminateExited TerminateOutcome = iota
+
+	// TerminateKilled indicates that the Process exited after it was sent SIGKILL.
+	TerminateKilled
+
+	// TerminateSurvived indicates that the Process was still alive when TerminateSubtree returned, e.g., because
+	// it belongs to another user.
+	TerminateSurvived
+)
+
+// String returns a readable name for a TerminateOutcome.
+func (o TerminateOutcome) String() string {
+	switch o {
+	case TerminateExited:
+		return "TerminateExited"
+	case TerminateKilled:
+		return "TerminateKilled"
+	case TerminateSurvived:
+		return "TerminateSurvived"
+	default:
+		return "TerminateOutcome(unknown)"
+	}
+}
+
+// TerminateResult describes the termination of a single Process by TerminateSubtree.
+type TerminateResult struct {
+	// Process is the Process that was terminated.
+	Process *Process
+
+	// Pid is the pid of the Process.
+	Pid int
+
+	// Outcome is how the Process ended.
+	Outcome TerminateOutcome
+
+	// Err is a PidError describing the last error returned when the Process was signalled, e.g., because
+	// permission was denied (see ErrPermissionDenied), or nil if every signal was delivered.
+	Err error
+}
+
+// terminateResult is the TerminateResult of a Process whose subtree is being terminated, with the signals that
+// it has been sent.
+type terminateResult struct {
+	TerminateResult
+	signalled bool
+	killed    bool
+}
+
+// lockedLiveOwnedSubtrees returns all live Processes that are one of the provided roots or are descended from
+// one, either through current parent links or through original parent links (i.e., including orphans that have
+// been reparented after their parent exited). Each Process is returned once, even if the subtrees overlap.
+// Zombie processes are not considered live.
+func (pt *ProcTree) lockedLiveOwnedSubtrees(roots []*Process) []*Process {
+	result := []*Process{}
+	_, local := pt.source.(systemSource)
+	for _, proc := range pt.absProcs {
+		if proc.isTombstone || (local && pt.procfs.isZombie(proc.lockedPid())) {
+			continue
+		}
+		for _, root := range roots {
+			if proc.lockedIsInOwnedSubtree(root) {
+				result = append(result, proc)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// signalPid sends a signal to a pid on the local system. Platforms that cannot deliver the signal fall back to
+// killing the process.
+func signalPid(pid int, sig os.Signal) error {
+	osProc, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	err = osProc.Signal(sig)
+	if err != nil && sig != os.Kill {
+		err = osProc.Kill()
+	}
+	return err
+}
+
+// lockedSignaler returns the function that sends signals to the processes of the ProcTree, or nil if they
+// cannot be signalled because the ProcTree is read-only, or its source neither lists the processes of the local
+// system nor is a SignalingProcessSource.
+func (pt *ProcTree) lockedSignaler() func(pid int, sig os.Signal) error {
+	if pt.readOnly {
+		return nil
+	}
+	switch source := pt.source.(type) {
+	case systemSource:
+		return signalPid
+	case SignalingProcessSource:
+		return func(pid int, sig os.Signal) error {
+			ssig, ok := sig.(syscall.Signal)
+			if !ok {
+				return fmt.Errorf("Unable to send signal %s through the process source", sig)
+			}
+			return source.Signal(pid, ssig)
+		}
+	default:
+		return nil
+	}
+}
+
+// TerminateSubtree terminates the subtree rooted at a Process, as the subtrees of roots configured with
+// WithOwnedRoot are terminated when the ProcTree is closed: every live member of the subtree, including
+// descendants that have been reparented after their parent exited and members that appear while the subtree is
+// terminating, is sent sig, or SIGTERM if sig is nil. Members that remain after the grace period are sent
+// SIGKILL. TerminateSubtree returns when no live members remain, or shortly after SIGKILL has been sent if some
+// members have not yet disappeared, with a result for each member, sorted by pid. Returns an error if the
+// ProcTree is read-only, or if its processes are neither processes of the local system nor listed by a
+// SignalingProcessSource.
+func (pt *ProcTree) TerminateSubtree(root *Process, sig os.Signal, gracePeriod time.Duration) ([]TerminateResult, error) {
+	if root == nil {
+		return pt.TerminateSubtrees(nil, sig, gracePeriod)
+	}
+	return pt.TerminateSubtrees([]*Process{root}, sig, gracePeriod)
+}
+
+// TerminateSubtrees terminates the subtrees rooted at several Processes together, as with TerminateSubtree. The
+// subtrees may overlap: each member is signalled once, and has a single result, and all members share the
+// same grace period.
+func (pt *ProcTree) TerminateSubtrees(roots []*Process, sig os.Signal, gracePeriod time.Duration) ([]TerminateResult, error) {
+	pt.prlock()
+	readOnly := pt.readOnly
+	signal := pt.lockedSignaler()
+	pt.prunlock()
+	if readOnly {
+		return nil, fmt.Errorf("Unable to terminate processes of a read-only ProcTree")
+	}
+	if signal == nil {
+		return nil, fmt.Errorf("Unable to terminate processes of a ProcTree whose source cannot signal them")
+	}
+	if sig == nil {
+		sig = syscall.SIGTERM
+	}
+	results := pt.terminateSubtrees(roots, sig, gracePeriod)
+	procs := make([]*Process, 0, len(results))
+	for proc := range results {
+		procs = append(procs, proc)
+	}
+	pt.SortProcessesByPid(procs)
+	sorted := make([]TerminateResult, len(procs))
+	for i, proc := range procs {
+		sorted[i] = results[proc].TerminateResult
+	}
+	return sorted, nil
+}
+
+// terminateSubtrees terminates the owned subtrees rooted at several Processes. Every live member of the
+// subtrees is sent sig, including members that appear while the subtrees are terminating. Members that remain
+// after the grace period are sent SIGKILL. terminateSubtrees returns when no live members remain, or shortly
+// after SIGKILL has been sent if some members have not yet disappeared, with the result for each member.
+func (pt *ProcTree) terminateSubtrees(roots []*Process, sig os.Signal, gracePeriod time.Duration) map[*Process]*terminateResult {
+	results := make(map[*Process]*terminateResult)
+	if len(roots) == 0 {
+		return results
+	}
+	pt.prlock()
+	signal := pt.lockedSignaler()
+	pt.prunlock()
+	if signal == nil {
+		return results
+	}
+	graceDeadline := time.Now().Add(gracePeriod)
+	killDeadline := graceDeadline.Add(killSettleTime)
+	for {
+		snap, err := pt.scanForUpdate(context.Background())
+		pt.plock()
+		if err == nil {
+			err = pt.lockedApplySnapshot(context.Background(), snap, false)
+		}
+		var live []*Process
+		if err == nil {
+			live = pt.lockedLiveOwnedSubtrees(roots)
+		}
+		log := pt.cfg.logger
+		pt.punlockAndDispatch()
+
+		// Members that are no longer live have ended
+		isLive := make(map[*Process]bool, len(live))
+		for _, proc := range live {
+			isLive[proc] = true
+		}
+		for proc, result := range results {
+			if result.Outcome == TerminateSurvived && !isLive[proc] {
+				result.Outcome = TerminateExited
+				if result.killed {
+					result.Outcome = TerminateKilled
+				}
+			}
+		}
+
+		if err != nil || len(live) == 0 {
+			return results
+		}
+
+		now := time.Now()
+		if now.After(killDeadline) {
+			return results
+		}
+		for _, proc := range live {
+			result := results[proc]
+			if result == nil {
+				result = &terminateResult{}
+				result.Process, result.Pid, result.Outcome = proc, proc.Pid(), TerminateSurvived
+				results[proc] = result
+			}
+			if !now.Before(graceDeadline) {
+				// SIGKILL is resent until the member disappears, but only logged once
+				wasKilled := result.killed
+				result.killed = true
+				result.Err = newPidError("kill", result.Pid, signal(result.Pid, os.Kill))
+				if !wasKilled {
+					logOp(log, "Kill process", result.Err, "pid", result.Pid)
+				}
+			} else if !result.signalled {
+				result.signalled = true
+				result.Err = newPidError("signal", result.Pid, signal(result.Pid, sig))
+				logOp(log, "Signal process", result.Err, "pid", result.Pid, "signal", sig.String())
+			}
+		}
+		time.Sleep(terminatePollInterval)
+	}
+}
+
+// terminateOwnedRoots terminates the subtrees of all roots configured with WithOwnedRoot together, so that
+// overlapping subtrees are signalled once and share the grace period.
+func (pt *ProcTree) terminateOwnedRoots() {
+	pt.plock()
+	roots := make([]*Process, len(pt.ownedRootProcs))
+	copy(roots, pt.ownedRootProcs)
+	gracePeriod := pt.cfg.gracePeriod
+	pt.punlock()
+
+	pt.terminateSubtrees(roots, syscall.SIGTERM, gracePeriod)
+}
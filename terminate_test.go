@@ -0,0 +1,112 @@
+package proctree
+
+import (
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestOwnedRootGracePeriod(t *testing.T) {
+	// The shell ignores SIGTERM, so it must be escalated to SIGKILL after the grace period
+	cmd := exec.Command("sh", "-c", "trap '' TERM; sleep 10 & wait")
+	err := cmd.Start()
+	if err != nil {
+		t.Fatalf("cmd.Start() returned error: %s", err)
+	}
+
+	pt, err := New(WithOwnedRoot(cmd.Process.Pid), WithGracePeriod(200*time.Millisecond))
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+
+	start := time.Now()
+	err = pt.Close()
+	if err != nil {
+		t.Errorf("pt.Close() returned error: %s", err)
+	}
+	elapsed := time.Since(start)
+	if elapsed < 200*time.Millisecond {
+		t.Errorf("pt.Close() returned after %s, before the grace period expired", elapsed)
+	}
+
+	err = cmd.Wait()
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		t.Fatalf("cmd.Wait() returned unexpected result: %v", err)
+	}
+	ws := exitErr.Sys().(syscall.WaitStatus)
+	if !ws.Signaled() || ws.Signal() != syscall.SIGKILL {
+		t.Errorf("Owned root was not terminated by SIGKILL: %s", exitErr)
+	}
+}
+
+func TestTerminateSubtree(t *testing.T) {
+	// The background sleep exits on SIGTERM, but the root ignores it, so it must be escalated to SIGKILL
+	cmd := exec.Command("sh", "-c", "sleep 10 & trap '' TERM; exec sleep 10")
+	err := cmd.Start()
+	if err != nil {
+		t.Fatalf("cmd.Start() returned error: %s", err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+	time.Sleep(200 * time.Millisecond)
+
+	pt, err := New(WithRootPid(cmd.Process.Pid))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	results, err := pt.TerminateSubtree(pt.PidProcess(cmd.Process.Pid), nil, 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("pt.TerminateSubtree() returned error: %s", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("pt.TerminateSubtree() returned %d results, expected 2", len(results))
+	}
+	if results[0].Pid != cmd.Process.Pid || results[0].Outcome != TerminateKilled || results[0].Err != nil {
+		t.Errorf("pt.TerminateSubtree() returned %+v for the root", results[0])
+	}
+	if results[1].Outcome != TerminateExited || results[1].Err != nil {
+		t.Errorf("pt.TerminateSubtree() returned %+v for the child", results[1])
+	}
+}
+
+func TestTerminateSubtrees(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "sleep 10 & exec sleep 10")
+	err := cmd.Start()
+	if err != nil {
+		t.Fatalf("cmd.Start() returned error: %s", err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+	time.Sleep(200 * time.Millisecond)
+
+	pt, err := New(WithRootPid(cmd.Process.Pid))
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	// The child's subtree overlaps the root's, but each process has a single result
+	root := pt.PidProcess(cmd.Process.Pid)
+	children := root.Children()
+	if len(children) != 1 {
+		t.Fatalf("Root has %d children, expected 1", len(children))
+	}
+	results, err := pt.TerminateSubtrees([]*Process{children[0], root}, nil, time.Second)
+	if err != nil {
+		t.Fatalf("pt.TerminateSubtrees() returned error: %s", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("pt.TerminateSubtrees() returned %d results, expected 2", len(results))
+	}
+	for _, result := range results {
+		if result.Outcome != TerminateExited || result.Err != nil {
+			t.Errorf("pt.TerminateSubtrees() returned %+v", result)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package proctree
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// Usage is the resource usage of a set of live processes.
+type Usage struct {
+	// Processes is the number of processes whose usage is included.
+	Processes int
+
+	// CPUTime is the total user and system CPU time consumed by the processes.
+	CPUTime time.Duration
+
+	// RSS is the total resident set size of the processes, in bytes. Memory shared between processes is counted
+	// once for each process.
+	RSS uint64
+
+	// Threads is the total number of threads of the processes.
+	Threads int
+
+	// FDs is the total number of open file descriptors of the processes. Processes whose file descriptors cannot
+	// be read, normally because they belong to another user, do not contribute to FDs. FDs is 0 unless MetadataFDs
+	// is enabled (see WithMetadata).
+	FDs int
+}
+
+// add accumulates another Usage.
+func (u *Usage) add(other Usage) {
+	u.Processes += other.Processes
+	u.CPUTime += other.CPUTime
+	u.RSS += other.RSS
+	u.Threads += other.Threads
+	u.FDs += other.FDs
+}
+
+// livePidsUsage returns the aggregate usage of a list of pids. Processes that have exited since the pids were
+// collected are skipped. File descriptors are counted only if fds is true.
+func livePidsUsage(fs procfs, pids []int, fds bool) Usage {
+	total := Usage{}
+	for _, pid := range pids {
+		usage, err := fs.processUsage(pid)
+		if err != nil {
+			continue
+		}
+		if fds {
+			count, err := fs.processFDCount(pid)
+			if err == nil {
+				usage.FDs = count
+			}
+		}
+		total.add(usage)
+	}
+	return total
+}
+
+// Usage returns the resource usage of the Process alone, as a Usage of one process (see SubtreeUsage). Usage is
+// read from the system without holding the tree lock. Returns an error if the Process has exited, if the
+// ProcTree is not updated from the system, or if resource usage is not supported on this platform; only Linux,
+// macOS and Windows are supported.
+func (p *Process) Usage() (Usage, error) {
+	p.prlock()
+	pid := p.lockedPid()
+	isTombstone := p.isTombstone
+	readOnly := p.pt.readOnly
+	fdsEnabled := p.pt.cfg.MetadataEnabled(MetadataFDs)
+	p.prunlock()
+	if readOnly {
+		return Usage{}, fmt.Errorf("Unable to read resource usage of a ProcTree that is not updated from the system")
+	}
+	if isTombstone {
+		return Usage{}, &PidError{Op: "read resource usage of", Pid: pid, Err: ErrProcessGone}
+	}
+	usage, err := p.pt.procfs.processUsage(pid)
+	if err != nil {
+		return Usage{}, &PidError{Op: "read resource usage of", Pid: pid, Err: err}
+	}
+	if fdsEnabled {
+		fds, err := p.pt.procfs.processFDCount(pid)
+		if err == nil {
+			usage.FDs = fds
+		}
+	}
+	return usage, nil
+}
+
+// SubtreeUsage returns the aggregate resource usage of the live Processes in the included subtree rooted at
+// this Process, including the Process itself. Usage is read from the system without holding the tree lock, so
+// processes that exit during the call are skipped. Returns an error if the ProcTree is not updated from the
+// system, or if resource usage is not supported on this platform; only Linux, macOS and Windows are supported.
+func (p *Process) SubtreeUsage() (Usage, error) {
+	pids := []int{}
+	p.prlock()
+	readOnly := p.pt.readOnly
+	fds := p.pt.cfg.MetadataEnabled(MetadataFDs)
+	p.lockedWalkSubtree(func(proc *Process) error {
+		if !proc.isTombstone {
+			pids = append(pids, proc.lockedPid())
+		}
+		return nil
+	})
+	p.prunlock()
+	if readOnly {
+		return Usage{}, fmt.Errorf("Unable to read resource usage of a ProcTree that is not updated from the system")
+	}
+	_, err := defaultProcfs.processUsage(os.Getpid())
+	if err != nil {
+		return Usage{}, fmt.Errorf("Unable to read resource usage: %s", err)
+	}
+	return livePidsUsage(p.pt.procfs, pids, fds), nil
+}
+
+// UsageMetric selects the resource by which ProcTree.TopBy ranks Processes.
+type UsageMetric int
+
+const (
+	// MetricCPU ranks Processes by total CPU time.
+	MetricCPU UsageMetric = iota
+
+	// MetricRSS ranks Processes by resident set size.
+	MetricRSS
+
+	// MetricThreads ranks Processes by number of threads.
+	MetricThreads
+
+	// MetricFDs ranks Processes by number of open file descriptors.
+	MetricFDs
+)
+
+func (m UsageMetric) String() string {
+	switch m {
+	case MetricCPU:
+		return "MetricCPU"
+	case MetricRSS:
+		return "MetricRSS"
+	case MetricThreads:
+		return "MetricThreads"
+	case MetricFDs:
+		return "MetricFDs"
+	default:
+		return "UsageMetric(unknown)"
+	}
+}
+
+// value returns the value of the metric in a Usage.
+func (m UsageMetric) value(u *Usage) uint64 {
+	switch m {
+	case MetricCPU:
+		return uint64(u.CPUTime)
+	case MetricRSS:
+		return u.RSS
+	case MetricThreads:
+		return uint64(u.Threads)
+	default:
+		return uint64(u.FDs)
+	}
+}
+
+// ProcessUsage is the resource usage of a single Process, as returned by ProcTree.TopBy.
+type ProcessUsage struct {
+	Process *Process
+	Usage   Usage
+}
+
+// TopBy returns the n live included Processes with the highest usage of a resource, with their usage, in
+// descending order of usage; Processes with equal usage are ordered by pid. Fewer than n are returned if there
+// are fewer live included Processes. Usage is read from the system without holding the tree lock, so processes
+// that exit during the call are omitted. Returns an error if the ProcTree is not updated from the system, or if
+// resource usage is not supported on this platform; only Linux, macOS and Windows are supported.
+func (pt *ProcTree) TopBy(metric UsageMetric, n int) ([]ProcessUsage, error) {
+	if metric < MetricCPU || metric > MetricFDs {
+		return nil, fmt.Errorf("Invalid UsageMetric value %d", int(metric))
+	}
+	procs := []*Process{}
+	pids := []int{}
+	pt.prlock()
+	readOnly := pt.readOnly
+	var metadataErr error
+	if metric == MetricFDs {
+		metadataErr = pt.cfg.checkMetadata(MetadataFDs)
+	}
+	for _, proc := range pt.includedProcs {
+		if !proc.isTombstone {
+			procs = append(procs, proc)
+			pids = append(pids, proc.lockedPid())
+		}
+	}
+	pt.prunlock()
+	if readOnly {
+		return nil, fmt.Errorf("Unable to read resource usage of a ProcTree that is not updated from the system")
+	}
+	if metadataErr != nil {
+		return nil, fmt.Errorf("Unable to rank processes by file descriptors: %w", metadataErr)
+	}
+	_, err := defaultProcfs.processUsage(os.Getpid())
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read resource usage: %s", err)
+	}
+
+	results := make([]ProcessUsage, 0, len(procs))
+	for i, proc := range procs {
+		usage, err := pt.procfs.processUsage(pids[i])
+		if err != nil {
+			continue
+		}
+		if metric == MetricFDs {
+			usage.FDs, _ = pt.procfs.processFDCount(pids[i])
+		}
+		results = append(results, ProcessUsage{Process: proc, Usage: usage})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return metric.value(&results[i].Usage) > metric.value(&results[j].Usage)
+	})
+	if n < 0 {
+		n = 0
+	}
+	if len(results) > n {
+		results = results[:n]
+	}
+	return results, nil
+}
+
+// UsageSample is the resource usage of a single Process, as returned by UsageSampler.Sample, with the rate at
+// which it has consumed CPU time since the previous sample.
+type UsageSample struct {
+	ProcessUsage
+
+	// CPURate is the CPU time consumed by the Process since the previous sample, divided by the time elapsed,
+	// e.g., 1.5 for a process that kept one and a half CPUs busy. It is 0 in the first sample of a Process.
+	CPURate float64
+}
+
+// UsageSampler samples the resource usage of the live included Processes of a ProcTree repeatedly, so that the
+// rate at which each consumes CPU time can be measured, as by top. It is not safe for concurrent use.
+type UsageSampler struct {
+	pt       *ProcTree
+	cpuTimes map[*Process]time.Duration
+	last     time.Time
+}
+
+// NewUsageSampler returns a UsageSampler for the ProcTree. The tree is not updated by the sampler, so it should
+// be updated between samples, e.g., with WithAutoUpdate, for new processes to be sampled.
+func (pt *ProcTree) NewUsageSampler() *UsageSampler {
+	return &UsageSampler{pt: pt, cpuTimes: make(map[*Process]time.Duration)}
+}
+
+// Sample reads the resource usage of the live included Processes, as by TopBy(MetricCPU), and returns it in
+// descending order of total CPU time, with the rate at which each Process consumed CPU time since the previous
+// sample. Returns an error under the same conditions as TopBy.
+func (s *UsageSampler) Sample() ([]UsageSample, error) {
+	now := s.pt.clock.Now()
+	top, err := s.pt.TopBy(MetricCPU, math.MaxInt32)
+	if err != nil {
+		return nil, err
+	}
+	elapsed := now.Sub(s.last).Seconds()
+	cpuTimes := make(map[*Process]time.Duration, len(top))
+	samples := make([]UsageSample, len(top))
+	for i, pu := range top {
+		samples[i].ProcessUsage = pu
+		prev, ok := s.cpuTimes[pu.Process]
+		if ok && elapsed > 0 && pu.Usage.CPUTime >= prev {
+			samples[i].CPURate = (pu.Usage.CPUTime - prev).Seconds() / elapsed
+		}
+		cpuTimes[pu.Process] = pu.Usage.CPUTime
+	}
+	s.cpuTimes, s.last = cpuTimes, now
+	return samples, nil
+}
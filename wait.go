@@ -0,0 +1,85 @@
+package proctree
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// waitPollInterval is the interval at which the ProcTree is updated while waiting for a process to appear, if
+// it is not being updated by background monitoring.
+const waitPollInterval = 50 * time.Millisecond
+
+// WaitForPid blocks until a Process with the given pid appears in the included tree, and returns it. If such a
+// Process is already live, it is returned immediately. If background monitoring was configured (see
+// WithAutoUpdate and WithRealtimeMonitor), the Process is found by background updates; otherwise the ProcTree
+// is updated periodically while waiting. An error is returned if ctx is done or the ProcTree is closed first.
+func (pt *ProcTree) WaitForPid(ctx context.Context, pid int) (*Process, error) {
+	return pt.waitFor(ctx, func(proc *Process) bool {
+		return proc.lockedPid() == pid
+	})
+}
+
+// WaitForExecutable blocks until a Process whose executable name matches a glob pattern appears in the
+// included tree, either by starting or by exec'ing, and returns it. The pattern uses the syntax of path.Match.
+// If a matching Process is already live, the one with the lowest pid is returned immediately. Otherwise, the
+// tree is updated as described for WaitForPid.
+func (pt *ProcTree) WaitForExecutable(ctx context.Context, pattern string) (*Process, error) {
+	lockedMatch, err := pt.newEventMatcher(&subscribeConfig{executableGlobs: []string{pattern}})
+	if err != nil {
+		return nil, err
+	}
+	return pt.waitFor(ctx, func(proc *Process) bool {
+		return lockedMatch(&Event{Process: proc})
+	})
+}
+
+// waitFor blocks until a live, included Process that satisfies lockedMatch is found, either in the current
+// tree or in a subsequent ProcessStarted or ProcessExeced event. lockedMatch is called with the tree lock held.
+func (pt *ProcTree) waitFor(ctx context.Context, lockedMatch func(proc *Process) bool) (*Process, error) {
+	// Subscribe before examining the tree, so that a Process that appears in between is not missed
+	sub := pt.subscribe(newSubscribeConfig(), func(ev *Event) bool {
+		return (ev.Type == ProcessStarted || ev.Type == ProcessExeced) && lockedMatch(ev.Process)
+	})
+	defer sub.Close()
+
+	pt.plock()
+	for _, proc := range pt.includedProcs {
+		if !proc.isTombstone && lockedMatch(proc) {
+			pt.punlock()
+			return proc, nil
+		}
+	}
+	monitored := pt.monitored
+	pt.punlock()
+
+	if !monitored {
+		// Updates are made from a separate goroutine, since they block while this subscription's buffer is full
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			ticker := time.NewTicker(waitPollInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-sub.done:
+					return
+				case <-ticker.C:
+					pt.Update(false)
+				}
+			}
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case ev, ok := <-sub.Events():
+		if !ok {
+			return nil, fmt.Errorf("ProcTree was closed while waiting for process")
+		}
+		return ev.Process, nil
+	}
+}
@@ -0,0 +1,51 @@
+package proctree
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestWaitForExecutable(t *testing.T) {
+	pt, err := New()
+	if err != nil {
+		t.Fatalf("proctree.New() returned error: %s", err)
+	}
+	defer pt.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The shell execs sleep after a delay, so the wait must observe the exec
+	cmd := exec.Command("sh", "-c", "sleep 0.2; exec sleep 10")
+	err = cmd.Start()
+	if err != nil {
+		t.Fatalf("cmd.Start() returned error: %s", err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	proc, err := pt.WaitForPid(ctx, cmd.Process.Pid)
+	if err != nil {
+		t.Fatalf("pt.WaitForPid() returned error: %s", err)
+	}
+	if proc.Pid() != cmd.Process.Pid {
+		t.Errorf("pt.WaitForPid() returned pid %d, expected %d", proc.Pid(), cmd.Process.Pid)
+	}
+
+	proc, err = pt.WaitForExecutable(ctx, "sle?p")
+	if err != nil {
+		t.Fatalf("pt.WaitForExecutable() returned error: %s", err)
+	}
+	if proc.Executable() != "sleep" {
+		t.Errorf("pt.WaitForExecutable() returned executable %s", proc.Executable())
+	}
+
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer shortCancel()
+	_, err = pt.WaitForExecutable(shortCtx, "no-such-executable-*")
+	if err != context.DeadlineExceeded {
+		t.Errorf("pt.WaitForExecutable() returned %v, expected deadline exceeded", err)
+	}
+}
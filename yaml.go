@@ -0,0 +1,79 @@
+package proctree
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlToJSON converts a YAML configuration document to JSON, so that it is decoded by the same code as a JSON
+// configuration file. The document is decoded with a full YAML decoder; numbers are converted to their values
+// (e.g., 0x1F becomes 31), and values that JSON cannot represent, such as .inf, are rejected.
+func yamlToJSON(data []byte) ([]byte, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	var value interface{}
+	err := dec.Decode(&value)
+	if err == io.EOF {
+		return []byte("{}"), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var extra interface{}
+	if dec.Decode(&extra) != io.EOF {
+		return nil, fmt.Errorf("Multiple YAML documents are not supported")
+	}
+	if value == nil {
+		return []byte("{}"), nil
+	}
+	value, err = yamlToJSONValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// yamlToJSONValue converts a value decoded from YAML to a value that can be encoded as JSON.
+func yamlToJSONValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, elem := range v {
+			converted, err := yamlToJSONValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = converted
+		}
+		return v, nil
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			converted, err := yamlToJSONValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			result[fmt.Sprint(key)] = converted
+		}
+		return result, nil
+	case []interface{}:
+		for i, elem := range v {
+			converted, err := yamlToJSONValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = converted
+		}
+		return v, nil
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return nil, fmt.Errorf("Number %v cannot be represented in JSON", v)
+		}
+		return v, nil
+	default:
+		return v, nil
+	}
+}